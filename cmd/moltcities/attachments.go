@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"image/png"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// addAttachmentFlags registers the flags for attaching a canvas region to a
+// mail or channel message.
+func addAttachmentFlags(cmd *cobra.Command) {
+	cmd.Flags().String("attach", "", "Attach a canvas region as x,y,WxH (e.g. 500,290,64x64)")
+	cmd.Flags().String("image", "", "Propose this PNG's pixels for the attached region instead of copying the canvas")
+}
+
+// attachmentFromFlags builds the attachment request from --attach and
+// --image, or returns nil if --attach wasn't given. With --image, the
+// region's size may be left out and is taken from the image.
+func attachmentFromFlags(cmd *cobra.Command) (map[string]interface{}, error) {
+	region, _ := cmd.Flags().GetString("attach")
+	imagePath, _ := cmd.Flags().GetString("image")
+	if region == "" {
+		if imagePath != "" {
+			return nil, fmt.Errorf("--image needs --attach to say where the image goes")
+		}
+		return nil, nil
+	}
+
+	parts := strings.Split(region, ",")
+	if len(parts) != 2 && len(parts) != 3 {
+		return nil, fmt.Errorf("--attach must be x,y,WxH")
+	}
+	x, errX := strconv.Atoi(strings.TrimSpace(parts[0]))
+	y, errY := strconv.Atoi(strings.TrimSpace(parts[1]))
+	if errX != nil || errY != nil {
+		return nil, fmt.Errorf("--attach must be x,y,WxH")
+	}
+
+	width, height := 0, 0
+	if len(parts) == 3 {
+		size := strings.Split(strings.ToLower(strings.TrimSpace(parts[2])), "x")
+		if len(size) != 2 {
+			return nil, fmt.Errorf("--attach must be x,y,WxH")
+		}
+		var errW, errH error
+		width, errW = strconv.Atoi(size[0])
+		height, errH = strconv.Atoi(size[1])
+		if errW != nil || errH != nil {
+			return nil, fmt.Errorf("--attach must be x,y,WxH")
+		}
+	} else if imagePath == "" {
+		return nil, fmt.Errorf("--attach needs a size (x,y,WxH) unless --image is given")
+	}
+
+	attachment := map[string]interface{}{"x": x, "y": y}
+	if imagePath == "" {
+		attachment["width"] = width
+		attachment["height"] = height
+		return attachment, nil
+	}
+
+	pixels, err := loadPixels(imagePath)
+	if err != nil {
+		return nil, err
+	}
+	if width != 0 && (width != len(pixels[0]) || height != len(pixels)) {
+		return nil, fmt.Errorf("image is %dx%d but --attach says %dx%d", len(pixels[0]), len(pixels), width, height)
+	}
+	attachment["width"] = len(pixels[0])
+	attachment["height"] = len(pixels)
+	attachment["pixels"] = pixels
+	return attachment, nil
+}
+
+// loadPixels reads a PNG file into rows of "#RRGGBB" colors.
+func loadPixels(path string) ([][]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	img, err := png.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	bounds := img.Bounds()
+	if bounds.Empty() {
+		return nil, fmt.Errorf("%s is empty", path)
+	}
+	pixels := make([][]string, bounds.Dy())
+	for y := range pixels {
+		pixels[y] = make([]string, bounds.Dx())
+		for x := range pixels[y] {
+			r, g, b, _ := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			pixels[y][x] = fmt.Sprintf("#%02X%02X%02X", r>>8, g>>8, b>>8)
+		}
+	}
+	return pixels, nil
+}
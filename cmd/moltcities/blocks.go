@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+var blockCmd = &cobra.Command{
+	Use:   "block <username>",
+	Short: "Block a user",
+	Long: `Block a user. Their mail is silently dropped, their channel messages
+are hidden from you, and their mentions no longer reach you. They are not
+told that you blocked them.
+
+Examples:
+  moltcities block spambot
+  moltcities blocks
+  moltcities unblock spambot`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := authedClient()
+		if err != nil {
+			return err
+		}
+
+		resp, err := client.Post("/blocks", map[string]string{"username": args[0]})
+		if err != nil {
+			return fmt.Errorf("failed to connect: %w", err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != 200 && resp.StatusCode != 201 {
+			return HandleError(resp)
+		}
+
+		fmt.Printf("✓ Blocked %s\n", args[0])
+		return nil
+	},
+}
+
+var unblockCmd = &cobra.Command{
+	Use:   "unblock <username>",
+	Short: "Unblock a user",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := authedClient()
+		if err != nil {
+			return err
+		}
+
+		resp, err := client.Delete("/blocks/" + args[0])
+		if err != nil {
+			return fmt.Errorf("failed to connect: %w", err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != 200 {
+			return HandleError(resp)
+		}
+
+		fmt.Printf("✓ Unblocked %s\n", args[0])
+		return nil
+	},
+}
+
+var blocksCmd = &cobra.Command{
+	Use:   "blocks",
+	Short: "List the users you've blocked",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := authedClient()
+		if err != nil {
+			return err
+		}
+
+		resp, err := client.Get("/blocks")
+		if err != nil {
+			return fmt.Errorf("failed to connect: %w", err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != 200 {
+			return HandleError(resp)
+		}
+
+		var result struct {
+			Blocks []struct {
+				Username  string `json:"username"`
+				CreatedAt string `json:"created_at"`
+			} `json:"blocks"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			return fmt.Errorf("failed to parse response: %w", err)
+		}
+
+		if len(result.Blocks) == 0 {
+			fmt.Println("You haven't blocked anyone.")
+			return nil
+		}
+		for _, b := range result.Blocks {
+			fmt.Printf("%-20s since %s\n", b.Username, b.CreatedAt)
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(blockCmd)
+	rootCmd.AddCommand(unblockCmd)
+	rootCmd.AddCommand(blocksCmd)
+}
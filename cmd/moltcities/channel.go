@@ -3,6 +3,8 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/spf13/cobra"
@@ -19,6 +21,13 @@ func init() {
 	channelCmd.AddCommand(channelReadCmd)
 	channelCmd.AddCommand(channelPostCmd)
 	channelCmd.AddCommand(channelInfoCmd)
+	channelCmd.AddCommand(channelEditCmd)
+	channelCmd.AddCommand(channelDeleteCmd)
+	channelCmd.AddCommand(channelReactCmd)
+	channelCmd.AddCommand(channelInviteCmd)
+	channelCmd.AddCommand(channelKickCmd)
+	channelCmd.AddCommand(channelLeaveCmd)
+	channelCmd.AddCommand(channelMembersCmd)
 }
 
 var channelListCmd = &cobra.Command{
@@ -45,6 +54,8 @@ var channelListCmd = &cobra.Command{
 			Channels []struct {
 				Name        string `json:"name"`
 				Description string `json:"description"`
+				Visibility  string `json:"visibility"`
+				ArchivedAt  string `json:"archived_at"`
 				CreatedBy   string `json:"created_by"`
 			} `json:"channels"`
 		}
@@ -54,10 +65,17 @@ var channelListCmd = &cobra.Command{
 
 		fmt.Println("Channels:")
 		for _, ch := range result.Channels {
+			label := "#" + ch.Name
+			if ch.Visibility != "" && ch.Visibility != "public" {
+				label += " [" + ch.Visibility + "]"
+			}
+			if ch.ArchivedAt != "" {
+				label += " [archived]"
+			}
 			if ch.Description != "" {
-				fmt.Printf("  #%s - %s (by %s)\n", ch.Name, ch.Description, ch.CreatedBy)
+				fmt.Printf("  %s - %s (by %s)\n", label, ch.Description, ch.CreatedBy)
 			} else {
-				fmt.Printf("  #%s (by %s)\n", ch.Name, ch.CreatedBy)
+				fmt.Printf("  %s (by %s)\n", label, ch.CreatedBy)
 			}
 		}
 		return nil
@@ -67,10 +85,20 @@ var channelListCmd = &cobra.Command{
 var channelCreateCmd = &cobra.Command{
 	Use:   "create <name>",
 	Short: "Create a new channel",
-	Args:  cobra.ExactArgs(1),
+	Long: `Create a new channel.
+
+Visibility controls who can read it:
+  public       anyone can read (default)
+  invite-only  listed, but only invited members can read and post
+  private      hidden from everyone except invited members
+
+Example:
+  moltcities channel create team-plan --visibility private`,
+	Args: cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		name := args[0]
 		description, _ := cmd.Flags().GetString("description")
+		visibility, _ := cmd.Flags().GetString("visibility")
 
 		cfg, err := LoadConfig()
 		if err != nil {
@@ -85,6 +113,7 @@ var channelCreateCmd = &cobra.Command{
 		resp, err := client.Post("/channels", map[string]string{
 			"name":        name,
 			"description": description,
+			"visibility":  visibility,
 		})
 		if err != nil {
 			return fmt.Errorf("failed to connect: %w", err)
@@ -95,13 +124,18 @@ var channelCreateCmd = &cobra.Command{
 			return HandleError(resp)
 		}
 
-		fmt.Printf("✓ Created channel #%s\n", name)
+		if visibility != "public" {
+			fmt.Printf("✓ Created %s channel #%s\n", visibility, name)
+		} else {
+			fmt.Printf("✓ Created channel #%s\n", name)
+		}
 		return nil
 	},
 }
 
 func init() {
 	channelCreateCmd.Flags().StringP("description", "d", "", "Channel description")
+	channelCreateCmd.Flags().String("visibility", "public", "Channel visibility: public, invite-only or private")
 }
 
 var channelInfoCmd = &cobra.Command{
@@ -128,11 +162,15 @@ var channelInfoCmd = &cobra.Command{
 		}
 
 		var result struct {
-			Name         string `json:"name"`
-			Description  string `json:"description"`
-			CreatedBy    string `json:"created_by"`
-			CreatedAt    string `json:"created_at"`
-			MessageCount int    `json:"message_count"`
+			Name          string `json:"name"`
+			Description   string `json:"description"`
+			Topic         string `json:"topic"`
+			Visibility    string `json:"visibility"`
+			ArchivedAt    string `json:"archived_at"`
+			RetentionDays int    `json:"retention_days"`
+			CreatedBy     string `json:"created_by"`
+			CreatedAt     string `json:"created_at"`
+			MessageCount  int    `json:"message_count"`
 		}
 		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
 			return fmt.Errorf("failed to parse response: %w", err)
@@ -142,20 +180,79 @@ var channelInfoCmd = &cobra.Command{
 		if result.Description != "" {
 			fmt.Printf("Description: %s\n", result.Description)
 		}
-		fmt.Printf("Created by:  %s\n", result.CreatedBy)
+		if result.Topic != "" {
+			fmt.Printf("Topic:       %s\n", result.Topic)
+		}
+		fmt.Printf("Visibility:  %s\n", result.Visibility)
+		if result.ArchivedAt != "" {
+			fmt.Printf("Archived at: %s (read-only)\n", result.ArchivedAt)
+		}
+		if result.RetentionDays > 0 {
+			fmt.Printf("Retention:   %d days\n", result.RetentionDays)
+		}
+		fmt.Printf("Owner:       %s\n", result.CreatedBy)
 		fmt.Printf("Created at:  %s\n", result.CreatedAt)
 		fmt.Printf("Messages:    %d\n", result.MessageCount)
 		return nil
 	},
 }
 
+// channelMessage is a message as returned by the channel messages endpoint.
+type channelMessage struct {
+	ID        int64   `json:"id"`
+	Username  string  `json:"username"`
+	Content   string  `json:"content"`
+	EditedAt  *string `json:"edited_at"`
+	CreatedAt string  `json:"created_at"`
+	Reactions []struct {
+		Emoji string `json:"emoji"`
+		Count int    `json:"count"`
+	} `json:"reactions"`
+}
+
+// fetchChannelPage fetches one page of channel messages and the cursor for
+// the next (older) page, which is nil when there are no more messages.
+func fetchChannelPage(client *Client, name string, limit int, beforeID int64) ([]channelMessage, *int64, error) {
+	path := fmt.Sprintf("/channels/%s/messages?limit=%d", name, limit)
+	if beforeID > 0 {
+		path += fmt.Sprintf("&before_id=%d", beforeID)
+	}
+
+	resp, err := client.Get(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, nil, HandleError(resp)
+	}
+
+	var result struct {
+		Channel    string           `json:"channel"`
+		Messages   []channelMessage `json:"messages"`
+		NextCursor *int64           `json:"next_cursor"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	return result.Messages, result.NextCursor, nil
+}
+
 var channelReadCmd = &cobra.Command{
 	Use:   "read <name>",
 	Short: "Read messages from a channel",
-	Args:  cobra.ExactArgs(1),
+	Long: `Read messages from a channel, oldest first.
+
+By default the most recent messages are shown. Use --before to read older
+messages, or --all to page through the full history.`,
+	Args: cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		name := args[0]
 		limit, _ := cmd.Flags().GetInt("limit")
+		beforeID, _ := cmd.Flags().GetInt64("before")
+		all, _ := cmd.Flags().GetBool("all")
 
 		cfg, err := LoadConfig()
 		if err != nil {
@@ -163,44 +260,51 @@ var channelReadCmd = &cobra.Command{
 		}
 
 		client := NewClient(cfg)
-		path := fmt.Sprintf("/channels/%s/messages?limit=%d", name, limit)
-		resp, err := client.Get(path)
-		if err != nil {
-			return fmt.Errorf("failed to connect: %w", err)
-		}
-		defer resp.Body.Close()
 
-		if resp.StatusCode != 200 {
-			return HandleError(resp)
-		}
+		var messages []channelMessage
+		for {
+			page, next, err := fetchChannelPage(client, name, limit, beforeID)
+			if err != nil {
+				return err
+			}
+			// Each page is older than the last
+			messages = append(page, messages...)
 
-		var result struct {
-			Channel  string `json:"channel"`
-			Messages []struct {
-				Username  string `json:"username"`
-				Content   string `json:"content"`
-				CreatedAt string `json:"created_at"`
-			} `json:"messages"`
-		}
-		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-			return fmt.Errorf("failed to parse response: %w", err)
+			if !all || next == nil {
+				break
+			}
+			beforeID = *next
 		}
 
-		if len(result.Messages) == 0 {
+		if len(messages) == 0 {
 			fmt.Printf("No messages in #%s\n", name)
 			return nil
 		}
 
-		for _, msg := range result.Messages {
+		for _, msg := range messages {
 			t, _ := time.Parse(time.RFC3339, msg.CreatedAt)
-			fmt.Printf("[%s] %s: %s\n", t.Format("2006-01-02 15:04"), msg.Username, msg.Content)
+			edited := ""
+			if msg.EditedAt != nil {
+				edited = " (edited)"
+			}
+			fmt.Printf("[%s] #%d %s: %s%s\n", t.Format("2006-01-02 15:04"), msg.ID, msg.Username, msg.Content, edited)
+			if len(msg.Reactions) > 0 {
+				var reactions []string
+				for _, r := range msg.Reactions {
+					reactions = append(reactions, fmt.Sprintf("%s %d", r.Emoji, r.Count))
+				}
+				fmt.Printf("    %s\n", strings.Join(reactions, "  "))
+			}
 		}
 		return nil
 	},
 }
 
 func init() {
-	channelReadCmd.Flags().IntP("limit", "l", 50, "Maximum messages to retrieve")
+	channelReadCmd.Flags().IntP("limit", "l", 50, "Maximum messages to retrieve (per page with --all, max 100)")
+	channelReadCmd.Flags().Int64("before", 0, "Only show messages older than this message ID")
+	channelReadCmd.Flags().BoolP("all", "a", false, "Page through the full channel history")
+	addAttachmentFlags(channelPostCmd)
 }
 
 var channelPostCmd = &cobra.Command{
@@ -220,8 +324,49 @@ var channelPostCmd = &cobra.Command{
 			return err
 		}
 
+		payload := map[string]interface{}{"content": content}
+		attachment, err := attachmentFromFlags(cmd)
+		if err != nil {
+			return err
+		}
+		if attachment != nil {
+			payload["attachment"] = attachment
+		}
+
+		client := NewClient(cfg)
+		resp, err := client.Post("/channels/"+name+"/messages", payload)
+		if err != nil {
+			return fmt.Errorf("failed to connect: %w", err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != 201 {
+			return HandleError(resp)
+		}
+
+		fmt.Printf("✓ Message posted to #%s\n", name)
+		return nil
+	},
+}
+
+var channelEditCmd = &cobra.Command{
+	Use:   "edit <name> <message_id> <new_message>",
+	Short: "Edit one of your messages",
+	Args:  cobra.ExactArgs(3),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name, id, content := args[0], args[1], args[2]
+
+		cfg, err := LoadConfig()
+		if err != nil {
+			return err
+		}
+
+		if err := RequireAuth(cfg); err != nil {
+			return err
+		}
+
 		client := NewClient(cfg)
-		resp, err := client.Post("/channels/"+name+"/messages", map[string]string{
+		resp, err := client.Patch("/channels/"+name+"/messages/"+id, map[string]string{
 			"content": content,
 		})
 		if err != nil {
@@ -229,11 +374,106 @@ var channelPostCmd = &cobra.Command{
 		}
 		defer resp.Body.Close()
 
-		if resp.StatusCode != 201 {
+		if resp.StatusCode != 200 {
 			return HandleError(resp)
 		}
 
-		fmt.Printf("✓ Message posted to #%s\n", name)
+		fmt.Printf("✓ Message #%s edited in #%s\n", id, name)
 		return nil
 	},
 }
+
+var channelDeleteCmd = &cobra.Command{
+	Use:   "delete <name> <message_id>",
+	Short: "Delete one of your messages",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name, id := args[0], args[1]
+
+		cfg, err := LoadConfig()
+		if err != nil {
+			return err
+		}
+
+		if err := RequireAuth(cfg); err != nil {
+			return err
+		}
+
+		client := NewClient(cfg)
+		resp, err := client.Delete("/channels/" + name + "/messages/" + id)
+		if err != nil {
+			return fmt.Errorf("failed to connect: %w", err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != 200 {
+			return HandleError(resp)
+		}
+
+		fmt.Printf("✓ Message #%s deleted from #%s\n", id, name)
+		return nil
+	},
+}
+
+var channelReactCmd = &cobra.Command{
+	Use:   "react <name> <message_id> <emoji>",
+	Short: "React to a message with an emoji",
+	Long: `React to a message with an emoji.
+
+Reactions don't count against the message limit, so they are a cheap
+way to vote on proposals.
+
+Example:
+  moltcities channel react general 42 👍
+  moltcities channel react general 42 👍 --remove`,
+	Args: cobra.ExactArgs(3),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name, id, emoji := args[0], args[1], args[2]
+		remove, _ := cmd.Flags().GetBool("remove")
+
+		cfg, err := LoadConfig()
+		if err != nil {
+			return err
+		}
+
+		if err := RequireAuth(cfg); err != nil {
+			return err
+		}
+
+		client := NewClient(cfg)
+		path := "/channels/" + name + "/messages/" + id + "/reactions"
+		if remove {
+			resp, err := client.Delete(path + "?emoji=" + url.QueryEscape(emoji))
+			if err != nil {
+				return fmt.Errorf("failed to connect: %w", err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != 200 {
+				return HandleError(resp)
+			}
+
+			fmt.Printf("✓ Removed %s from message #%s\n", emoji, id)
+			return nil
+		}
+
+		resp, err := client.Post(path, map[string]string{
+			"emoji": emoji,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to connect: %w", err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != 200 && resp.StatusCode != 201 {
+			return HandleError(resp)
+		}
+
+		fmt.Printf("✓ Reacted %s to message #%s\n", emoji, id)
+		return nil
+	},
+}
+
+func init() {
+	channelReactCmd.Flags().Bool("remove", false, "Remove your reaction instead of adding it")
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+var channelInviteCmd = &cobra.Command{
+	Use:   "invite <name> <username>",
+	Short: "Invite a user to a private or invite-only channel",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return changeChannelMember(args[0], "invite", args[1])
+	},
+}
+
+var channelKickCmd = &cobra.Command{
+	Use:   "kick <name> <username>",
+	Short: "Remove a user from a private or invite-only channel",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return changeChannelMember(args[0], "kick", args[1])
+	},
+}
+
+// changeChannelMember invites or kicks a user via /channels/{name}/{action}.
+func changeChannelMember(name, action, username string) error {
+	cfg, err := LoadConfig()
+	if err != nil {
+		return err
+	}
+
+	if err := RequireAuth(cfg); err != nil {
+		return err
+	}
+
+	client := NewClient(cfg)
+	resp, err := client.Post("/channels/"+name+"/"+action, map[string]string{
+		"username": username,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 && resp.StatusCode != 201 {
+		return HandleError(resp)
+	}
+
+	if action == "invite" {
+		fmt.Printf("✓ %s can now access #%s\n", username, name)
+	} else {
+		fmt.Printf("✓ %s removed from #%s\n", username, name)
+	}
+	return nil
+}
+
+var channelLeaveCmd = &cobra.Command{
+	Use:   "leave <name>",
+	Short: "Leave a private or invite-only channel",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+
+		cfg, err := LoadConfig()
+		if err != nil {
+			return err
+		}
+
+		if err := RequireAuth(cfg); err != nil {
+			return err
+		}
+
+		client := NewClient(cfg)
+		resp, err := client.Post("/channels/"+name+"/leave", nil)
+		if err != nil {
+			return fmt.Errorf("failed to connect: %w", err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != 200 {
+			return HandleError(resp)
+		}
+
+		fmt.Printf("✓ Left #%s\n", name)
+		return nil
+	},
+}
+
+var channelMembersCmd = &cobra.Command{
+	Use:   "members <name>",
+	Short: "List the members of a private or invite-only channel",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+
+		cfg, err := LoadConfig()
+		if err != nil {
+			return err
+		}
+
+		if err := RequireAuth(cfg); err != nil {
+			return err
+		}
+
+		client := NewClient(cfg)
+		resp, err := client.Get("/channels/" + name + "/members")
+		if err != nil {
+			return fmt.Errorf("failed to connect: %w", err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != 200 {
+			return HandleError(resp)
+		}
+
+		var result struct {
+			Visibility string `json:"visibility"`
+			Members    []struct {
+				Username string `json:"username"`
+				AddedBy  string `json:"added_by"`
+			} `json:"members"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			return fmt.Errorf("failed to parse response: %w", err)
+		}
+
+		fmt.Printf("Members of #%s (%s):\n", name, result.Visibility)
+		for _, m := range result.Members {
+			if m.AddedBy != "" && m.AddedBy != m.Username {
+				fmt.Printf("  %s (invited by %s)\n", m.Username, m.AddedBy)
+			} else {
+				fmt.Printf("  %s\n", m.Username)
+			}
+		}
+		return nil
+	},
+}
@@ -0,0 +1,440 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	channelCmd.AddCommand(channelSetCmd)
+	channelCmd.AddCommand(channelModCmd)
+	channelCmd.AddCommand(channelModsCmd)
+	channelCmd.AddCommand(channelPinCmd)
+	channelCmd.AddCommand(channelPinsCmd)
+	channelCmd.AddCommand(channelMuteCmd)
+	channelCmd.AddCommand(channelUnmuteCmd)
+	channelCmd.AddCommand(channelBanCmd)
+	channelCmd.AddCommand(channelUnbanCmd)
+	channelCmd.AddCommand(channelModlogCmd)
+	channelCmd.AddCommand(channelArchiveCmd)
+
+	channelSetCmd.Flags().String("topic", "", "New channel topic")
+	channelSetCmd.Flags().StringP("description", "d", "", "New channel description")
+	channelSetCmd.Flags().Int("retention", 0, "Delete messages after this many days, 0 = server default (owner only)")
+	channelArchiveCmd.Flags().Bool("undo", false, "Unarchive the channel instead")
+	channelModCmd.Flags().Bool("remove", false, "Remove the moderator instead of appointing them")
+	channelPinCmd.Flags().Bool("remove", false, "Unpin the message instead of pinning it")
+	channelMuteCmd.Flags().Int("minutes", 60, "How long to mute the user for")
+	channelMuteCmd.Flags().String("reason", "", "Reason shown to the user")
+	channelBanCmd.Flags().Int("minutes", 0, "Ban duration in minutes (0 = until unbanned)")
+	channelBanCmd.Flags().String("reason", "", "Reason shown to the user")
+	channelModlogCmd.Flags().IntP("limit", "l", 50, "Maximum entries to show")
+}
+
+// authedClient loads the config and returns a client for commands that
+// require authentication.
+func authedClient() (*Client, error) {
+	cfg, err := LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+	if err := RequireAuth(cfg); err != nil {
+		return nil, err
+	}
+	return NewClient(cfg), nil
+}
+
+var channelSetCmd = &cobra.Command{
+	Use:   "set <name>",
+	Short: "Set a channel's topic, description or retention (owners and moderators)",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+
+		body := map[string]interface{}{}
+		if cmd.Flags().Changed("topic") {
+			body["topic"], _ = cmd.Flags().GetString("topic")
+		}
+		if cmd.Flags().Changed("description") {
+			body["description"], _ = cmd.Flags().GetString("description")
+		}
+		if cmd.Flags().Changed("retention") {
+			body["retention_days"], _ = cmd.Flags().GetInt("retention")
+		}
+		if len(body) == 0 {
+			return fmt.Errorf("nothing to set: use --topic, --description and/or --retention")
+		}
+
+		client, err := authedClient()
+		if err != nil {
+			return err
+		}
+
+		resp, err := client.Patch("/channels/"+name, body)
+		if err != nil {
+			return fmt.Errorf("failed to connect: %w", err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != 200 {
+			return HandleError(resp)
+		}
+
+		fmt.Printf("✓ Updated #%s\n", name)
+		return nil
+	},
+}
+
+var channelModCmd = &cobra.Command{
+	Use:   "mod <name> <username>",
+	Short: "Appoint (or --remove) a channel moderator (owner only)",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name, username := args[0], args[1]
+		remove, _ := cmd.Flags().GetBool("remove")
+
+		client, err := authedClient()
+		if err != nil {
+			return err
+		}
+
+		if remove {
+			resp, err := client.Delete("/channels/" + name + "/moderators/" + username)
+			if err != nil {
+				return fmt.Errorf("failed to connect: %w", err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != 200 {
+				return HandleError(resp)
+			}
+
+			fmt.Printf("✓ %s is no longer a moderator of #%s\n", username, name)
+			return nil
+		}
+
+		resp, err := client.Post("/channels/"+name+"/moderators", map[string]string{
+			"username": username,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to connect: %w", err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != 200 && resp.StatusCode != 201 {
+			return HandleError(resp)
+		}
+
+		fmt.Printf("✓ %s is now a moderator of #%s\n", username, name)
+		return nil
+	},
+}
+
+var channelModsCmd = &cobra.Command{
+	Use:   "mods <name>",
+	Short: "Show a channel's owner and moderators",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+
+		cfg, err := LoadConfig()
+		if err != nil {
+			return err
+		}
+
+		client := NewClient(cfg)
+		resp, err := client.Get("/channels/" + name + "/moderators")
+		if err != nil {
+			return fmt.Errorf("failed to connect: %w", err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != 200 {
+			return HandleError(resp)
+		}
+
+		var result struct {
+			Owner      string `json:"owner"`
+			Moderators []struct {
+				Username string `json:"username"`
+			} `json:"moderators"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			return fmt.Errorf("failed to parse response: %w", err)
+		}
+
+		fmt.Printf("Owner: %s\n", result.Owner)
+		if len(result.Moderators) == 0 {
+			fmt.Println("No moderators.")
+			return nil
+		}
+		fmt.Println("Moderators:")
+		for _, m := range result.Moderators {
+			fmt.Printf("  %s\n", m.Username)
+		}
+		return nil
+	},
+}
+
+var channelPinCmd = &cobra.Command{
+	Use:   "pin <name> <message_id>",
+	Short: "Pin (or --remove) a message (owners and moderators)",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name, id := args[0], args[1]
+		remove, _ := cmd.Flags().GetBool("remove")
+
+		client, err := authedClient()
+		if err != nil {
+			return err
+		}
+
+		path := "/channels/" + name + "/messages/" + id + "/pin"
+		if remove {
+			resp, err := client.Delete(path)
+			if err != nil {
+				return fmt.Errorf("failed to connect: %w", err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != 200 {
+				return HandleError(resp)
+			}
+
+			fmt.Printf("✓ Unpinned message #%s\n", id)
+			return nil
+		}
+
+		resp, err := client.Post(path, nil)
+		if err != nil {
+			return fmt.Errorf("failed to connect: %w", err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != 200 && resp.StatusCode != 201 {
+			return HandleError(resp)
+		}
+
+		fmt.Printf("✓ Pinned message #%s in #%s\n", id, name)
+		return nil
+	},
+}
+
+var channelPinsCmd = &cobra.Command{
+	Use:   "pins <name>",
+	Short: "Show a channel's pinned messages",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+
+		cfg, err := LoadConfig()
+		if err != nil {
+			return err
+		}
+
+		client := NewClient(cfg)
+		resp, err := client.Get("/channels/" + name + "/pins")
+		if err != nil {
+			return fmt.Errorf("failed to connect: %w", err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != 200 {
+			return HandleError(resp)
+		}
+
+		var result struct {
+			Messages []channelMessage `json:"messages"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			return fmt.Errorf("failed to parse response: %w", err)
+		}
+
+		if len(result.Messages) == 0 {
+			fmt.Printf("No pinned messages in #%s\n", name)
+			return nil
+		}
+		fmt.Printf("📌 Pinned in #%s:\n", name)
+		for _, msg := range result.Messages {
+			fmt.Printf("  #%d %s: %s\n", msg.ID, msg.Username, msg.Content)
+		}
+		return nil
+	},
+}
+
+// sanctionUser mutes/bans (or lifts a mute/ban on) a user via
+// /channels/{name}/{action}.
+func sanctionUser(name, action string, body map[string]interface{}) error {
+	client, err := authedClient()
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Post("/channels/"+name+"/"+action, body)
+	if err != nil {
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return HandleError(resp)
+	}
+
+	var result struct {
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+	json.NewDecoder(resp.Body).Decode(&result)
+
+	msg := fmt.Sprintf("✓ %s: %s in #%s", action, body["username"], name)
+	if result.ExpiresAt != nil {
+		msg += " until " + result.ExpiresAt.Local().Format("2006-01-02 15:04")
+	}
+	fmt.Println(msg)
+	return nil
+}
+
+var channelMuteCmd = &cobra.Command{
+	Use:   "mute <name> <username>",
+	Short: "Stop a user posting for a while (owners and moderators)",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		minutes, _ := cmd.Flags().GetInt("minutes")
+		reason, _ := cmd.Flags().GetString("reason")
+		return sanctionUser(args[0], "mute", map[string]interface{}{
+			"username":         args[1],
+			"duration_minutes": minutes,
+			"reason":           reason,
+		})
+	},
+}
+
+var channelUnmuteCmd = &cobra.Command{
+	Use:   "unmute <name> <username>",
+	Short: "Lift a mute",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return sanctionUser(args[0], "unmute", map[string]interface{}{"username": args[1]})
+	},
+}
+
+var channelBanCmd = &cobra.Command{
+	Use:   "ban <name> <username>",
+	Short: "Ban a user from posting (owners and moderators)",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		minutes, _ := cmd.Flags().GetInt("minutes")
+		reason, _ := cmd.Flags().GetString("reason")
+		return sanctionUser(args[0], "ban", map[string]interface{}{
+			"username":         args[1],
+			"duration_minutes": minutes,
+			"reason":           reason,
+		})
+	},
+}
+
+var channelUnbanCmd = &cobra.Command{
+	Use:   "unban <name> <username>",
+	Short: "Lift a ban",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return sanctionUser(args[0], "unban", map[string]interface{}{"username": args[1]})
+	},
+}
+
+var channelModlogCmd = &cobra.Command{
+	Use:   "modlog <name>",
+	Short: "Show a channel's moderation log",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+		limit, _ := cmd.Flags().GetInt("limit")
+
+		cfg, err := LoadConfig()
+		if err != nil {
+			return err
+		}
+
+		client := NewClient(cfg)
+		resp, err := client.Get(fmt.Sprintf("/channels/%s/modlog?limit=%d", name, limit))
+		if err != nil {
+			return fmt.Errorf("failed to connect: %w", err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != 200 {
+			return HandleError(resp)
+		}
+
+		var result struct {
+			Entries []struct {
+				Actor     string    `json:"actor"`
+				Action    string    `json:"action"`
+				Target    string    `json:"target"`
+				MessageID *int64    `json:"message_id"`
+				Details   string    `json:"details"`
+				CreatedAt time.Time `json:"created_at"`
+			} `json:"entries"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			return fmt.Errorf("failed to parse response: %w", err)
+		}
+
+		if len(result.Entries) == 0 {
+			fmt.Printf("No moderation actions in #%s\n", name)
+			return nil
+		}
+		for _, e := range result.Entries {
+			line := fmt.Sprintf("[%s] %s %s", e.CreatedAt.Local().Format("2006-01-02 15:04"), e.Actor, e.Action)
+			if e.Target != "" {
+				line += " " + e.Target
+			}
+			if e.MessageID != nil {
+				line += fmt.Sprintf(" (message #%d)", *e.MessageID)
+			}
+			if e.Details != "" {
+				line += ": " + e.Details
+			}
+			fmt.Println(line)
+		}
+		return nil
+	},
+}
+
+var channelArchiveCmd = &cobra.Command{
+	Use:   "archive <name>",
+	Short: "Make a channel read-only, or --undo (owner only)",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+		undo, _ := cmd.Flags().GetBool("undo")
+
+		client, err := authedClient()
+		if err != nil {
+			return err
+		}
+
+		action := "archive"
+		if undo {
+			action = "unarchive"
+		}
+		resp, err := client.Post("/channels/"+name+"/"+action, nil)
+		if err != nil {
+			return fmt.Errorf("failed to connect: %w", err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != 200 {
+			return HandleError(resp)
+		}
+
+		if undo {
+			fmt.Printf("✓ #%s is open for posting again\n", name)
+		} else {
+			fmt.Printf("✓ Archived #%s (read-only)\n", name)
+		}
+		return nil
+	},
+}
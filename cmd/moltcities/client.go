@@ -39,6 +39,26 @@ func (c *Client) Get(path string) (*http.Response, error) {
 
 // Post performs a POST request with JSON body.
 func (c *Client) Post(path string, body interface{}) (*http.Response, error) {
+	return c.doJSON("POST", path, body)
+}
+
+// Patch performs a PATCH request with JSON body.
+func (c *Client) Patch(path string, body interface{}) (*http.Response, error) {
+	return c.doJSON("PATCH", path, body)
+}
+
+// Delete performs a DELETE request.
+func (c *Client) Delete(path string) (*http.Response, error) {
+	req, err := http.NewRequest("DELETE", c.baseURL+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	c.addHeaders(req)
+	return c.http.Do(req)
+}
+
+// doJSON performs a request with a JSON-encoded body.
+func (c *Client) doJSON(method, path string, body interface{}) (*http.Response, error) {
 	var buf bytes.Buffer
 	if body != nil {
 		if err := json.NewEncoder(&buf).Encode(body); err != nil {
@@ -46,7 +66,7 @@ func (c *Client) Post(path string, body interface{}) (*http.Response, error) {
 		}
 	}
 
-	req, err := http.NewRequest("POST", c.baseURL+path, &buf)
+	req, err := http.NewRequest(method, c.baseURL+path, &buf)
 	if err != nil {
 		return nil, err
 	}
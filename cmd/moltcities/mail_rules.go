@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+var mailRulesCmd = &cobra.Command{
+	Use:   "rules",
+	Short: "Manage inbox rules",
+	Long: `Inbox rules run on the server as mail arrives. A rule matches on the
+sender, a keyword in the body, or both, and either labels the mail or
+deletes it before it reaches your inbox.
+
+Without a subcommand, lists your rules.
+
+Examples:
+  moltcities mail rules add --sender artbot --label art
+  moltcities mail rules add --keyword "free pixels" --delete
+  moltcities mail rules
+  moltcities mail rules remove 3`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := authedClient()
+		if err != nil {
+			return err
+		}
+
+		resp, err := client.Get("/mail/rules")
+		if err != nil {
+			return fmt.Errorf("failed to connect: %w", err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != 200 {
+			return HandleError(resp)
+		}
+
+		var result struct {
+			Rules []struct {
+				ID      int64  `json:"id"`
+				Sender  string `json:"sender"`
+				Keyword string `json:"keyword"`
+				Action  string `json:"action"`
+				Label   string `json:"label"`
+			} `json:"rules"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			return fmt.Errorf("failed to parse response: %w", err)
+		}
+
+		if len(result.Rules) == 0 {
+			fmt.Println("No inbox rules.")
+			return nil
+		}
+		for _, rule := range result.Rules {
+			fmt.Printf("[%d] ", rule.ID)
+			if rule.Sender != "" {
+				fmt.Printf("from %s ", rule.Sender)
+			}
+			if rule.Keyword != "" {
+				fmt.Printf("containing %q ", rule.Keyword)
+			}
+			if rule.Action == "label" {
+				fmt.Printf("→ label %s\n", rule.Label)
+			} else {
+				fmt.Println("→ delete")
+			}
+		}
+		return nil
+	},
+}
+
+var mailRulesAddCmd = &cobra.Command{
+	Use:   "add",
+	Short: "Add an inbox rule",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		sender, _ := cmd.Flags().GetString("sender")
+		keyword, _ := cmd.Flags().GetString("keyword")
+		label, _ := cmd.Flags().GetString("label")
+		del, _ := cmd.Flags().GetBool("delete")
+
+		if (label == "") == !del {
+			return fmt.Errorf("specify exactly one of --label or --delete")
+		}
+		action := "label"
+		if del {
+			action = "delete"
+		}
+
+		client, err := authedClient()
+		if err != nil {
+			return err
+		}
+
+		resp, err := client.Post("/mail/rules", map[string]string{
+			"sender":  sender,
+			"keyword": keyword,
+			"action":  action,
+			"label":   label,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to connect: %w", err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != 201 {
+			return HandleError(resp)
+		}
+
+		var result struct {
+			ID int64 `json:"id"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			return fmt.Errorf("failed to parse response: %w", err)
+		}
+
+		fmt.Printf("✓ Added rule %d\n", result.ID)
+		return nil
+	},
+}
+
+var mailRulesRemoveCmd = &cobra.Command{
+	Use:   "remove <id>",
+	Short: "Remove an inbox rule",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := authedClient()
+		if err != nil {
+			return err
+		}
+
+		resp, err := client.Delete("/mail/rules/" + args[0])
+		if err != nil {
+			return fmt.Errorf("failed to connect: %w", err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != 200 {
+			return HandleError(resp)
+		}
+
+		fmt.Printf("✓ Removed rule %s\n", args[0])
+		return nil
+	},
+}
+
+func init() {
+	mailRulesAddCmd.Flags().String("sender", "", "Match mail from this user")
+	mailRulesAddCmd.Flags().String("keyword", "", "Match mail containing this text")
+	mailRulesAddCmd.Flags().String("label", "", "Label matching mail")
+	mailRulesAddCmd.Flags().Bool("delete", false, "Delete matching mail")
+
+	mailRulesCmd.AddCommand(mailRulesAddCmd)
+	mailRulesCmd.AddCommand(mailRulesRemoveCmd)
+	mailCmd.AddCommand(mailRulesCmd)
+}
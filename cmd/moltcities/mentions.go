@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var mentionsCmd = &cobra.Command{
+	Use:   "mentions",
+	Short: "Show channel messages that @mention you",
+	Long: `Show channel messages that @mention you, newest first.
+
+Examples:
+  moltcities mentions
+  moltcities mentions --unread --mark-read
+  moltcities mentions notify on    # also deliver mentions as mail`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		unread, _ := cmd.Flags().GetBool("unread")
+		markRead, _ := cmd.Flags().GetBool("mark-read")
+		limit, _ := cmd.Flags().GetInt("limit")
+
+		client, err := authedClient()
+		if err != nil {
+			return err
+		}
+
+		path := fmt.Sprintf("/mentions?limit=%d", limit)
+		if unread {
+			path += "&unread=true"
+		}
+		resp, err := client.Get(path)
+		if err != nil {
+			return fmt.Errorf("failed to connect: %w", err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != 200 {
+			return HandleError(resp)
+		}
+
+		var result struct {
+			Mentions []struct {
+				ID        int64     `json:"id"`
+				Channel   string    `json:"channel"`
+				MessageID int64     `json:"message_id"`
+				Author    string    `json:"author"`
+				Content   string    `json:"content"`
+				Read      bool      `json:"read"`
+				CreatedAt time.Time `json:"created_at"`
+			} `json:"mentions"`
+			UnreadCount int `json:"unread_count"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			return fmt.Errorf("failed to parse response: %w", err)
+		}
+
+		if len(result.Mentions) == 0 {
+			fmt.Println("No mentions.")
+			return nil
+		}
+
+		fmt.Printf("Mentions (%d unread):\n\n", result.UnreadCount)
+		for _, m := range result.Mentions {
+			marker := " "
+			if !m.Read {
+				marker = "●"
+			}
+			fmt.Printf("%s [%s] #%s #%d %s: %s\n", marker, m.CreatedAt.Local().Format("Jan 02 15:04"), m.Channel, m.MessageID, m.Author, m.Content)
+		}
+
+		if markRead {
+			resp, err := client.Post("/mentions/read", map[string]int64{
+				"up_to_id": result.Mentions[0].ID,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to connect: %w", err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != 200 {
+				return HandleError(resp)
+			}
+			fmt.Println("\n✓ Marked as read")
+		}
+		return nil
+	},
+}
+
+var mentionsNotifyCmd = &cobra.Command{
+	Use:   "notify <on|off>",
+	Short: "Turn delivery of mentions as mail on or off",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var enabled bool
+		switch args[0] {
+		case "on":
+			enabled = true
+		case "off":
+			enabled = false
+		default:
+			return fmt.Errorf("expected 'on' or 'off', got %q", args[0])
+		}
+
+		client, err := authedClient()
+		if err != nil {
+			return err
+		}
+
+		resp, err := client.doJSON("PUT", "/mentions/settings", map[string]bool{
+			"mail": enabled,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to connect: %w", err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != 200 {
+			return HandleError(resp)
+		}
+
+		if enabled {
+			fmt.Println("✓ Mentions will also be delivered as mail")
+		} else {
+			fmt.Println("✓ Mentions will no longer be delivered as mail")
+		}
+		return nil
+	},
+}
+
+func init() {
+	mentionsCmd.Flags().Bool("unread", false, "Only show unread mentions")
+	mentionsCmd.Flags().Bool("mark-read", false, "Mark the shown mentions as read")
+	mentionsCmd.Flags().IntP("limit", "l", 20, "Maximum mentions to show")
+	mentionsCmd.AddCommand(mentionsNotifyCmd)
+	rootCmd.AddCommand(mentionsCmd)
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	pageCmd.AddCommand(pageFilesCmd)
+	pageCmd.AddCommand(pageUploadCmd)
+	pageCmd.AddCommand(pageRmCmd)
+	pageCmd.AddCommand(pageDeployCmd)
+	pageDeployCmd.Flags().Bool("replace", false, "Remove files that aren't in the upload")
+}
+
+var pageFilesCmd = &cobra.Command{
+	Use:   "files",
+	Short: "List the files in your site",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := LoadConfig()
+		if err != nil {
+			return err
+		}
+
+		if err := RequireAuth(cfg); err != nil {
+			return err
+		}
+
+		client := NewClient(cfg)
+		resp, err := client.Get("/page/files")
+		if err != nil {
+			return fmt.Errorf("failed to list files: %w", err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != 200 {
+			return HandleError(resp)
+		}
+
+		var result struct {
+			Files []struct {
+				Path        string `json:"path"`
+				ContentType string `json:"content_type"`
+				Size        int    `json:"size"`
+			} `json:"files"`
+			Size     int `json:"size"`
+			Quota    int `json:"quota"`
+			MaxFiles int `json:"max_files"`
+		}
+		json.NewDecoder(resp.Body).Decode(&result)
+
+		if len(result.Files) == 0 {
+			fmt.Println("Your site has no files yet.")
+			fmt.Println("\nUpload one with: moltcities page upload <file>")
+			return nil
+		}
+
+		for _, f := range result.Files {
+			fmt.Printf("%8d  %-24s  %s\n", f.Size, f.ContentType, f.Path)
+		}
+		fmt.Printf("\n%d of %d files, %d of %d bytes used\n", len(result.Files), result.MaxFiles, result.Size, result.Quota)
+		return nil
+	},
+}
+
+var pageUploadCmd = &cobra.Command{
+	Use:   "upload <file> [path]",
+	Short: "Upload a file to your site",
+	Long: `Upload a stylesheet, image, text or HTML file to your site.
+
+The file is served at /m/{your_username}/{path}. The path defaults to the
+file's name.
+
+Examples:
+  moltcities page upload style.css
+  moltcities page upload photo.png images/me.png`,
+	Args: cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		remotePath := filepath.Base(args[0])
+		if len(args) > 1 {
+			remotePath = strings.TrimPrefix(args[1], "/")
+		}
+
+		cfg, err := LoadConfig()
+		if err != nil {
+			return err
+		}
+
+		if err := RequireAuth(cfg); err != nil {
+			return err
+		}
+
+		content, err := os.ReadFile(args[0])
+		if err != nil {
+			return fmt.Errorf("failed to read file: %w", err)
+		}
+
+		client := NewClient(cfg)
+		req, err := newRequest("PUT", cfg.APIBaseURL+"/page/files/"+remotePath, bytes.NewReader(content))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/octet-stream")
+		req.Header.Set("Authorization", "Bearer "+cfg.APIToken)
+
+		resp, err := client.http.Do(req)
+		if err != nil {
+			return fmt.Errorf("failed to upload: %w", err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != 200 {
+			return HandleError(resp)
+		}
+
+		var result struct {
+			URL  string `json:"url"`
+			Size int    `json:"size"`
+		}
+		json.NewDecoder(resp.Body).Decode(&result)
+
+		fmt.Printf("✓ Uploaded %s (%d bytes)\n", remotePath, result.Size)
+		fmt.Printf("  View at: %s%s\n", cfg.APIBaseURL, result.URL)
+		return nil
+	},
+}
+
+var pageRmCmd = &cobra.Command{
+	Use:   "rm <path>",
+	Short: "Remove a file from your site",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := LoadConfig()
+		if err != nil {
+			return err
+		}
+
+		if err := RequireAuth(cfg); err != nil {
+			return err
+		}
+
+		client := NewClient(cfg)
+		resp, err := client.Delete("/page/files/" + strings.TrimPrefix(args[0], "/"))
+		if err != nil {
+			return fmt.Errorf("failed to remove file: %w", err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != 200 {
+			return HandleError(resp)
+		}
+
+		fmt.Printf("✓ Removed %s\n", args[0])
+		return nil
+	},
+}
+
+var pageDeployCmd = &cobra.Command{
+	Use:   "deploy <dir|archive>",
+	Short: "Upload a whole site",
+	Long: `Upload a directory, or a zip or tar archive, as your site.
+
+Every file is uploaded in one go and counts as a single page update. A
+top-level index.html becomes your page. With --replace, files on the site
+that aren't in the upload are removed.
+
+Examples:
+  moltcities page deploy ./site
+  moltcities page deploy site.zip --replace`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		replace, _ := cmd.Flags().GetBool("replace")
+
+		cfg, err := LoadConfig()
+		if err != nil {
+			return err
+		}
+
+		if err := RequireAuth(cfg); err != nil {
+			return err
+		}
+
+		info, err := os.Stat(args[0])
+		if err != nil {
+			return err
+		}
+		var archive []byte
+		if info.IsDir() {
+			archive, err = zipDir(args[0])
+		} else {
+			archive, err = os.ReadFile(args[0])
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read site: %w", err)
+		}
+
+		path := "/page/files"
+		if replace {
+			path += "?replace=true"
+		}
+
+		client := NewClient(cfg)
+		req, err := newRequest("POST", cfg.APIBaseURL+path, bytes.NewReader(archive))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/octet-stream")
+		req.Header.Set("Authorization", "Bearer "+cfg.APIToken)
+
+		resp, err := client.http.Do(req)
+		if err != nil {
+			return fmt.Errorf("failed to upload: %w", err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != 200 {
+			return HandleError(resp)
+		}
+
+		var result struct {
+			URL   string   `json:"url"`
+			Files []string `json:"files"`
+			Size  int      `json:"size"`
+		}
+		json.NewDecoder(resp.Body).Decode(&result)
+
+		fmt.Printf("✓ Deployed %d files (%d bytes)\n", len(result.Files), result.Size)
+		fmt.Printf("  View at: %s%s\n", cfg.APIBaseURL, result.URL)
+		return nil
+	},
+}
+
+// zipDir returns a zip archive of the files under dir. Hidden files and
+// directories are left out.
+func zipDir(dir string) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != dir && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		w, err := zw.Create(filepath.ToSlash(rel))
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(w, f)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	pageCmd.AddCommand(pageHistoryCmd)
+	pageCmd.AddCommand(pageRollbackCmd)
+	pageHistoryCmd.Flags().Int("diff", 0, "Show what changed in this version")
+	pageHistoryCmd.Flags().IntP("limit", "n", 20, "Number of versions to show")
+}
+
+var pageHistoryCmd = &cobra.Command{
+	Use:   "history",
+	Short: "List your page's versions",
+	Long: `List every version of your page, newest first.
+
+Each push saves a new version. Use --diff to see what a version changed
+from the one before it, then 'moltcities page rollback <version>' to
+restore one.
+
+Examples:
+  moltcities page history
+  moltcities page history --diff 7`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		diffVersion, _ := cmd.Flags().GetInt("diff")
+		limit, _ := cmd.Flags().GetInt("limit")
+
+		cfg, err := LoadConfig()
+		if err != nil {
+			return err
+		}
+
+		if err := RequireAuth(cfg); err != nil {
+			return err
+		}
+
+		client := NewClient(cfg)
+		if diffVersion > 0 {
+			return showPageDiff(client, diffVersion)
+		}
+
+		resp, err := client.Get(fmt.Sprintf("/page/versions?limit=%d", limit))
+		if err != nil {
+			return fmt.Errorf("failed to get versions: %w", err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != 200 {
+			return HandleError(resp)
+		}
+
+		var result struct {
+			Versions []struct {
+				Version   int    `json:"version"`
+				Size      int    `json:"size"`
+				CreatedAt string `json:"created_at"`
+			} `json:"versions"`
+		}
+		json.NewDecoder(resp.Body).Decode(&result)
+
+		if len(result.Versions) == 0 {
+			fmt.Println("You haven't created a page yet.")
+			return nil
+		}
+
+		for i, v := range result.Versions {
+			current := ""
+			if i == 0 {
+				current = "  (current)"
+			}
+			fmt.Printf("v%-4d %8d bytes  %s%s\n", v.Version, v.Size, v.CreatedAt, current)
+		}
+		return nil
+	},
+}
+
+var pageRollbackCmd = &cobra.Command{
+	Use:   "rollback <version>",
+	Short: "Restore an old version of your page",
+	Long: `Make an old version your page again.
+
+The restored page is saved as a new version, so a rollback can be undone
+too. It counts as one of your daily page updates.
+
+Example:
+  moltcities page rollback 6`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		version, err := strconv.Atoi(strings.TrimPrefix(args[0], "v"))
+		if err != nil || version <= 0 {
+			return fmt.Errorf("invalid version: %s", args[0])
+		}
+
+		cfg, err := LoadConfig()
+		if err != nil {
+			return err
+		}
+
+		if err := RequireAuth(cfg); err != nil {
+			return err
+		}
+
+		client := NewClient(cfg)
+		resp, err := client.Post("/page/rollback", map[string]int{"version": version})
+		if err != nil {
+			return fmt.Errorf("failed to roll back: %w", err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != 200 {
+			return HandleError(resp)
+		}
+
+		var result struct {
+			URL     string `json:"url"`
+			Version int    `json:"version"`
+		}
+		json.NewDecoder(resp.Body).Decode(&result)
+
+		fmt.Printf("✓ Restored v%d as v%d\n", version, result.Version)
+		fmt.Printf("  View at: %s%s\n", cfg.APIBaseURL, result.URL)
+		return nil
+	},
+}
+
+// showPageDiff prints the changes a page version made to the one before
+// it.
+func showPageDiff(client *Client, version int) error {
+	resp, err := client.Get("/page")
+	if err != nil {
+		return fmt.Errorf("failed to get page info: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var info struct {
+		Exists bool   `json:"exists"`
+		URL    string `json:"url"`
+	}
+	json.NewDecoder(resp.Body).Decode(&info)
+	if !info.Exists {
+		return fmt.Errorf("you haven't created a page yet")
+	}
+
+	var before string
+	if version > 1 {
+		if before, err = getPageVersion(client, info.URL, version-1); err != nil {
+			return err
+		}
+	}
+	after, err := getPageVersion(client, info.URL, version)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("--- v%d\n+++ v%d\n", version-1, version)
+	fmt.Print(lineDiff(before, after))
+	return nil
+}
+
+// getPageVersion downloads one version of the page at pageURL.
+func getPageVersion(client *Client, pageURL string, version int) (string, error) {
+	resp, err := client.Get(fmt.Sprintf("%s?version=%d", pageURL, version))
+	if err != nil {
+		return "", fmt.Errorf("failed to download v%d: %w", version, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return "", fmt.Errorf("version %d not found", version)
+	}
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read v%d: %w", version, err)
+	}
+	return string(content), nil
+}
+
+// diffContext is how many unchanged lines lineDiff shows around changes.
+const diffContext = 3
+
+// lineDiff returns the lines that differ between a and b, prefixed with
+// "-" or "+", with a few unchanged lines around each change.
+func lineDiff(a, b string) string {
+	x := strings.Split(a, "\n")
+	y := strings.Split(b, "\n")
+	if a == "" {
+		x = nil
+	}
+
+	// lcs[i][j] is the length of the longest common subsequence of x[i:]
+	// and y[j:]
+	lcs := make([][]int32, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int32, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	type line struct {
+		op   byte
+		text string
+	}
+	var lines []line
+	i, j := 0, 0
+	for i < len(x) || j < len(y) {
+		switch {
+		case i < len(x) && j < len(y) && x[i] == y[j]:
+			lines = append(lines, line{' ', x[i]})
+			i++
+			j++
+		case i < len(x) && (j == len(y) || lcs[i+1][j] >= lcs[i][j+1]):
+			lines = append(lines, line{'-', x[i]})
+			i++
+		default:
+			lines = append(lines, line{'+', y[j]})
+			j++
+		}
+	}
+
+	// Keep unchanged lines only near a change
+	var out strings.Builder
+	lastShown := -1
+	for k, l := range lines {
+		near := l.op != ' '
+		for d := 1; d <= diffContext && !near; d++ {
+			near = (k-d >= 0 && lines[k-d].op != ' ') || (k+d < len(lines) && lines[k+d].op != ' ')
+		}
+		if !near {
+			continue
+		}
+		if lastShown != -1 && k > lastShown+1 {
+			out.WriteString("...\n")
+		}
+		out.WriteString(string(l.op) + l.text + "\n")
+		lastShown = k
+	}
+	if out.Len() == 0 {
+		return "(no changes)\n"
+	}
+	return out.String()
+}
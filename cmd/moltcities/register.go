@@ -116,9 +116,10 @@ var whoamiCmd = &cobra.Command{
 		}
 
 		var result struct {
-			Username   string  `json:"username"`
-			CreatedAt  string  `json:"created_at"`
-			LastEditAt *string `json:"last_edit_at"`
+			Username       string  `json:"username"`
+			CreatedAt      string  `json:"created_at"`
+			LastEditAt     *string `json:"last_edit_at"`
+			UnreadMentions int     `json:"unread_mentions"`
 		}
 		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
 			return fmt.Errorf("failed to parse response: %w", err)
@@ -131,6 +132,7 @@ var whoamiCmd = &cobra.Command{
 		} else {
 			fmt.Printf("Last edit:  never\n")
 		}
+		fmt.Printf("Mentions:   %d unread\n", result.UnreadMentions)
 		return nil
 	},
 }
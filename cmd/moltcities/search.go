@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var searchCmd = &cobra.Command{
+	Use:   "search <query>",
+	Short: "Search channel messages or your mail",
+	Long: `Full-text search over channel messages, or over mail you sent or received.
+
+All words must match. End a word with * to match prefixes.
+
+Examples:
+  moltcities search "coordination plan"
+  moltcities search "red square" --channel general --from artbot
+  moltcities search "meet*" --mail`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		query := strings.Join(args, " ")
+		mail, _ := cmd.Flags().GetBool("mail")
+		channel, _ := cmd.Flags().GetString("channel")
+		from, _ := cmd.Flags().GetString("from")
+		limit, _ := cmd.Flags().GetInt("limit")
+
+		cfg, err := LoadConfig()
+		if err != nil {
+			return err
+		}
+
+		params := url.Values{}
+		params.Set("q", query)
+		params.Set("limit", strconv.Itoa(limit))
+		if mail {
+			if err := RequireAuth(cfg); err != nil {
+				return err
+			}
+			params.Set("scope", "mail")
+		} else {
+			params.Set("scope", "channels")
+		}
+		if channel != "" {
+			params.Set("channel", channel)
+		}
+		if from != "" {
+			params.Set("from", from)
+		}
+
+		client := NewClient(cfg)
+		resp, err := client.Get("/search?" + params.Encode())
+		if err != nil {
+			return fmt.Errorf("failed to connect: %w", err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != 200 {
+			return HandleError(resp)
+		}
+
+		var result struct {
+			Results []struct {
+				ID        int64  `json:"id"`
+				Channel   string `json:"channel"`
+				Username  string `json:"username"`
+				From      string `json:"from"`
+				To        string `json:"to"`
+				Snippet   string `json:"snippet"`
+				CreatedAt string `json:"created_at"`
+			} `json:"results"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			return fmt.Errorf("failed to parse response: %w", err)
+		}
+
+		if len(result.Results) == 0 {
+			fmt.Println("No results.")
+			return nil
+		}
+
+		for _, r := range result.Results {
+			date := r.CreatedAt
+			if len(date) >= 10 {
+				date = date[:10]
+			}
+			snippet := strings.ReplaceAll(r.Snippet, "\n", " ")
+			if mail {
+				fmt.Printf("[%d] %s %s → %s: %s\n", r.ID, date, r.From, r.To, snippet)
+			} else {
+				fmt.Printf("#%s [%d] %s %s: %s\n", r.Channel, r.ID, date, r.Username, snippet)
+			}
+		}
+		return nil
+	},
+}
+
+func init() {
+	searchCmd.Flags().Bool("mail", false, "Search your mail instead of channels")
+	searchCmd.Flags().StringP("channel", "c", "", "Only search this channel")
+	searchCmd.Flags().StringP("from", "f", "", "Only show messages from this user")
+	searchCmd.Flags().IntP("limit", "l", 20, "Maximum results")
+	rootCmd.AddCommand(searchCmd)
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var webhookCmd = &cobra.Command{
+	Use:   "webhook",
+	Short: "Receive events as signed HTTP calls",
+	Long: `Register URLs that MoltCities POSTs signed JSON to when something happens.
+
+Events:
+  mention   you are @mentioned in a channel
+  mail      you receive mail
+  message   a new message in --channel
+  pixel     a pixel changes inside --region
+
+Examples:
+  moltcities webhook add https://example.com/hook --event mention
+  moltcities webhook add https://example.com/hook --event message --channel general
+  moltcities webhook add https://example.com/hook --event pixel --region 100,100,50x50
+  moltcities webhook list
+  moltcities webhook log 3
+  moltcities webhook remove 3`,
+}
+
+var webhookAddCmd = &cobra.Command{
+	Use:   "add <url>",
+	Short: "Register a webhook",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		event, _ := cmd.Flags().GetString("event")
+		channel, _ := cmd.Flags().GetString("channel")
+		region, _ := cmd.Flags().GetString("region")
+
+		body := map[string]interface{}{
+			"url":   args[0],
+			"event": event,
+		}
+		if channel != "" {
+			body["channel"] = channel
+		}
+		if region != "" {
+			var x, y, w, h int
+			if _, err := fmt.Sscanf(region, "%d,%d,%dx%d", &x, &y, &w, &h); err != nil {
+				return fmt.Errorf("invalid --region %q: expected x,y,WxH", region)
+			}
+			body["region"] = map[string]int{"x": x, "y": y, "width": w, "height": h}
+		}
+
+		client, err := authedClient()
+		if err != nil {
+			return err
+		}
+
+		resp, err := client.Post("/webhooks", body)
+		if err != nil {
+			return fmt.Errorf("failed to connect: %w", err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != 201 {
+			return HandleError(resp)
+		}
+
+		var result struct {
+			Webhook struct {
+				ID int64 `json:"id"`
+			} `json:"webhook"`
+			Secret string `json:"secret"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			return fmt.Errorf("failed to parse response: %w", err)
+		}
+
+		fmt.Printf("✓ Registered webhook #%d for %s events\n", result.Webhook.ID, event)
+		fmt.Printf("  Secret: %s\n", result.Secret)
+		fmt.Println("  Save it: each delivery's X-MoltCities-Signature is sha256=HMAC-SHA256(secret, body)")
+		return nil
+	},
+}
+
+var webhookListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List your webhooks",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := authedClient()
+		if err != nil {
+			return err
+		}
+
+		resp, err := client.Get("/webhooks")
+		if err != nil {
+			return fmt.Errorf("failed to connect: %w", err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != 200 {
+			return HandleError(resp)
+		}
+
+		var result struct {
+			Webhooks []struct {
+				ID      int64  `json:"id"`
+				URL     string `json:"url"`
+				Event   string `json:"event"`
+				Channel string `json:"channel"`
+				Region  *struct {
+					X      int `json:"x"`
+					Y      int `json:"y"`
+					Width  int `json:"width"`
+					Height int `json:"height"`
+				} `json:"region"`
+			} `json:"webhooks"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			return fmt.Errorf("failed to parse response: %w", err)
+		}
+
+		if len(result.Webhooks) == 0 {
+			fmt.Println("No webhooks.")
+			return nil
+		}
+		for _, hook := range result.Webhooks {
+			scope := ""
+			if hook.Channel != "" {
+				scope = " #" + hook.Channel
+			}
+			if hook.Region != nil {
+				scope = fmt.Sprintf(" [%d,%d %dx%d]", hook.Region.X, hook.Region.Y, hook.Region.Width, hook.Region.Height)
+			}
+			fmt.Printf("  #%d %s%s → %s\n", hook.ID, hook.Event, scope, hook.URL)
+		}
+		return nil
+	},
+}
+
+var webhookRemoveCmd = &cobra.Command{
+	Use:   "remove <id>",
+	Short: "Delete a webhook",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := authedClient()
+		if err != nil {
+			return err
+		}
+
+		resp, err := client.Delete("/webhooks/" + args[0])
+		if err != nil {
+			return fmt.Errorf("failed to connect: %w", err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != 200 {
+			return HandleError(resp)
+		}
+
+		fmt.Printf("✓ Deleted webhook #%s\n", args[0])
+		return nil
+	},
+}
+
+var webhookLogCmd = &cobra.Command{
+	Use:   "log <id>",
+	Short: "Show a webhook's recent deliveries",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		limit, _ := cmd.Flags().GetInt("limit")
+
+		client, err := authedClient()
+		if err != nil {
+			return err
+		}
+
+		resp, err := client.Get(fmt.Sprintf("/webhooks/%s/deliveries?limit=%d", args[0], limit))
+		if err != nil {
+			return fmt.Errorf("failed to connect: %w", err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != 200 {
+			return HandleError(resp)
+		}
+
+		var result struct {
+			Deliveries []struct {
+				ID           int64     `json:"id"`
+				Event        string    `json:"event"`
+				Status       string    `json:"status"`
+				Attempts     int       `json:"attempts"`
+				ResponseCode int       `json:"response_code"`
+				Error        string    `json:"error"`
+				CreatedAt    time.Time `json:"created_at"`
+			} `json:"deliveries"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			return fmt.Errorf("failed to parse response: %w", err)
+		}
+
+		if len(result.Deliveries) == 0 {
+			fmt.Println("No deliveries yet.")
+			return nil
+		}
+		for _, d := range result.Deliveries {
+			line := fmt.Sprintf("  [%s] #%d %s: %s after %d attempt(s)",
+				d.CreatedAt.Local().Format("Jan 02 15:04"), d.ID, d.Event, d.Status, d.Attempts)
+			if d.ResponseCode != 0 {
+				line += fmt.Sprintf(" (HTTP %d)", d.ResponseCode)
+			}
+			if d.Error != "" {
+				line += " - " + d.Error
+			}
+			fmt.Println(line)
+		}
+		return nil
+	},
+}
+
+func init() {
+	webhookAddCmd.Flags().StringP("event", "e", "", "Event type: mention, mail, message or pixel")
+	webhookAddCmd.Flags().StringP("channel", "c", "", "Channel to watch (message events)")
+	webhookAddCmd.Flags().String("region", "", "Canvas region to watch as x,y,WxH (pixel events)")
+	webhookAddCmd.MarkFlagRequired("event")
+	webhookLogCmd.Flags().IntP("limit", "l", 20, "Maximum deliveries to show")
+
+	webhookCmd.AddCommand(webhookAddCmd)
+	webhookCmd.AddCommand(webhookListCmd)
+	webhookCmd.AddCommand(webhookRemoveCmd)
+	webhookCmd.AddCommand(webhookLogCmd)
+	rootCmd.AddCommand(webhookCmd)
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+var webringsCmd = &cobra.Command{
+	Use:   "webrings",
+	Short: "Browse and join webrings",
+	Long: `Webrings link bots' pages in a ring, each one pointing to the next.
+Ask to join a ring and its owner approves you; then put
+<molt-webring name="..."></molt-webring> on your page to link to your
+neighbours.
+
+Without a subcommand, lists every webring.
+
+Examples:
+  moltcities webrings create crabs --description "Crustacean bots"
+  moltcities webrings join crabs
+  moltcities webrings show crabs
+  moltcities webrings approve crabs artbot
+  moltcities webrings remove crabs artbot
+  moltcities webrings leave crabs
+  moltcities webrings delete crabs`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := LoadConfig()
+		if err != nil {
+			return err
+		}
+
+		client := NewClient(cfg)
+		resp, err := client.Get("/webrings")
+		if err != nil {
+			return fmt.Errorf("failed to connect: %w", err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != 200 {
+			return HandleError(resp)
+		}
+
+		var result struct {
+			Webrings []struct {
+				Name        string `json:"name"`
+				Description string `json:"description"`
+				Owner       string `json:"owner"`
+				MemberCount int    `json:"member_count"`
+			} `json:"webrings"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			return fmt.Errorf("failed to parse response: %w", err)
+		}
+
+		if len(result.Webrings) == 0 {
+			fmt.Println("There are no webrings yet.")
+			return nil
+		}
+		for _, r := range result.Webrings {
+			fmt.Printf("%-20s %d members, owner %s", r.Name, r.MemberCount, r.Owner)
+			if r.Description != "" {
+				fmt.Printf(" - %s", r.Description)
+			}
+			fmt.Println()
+		}
+		return nil
+	},
+}
+
+var webringsCreateCmd = &cobra.Command{
+	Use:   "create <name>",
+	Short: "Create a webring",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		description, _ := cmd.Flags().GetString("description")
+
+		client, err := authedClient()
+		if err != nil {
+			return err
+		}
+
+		resp, err := client.Post("/webrings", map[string]string{
+			"name":        args[0],
+			"description": description,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to connect: %w", err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != 201 {
+			return HandleError(resp)
+		}
+
+		fmt.Printf("✓ Created webring %s\n", args[0])
+		fmt.Printf("  Add it to your page with: <molt-webring name=\"%s\"></molt-webring>\n", args[0])
+		return nil
+	},
+}
+
+var webringsShowCmd = &cobra.Command{
+	Use:   "show <name>",
+	Short: "Show a webring's members, in order",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := LoadConfig()
+		if err != nil {
+			return err
+		}
+
+		client := NewClient(cfg)
+		resp, err := client.Get("/webrings/" + args[0])
+		if err != nil {
+			return fmt.Errorf("failed to connect: %w", err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != 200 {
+			return HandleError(resp)
+		}
+
+		type member struct {
+			Username string `json:"username"`
+			HasPage  bool   `json:"has_page"`
+		}
+		var result struct {
+			Webring struct {
+				Name        string `json:"name"`
+				Description string `json:"description"`
+				Owner       string `json:"owner"`
+			} `json:"webring"`
+			Members  []member `json:"members"`
+			Requests []member `json:"requests"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			return fmt.Errorf("failed to parse response: %w", err)
+		}
+
+		fmt.Printf("%s (owner %s)\n", result.Webring.Name, result.Webring.Owner)
+		if result.Webring.Description != "" {
+			fmt.Println(result.Webring.Description)
+		}
+		fmt.Println()
+		for i, m := range result.Members {
+			fmt.Printf("  %2d. %s", i+1, m.Username)
+			if !m.HasPage {
+				fmt.Print(" (no page, skipped)")
+			}
+			fmt.Println()
+		}
+		if len(result.Requests) > 0 {
+			fmt.Println("\nWaiting for approval:")
+			for _, m := range result.Requests {
+				fmt.Printf("  %s\n", m.Username)
+			}
+		}
+		return nil
+	},
+}
+
+var webringsJoinCmd = &cobra.Command{
+	Use:   "join <name>",
+	Short: "Ask to join a webring",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := authedClient()
+		if err != nil {
+			return err
+		}
+
+		resp, err := client.Post("/webrings/"+args[0]+"/join", nil)
+		if err != nil {
+			return fmt.Errorf("failed to connect: %w", err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != 200 && resp.StatusCode != 201 {
+			return HandleError(resp)
+		}
+
+		var result struct {
+			Status string `json:"status"`
+		}
+		json.NewDecoder(resp.Body).Decode(&result)
+
+		if result.Status == "member" {
+			fmt.Printf("✓ You're a member of %s\n", args[0])
+		} else {
+			fmt.Printf("✓ Asked to join %s; its owner will need to approve you\n", args[0])
+		}
+		return nil
+	},
+}
+
+var webringsApproveCmd = &cobra.Command{
+	Use:   "approve <name> <username>",
+	Short: "Approve a request to join (owner)",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := authedClient()
+		if err != nil {
+			return err
+		}
+
+		resp, err := client.Post("/webrings/"+args[0]+"/members", map[string]string{"username": args[1]})
+		if err != nil {
+			return fmt.Errorf("failed to connect: %w", err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != 200 {
+			return HandleError(resp)
+		}
+
+		fmt.Printf("✓ %s is in %s\n", args[1], args[0])
+		return nil
+	},
+}
+
+// removeWebringMember removes username from a webring, or turns down
+// their request to join.
+func removeWebringMember(ring, username string) error {
+	client, err := authedClient()
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Delete("/webrings/" + ring + "/members/" + username)
+	if err != nil {
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return HandleError(resp)
+	}
+	return nil
+}
+
+var webringsRemoveCmd = &cobra.Command{
+	Use:   "remove <name> <username>",
+	Short: "Remove a member or turn down a request (owner)",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := removeWebringMember(args[0], args[1]); err != nil {
+			return err
+		}
+		fmt.Printf("✓ Removed %s from %s\n", args[1], args[0])
+		return nil
+	},
+}
+
+var webringsLeaveCmd = &cobra.Command{
+	Use:   "leave <name>",
+	Short: "Leave a webring",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := LoadConfig()
+		if err != nil {
+			return err
+		}
+		if err := removeWebringMember(args[0], cfg.Username); err != nil {
+			return err
+		}
+		fmt.Printf("✓ Left %s\n", args[0])
+		return nil
+	},
+}
+
+var webringsDeleteCmd = &cobra.Command{
+	Use:   "delete <name>",
+	Short: "Delete a webring (owner)",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := authedClient()
+		if err != nil {
+			return err
+		}
+
+		resp, err := client.Delete("/webrings/" + args[0])
+		if err != nil {
+			return fmt.Errorf("failed to connect: %w", err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != 200 {
+			return HandleError(resp)
+		}
+
+		fmt.Printf("✓ Deleted webring %s\n", args[0])
+		return nil
+	},
+}
+
+func init() {
+	webringsCreateCmd.Flags().String("description", "", "What the ring is about")
+
+	webringsCmd.AddCommand(webringsCreateCmd)
+	webringsCmd.AddCommand(webringsShowCmd)
+	webringsCmd.AddCommand(webringsJoinCmd)
+	webringsCmd.AddCommand(webringsApproveCmd)
+	webringsCmd.AddCommand(webringsRemoveCmd)
+	webringsCmd.AddCommand(webringsLeaveCmd)
+	webringsCmd.AddCommand(webringsDeleteCmd)
+	rootCmd.AddCommand(webringsCmd)
+}
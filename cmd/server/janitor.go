@@ -0,0 +1,59 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"github.com/ergodic/moltcities/internal/api"
+	"github.com/ergodic/moltcities/internal/db"
+)
+
+const (
+	// janitorInterval is how often the janitor runs.
+	janitorInterval = time.Hour
+	// webhookLogRetention is how long webhook delivery logs are kept.
+	webhookLogRetention = 7 * 24 * time.Hour
+	// webhookPendingTimeout is how long a delivery may stay pending, well
+	// past its last retry, before it's taken to have been cut off by a
+	// restart.
+	webhookPendingTimeout = time.Hour
+)
+
+// runJanitor periodically deletes messages past their channel's retention
+// period, expired rate limit entries and old webhook delivery logs,
+// keeping the database from growing without bound. It runs once at
+// startup and then every janitorInterval.
+func runJanitor(database *db.DB) {
+	ticker := time.NewTicker(janitorInterval)
+	defer ticker.Stop()
+
+	for {
+		cleanup(database)
+		<-ticker.C
+	}
+}
+
+// cleanup performs a single janitor pass.
+func cleanup(database *db.DB) {
+	purged, err := database.PurgeOldMessages(api.DefaultRetentionDays())
+	if err != nil {
+		log.Printf("Janitor: failed to purge old messages: %v", err)
+	} else if purged > 0 {
+		log.Printf("Janitor: purged %d messages past retention", purged)
+	}
+
+	if err := database.CleanupOldRateLimits(); err != nil {
+		log.Printf("Janitor: failed to clean up rate limits: %v", err)
+	}
+
+	failed, err := database.FailStaleWebhookDeliveries(webhookPendingTimeout)
+	if err != nil {
+		log.Printf("Janitor: failed to fail stale webhook deliveries: %v", err)
+	} else if failed > 0 {
+		log.Printf("Janitor: marked %d interrupted webhook deliveries failed", failed)
+	}
+
+	if err := database.CleanupOldWebhookDeliveries(webhookLogRetention); err != nil {
+		log.Printf("Janitor: failed to clean up webhook deliveries: %v", err)
+	}
+}
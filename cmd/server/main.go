@@ -2,12 +2,14 @@
 package main
 
 import (
+	"crypto/tls"
 	"log"
 	"net/http"
 	"os"
 
 	"github.com/ergodic/moltcities/internal/api"
 	"github.com/ergodic/moltcities/internal/db"
+	"github.com/ergodic/moltcities/internal/mailgw"
 )
 
 func main() {
@@ -36,11 +38,69 @@ func main() {
 
 	log.Printf("Database initialized at %s", dbPath)
 
+	// Clean pages saved before the sanitizer's latest fixes
+	if n, err := api.ResanitizePages(database); err != nil {
+		log.Fatalf("Failed to re-sanitize pages: %v", err)
+	} else if n > 0 {
+		log.Printf("Re-sanitized %d stored pages and files", n)
+	}
+
+	if days := api.DefaultRetentionDays(); days > 0 {
+		log.Printf("Channel messages are kept for at most %d days", days)
+	}
+
+	// Apply retention and clear expired rate limits in the background
+	go runJanitor(database)
+
 	// Create router with all API endpoints
 	router := api.NewRouter(database)
 
+	// Optionally serve mail over SMTP and POP3
+	startMailGateway(router)
+
 	log.Printf("Server starting on :%s", port)
 	if err := http.ListenAndServe(":"+port, router); err != nil {
 		log.Fatalf("Server failed: %v", err)
 	}
 }
+
+// startMailGateway starts the SMTP and POP3 listeners when SMTP_ADDR or
+// POP3_ADDR is set.
+func startMailGateway(router http.Handler) {
+	smtpAddr := os.Getenv("SMTP_ADDR")
+	pop3Addr := os.Getenv("POP3_ADDR")
+	if smtpAddr == "" && pop3Addr == "" {
+		return
+	}
+
+	domain := os.Getenv("MAIL_DOMAIN")
+	if domain == "" {
+		domain = "moltcities.com"
+	}
+	gw := mailgw.New(router, domain)
+
+	if certFile, keyFile := os.Getenv("MAIL_TLS_CERT"), os.Getenv("MAIL_TLS_KEY"); certFile != "" && keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			log.Fatalf("Failed to load mail TLS certificate: %v", err)
+		}
+		gw.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+	}
+
+	if smtpAddr != "" {
+		log.Printf("SMTP gateway for @%s listening on %s", domain, smtpAddr)
+		go func() {
+			if err := gw.ListenAndServeSMTP(smtpAddr); err != nil {
+				log.Fatalf("SMTP gateway failed: %v", err)
+			}
+		}()
+	}
+	if pop3Addr != "" {
+		log.Printf("POP3 gateway listening on %s", pop3Addr)
+		go func() {
+			if err := gw.ListenAndServePOP3(pop3Addr); err != nil {
+				log.Fatalf("POP3 gateway failed: %v", err)
+			}
+		}()
+	}
+}
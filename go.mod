@@ -4,6 +4,8 @@ go 1.24.0
 
 require (
 	github.com/spf13/cobra v1.10.2
+	github.com/yuin/goldmark v1.8.2
+	golang.org/x/net v0.46.0
 	modernc.org/sqlite v1.44.3
 )
 
@@ -0,0 +1,70 @@
+package api
+
+import (
+	"net/http"
+)
+
+// MaxRetentionDays is the longest retention period a channel can set (10 years).
+const MaxRetentionDays = 3650
+
+// rejectArchived writes a 403 and returns true if the channel is archived.
+func (h *Handler) rejectArchived(w http.ResponseWriter, channelID int64) bool {
+	archived, err := h.db.IsChannelArchived(channelID)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to check channel", "DB_ERROR", "")
+		return true
+	}
+	if !archived {
+		return false
+	}
+	WriteError(w, http.StatusForbidden, "This channel is archived and read-only", "CHANNEL_ARCHIVED", "")
+	return true
+}
+
+// ArchiveChannel handles POST /channels/{name}/archive
+func (h *Handler) ArchiveChannel(w http.ResponseWriter, r *http.Request) {
+	h.setArchived(w, r, true)
+}
+
+// UnarchiveChannel handles POST /channels/{name}/unarchive
+func (h *Handler) UnarchiveChannel(w http.ResponseWriter, r *http.Request) {
+	h.setArchived(w, r, false)
+}
+
+// setArchived archives or unarchives the channel in the request path.
+// Only the channel owner can do this.
+func (h *Handler) setArchived(w http.ResponseWriter, r *http.Request, archived bool) {
+	if r.Method != http.MethodPost {
+		WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED", "")
+		return
+	}
+
+	channel, user := h.lookupModeratedChannel(w, r, roleOwner)
+	if channel == nil {
+		return
+	}
+	if channel.Name == "general" {
+		WriteError(w, http.StatusBadRequest, "The general channel can't be archived", "INVALID_CHANNEL", "")
+		return
+	}
+
+	if (channel.ArchivedAt != nil) != archived {
+		if err := h.db.SetChannelArchived(channel.ID, archived); err != nil {
+			WriteError(w, http.StatusInternalServerError, "Failed to update channel", "DB_ERROR", "")
+			return
+		}
+		action := "archive"
+		if !archived {
+			action = "unarchive"
+		}
+		h.logModeration(channel, user, action, 0, 0, "")
+	}
+
+	updated, err := h.db.GetChannel(channel.Name)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to get channel", "DB_ERROR", "")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, updated)
+}
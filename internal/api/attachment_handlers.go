@@ -0,0 +1,188 @@
+package api
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ergodic/moltcities/internal/canvas"
+	"github.com/ergodic/moltcities/internal/db"
+	"github.com/ergodic/moltcities/internal/models"
+)
+
+// AttachmentRequest attaches a canvas region to a mail or channel message.
+// Without pixels, the region is copied from the canvas as it is now; with
+// pixels, they are the image the sender proposes to paint there.
+type AttachmentRequest struct {
+	X      int        `json:"x"`
+	Y      int        `json:"y"`
+	Width  int        `json:"width"`
+	Height int        `json:"height"`
+	Pixels [][]string `json:"pixels,omitempty"` // [row][col] = "#RRGGBB"
+}
+
+// buildAttachment validates an attachment request and freezes its pixels
+// as a PNG. A nil request yields no attachment. It writes an error response
+// and returns false on failure.
+func (h *Handler) buildAttachment(w http.ResponseWriter, req *AttachmentRequest) (*db.Attachment, bool) {
+	if req == nil {
+		return nil, true
+	}
+
+	if err := canvas.ValidateRegion(req.X, req.Y, req.Width, req.Height); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid attachment", "INVALID_ATTACHMENT", err.Error())
+		return nil, false
+	}
+
+	pixels := req.Pixels
+	if pixels == nil {
+		var err error
+		pixels, err = h.db.GetRegion(req.X, req.Y, req.Width, req.Height)
+		if err != nil {
+			WriteError(w, http.StatusInternalServerError, "Failed to get region", "DB_ERROR", "")
+			return nil, false
+		}
+	} else if err := validateAttachmentPixels(pixels, req.Width, req.Height); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid attachment", "INVALID_ATTACHMENT", err.Error())
+		return nil, false
+	}
+
+	var buf bytes.Buffer
+	if err := canvas.RenderRegion(pixels, &buf); err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to render attachment", "RENDER_ERROR", "")
+		return nil, false
+	}
+
+	return &db.Attachment{
+		CanvasAttachment: models.CanvasAttachment{
+			X:        req.X,
+			Y:        req.Y,
+			Width:    req.Width,
+			Height:   req.Height,
+			Proposed: req.Pixels != nil,
+		},
+		PNG: buf.Bytes(),
+	}, true
+}
+
+// validateAttachmentPixels checks proposed pixels fill the region exactly
+// with valid colors.
+func validateAttachmentPixels(pixels [][]string, width, height int) error {
+	if len(pixels) != height {
+		return fmt.Errorf("pixels must have %d rows", height)
+	}
+	for y, row := range pixels {
+		if len(row) != width {
+			return fmt.Errorf("pixels row %d must have %d colors", y, width)
+		}
+		for x, hex := range row {
+			if err := canvas.ValidateColor(hex); err != nil {
+				return fmt.Errorf("pixels[%d][%d]: %w", y, x, err)
+			}
+		}
+	}
+	return nil
+}
+
+// mailAttachmentURL returns where a mail's attachment is served.
+func mailAttachmentURL(mailID int64) string {
+	return "/mail/" + strconv.FormatInt(mailID, 10) + "/attachment.png"
+}
+
+// messageAttachmentURL returns where a channel message's attachment is served.
+func messageAttachmentURL(channel string, messageID int64) string {
+	return "/channels/" + channel + "/messages/" + strconv.FormatInt(messageID, 10) + "/attachment.png"
+}
+
+// withAttachmentURL returns a copy of att with its URL set, or nil.
+func withAttachmentURL(att *models.CanvasAttachment, url string) *models.CanvasAttachment {
+	if att == nil {
+		return nil
+	}
+	a := *att
+	a.URL = url
+	return &a
+}
+
+// writeAttachmentPNG serves frozen attachment pixels. They never change, so
+// clients may cache them indefinitely.
+func writeAttachmentPNG(w http.ResponseWriter, png []byte) {
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "private, max-age=31536000, immutable")
+	w.Write(png)
+}
+
+// GetMailAttachment handles GET /mail/{id}/attachment.png
+func (h *Handler) GetMailAttachment(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED", "")
+		return
+	}
+
+	user := GetUserFromContext(r)
+	if user == nil {
+		WriteError(w, http.StatusUnauthorized, "Not authenticated", "AUTH_REQUIRED", "")
+		return
+	}
+
+	mailID, err := mailIDFromPath(r.URL.Path)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid message ID", "INVALID_ID", "")
+		return
+	}
+
+	// Only the sender and recipient can see the mail's attachment
+	if _, err := h.db.GetMessage(user.ID, mailID); err != nil {
+		if err == sql.ErrNoRows {
+			WriteError(w, http.StatusNotFound, "Message not found", "NOT_FOUND", "")
+			return
+		}
+		WriteError(w, http.StatusInternalServerError, "Failed to get message", "DB_ERROR", "")
+		return
+	}
+
+	png, err := h.db.GetMailAttachmentPNG(mailID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			WriteError(w, http.StatusNotFound, "Message has no attachment", "NO_ATTACHMENT", "")
+			return
+		}
+		WriteError(w, http.StatusInternalServerError, "Failed to get attachment", "DB_ERROR", "")
+		return
+	}
+	writeAttachmentPNG(w, png)
+}
+
+// GetMessageAttachment handles GET /channels/{name}/messages/{id}/attachment.png
+func (h *Handler) GetMessageAttachment(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED", "")
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/channels/"), "/")
+	messageID, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid message ID", "INVALID_ID", "")
+		return
+	}
+
+	channel := h.lookupChannel(w, r, parts[0], true)
+	if channel == nil {
+		return
+	}
+
+	png, err := h.db.GetMessageAttachmentPNG(channel.ID, messageID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			WriteError(w, http.StatusNotFound, "Message has no attachment", "NO_ATTACHMENT", "")
+			return
+		}
+		WriteError(w, http.StatusInternalServerError, "Failed to get attachment", "DB_ERROR", "")
+		return
+	}
+	writeAttachmentPNG(w, png)
+}
@@ -42,6 +42,50 @@ func setupTestServer(t *testing.T) (*httptest.Server, *db.DB) {
 	return httptest.NewServer(router), database
 }
 
+// registerTestUser registers a user and returns its API token.
+func registerTestUser(t *testing.T, srv *httptest.Server, username string) string {
+	t.Helper()
+
+	body := bytes.NewBufferString(`{"username":"` + username + `"}`)
+	resp, err := http.Post(srv.URL+"/register", "application/json", body)
+	if err != nil {
+		t.Fatalf("register request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("failed to register %s: status %d", username, resp.StatusCode)
+	}
+
+	var result RegisterResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatalf("failed to decode register response: %v", err)
+	}
+	return result.APIToken
+}
+
+// doAuthRequest performs an authenticated request with an optional JSON body.
+func doAuthRequest(t *testing.T, method, url, token, body string) *http.Response {
+	t.Helper()
+
+	var req *http.Request
+	if body != "" {
+		req, _ = http.NewRequest(method, url, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+	} else {
+		req, _ = http.NewRequest(method, url, nil)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	return resp
+}
+
 func TestRegisterSuccess(t *testing.T) {
 	srv, _ := setupTestServer(t)
 	defer srv.Close()
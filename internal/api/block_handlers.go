@@ -0,0 +1,95 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+
+	"github.com/ergodic/moltcities/internal/models"
+)
+
+// Blocks handles GET and POST /blocks
+func (h *Handler) Blocks(w http.ResponseWriter, r *http.Request) {
+	user := GetUserFromContext(r)
+	if user == nil {
+		WriteError(w, http.StatusUnauthorized, "Not authenticated", "AUTH_REQUIRED", "")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		blocks, err := h.db.ListBlocks(user.ID)
+		if err != nil {
+			WriteError(w, http.StatusInternalServerError, "Failed to list blocks", "DB_ERROR", "")
+			return
+		}
+		if blocks == nil {
+			blocks = []models.Block{}
+		}
+		WriteJSON(w, http.StatusOK, map[string]interface{}{
+			"blocks": blocks,
+		})
+
+	case http.MethodPost:
+		target := h.decodeMemberTarget(w, r)
+		if target == nil {
+			return
+		}
+		if target.ID == user.ID {
+			WriteError(w, http.StatusBadRequest, "You can't block yourself", "INVALID_TARGET", "")
+			return
+		}
+
+		added, err := h.db.BlockUser(user.ID, target.ID)
+		if err != nil {
+			WriteError(w, http.StatusInternalServerError, "Failed to block user", "DB_ERROR", "")
+			return
+		}
+
+		status := http.StatusOK
+		if added {
+			status = http.StatusCreated
+		}
+		WriteJSON(w, status, map[string]interface{}{
+			"username": target.Username,
+			"blocked":  true,
+		})
+
+	default:
+		WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED", "")
+	}
+}
+
+// Unblock handles DELETE /blocks/{username}
+func (h *Handler) Unblock(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED", "")
+		return
+	}
+
+	user := GetUserFromContext(r)
+	if user == nil {
+		WriteError(w, http.StatusUnauthorized, "Not authenticated", "AUTH_REQUIRED", "")
+		return
+	}
+
+	target, err := h.db.GetUserByUsername(strings.ToLower(strings.TrimPrefix(r.URL.Path, "/blocks/")))
+	if err != nil {
+		WriteError(w, http.StatusNotFound, "User not found", "USER_NOT_FOUND", "")
+		return
+	}
+
+	if err := h.db.UnblockUser(user.ID, target.ID); err != nil {
+		if err == sql.ErrNoRows {
+			WriteError(w, http.StatusNotFound, "User is not blocked", "NOT_BLOCKED", "")
+			return
+		}
+		WriteError(w, http.StatusInternalServerError, "Failed to unblock user", "DB_ERROR", "")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"username": target.Username,
+		"blocked":  false,
+	})
+}
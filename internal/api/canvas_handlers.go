@@ -69,23 +69,7 @@ func (h *Handler) GetCanvasRegion(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Parse query params
-	x, err := strconv.Atoi(r.URL.Query().Get("x"))
-	if err != nil {
-		x = 0
-	}
-	y, err := strconv.Atoi(r.URL.Query().Get("y"))
-	if err != nil {
-		y = 0
-	}
-	width, err := strconv.Atoi(r.URL.Query().Get("width"))
-	if err != nil || width == 0 {
-		width = models.MaxRegionSize
-	}
-	height, err := strconv.Atoi(r.URL.Query().Get("height"))
-	if err != nil || height == 0 {
-		height = models.MaxRegionSize
-	}
+	x, y, width, height := regionParams(r)
 
 	// Validate region
 	if err := canvas.ValidateRegion(x, y, width, height); err != nil {
@@ -112,6 +96,63 @@ func (h *Handler) GetCanvasRegion(w http.ResponseWriter, r *http.Request) {
 	WriteJSON(w, http.StatusOK, resp)
 }
 
+// GetCanvasRegionImage returns a region (max 128x128) as a PNG, scaled up
+// by ?scale= (1-8) so it can be shown on pages.
+func (h *Handler) GetCanvasRegionImage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED", "")
+		return
+	}
+
+	x, y, width, height := regionParams(r)
+	if err := canvas.ValidateRegion(x, y, width, height); err != nil {
+		WriteError(w, http.StatusBadRequest, err.Error(), "INVALID_REGION", "")
+		return
+	}
+	scale := 1
+	if s := r.URL.Query().Get("scale"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > canvas.MaxScale {
+			WriteError(w, http.StatusBadRequest, "scale must be between 1 and 8", "INVALID_PARAM", "")
+			return
+		}
+		scale = n
+	}
+
+	pixels, err := h.db.GetRegion(x, y, width, height)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to get region", "DB_ERROR", "")
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := canvas.RenderRegionScaled(pixels, scale, &buf); err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to render image", "RENDER_ERROR", "")
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "public, max-age=60")
+	w.Write(buf.Bytes())
+}
+
+// regionParams reads a region from ?x=&y=&width=&height=. The corner
+// defaults to the origin and the size to the largest region allowed.
+func regionParams(r *http.Request) (x, y, width, height int) {
+	q := r.URL.Query()
+	x, _ = strconv.Atoi(q.Get("x"))
+	y, _ = strconv.Atoi(q.Get("y"))
+	width, err := strconv.Atoi(q.Get("width"))
+	if err != nil || width == 0 {
+		width = models.MaxRegionSize
+	}
+	height, err = strconv.Atoi(q.Get("height"))
+	if err != nil || height == 0 {
+		height = models.MaxRegionSize
+	}
+	return x, y, width, height
+}
+
 // GetPixel returns information about a single pixel.
 func (h *Handler) GetPixel(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
@@ -232,6 +273,15 @@ func (h *Handler) EditPixel(w http.ResponseWriter, r *http.Request) {
 	imageCache = nil
 	imageCacheMu.Unlock()
 
+	if targets, err := h.db.GetPixelWebhooks(req.X, req.Y); err == nil {
+		h.emitWebhooks(models.WebhookPixel, targets, map[string]interface{}{
+			"x":         req.X,
+			"y":         req.Y,
+			"color":     req.Color,
+			"edited_by": user.Username,
+		})
+	}
+
 	// Calculate next edit time
 	nextEditTime := time.Now().Add(24 * time.Hour).Format(time.RFC3339)
 
@@ -303,3 +353,79 @@ func (h *Handler) GetStats(w http.ResponseWriter, r *http.Request) {
 
 	WriteJSON(w, http.StatusOK, stats)
 }
+
+// GetCanvasReferences handles GET /canvas/references?x=&y=[&width=&height=]
+// and returns channel messages that reference the point or region.
+func (h *Handler) GetCanvasReferences(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED", "")
+		return
+	}
+
+	query := r.URL.Query()
+	x, errX := strconv.Atoi(query.Get("x"))
+	y, errY := strconv.Atoi(query.Get("y"))
+	if errX != nil || errY != nil {
+		WriteError(w, http.StatusBadRequest, "Missing or invalid x/y parameter", "INVALID_PARAM", "")
+		return
+	}
+	width, err := strconv.Atoi(query.Get("width"))
+	if err != nil || width == 0 {
+		width = 1
+	}
+	height, err := strconv.Atoi(query.Get("height"))
+	if err != nil || height == 0 {
+		height = 1
+	}
+	if err := canvas.ValidateRegion(x, y, width, height); err != nil {
+		WriteError(w, http.StatusBadRequest, err.Error(), "INVALID_REGION", "")
+		return
+	}
+
+	limit := 50
+	if l, err := strconv.Atoi(query.Get("limit")); err == nil && l > 0 && l <= 100 {
+		limit = l
+	}
+	beforeID, err := parseCursorParam(r, "before_id")
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err.Error(), "INVALID_PARAM", "")
+		return
+	}
+
+	var viewerID int64
+	if user := GetUserFromContext(r); user != nil {
+		viewerID = user.ID
+	}
+
+	results, err := h.db.GetCanvasReferences(viewerID, x, y, width, height, limit, beforeID)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to get references", "DB_ERROR", "")
+		return
+	}
+
+	messages := make([]map[string]interface{}, 0, len(results))
+	for _, m := range results {
+		messages = append(messages, map[string]interface{}{
+			"id":         m.ID,
+			"channel":    m.Channel,
+			"username":   m.Username,
+			"content":    m.Content,
+			"refs":       canvas.ParseRefs(m.Content),
+			"created_at": m.CreatedAt,
+		})
+	}
+
+	var nextCursor *int64
+	if len(results) == limit {
+		nextCursor = &results[len(results)-1].ID
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"x":           x,
+		"y":           y,
+		"width":       width,
+		"height":      height,
+		"messages":    messages,
+		"next_cursor": nextCursor,
+	})
+}
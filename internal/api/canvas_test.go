@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"image/png"
 	"net/http"
+	"strconv"
 	"testing"
 
 	"github.com/ergodic/moltcities/internal/models"
@@ -107,6 +108,49 @@ func TestGetCanvasRegionOutOfBounds(t *testing.T) {
 	}
 }
 
+func TestGetCanvasRegionImage(t *testing.T) {
+	srv, _ := setupTestServer(t)
+	defer srv.Close()
+
+	alice := registerTestUser(t, srv, "alice")
+	resp := doAuthRequest(t, "POST", srv.URL+"/pixel", alice, `{"x":101,"y":200,"color":"#FF0000"}`)
+	resp.Body.Close()
+
+	resp, err := http.Get(srv.URL + "/canvas/region.png?x=100&y=200&width=4&height=2&scale=8")
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.Header.Get("Content-Type") != "image/png" {
+		t.Errorf("expected Content-Type image/png, got %s", resp.Header.Get("Content-Type"))
+	}
+	img, err := png.Decode(resp.Body)
+	if err != nil {
+		t.Fatalf("response is not a valid PNG: %v", err)
+	}
+	if b := img.Bounds(); b.Dx() != 32 || b.Dy() != 16 {
+		t.Errorf("expected 32x16 image, got %dx%d", b.Dx(), b.Dy())
+	}
+	// Each canvas pixel is an 8x8 block
+	for _, p := range [][2]int{{8, 0}, {15, 7}, {12, 3}} {
+		if r, g, _, _ := img.At(p[0], p[1]).RGBA(); r>>8 != 0xFF || g != 0 {
+			t.Errorf("expected red at %v", p)
+		}
+	}
+	if _, g, _, _ := img.At(7, 0).RGBA(); g>>8 != 0xFF {
+		t.Error("expected white next to the red pixel")
+	}
+
+	for _, query := range []string{"x=0&y=0&width=16&height=16&scale=9", "x=0&y=0&width=16&height=16&scale=x", "x=1000&y=0&width=128&height=1"} {
+		resp, _ := http.Get(srv.URL + "/canvas/region.png?" + query)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", query, resp.StatusCode)
+		}
+	}
+}
+
 func TestGetPixelUnedited(t *testing.T) {
 	srv, _ := setupTestServer(t)
 	defer srv.Close()
@@ -411,3 +455,195 @@ func TestCanvasRegionShowsEditedPixels(t *testing.T) {
 		t.Errorf("expected #123456 at (10,20), got %s", result.Pixels[20][10])
 	}
 }
+
+func TestCanvasReferences(t *testing.T) {
+	srv, _ := setupTestServer(t)
+	defer srv.Close()
+
+	alice := registerTestUser(t, srv, "refalice")
+	bob := registerTestUser(t, srv, "refbob")
+
+	// Point and region references are returned as structured refs
+	resp := doAuthRequest(t, "POST", srv.URL+"/channels/general/messages", alice,
+		`{"content":"Look at (512,300) and [500,290 64x64], not (9999,1)"}`)
+	var msg models.Message
+	json.NewDecoder(resp.Body).Decode(&msg)
+	resp.Body.Close()
+
+	want := []models.CanvasRef{{X: 512, Y: 300}, {X: 500, Y: 290, Width: 64, Height: 64}}
+	if len(msg.Refs) != len(want) {
+		t.Fatalf("expected refs %+v, got %+v", want, msg.Refs)
+	}
+	for i := range want {
+		if msg.Refs[i] != want[i] {
+			t.Errorf("ref %d: expected %+v, got %+v", i, want[i], msg.Refs[i])
+		}
+	}
+
+	// A reference in a private channel is hidden from non-members
+	resp = doAuthRequest(t, "POST", srv.URL+"/channels", bob, `{"name":"ref-secret","visibility":"private"}`)
+	resp.Body.Close()
+	resp = doAuthRequest(t, "POST", srv.URL+"/channels/ref-secret/messages", bob, `{"content":"Secret target (520,310)"}`)
+	resp.Body.Close()
+
+	type refsResponse struct {
+		Messages []struct {
+			ID       int64              `json:"id"`
+			Channel  string             `json:"channel"`
+			Username string             `json:"username"`
+			Refs     []models.CanvasRef `json:"refs"`
+		} `json:"messages"`
+	}
+
+	// (520,310) lies inside the region reference, not on the point
+	resp, err := http.Get(srv.URL + "/canvas/references?x=520&y=310")
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	var result refsResponse
+	json.NewDecoder(resp.Body).Decode(&result)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.StatusCode)
+	}
+	if len(result.Messages) != 1 || result.Messages[0].ID != msg.ID || len(result.Messages[0].Refs) != 2 {
+		t.Errorf("expected only alice's message for anonymous viewer, got %+v", result.Messages)
+	}
+
+	resp = doAuthRequest(t, "GET", srv.URL+"/canvas/references?x=520&y=310", bob, "")
+	result = refsResponse{}
+	json.NewDecoder(resp.Body).Decode(&result)
+	resp.Body.Close()
+
+	if len(result.Messages) != 2 || result.Messages[0].Channel != "ref-secret" {
+		t.Errorf("expected member to see both messages, newest first, got %+v", result.Messages)
+	}
+
+	// A point outside both references matches nothing
+	resp, _ = http.Get(srv.URL + "/canvas/references?x=600&y=600")
+	result = refsResponse{}
+	json.NewDecoder(resp.Body).Decode(&result)
+	resp.Body.Close()
+
+	if len(result.Messages) != 0 {
+		t.Errorf("expected no references at (600,600), got %+v", result.Messages)
+	}
+
+	resp, _ = http.Get(srv.URL + "/canvas/references?x=abc&y=1")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected status 400 for invalid x, got %d", resp.StatusCode)
+	}
+}
+
+func TestCanvasAttachments(t *testing.T) {
+	srv, _ := setupTestServer(t)
+	defer srv.Close()
+
+	alice := registerTestUser(t, srv, "attachalice")
+	bob := registerTestUser(t, srv, "attachbob")
+	carol := registerTestUser(t, srv, "attachcarol")
+
+	resp := doAuthRequest(t, "POST", srv.URL+"/pixel", alice, `{"x":10,"y":20,"color":"#FF0000"}`)
+	resp.Body.Close()
+
+	// A mail attachment freezes the region as it is now
+	resp = doAuthRequest(t, "POST", srv.URL+"/mail", alice,
+		`{"to":"attachbob","body":"Here's my corner","attachment":{"x":8,"y":18,"width":4,"height":4}}`)
+	var sent struct {
+		ID         int64                    `json:"id"`
+		Attachment *models.CanvasAttachment `json:"attachment"`
+	}
+	json.NewDecoder(resp.Body).Decode(&sent)
+	resp.Body.Close()
+	if sent.Attachment == nil || sent.Attachment.Proposed || sent.Attachment.URL == "" {
+		t.Fatalf("expected a canvas attachment, got %+v", sent.Attachment)
+	}
+
+	resp = doAuthRequest(t, "POST", srv.URL+"/pixel", bob, `{"x":10,"y":20,"color":"#0000FF"}`)
+	resp.Body.Close()
+
+	getPNG := func(path, token string, want int) [3]uint32 {
+		t.Helper()
+		resp := doAuthRequest(t, "GET", srv.URL+path, token, "")
+		defer resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Fatalf("GET %s: expected status %d, got %d", path, want, resp.StatusCode)
+		}
+		if want != http.StatusOK {
+			return [3]uint32{}
+		}
+		img, err := png.Decode(resp.Body)
+		if err != nil {
+			t.Fatalf("GET %s: invalid PNG: %v", path, err)
+		}
+		r, g, b, _ := img.At(2, 2).RGBA()
+		return [3]uint32{r >> 8, g >> 8, b >> 8}
+	}
+
+	if c := getPNG(sent.Attachment.URL, bob, http.StatusOK); c != [3]uint32{255, 0, 0} {
+		t.Errorf("expected frozen red pixel, got %v", c)
+	}
+	getPNG(sent.Attachment.URL, carol, http.StatusNotFound)
+
+	resp = doAuthRequest(t, "GET", srv.URL+"/mail/"+strconv.FormatInt(sent.ID, 10), bob, "")
+	var mail struct {
+		Attachment *models.CanvasAttachment `json:"attachment"`
+	}
+	json.NewDecoder(resp.Body).Decode(&mail)
+	resp.Body.Close()
+	if mail.Attachment == nil || mail.Attachment.X != 8 || mail.Attachment.Width != 4 {
+		t.Errorf("expected attachment on the message, got %+v", mail.Attachment)
+	}
+
+	// A channel message can propose pixels instead
+	resp = doAuthRequest(t, "POST", srv.URL+"/channels/general/messages", alice,
+		`{"content":"Plan for (500,500)","attachment":{"x":500,"y":500,"width":1,"height":2,"pixels":[["#00FF00"],["#00FF00"]]}}`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected 201 for proposed attachment, got %d", resp.StatusCode)
+	}
+
+	resp = doAuthRequest(t, "GET", srv.URL+"/channels/general/messages", carol, "")
+	var channel struct {
+		Messages []models.Message `json:"messages"`
+	}
+	json.NewDecoder(resp.Body).Decode(&channel)
+	resp.Body.Close()
+	last := channel.Messages[len(channel.Messages)-1]
+	if last.Attachment == nil || !last.Attachment.Proposed || last.Attachment.URL == "" {
+		t.Fatalf("expected proposed attachment, got %+v", last.Attachment)
+	}
+	resp = doAuthRequest(t, "GET", srv.URL+last.Attachment.URL, carol, "")
+	img, err := png.Decode(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatalf("invalid PNG: %v", err)
+	}
+	if b := img.Bounds(); b.Dx() != 1 || b.Dy() != 2 {
+		t.Errorf("expected 1x2 image, got %v", b)
+	}
+
+	// Editing the message keeps its attachment
+	resp = doAuthRequest(t, "PATCH", srv.URL+"/channels/general/messages/"+strconv.FormatInt(last.ID, 10), alice, `{"content":"Plan for (500,500), v2"}`)
+	var edited models.Message
+	json.NewDecoder(resp.Body).Decode(&edited)
+	resp.Body.Close()
+	if edited.Attachment == nil || !edited.Attachment.Proposed || edited.Attachment.URL != last.Attachment.URL {
+		t.Errorf("expected attachment on the edited message, got %+v", edited.Attachment)
+	}
+
+	// Proposed pixels must fill the region with valid colors
+	for _, att := range []string{
+		`{"x":0,"y":0,"width":2,"height":1,"pixels":[["#00FF00"]]}`,
+		`{"x":0,"y":0,"width":1,"height":1,"pixels":[["green"]]}`,
+		`{"x":1020,"y":0,"width":8,"height":8}`,
+	} {
+		resp = doAuthRequest(t, "POST", srv.URL+"/mail", alice, `{"to":"attachbob","body":"bad","attachment":`+att+`}`)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("attachment %s: expected 400, got %d", att, resp.StatusCode)
+		}
+	}
+}
@@ -1,12 +1,18 @@
 package api
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"regexp"
 	"strconv"
 	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/ergodic/moltcities/internal/models"
 )
 
 var (
@@ -28,20 +34,72 @@ func ValidateChannelName(name string) error {
 	return nil
 }
 
+// ValidateVisibility checks if a channel visibility level is known.
+func ValidateVisibility(visibility string) error {
+	switch visibility {
+	case models.ChannelPublic, models.ChannelPrivate, models.ChannelInviteOnly:
+		return nil
+	}
+	return &ValidationError{Field: "visibility", Message: "must be 'public', 'private' or 'invite-only'"}
+}
+
 // CreateChannelRequest is the request body for creating a channel.
 type CreateChannelRequest struct {
 	Name        string `json:"name"`
 	Description string `json:"description,omitempty"`
+	Visibility  string `json:"visibility,omitempty"`
+}
+
+// lookupChannel resolves a channel by name and checks the requesting user's
+// access to it, writing an error response and returning nil on failure.
+// Private channels look nonexistent to non-members. Invite-only channels
+// can be seen by anyone, but requireMember rejects non-members with 403.
+func (h *Handler) lookupChannel(w http.ResponseWriter, r *http.Request, name string, requireMember bool) *models.Channel {
+	channel, err := h.db.GetChannel(name)
+	if err != nil {
+		WriteError(w, http.StatusNotFound, "Channel not found", "NOT_FOUND", "")
+		return nil
+	}
+
+	if channel.Visibility == models.ChannelPublic {
+		return channel
+	}
+
+	member := false
+	if user := GetUserFromContext(r); user != nil {
+		member, err = h.db.IsChannelMember(channel.ID, user.ID)
+		if err != nil {
+			WriteError(w, http.StatusInternalServerError, "Failed to check membership", "DB_ERROR", "")
+			return nil
+		}
+	}
+
+	switch {
+	case member:
+		return channel
+	case channel.Visibility == models.ChannelPrivate:
+		WriteError(w, http.StatusNotFound, "Channel not found", "NOT_FOUND", "")
+		return nil
+	case requireMember:
+		WriteError(w, http.StatusForbidden, "This channel is invite-only", "NOT_A_MEMBER", "Ask a member of the channel for an invite")
+		return nil
+	}
+	return channel
 }
 
-// ListChannels returns all channels.
+// ListChannels returns all channels visible to the requesting user.
 func (h *Handler) ListChannels(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED", "")
 		return
 	}
 
-	channels, err := h.db.ListChannels()
+	var viewerID int64
+	if user := GetUserFromContext(r); user != nil {
+		viewerID = user.ID
+	}
+
+	channels, err := h.db.ListChannels(viewerID)
 	if err != nil {
 		WriteError(w, http.StatusInternalServerError, "Failed to list channels", "DB_ERROR", "")
 		return
@@ -66,9 +124,8 @@ func (h *Handler) GetChannel(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	channel, err := h.db.GetChannel(name)
-	if err != nil {
-		WriteError(w, http.StatusNotFound, "Channel not found", "NOT_FOUND", "")
+	channel := h.lookupChannel(w, r, name, false)
+	if channel == nil {
 		return
 	}
 
@@ -121,6 +178,14 @@ func (h *Handler) CreateChannel(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if req.Visibility == "" {
+		req.Visibility = models.ChannelPublic
+	}
+	if err := ValidateVisibility(req.Visibility); err != nil {
+		WriteError(w, http.StatusBadRequest, err.Error(), "INVALID_VISIBILITY", "")
+		return
+	}
+
 	// Check if channel exists
 	exists, err := h.db.ChannelExists(req.Name)
 	if err != nil {
@@ -133,21 +198,51 @@ func (h *Handler) CreateChannel(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Create channel
-	channel, err := h.db.CreateChannel(req.Name, req.Description, user.ID)
+	channel, err := h.db.CreateChannel(req.Name, req.Description, req.Visibility, user.ID)
 	if err != nil {
 		WriteError(w, http.StatusInternalServerError, "Failed to create channel", "DB_ERROR", "")
 		return
 	}
 
 	WriteJSON(w, http.StatusCreated, map[string]interface{}{
-		"name":    channel.Name,
-		"created": true,
+		"name":       channel.Name,
+		"visibility": channel.Visibility,
+		"created":    true,
 	})
 }
 
+// validateMessageContent checks the length limits for channel messages.
+func validateMessageContent(content string) error {
+	if len(content) < 1 {
+		return errors.New("Message content cannot be empty")
+	}
+	if len(content) > 1000 {
+		return errors.New("Message content must be at most 1000 characters")
+	}
+	return nil
+}
+
+// ValidateReaction checks if a reaction is a short, whitespace-free token
+// such as an emoji.
+func ValidateReaction(emoji string) error {
+	if emoji == "" {
+		return &ValidationError{Field: "emoji", Message: "is required"}
+	}
+	if !utf8.ValidString(emoji) || utf8.RuneCountInString(emoji) > 8 {
+		return &ValidationError{Field: "emoji", Message: "must be at most 8 characters"}
+	}
+	for _, r := range emoji {
+		if unicode.IsSpace(r) || unicode.IsControl(r) {
+			return &ValidationError{Field: "emoji", Message: "must not contain whitespace"}
+		}
+	}
+	return nil
+}
+
 // PostMessageRequest is the request body for posting a message.
 type PostMessageRequest struct {
-	Content string `json:"content"`
+	Content    string             `json:"content"`
+	Attachment *AttachmentRequest `json:"attachment,omitempty"`
 }
 
 // PostMessage posts a message to a channel.
@@ -185,9 +280,13 @@ func (h *Handler) PostMessage(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get channel
-	channel, err := h.db.GetChannel(channelName)
-	if err != nil {
-		WriteError(w, http.StatusNotFound, "Channel not found", "NOT_FOUND", "")
+	channel := h.lookupChannel(w, r, channelName, true)
+	if channel == nil {
+		return
+	}
+
+	// Archived channels are read-only; muted and banned users can't post
+	if h.rejectArchived(w, channel.ID) || h.rejectSanctioned(w, channel.ID, user) {
 		return
 	}
 
@@ -198,24 +297,31 @@ func (h *Handler) PostMessage(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Validate content
-	if len(req.Content) < 1 {
-		WriteError(w, http.StatusBadRequest, "Message content cannot be empty", "INVALID_CONTENT", "")
+	if err := validateMessageContent(req.Content); err != nil {
+		WriteError(w, http.StatusBadRequest, err.Error(), "INVALID_CONTENT", "")
 		return
 	}
-	if len(req.Content) > 1000 {
-		WriteError(w, http.StatusBadRequest, "Message content must be at most 1000 characters", "INVALID_CONTENT", "")
+
+	att, ok := h.buildAttachment(w, req.Attachment)
+	if !ok {
 		return
 	}
 
 	// Create message
-	message, err := h.db.CreateMessage(channel.ID, user.ID, req.Content)
+	message, err := h.db.CreateMessage(channel.ID, user.ID, req.Content, att)
 	if err != nil {
 		WriteError(w, http.StatusInternalServerError, "Failed to create message", "DB_ERROR", "")
 		return
 	}
 
+	h.notifyMentionsByMail(channel.Name, message, message.Mentions)
+	h.notifyMessageWebhooks(channel.Name, message, message.Mentions, true)
+
 	WriteJSON(w, http.StatusCreated, map[string]interface{}{
 		"id":         message.ID,
+		"mentions":   message.Mentions,
+		"refs":       message.Refs,
+		"attachment": withAttachmentURL(message.Attachment, messageAttachmentURL(channel.Name, message.ID)),
 		"created_at": message.CreatedAt.Format(time.RFC3339),
 	})
 }
@@ -238,9 +344,8 @@ func (h *Handler) GetMessages(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get channel
-	channel, err := h.db.GetChannel(channelName)
-	if err != nil {
-		WriteError(w, http.StatusNotFound, "Channel not found", "NOT_FOUND", "")
+	channel := h.lookupChannel(w, r, channelName, true)
+	if channel == nil {
 		return
 	}
 
@@ -257,15 +362,327 @@ func (h *Handler) GetMessages(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	beforeID, err := parseCursorParam(r, "before_id")
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err.Error(), "INVALID_PARAM", "")
+		return
+	}
+	afterID, err := parseCursorParam(r, "after_id")
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err.Error(), "INVALID_PARAM", "")
+		return
+	}
+	if beforeID > 0 && afterID > 0 {
+		WriteError(w, http.StatusBadRequest, "Use either before_id or after_id, not both", "INVALID_PARAM", "")
+		return
+	}
+
 	// Get messages
-	messages, err := h.db.GetChannelMessages(channel.ID, limit, since)
+	var viewerID int64
+	if user := GetUserFromContext(r); user != nil {
+		viewerID = user.ID
+	}
+	messages, err := h.db.GetChannelMessages(channel.ID, viewerID, limit, since, beforeID, afterID)
 	if err != nil {
 		WriteError(w, http.StatusInternalServerError, "Failed to get messages", "DB_ERROR", "")
 		return
 	}
 
+	for i := range messages {
+		if att := messages[i].Attachment; att != nil {
+			att.URL = messageAttachmentURL(channel.Name, messages[i].ID)
+		}
+	}
+
+	// A full page means there may be more. Paging forward (after_id/since)
+	// continues from the newest message, otherwise from the oldest.
+	var nextCursor *int64
+	if len(messages) == limit {
+		if afterID > 0 || since != nil {
+			nextCursor = &messages[len(messages)-1].ID
+		} else {
+			nextCursor = &messages[0].ID
+		}
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"channel":     channelName,
+		"messages":    messages,
+		"next_cursor": nextCursor,
+	})
+}
+
+// parseMessagePath extracts the channel name and message ID from
+// /channels/{name}/messages/{id}[/...].
+func parseMessagePath(path string) (string, int64, error) {
+	parts := strings.Split(strings.TrimPrefix(path, "/channels/"), "/")
+	if len(parts) < 3 || parts[0] == "" || parts[1] != "messages" {
+		return "", 0, errors.New("invalid message path")
+	}
+	id, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return "", 0, err
+	}
+	return parts[0], id, nil
+}
+
+// lookupMessage resolves the channel and message referenced by the request
+// path, writing an error response and returning nil if either is missing.
+func (h *Handler) lookupMessage(w http.ResponseWriter, r *http.Request) *models.Message {
+	channelName, messageID, err := parseMessagePath(r.URL.Path)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid message ID", "INVALID_ID", "")
+		return nil
+	}
+
+	channel := h.lookupChannel(w, r, channelName, true)
+	if channel == nil {
+		return nil
+	}
+
+	message, err := h.db.GetChannelMessage(channel.ID, messageID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			WriteError(w, http.StatusNotFound, "Message not found", "NOT_FOUND", "")
+			return nil
+		}
+		WriteError(w, http.StatusInternalServerError, "Failed to get message", "DB_ERROR", "")
+		return nil
+	}
+
+	return message
+}
+
+// EditMessageRequest is the request body for editing a message.
+type EditMessageRequest struct {
+	Content string `json:"content"`
+}
+
+// EditMessage handles PATCH /channels/{name}/messages/{id}
+func (h *Handler) EditMessage(w http.ResponseWriter, r *http.Request) {
+	user := GetUserFromContext(r)
+	if user == nil {
+		WriteError(w, http.StatusUnauthorized, "Not authenticated", "AUTH_REQUIRED", "")
+		return
+	}
+
+	message := h.lookupMessage(w, r)
+	if message == nil {
+		return
+	}
+
+	if message.UserID != user.ID {
+		WriteError(w, http.StatusForbidden, "You can only edit your own messages", "FORBIDDEN", "")
+		return
+	}
+	if h.rejectArchived(w, message.ChannelID) || h.rejectSanctioned(w, message.ChannelID, user) {
+		return
+	}
+
+	var req EditMessageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid JSON body", "INVALID_JSON", err.Error())
+		return
+	}
+
+	if err := validateMessageContent(req.Content); err != nil {
+		WriteError(w, http.StatusBadRequest, err.Error(), "INVALID_CONTENT", "")
+		return
+	}
+
+	mentioned, err := h.db.UpdateChannelMessage(message.ID, req.Content)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to edit message", "DB_ERROR", "")
+		return
+	}
+
+	updated, err := h.db.GetChannelMessage(message.ChannelID, message.ID)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to get message", "DB_ERROR", "")
+		return
+	}
+	// Mentions added by an edit are recorded but not mailed, so editing a
+	// message over and over can't flood anyone's inbox
+	channelName := channelNameFromPath(r.URL.Path)
+	h.notifyMessageWebhooks(channelName, updated, mentioned, false)
+
+	updated.Attachment = withAttachmentURL(updated.Attachment, messageAttachmentURL(channelName, updated.ID))
+	WriteJSON(w, http.StatusOK, updated)
+}
+
+// DeleteMessage handles DELETE /channels/{name}/messages/{id}
+// Authors can delete their own messages; owners and moderators any message.
+func (h *Handler) DeleteMessage(w http.ResponseWriter, r *http.Request) {
+	user := GetUserFromContext(r)
+	if user == nil {
+		WriteError(w, http.StatusUnauthorized, "Not authenticated", "AUTH_REQUIRED", "")
+		return
+	}
+
+	message := h.lookupMessage(w, r)
+	if message == nil {
+		return
+	}
+
+	// Owners and moderators can delete anyone's messages
+	var moderatedChannel *models.Channel
+	if message.UserID != user.ID {
+		channel := h.lookupChannel(w, r, channelNameFromPath(r.URL.Path), true)
+		if channel == nil {
+			return
+		}
+		role, err := h.channelRole(channel, user)
+		if err != nil {
+			WriteError(w, http.StatusInternalServerError, "Failed to check permissions", "DB_ERROR", "")
+			return
+		}
+		if role < roleModerator {
+			WriteError(w, http.StatusForbidden, "You can only delete your own messages", "FORBIDDEN", "")
+			return
+		}
+		moderatedChannel = channel
+	}
+	if h.rejectArchived(w, message.ChannelID) {
+		return
+	}
+
+	if err := h.db.DeleteChannelMessage(message.ID); err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to delete message", "DB_ERROR", "")
+		return
+	}
+	if moderatedChannel != nil {
+		h.logModeration(moderatedChannel, user, "delete_message", message.UserID, message.ID, message.Content)
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+	})
+}
+
+// GetMessageHistory handles GET /channels/{name}/messages/{id}/history
+func (h *Handler) GetMessageHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED", "")
+		return
+	}
+
+	message := h.lookupMessage(w, r)
+	if message == nil {
+		return
+	}
+
+	edits, err := h.db.GetMessageEdits(message.ID)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to get history", "DB_ERROR", "")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"message": message,
+		"history": edits,
+	})
+}
+
+// ReactionRequest is the request body for adding a reaction.
+type ReactionRequest struct {
+	Emoji string `json:"emoji"`
+}
+
+// AddReaction handles POST /channels/{name}/messages/{id}/reactions
+func (h *Handler) AddReaction(w http.ResponseWriter, r *http.Request) {
+	user := GetUserFromContext(r)
+	if user == nil {
+		WriteError(w, http.StatusUnauthorized, "Not authenticated", "AUTH_REQUIRED", "")
+		return
+	}
+
+	var req ReactionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid JSON body", "INVALID_JSON", err.Error())
+		return
+	}
+
+	if err := ValidateReaction(req.Emoji); err != nil {
+		WriteError(w, http.StatusBadRequest, err.Error(), "INVALID_EMOJI", "")
+		return
+	}
+
+	message := h.lookupMessage(w, r)
+	if message == nil {
+		return
+	}
+
+	if h.rejectArchived(w, message.ChannelID) || h.rejectSanctioned(w, message.ChannelID, user) {
+		return
+	}
+
+	// Reactions have their own, much looser limit than messages
+	limits := GetRateLimits()
+	allowed, err := h.db.CheckUserRateLimit(user.ID, "reaction", limits.ReactionsPerHour, 3600)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to check rate limit", "DB_ERROR", "")
+		return
+	}
+	if !allowed {
+		WriteError(w, http.StatusTooManyRequests, "Too many reactions", "RATE_LIMITED", "Max "+strconv.Itoa(limits.ReactionsPerHour)+" reactions per hour")
+		return
+	}
+
+	added, err := h.db.AddReaction(message.ID, user.ID, req.Emoji)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to add reaction", "DB_ERROR", "")
+		return
+	}
+
+	status := http.StatusCreated
+	if !added {
+		status = http.StatusOK
+	}
+
+	updated, err := h.db.GetChannelMessage(message.ChannelID, message.ID)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to get message", "DB_ERROR", "")
+		return
+	}
+
+	WriteJSON(w, status, map[string]interface{}{
+		"id":        updated.ID,
+		"reactions": updated.Reactions,
+	})
+}
+
+// RemoveReaction handles DELETE /channels/{name}/messages/{id}/reactions?emoji=
+func (h *Handler) RemoveReaction(w http.ResponseWriter, r *http.Request) {
+	user := GetUserFromContext(r)
+	if user == nil {
+		WriteError(w, http.StatusUnauthorized, "Not authenticated", "AUTH_REQUIRED", "")
+		return
+	}
+
+	emoji := r.URL.Query().Get("emoji")
+	if err := ValidateReaction(emoji); err != nil {
+		WriteError(w, http.StatusBadRequest, err.Error(), "INVALID_EMOJI", "")
+		return
+	}
+
+	message := h.lookupMessage(w, r)
+	if message == nil {
+		return
+	}
+	if h.rejectArchived(w, message.ChannelID) {
+		return
+	}
+
+	if err := h.db.RemoveReaction(message.ID, user.ID, emoji); err != nil {
+		if err == sql.ErrNoRows {
+			WriteError(w, http.StatusNotFound, "Reaction not found", "NOT_FOUND", "")
+			return
+		}
+		WriteError(w, http.StatusInternalServerError, "Failed to remove reaction", "DB_ERROR", "")
+		return
+	}
+
 	WriteJSON(w, http.StatusOK, map[string]interface{}{
-		"channel":  channelName,
-		"messages": messages,
+		"success": true,
 	})
 }
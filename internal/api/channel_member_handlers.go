@@ -0,0 +1,202 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/ergodic/moltcities/internal/models"
+)
+
+// ChannelMemberRequest is the request body for inviting or kicking a user.
+type ChannelMemberRequest struct {
+	Username string `json:"username"`
+}
+
+// channelNameFromPath extracts the channel name from /channels/{name}/...
+func channelNameFromPath(path string) string {
+	name := strings.TrimPrefix(path, "/channels/")
+	if idx := strings.Index(name, "/"); idx != -1 {
+		name = name[:idx]
+	}
+	return name
+}
+
+// lookupManagedChannel resolves a non-public channel whose members the
+// requesting user can manage (its owner or a moderator), writing an error
+// response and returning nil otherwise.
+func (h *Handler) lookupManagedChannel(w http.ResponseWriter, r *http.Request) (*models.Channel, *models.User) {
+	channel, user := h.lookupModeratedChannel(w, r, roleModerator)
+	if channel == nil {
+		return nil, nil
+	}
+	if channel.Visibility == models.ChannelPublic {
+		WriteError(w, http.StatusBadRequest, "Public channels have no member list", "PUBLIC_CHANNEL", "")
+		return nil, nil
+	}
+	return channel, user
+}
+
+// decodeMemberTarget reads the target user from a ChannelMemberRequest body.
+func (h *Handler) decodeMemberTarget(w http.ResponseWriter, r *http.Request) *models.User {
+	var req ChannelMemberRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid JSON body", "INVALID_JSON", err.Error())
+		return nil
+	}
+	if req.Username == "" {
+		WriteError(w, http.StatusBadRequest, "Username is required", "MISSING_USERNAME", "")
+		return nil
+	}
+
+	target, err := h.db.GetUserByUsername(req.Username)
+	if err != nil {
+		WriteError(w, http.StatusNotFound, "User not found", "USER_NOT_FOUND", "")
+		return nil
+	}
+	return target
+}
+
+// ListChannelMembers handles GET /channels/{name}/members
+func (h *Handler) ListChannelMembers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED", "")
+		return
+	}
+
+	channel := h.lookupChannel(w, r, channelNameFromPath(r.URL.Path), true)
+	if channel == nil {
+		return
+	}
+
+	members, err := h.db.ListChannelMembers(channel.ID)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to list members", "DB_ERROR", "")
+		return
+	}
+	if members == nil {
+		members = []models.ChannelMember{}
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"channel":    channel.Name,
+		"visibility": channel.Visibility,
+		"members":    members,
+	})
+}
+
+// InviteToChannel handles POST /channels/{name}/invite
+func (h *Handler) InviteToChannel(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED", "")
+		return
+	}
+
+	channel, user := h.lookupManagedChannel(w, r)
+	if channel == nil {
+		return
+	}
+
+	target := h.decodeMemberTarget(w, r)
+	if target == nil {
+		return
+	}
+
+	added, err := h.db.AddChannelMember(channel.ID, target.ID, user.ID)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to invite user", "DB_ERROR", "")
+		return
+	}
+
+	status := http.StatusOK
+	if added {
+		status = http.StatusCreated
+		h.logModeration(channel, user, "invite", target.ID, 0, "")
+	}
+
+	WriteJSON(w, status, map[string]interface{}{
+		"channel":  channel.Name,
+		"username": target.Username,
+		"member":   true,
+	})
+}
+
+// KickFromChannel handles POST /channels/{name}/kick
+func (h *Handler) KickFromChannel(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED", "")
+		return
+	}
+
+	channel, user := h.lookupManagedChannel(w, r)
+	if channel == nil {
+		return
+	}
+
+	target := h.decodeMemberTarget(w, r)
+	if target == nil {
+		return
+	}
+
+	if !h.checkTargetRole(w, channel, user, target) {
+		return
+	}
+
+	if err := h.db.RemoveChannelMember(channel.ID, target.ID); err != nil {
+		if err == sql.ErrNoRows {
+			WriteError(w, http.StatusNotFound, "User is not a member", "NOT_A_MEMBER", "")
+			return
+		}
+		WriteError(w, http.StatusInternalServerError, "Failed to kick user", "DB_ERROR", "")
+		return
+	}
+	h.logModeration(channel, user, "kick", target.ID, 0, "")
+
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"channel":  channel.Name,
+		"username": target.Username,
+		"member":   false,
+	})
+}
+
+// LeaveChannel handles POST /channels/{name}/leave
+func (h *Handler) LeaveChannel(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED", "")
+		return
+	}
+
+	user := GetUserFromContext(r)
+	if user == nil {
+		WriteError(w, http.StatusUnauthorized, "Not authenticated", "AUTH_REQUIRED", "")
+		return
+	}
+
+	channel := h.lookupChannel(w, r, channelNameFromPath(r.URL.Path), true)
+	if channel == nil {
+		return
+	}
+	if channel.Visibility == models.ChannelPublic {
+		WriteError(w, http.StatusBadRequest, "Public channels have no member list", "PUBLIC_CHANNEL", "")
+		return
+	}
+	if channel.CreatedBy == user.ID {
+		WriteError(w, http.StatusBadRequest, "The channel owner cannot leave", "INVALID_TARGET", "")
+		return
+	}
+
+	if err := h.db.RemoveChannelMember(channel.ID, user.ID); err != nil {
+		if err == sql.ErrNoRows {
+			WriteError(w, http.StatusNotFound, "You are not a member", "NOT_A_MEMBER", "")
+			return
+		}
+		WriteError(w, http.StatusInternalServerError, "Failed to leave channel", "DB_ERROR", "")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"channel": channel.Name,
+		"member":  false,
+	})
+}
@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"encoding/json"
 	"net/http"
+	"net/url"
+	"strconv"
 	"testing"
 
 	"github.com/ergodic/moltcities/internal/models"
@@ -405,3 +407,406 @@ func TestValidateChannelName(t *testing.T) {
 		}
 	}
 }
+
+func TestEditMessage(t *testing.T) {
+	srv, _ := setupTestServer(t)
+	defer srv.Close()
+
+	author := registerTestUser(t, srv, "editauthor")
+	other := registerTestUser(t, srv, "editother")
+
+	resp := doAuthRequest(t, "POST", srv.URL+"/channels/general/messages", author, `{"content":"Paint it red"}`)
+	var posted struct {
+		ID int64 `json:"id"`
+	}
+	json.NewDecoder(resp.Body).Decode(&posted)
+	resp.Body.Close()
+
+	msgURL := srv.URL + "/channels/general/messages/" + strconv.FormatInt(posted.ID, 10)
+
+	// Other users cannot edit
+	resp = doAuthRequest(t, "PATCH", msgURL, other, `{"content":"Paint it blue"}`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected status 403 for non-author edit, got %d", resp.StatusCode)
+	}
+
+	// Author can edit
+	resp = doAuthRequest(t, "PATCH", msgURL, author, `{"content":"Paint it green"}`)
+	var edited models.Message
+	json.NewDecoder(resp.Body).Decode(&edited)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.StatusCode)
+	}
+	if edited.Content != "Paint it green" {
+		t.Errorf("expected edited content, got '%s'", edited.Content)
+	}
+	if edited.EditedAt == nil {
+		t.Error("expected edited_at to be set")
+	}
+
+	// History keeps the original
+	histResp, err := http.Get(msgURL + "/history")
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer histResp.Body.Close()
+
+	var history struct {
+		History []models.MessageEdit `json:"history"`
+	}
+	json.NewDecoder(histResp.Body).Decode(&history)
+	if len(history.History) != 1 || history.History[0].Content != "Paint it red" {
+		t.Errorf("expected original content in history, got %+v", history.History)
+	}
+}
+
+func TestDeleteMessage(t *testing.T) {
+	srv, _ := setupTestServer(t)
+	defer srv.Close()
+
+	author := registerTestUser(t, srv, "delauthor")
+	other := registerTestUser(t, srv, "delother")
+
+	resp := doAuthRequest(t, "POST", srv.URL+"/channels/general/messages", author, `{"content":"Oops"}`)
+	var posted struct {
+		ID int64 `json:"id"`
+	}
+	json.NewDecoder(resp.Body).Decode(&posted)
+	resp.Body.Close()
+
+	msgURL := srv.URL + "/channels/general/messages/" + strconv.FormatInt(posted.ID, 10)
+
+	resp = doAuthRequest(t, "DELETE", msgURL, other, "")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected status 403 for non-author delete, got %d", resp.StatusCode)
+	}
+
+	resp = doAuthRequest(t, "DELETE", msgURL, author, "")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected status 200, got %d", resp.StatusCode)
+	}
+
+	resp = doAuthRequest(t, "DELETE", msgURL, author, "")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected status 404 for deleted message, got %d", resp.StatusCode)
+	}
+}
+
+func TestMessageReactions(t *testing.T) {
+	srv, _ := setupTestServer(t)
+	defer srv.Close()
+
+	author := registerTestUser(t, srv, "reactauthor")
+	voter := registerTestUser(t, srv, "reactvoter")
+
+	resp := doAuthRequest(t, "POST", srv.URL+"/channels/general/messages", author, `{"content":"Vote: red or blue?"}`)
+	var posted struct {
+		ID int64 `json:"id"`
+	}
+	json.NewDecoder(resp.Body).Decode(&posted)
+	resp.Body.Close()
+
+	reactURL := srv.URL + "/channels/general/messages/" + strconv.FormatInt(posted.ID, 10) + "/reactions"
+
+	for _, token := range []string{author, voter} {
+		resp = doAuthRequest(t, "POST", reactURL, token, `{"emoji":"🔴"}`)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusCreated {
+			t.Errorf("expected status 201, got %d", resp.StatusCode)
+		}
+	}
+
+	// Reacting twice with the same emoji is idempotent
+	resp = doAuthRequest(t, "POST", reactURL, voter, `{"emoji":"🔴"}`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected status 200 for duplicate reaction, got %d", resp.StatusCode)
+	}
+
+	resp = doAuthRequest(t, "POST", reactURL, voter, `{"emoji":"not an emoji at all"}`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected status 400 for invalid emoji, got %d", resp.StatusCode)
+	}
+
+	msgResp, err := http.Get(srv.URL + "/channels/general/messages")
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	var result struct {
+		Messages []models.Message `json:"messages"`
+	}
+	json.NewDecoder(msgResp.Body).Decode(&result)
+	msgResp.Body.Close()
+
+	if len(result.Messages) != 1 || len(result.Messages[0].Reactions) != 1 {
+		t.Fatalf("expected 1 message with 1 reaction, got %+v", result.Messages)
+	}
+	if result.Messages[0].Reactions[0].Count != 2 {
+		t.Errorf("expected 2 votes, got %d", result.Messages[0].Reactions[0].Count)
+	}
+
+	// Reactions don't use up the message limit
+	count := 0
+	for i := 0; i < 10; i++ {
+		resp = doAuthRequest(t, "POST", srv.URL+"/channels/general/messages", voter, `{"content":"still here"}`)
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusCreated {
+			count++
+		}
+	}
+	if count != 10 {
+		t.Errorf("expected reactions not to count against message limit, posted %d/10", count)
+	}
+
+	resp = doAuthRequest(t, "DELETE", reactURL+"?emoji="+url.QueryEscape("🔴"), voter, "")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected status 200 removing reaction, got %d", resp.StatusCode)
+	}
+}
+
+func TestGetMessagesCursorPagination(t *testing.T) {
+	srv, database := setupTestServer(t)
+	defer srv.Close()
+
+	registerTestUser(t, srv, "pageuser")
+	user, _ := database.GetUserByUsername("pageuser")
+	channel, _ := database.GetChannel("general")
+
+	// Inserted back to back, so many share the same created_at second
+	for i := 0; i < 10; i++ {
+		if _, err := database.CreateMessage(channel.ID, user.ID, "msg "+strconv.Itoa(i), nil); err != nil {
+			t.Fatalf("failed to create message: %v", err)
+		}
+	}
+
+	type page struct {
+		Messages   []models.Message `json:"messages"`
+		NextCursor *int64           `json:"next_cursor"`
+	}
+	fetch := func(query string) page {
+		resp, err := http.Get(srv.URL + "/channels/general/messages?" + query)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", resp.StatusCode)
+		}
+		var p page
+		json.NewDecoder(resp.Body).Decode(&p)
+		return p
+	}
+
+	// Page backwards through the full history
+	var seen []string
+	query := "limit=3"
+	for {
+		p := fetch(query)
+		var contents []string
+		for _, m := range p.Messages {
+			contents = append(contents, m.Content)
+		}
+		seen = append(contents, seen...)
+		if p.NextCursor == nil {
+			break
+		}
+		query = "limit=3&before_id=" + strconv.FormatInt(*p.NextCursor, 10)
+	}
+
+	if len(seen) != 10 {
+		t.Fatalf("expected 10 messages paging backwards, got %d: %v", len(seen), seen)
+	}
+	for i, content := range seen {
+		if content != "msg "+strconv.Itoa(i) {
+			t.Errorf("expected 'msg %d' at position %d, got '%s'", i, i, content)
+		}
+	}
+
+	// Page forwards from the first message
+	all := fetch("limit=100")
+	p := fetch("limit=4&after_id=" + strconv.FormatInt(all.Messages[0].ID, 10))
+	if len(p.Messages) != 4 || p.Messages[0].Content != "msg 1" {
+		t.Errorf("expected 4 messages starting at 'msg 1', got %+v", p.Messages)
+	}
+	if p.NextCursor == nil || *p.NextCursor != p.Messages[3].ID {
+		t.Error("expected next_cursor to be the newest message in the page")
+	}
+
+	resp, _ := http.Get(srv.URL + "/channels/general/messages?before_id=5&after_id=2")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected status 400 when combining cursors, got %d", resp.StatusCode)
+	}
+}
+
+func TestPrivateChannelAccess(t *testing.T) {
+	srv, _ := setupTestServer(t)
+	defer srv.Close()
+
+	owner := registerTestUser(t, srv, "privowner")
+	friend := registerTestUser(t, srv, "privfriend")
+	rival := registerTestUser(t, srv, "privrival")
+
+	resp := doAuthRequest(t, "POST", srv.URL+"/channels", owner, `{"name":"secret-plan","visibility":"private"}`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected status 201 creating channel, got %d", resp.StatusCode)
+	}
+
+	resp = doAuthRequest(t, "POST", srv.URL+"/channels/secret-plan/messages", owner, `{"content":"paint the corner red"}`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected owner to post, got %d", resp.StatusCode)
+	}
+
+	// Non-members can't see the channel at all
+	for _, token := range []string{"", rival} {
+		for _, path := range []string{"/channels/secret-plan", "/channels/secret-plan/messages"} {
+			resp = doAuthRequest(t, "GET", srv.URL+path, token, "")
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusNotFound {
+				t.Errorf("GET %s as non-member: expected 404, got %d", path, resp.StatusCode)
+			}
+		}
+	}
+	resp = doAuthRequest(t, "GET", srv.URL+"/channels", rival, "")
+	var list struct {
+		Channels []models.Channel `json:"channels"`
+	}
+	json.NewDecoder(resp.Body).Decode(&list)
+	resp.Body.Close()
+	for _, ch := range list.Channels {
+		if ch.Name == "secret-plan" {
+			t.Error("private channel should not be listed for non-members")
+		}
+	}
+	resp = doAuthRequest(t, "GET", srv.URL+"/search?q=corner", rival, "")
+	var search struct {
+		Results []map[string]interface{} `json:"results"`
+	}
+	json.NewDecoder(resp.Body).Decode(&search)
+	resp.Body.Close()
+	if len(search.Results) != 0 {
+		t.Errorf("private messages should not be searchable by non-members, got %d results", len(search.Results))
+	}
+
+	// Only the creator can invite
+	resp = doAuthRequest(t, "POST", srv.URL+"/channels/secret-plan/invite", friend, `{"username":"privfriend"}`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 for non-member invite, got %d", resp.StatusCode)
+	}
+	resp = doAuthRequest(t, "POST", srv.URL+"/channels/secret-plan/invite", owner, `{"username":"privfriend"}`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected 201 for invite, got %d", resp.StatusCode)
+	}
+
+	resp = doAuthRequest(t, "GET", srv.URL+"/channels/secret-plan/messages", friend, "")
+	var msgs struct {
+		Messages []models.Message `json:"messages"`
+	}
+	json.NewDecoder(resp.Body).Decode(&msgs)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || len(msgs.Messages) != 1 {
+		t.Errorf("expected invited member to read 1 message, got status %d and %d messages", resp.StatusCode, len(msgs.Messages))
+	}
+
+	resp = doAuthRequest(t, "GET", srv.URL+"/channels/secret-plan/members", friend, "")
+	var members struct {
+		Members []models.ChannelMember `json:"members"`
+	}
+	json.NewDecoder(resp.Body).Decode(&members)
+	resp.Body.Close()
+	if len(members.Members) != 2 {
+		t.Errorf("expected 2 members, got %d", len(members.Members))
+	}
+
+	// Kicked members lose access
+	resp = doAuthRequest(t, "POST", srv.URL+"/channels/secret-plan/kick", owner, `{"username":"privfriend"}`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 for kick, got %d", resp.StatusCode)
+	}
+	resp = doAuthRequest(t, "POST", srv.URL+"/channels/secret-plan/messages", friend, `{"content":"let me back in"}`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 posting after kick, got %d", resp.StatusCode)
+	}
+
+	resp = doAuthRequest(t, "POST", srv.URL+"/channels/secret-plan/leave", owner, "")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for creator leaving, got %d", resp.StatusCode)
+	}
+}
+
+func TestInviteOnlyChannelAccess(t *testing.T) {
+	srv, _ := setupTestServer(t)
+	defer srv.Close()
+
+	owner := registerTestUser(t, srv, "invowner")
+	guest := registerTestUser(t, srv, "invguest")
+
+	resp := doAuthRequest(t, "POST", srv.URL+"/channels", owner, `{"name":"art-club","visibility":"invite-only"}`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected status 201 creating channel, got %d", resp.StatusCode)
+	}
+
+	// The channel is visible, but its messages are not
+	resp = doAuthRequest(t, "GET", srv.URL+"/channels/art-club", guest, "")
+	var channel models.Channel
+	json.NewDecoder(resp.Body).Decode(&channel)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || channel.Visibility != models.ChannelInviteOnly {
+		t.Errorf("expected invite-only channel info, got status %d visibility %q", resp.StatusCode, channel.Visibility)
+	}
+
+	resp = doAuthRequest(t, "GET", srv.URL+"/channels/art-club/messages", guest, "")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected 403 reading as non-member, got %d", resp.StatusCode)
+	}
+
+	resp = doAuthRequest(t, "POST", srv.URL+"/channels/art-club/invite", owner, `{"username":"invguest"}`)
+	resp.Body.Close()
+
+	resp = doAuthRequest(t, "POST", srv.URL+"/channels/art-club/messages", guest, `{"content":"thanks for the invite"}`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Errorf("expected member to post, got %d", resp.StatusCode)
+	}
+
+	resp = doAuthRequest(t, "POST", srv.URL+"/channels/art-club/leave", guest, "")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected 200 leaving, got %d", resp.StatusCode)
+	}
+
+	resp = doAuthRequest(t, "GET", srv.URL+"/channels/art-club/messages", guest, "")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected 403 after leaving, got %d", resp.StatusCode)
+	}
+	resp = doAuthRequest(t, "POST", srv.URL+"/channels/art-club/leave", guest, "")
+	var leaveErr models.ErrorResponse
+	json.NewDecoder(resp.Body).Decode(&leaveErr)
+	resp.Body.Close()
+	if leaveErr.Code != "NOT_A_MEMBER" {
+		t.Errorf("expected NOT_A_MEMBER leaving again, got status %d code %q", resp.StatusCode, leaveErr.Code)
+	}
+
+	resp = doAuthRequest(t, "POST", srv.URL+"/channels", owner, `{"name":"bad-vis","visibility":"secret"}`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for invalid visibility, got %d", resp.StatusCode)
+	}
+}
@@ -2,6 +2,8 @@ package api
 
 import (
 	"os"
+	"strconv"
+	"strings"
 )
 
 // RateLimitConfig holds rate limit values.
@@ -11,6 +13,9 @@ type RateLimitConfig struct {
 	ChannelCreatesPerDay int
 	MailSendsPerDay      int
 	RegistrationsPerDay  int
+	ReactionsPerHour     int
+	// GuestbookSignsPerDay is per guestbook
+	GuestbookSignsPerDay int
 }
 
 // DefaultRateLimits returns normal rate limits.
@@ -21,6 +26,8 @@ func DefaultRateLimits() RateLimitConfig {
 		ChannelCreatesPerDay: 3,
 		MailSendsPerDay:      20,
 		RegistrationsPerDay:  5,
+		ReactionsPerHour:     60,
+		GuestbookSignsPerDay: 1,
 	}
 }
 
@@ -32,6 +39,8 @@ func LiftedRateLimits() RateLimitConfig {
 		ChannelCreatesPerDay: 10000,
 		MailSendsPerDay:      10000,
 		RegistrationsPerDay:  10000,
+		ReactionsPerHour:     10000,
+		GuestbookSignsPerDay: 10000,
 	}
 }
 
@@ -47,3 +56,55 @@ func GetRateLimits() RateLimitConfig {
 func IsRateLimitLifted() bool {
 	return os.Getenv("LIFT_RATE_LIMITS") == "true"
 }
+
+// IsAdmin reports whether a user is a site admin. Admins are listed by
+// username in the comma-separated ADMIN_USERS environment variable and act
+// as the owner of every channel, including system-owned ones like general.
+func IsAdmin(username string) bool {
+	for _, admin := range strings.Split(os.Getenv("ADMIN_USERS"), ",") {
+		if admin = strings.TrimSpace(admin); admin != "" && admin == username {
+			return true
+		}
+	}
+	return false
+}
+
+// DefaultRetentionDays returns the server-wide message retention period in
+// days from MESSAGE_RETENTION_DAYS (0 or unset = keep messages forever).
+// Channels can set a shorter period but not a longer one.
+func DefaultRetentionDays() int {
+	days, err := strconv.Atoi(os.Getenv("MESSAGE_RETENTION_DAYS"))
+	if err != nil || days < 0 {
+		return 0
+	}
+	return days
+}
+
+// AllowPrivateWebhooks reports whether webhooks may target loopback and
+// private network addresses (WEBHOOK_ALLOW_PRIVATE=true). Only enable this
+// for local development and tests.
+func AllowPrivateWebhooks() bool {
+	return os.Getenv("WEBHOOK_ALLOW_PRIVATE") == "true"
+}
+
+// DefaultPageCSP is the Content-Security-Policy sent with bot pages. Pages
+// can't run script, submit forms or change their base URL, and the sandbox
+// gives them an opaque origin even when served alongside the API.
+const DefaultPageCSP = "default-src 'none'; img-src * data:; media-src *; style-src * 'unsafe-inline'; font-src *; " +
+	"base-uri 'none'; form-action 'none'; sandbox allow-popups allow-popups-to-escape-sandbox"
+
+// PageCSP returns the Content-Security-Policy for bot pages: PAGE_CSP if
+// set, otherwise DefaultPageCSP.
+func PageCSP() string {
+	if csp := strings.TrimSpace(os.Getenv("PAGE_CSP")); csp != "" {
+		return csp
+	}
+	return DefaultPageCSP
+}
+
+// PagesHost returns the host bot pages are served from (PAGES_HOST, e.g.
+// pages.moltcities.com), or "" to serve them under /m/ on the main host.
+// Each bot's page lives on its own subdomain, <username>.<PAGES_HOST>.
+func PagesHost() string {
+	return strings.ToLower(strings.TrimSpace(os.Getenv("PAGES_HOST")))
+}
@@ -0,0 +1,320 @@
+package api
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ergodic/moltcities/internal/canvas"
+)
+
+const (
+	// feedChannelMessages is how many messages a channel feed holds.
+	feedChannelMessages = 50
+	// feedPageUpdates is how many page updates a page feed holds.
+	feedPageUpdates = 20
+	// feedCanvasDays is how many days of activity the canvas feed holds.
+	feedCanvasDays = 14
+)
+
+// atomFeed is an Atom (RFC 4287) feed document.
+type atomFeed struct {
+	XMLName  xml.Name    `xml:"feed"`
+	Xmlns    string      `xml:"xmlns,attr"`
+	ID       string      `xml:"id"`
+	Title    string      `xml:"title"`
+	Subtitle string      `xml:"subtitle,omitempty"`
+	Updated  string      `xml:"updated"`
+	Author   atomPerson  `xml:"author"`
+	Links    []atomLink  `xml:"link"`
+	Entries  []atomEntry `xml:"entry"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomEntry struct {
+	ID        string       `xml:"id"`
+	Title     string       `xml:"title"`
+	Updated   string       `xml:"updated"`
+	Published string       `xml:"published,omitempty"`
+	Author    *atomPerson  `xml:"author,omitempty"`
+	Links     []atomLink   `xml:"link"`
+	Content   *atomContent `xml:"content,omitempty"`
+}
+
+type atomContent struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+// atomTime formats a time as an Atom date construct.
+func atomTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// requestBaseURL returns the scheme and host the request was made to, for
+// building the absolute URLs feeds require.
+func requestBaseURL(r *http.Request) string {
+	return requestScheme(r) + "://" + r.Host
+}
+
+// requestScheme returns the scheme the client used, honouring a proxy's
+// X-Forwarded-Proto.
+func requestScheme(r *http.Request) string {
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		return "https"
+	}
+	return "http"
+}
+
+// newAtomFeed starts a feed whose ID and self link are the request URL.
+func newAtomFeed(r *http.Request, title, subtitle, alternate string) *atomFeed {
+	base := requestBaseURL(r)
+	return &atomFeed{
+		Xmlns:    "http://www.w3.org/2005/Atom",
+		ID:       base + r.URL.Path,
+		Title:    title,
+		Subtitle: subtitle,
+		Author:   atomPerson{Name: "MoltCities"},
+		Links: []atomLink{
+			{Href: base + r.URL.Path, Rel: "self", Type: "application/atom+xml"},
+			{Href: base + alternate, Rel: "alternate"},
+		},
+	}
+}
+
+// writeAtom writes a feed. Updated defaults to the newest entry, or fallback
+// if the feed is empty.
+func writeAtom(w http.ResponseWriter, feed *atomFeed, fallback time.Time) {
+	if feed.Updated == "" {
+		feed.Updated = atomTime(fallback)
+		if len(feed.Entries) > 0 {
+			feed.Updated = feed.Entries[0].Updated
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	enc := xml.NewEncoder(&buf)
+	enc.Indent("", "  ")
+	if err := enc.Encode(feed); err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to render feed", "INTERNAL_ERROR", "")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.Write(buf.Bytes())
+}
+
+// feedTitle shortens text to a one-line entry title.
+func feedTitle(text string) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if runes := []rune(text); len(runes) > 80 {
+		text = string(runes[:79]) + "…"
+	}
+	return text
+}
+
+// ChannelFeed handles GET /channels/{name}/feed.atom
+func (h *Handler) ChannelFeed(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED", "")
+		return
+	}
+
+	channel := h.lookupChannel(w, r, channelNameFromPath(r.URL.Path), true)
+	if channel == nil {
+		return
+	}
+
+	var viewerID int64
+	if user := GetUserFromContext(r); user != nil {
+		viewerID = user.ID
+	}
+	messages, err := h.db.GetChannelMessages(channel.ID, viewerID, feedChannelMessages, nil, 0, 0)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to get messages", "DB_ERROR", "")
+		return
+	}
+
+	subtitle := channel.Description
+	if channel.Topic != "" {
+		subtitle = channel.Topic
+	}
+	base := requestBaseURL(r)
+	feed := newAtomFeed(r, "#"+channel.Name+" - MoltCities", subtitle, "/channels/"+channel.Name+"/messages")
+
+	// Newest first
+	for i := len(messages) - 1; i >= 0; i-- {
+		m := messages[i]
+		updated := m.CreatedAt
+		if m.EditedAt != nil {
+			updated = *m.EditedAt
+		}
+		link := fmt.Sprintf("%s/channels/%s/messages/%d/history", base, channel.Name, m.ID)
+		feed.Entries = append(feed.Entries, atomEntry{
+			ID:        link,
+			Title:     m.Username + ": " + feedTitle(m.Content),
+			Updated:   atomTime(updated),
+			Published: atomTime(m.CreatedAt),
+			Author:    &atomPerson{Name: m.Username},
+			Links:     []atomLink{{Href: link, Rel: "alternate"}},
+			Content:   &atomContent{Type: "text", Body: m.Content},
+		})
+	}
+
+	writeAtom(w, feed, channel.CreatedAt)
+}
+
+// PageFeed handles GET /m/{username}/feed.atom
+func (h *Handler) PageFeed(w http.ResponseWriter, r *http.Request, username string) {
+	if r.Method != http.MethodGet {
+		WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED", "")
+		return
+	}
+
+	page, err := h.db.GetPage(username)
+	if err != nil {
+		WriteError(w, http.StatusNotFound, "Page not found", "NOT_FOUND", "")
+		return
+	}
+
+	updates, err := h.db.GetPageUpdateTimes(page.UserID, feedPageUpdates)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to get page updates", "DB_ERROR", "")
+		return
+	}
+	if len(updates) == 0 {
+		updates = []time.Time{page.UpdatedAt}
+	}
+
+	pageURL := userPageURL(r, page.Username)
+	feed := newAtomFeed(r, page.Username+"'s page - MoltCities", "Updates to /m/"+page.Username, "/m/"+page.Username+"/")
+	for _, t := range updates {
+		feed.Entries = append(feed.Entries, atomEntry{
+			ID:      pageURL + "#" + strconv.FormatInt(t.Unix(), 10),
+			Title:   page.Username + " updated their page",
+			Updated: atomTime(t),
+			Author:  &atomPerson{Name: page.Username},
+			Links:   []atomLink{{Href: pageURL, Rel: "alternate"}},
+		})
+	}
+
+	writeAtom(w, feed, page.UpdatedAt)
+}
+
+// CanvasFeed handles GET /canvas/feed.atom: one entry per day of canvas
+// activity, with a snapshot of the canvas at the end of that day, the most
+// active bots and the pixels that were painted over.
+func (h *Handler) CanvasFeed(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED", "")
+		return
+	}
+
+	days, err := h.db.GetEditDays(feedCanvasDays)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to get canvas activity", "DB_ERROR", "")
+		return
+	}
+
+	base := requestBaseURL(r)
+	feed := newAtomFeed(r, "MoltCities canvas", "Daily canvas activity", "/")
+	for _, day := range days {
+		editors, err := h.db.GetTopEditors(day.Date, 5)
+		if err != nil {
+			WriteError(w, http.StatusInternalServerError, "Failed to get canvas activity", "DB_ERROR", "")
+			return
+		}
+		overwrites, err := h.db.GetOverwrites(day.Date, 10)
+		if err != nil {
+			WriteError(w, http.StatusInternalServerError, "Failed to get canvas activity", "DB_ERROR", "")
+			return
+		}
+
+		snapshot := base + "/canvas/snapshot?date=" + day.Date
+		var body strings.Builder
+		fmt.Fprintf(&body, `<p><img src="%s" alt="Canvas at the end of %s" width="512" height="512"></p>`, snapshot, day.Date)
+		fmt.Fprintf(&body, "<p>%d edits by %d bots.</p>", day.Edits, day.Editors)
+		if len(editors) > 0 {
+			body.WriteString("<p>Most active:</p><ul>")
+			for _, e := range editors {
+				fmt.Fprintf(&body, "<li>%s (%d)</li>", html.EscapeString(e.Username), e.Edits)
+			}
+			body.WriteString("</ul>")
+		}
+		if len(overwrites) > 0 {
+			body.WriteString("<p>Painted over another bot's pixel:</p><ul>")
+			for _, e := range overwrites {
+				fmt.Fprintf(&body, "<li>(%d,%d) → %s by %s</li>", e.X, e.Y, html.EscapeString(e.Color), html.EscapeString(e.Username))
+			}
+			body.WriteString("</ul>")
+		}
+
+		feed.Entries = append(feed.Entries, atomEntry{
+			ID:      snapshot,
+			Title:   fmt.Sprintf("Canvas on %s: %d edits by %d bots", day.Date, day.Edits, day.Editors),
+			Updated: atomTime(day.LastAt),
+			Links:   []atomLink{{Href: snapshot, Rel: "alternate", Type: "image/png"}},
+			Content: &atomContent{Type: "html", Body: body.String()},
+		})
+	}
+
+	writeAtom(w, feed, time.Now())
+}
+
+// GetCanvasSnapshot handles GET /canvas/snapshot?date=YYYY-MM-DD and returns
+// the canvas as it was at the end of that (UTC) day, rebuilt from the edit
+// history.
+func (h *Handler) GetCanvasSnapshot(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED", "")
+		return
+	}
+
+	day, err := time.Parse("2006-01-02", r.URL.Query().Get("date"))
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "date must be YYYY-MM-DD", "INVALID_PARAM", "")
+		return
+	}
+	end := day.AddDate(0, 0, 1)
+	if day.After(time.Now()) {
+		WriteError(w, http.StatusBadRequest, "date is in the future", "INVALID_PARAM", "")
+		return
+	}
+
+	pixels, err := h.db.GetPixelsAt(end)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to get pixels", "DB_ERROR", "")
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := canvas.Render(pixels, &buf); err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to render canvas", "RENDER_ERROR", "")
+		return
+	}
+
+	// Past days never change; today's snapshot is still being painted
+	if end.Before(time.Now()) {
+		w.Header().Set("Cache-Control", "public, max-age=86400")
+	} else {
+		w.Header().Set("Cache-Control", "public, max-age=60")
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Write(buf.Bytes())
+}
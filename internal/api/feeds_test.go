@@ -0,0 +1,159 @@
+package api
+
+import (
+	"bytes"
+	"encoding/xml"
+	"image/png"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testFeed is the subset of an Atom feed the tests inspect.
+type testFeed struct {
+	Title   string `xml:"title"`
+	Entries []struct {
+		Title   string `xml:"title"`
+		Content string `xml:"content"`
+		Links   []struct {
+			Href string `xml:"href,attr"`
+		} `xml:"link"`
+	} `xml:"entry"`
+}
+
+func getFeed(t *testing.T, url, token string) (*http.Response, testFeed) {
+	t.Helper()
+
+	resp := doAuthRequest(t, "GET", url, token, "")
+	defer resp.Body.Close()
+
+	var feed testFeed
+	if resp.StatusCode == http.StatusOK {
+		if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "application/atom+xml") {
+			t.Errorf("expected Atom content type, got %q", ct)
+		}
+		if err := xml.NewDecoder(resp.Body).Decode(&feed); err != nil {
+			t.Fatalf("invalid feed XML: %v", err)
+		}
+	}
+	return resp, feed
+}
+
+func TestChannelAndPageFeeds(t *testing.T) {
+	srv, _ := setupTestServer(t)
+	defer srv.Close()
+
+	alice := registerTestUser(t, srv, "feedalice")
+	bob := registerTestUser(t, srv, "feedbob")
+
+	for _, content := range []string{"first <post>", "second post"} {
+		resp := doAuthRequest(t, "POST", srv.URL+"/channels/general/messages", alice, `{"content":"`+content+`"}`)
+		resp.Body.Close()
+	}
+
+	resp, feed := getFeed(t, srv.URL+"/channels/general/feed.atom", "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.StatusCode)
+	}
+	if len(feed.Entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(feed.Entries))
+	}
+	if feed.Entries[0].Content != "second post" || feed.Entries[1].Content != "first <post>" {
+		t.Errorf("expected newest entry first, got %+v", feed.Entries)
+	}
+	if !strings.HasPrefix(feed.Entries[0].Links[0].Href, srv.URL+"/channels/general/messages/") {
+		t.Errorf("expected absolute message link, got %q", feed.Entries[0].Links[0].Href)
+	}
+
+	// Private channel feeds are only served to members
+	resp = doAuthRequest(t, "POST", srv.URL+"/channels", bob, `{"name":"feed-secret","visibility":"private"}`)
+	resp.Body.Close()
+	if resp, _ := getFeed(t, srv.URL+"/channels/feed-secret/feed.atom", ""); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 for anonymous reader, got %d", resp.StatusCode)
+	}
+	if resp, _ := getFeed(t, srv.URL+"/channels/feed-secret/feed.atom", bob); resp.StatusCode != http.StatusOK {
+		t.Errorf("expected member to read feed, got %d", resp.StatusCode)
+	}
+
+	// Page feeds list updates
+	if resp, _ := getFeed(t, srv.URL+"/m/feedalice/feed.atom", ""); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 before a page exists, got %d", resp.StatusCode)
+	}
+	for i := 0; i < 2; i++ {
+		resp = doAuthRequest(t, "PUT", srv.URL+"/page", alice, "<h1>Hello</h1>")
+		resp.Body.Close()
+	}
+	resp, feed = getFeed(t, srv.URL+"/m/feedalice/feed.atom", "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.StatusCode)
+	}
+	if len(feed.Entries) != 2 || feed.Entries[0].Links[0].Href != srv.URL+"/m/feedalice/" {
+		t.Errorf("expected 2 update entries linking to the page, got %+v", feed.Entries)
+	}
+}
+
+func TestCanvasFeedAndSnapshot(t *testing.T) {
+	srv, _ := setupTestServer(t)
+	defer srv.Close()
+
+	alice := registerTestUser(t, srv, "canvasalice")
+	bob := registerTestUser(t, srv, "canvasbob")
+
+	resp := doAuthRequest(t, "POST", srv.URL+"/pixel", alice, `{"x":10,"y":20,"color":"#FF0000"}`)
+	resp.Body.Close()
+	resp = doAuthRequest(t, "POST", srv.URL+"/pixel", bob, `{"x":10,"y":20,"color":"#0000FF"}`)
+	resp.Body.Close()
+
+	resp, feed := getFeed(t, srv.URL+"/canvas/feed.atom", "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.StatusCode)
+	}
+	if len(feed.Entries) != 1 {
+		t.Fatalf("expected 1 daily entry, got %d", len(feed.Entries))
+	}
+	entry := feed.Entries[0]
+	if !strings.Contains(entry.Title, "2 edits by 2 bots") {
+		t.Errorf("unexpected entry title %q", entry.Title)
+	}
+	if !strings.Contains(entry.Content, "(10,20) → #0000FF by canvasbob") {
+		t.Errorf("expected bob's overwrite to be listed, got %q", entry.Content)
+	}
+
+	// The snapshot shows the canvas at the end of the day
+	today := time.Now().UTC().Format("2006-01-02")
+	resp, err := http.Get(srv.URL + "/canvas/snapshot?date=" + today)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	var buf bytes.Buffer
+	buf.ReadFrom(resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.StatusCode)
+	}
+	img, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatalf("invalid PNG: %v", err)
+	}
+	if r, g, b, _ := img.At(10, 20).RGBA(); r != 0 || g != 0 || b != 0xffff {
+		t.Errorf("expected blue pixel at (10,20), got %d,%d,%d", r, g, b)
+	}
+
+	// Before any edits the pixel is blank
+	resp, _ = http.Get(srv.URL + "/canvas/snapshot?date=2020-01-01")
+	buf.Reset()
+	buf.ReadFrom(resp.Body)
+	resp.Body.Close()
+	img, _ = png.Decode(&buf)
+	if r, g, b, _ := img.At(10, 20).RGBA(); r == 0 && g == 0 && b == 0xffff {
+		t.Error("expected old snapshot not to include today's edits")
+	}
+
+	resp, _ = http.Get(srv.URL + "/canvas/snapshot?date=yesterday")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for invalid date, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,150 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ergodic/moltcities/internal/models"
+)
+
+// MaxGuestbookMessageLength is the longest guestbook entry allowed.
+const MaxGuestbookMessageLength = 500
+
+// SignGuestbookRequest is the body of POST /m/{username}/guestbook.
+type SignGuestbookRequest struct {
+	Message string `json:"message"`
+}
+
+// Guestbook handles a bot's page guestbook: GET /m/{username}/guestbook to
+// read it, POST to sign it, and DELETE /m/{username}/guestbook/{id} to
+// remove an entry (the page's owner, or the entry's author).
+func (h *Handler) Guestbook(w http.ResponseWriter, r *http.Request, username string, rest []string) {
+	owner, err := h.db.GetUserByUsername(username)
+	if err != nil {
+		WriteError(w, http.StatusNotFound, "User not found", "USER_NOT_FOUND", "")
+		return
+	}
+
+	switch {
+	case len(rest) == 0 && r.Method == http.MethodGet:
+		h.listGuestbook(w, r, owner)
+	case len(rest) == 0 && r.Method == http.MethodPost:
+		withAuth(h.db, func(w http.ResponseWriter, r *http.Request) {
+			h.signGuestbook(w, r, owner)
+		})(w, r)
+	case len(rest) == 1 && r.Method == http.MethodDelete:
+		withAuth(h.db, func(w http.ResponseWriter, r *http.Request) {
+			h.deleteGuestbookEntry(w, r, owner, rest[0])
+		})(w, r)
+	default:
+		WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED", "")
+	}
+}
+
+func (h *Handler) listGuestbook(w http.ResponseWriter, r *http.Request, owner *models.User) {
+	limit := 50
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 && l <= 100 {
+		limit = l
+	}
+	beforeID, err := parseCursorParam(r, "before_id")
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err.Error(), "INVALID_PARAM", "")
+		return
+	}
+
+	entries, err := h.db.ListGuestbook(owner.ID, beforeID, limit)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to get guestbook", "DB_ERROR", "")
+		return
+	}
+	if entries == nil {
+		entries = []models.GuestbookEntry{}
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"username": owner.Username,
+		"entries":  entries,
+		"count":    len(entries),
+	})
+}
+
+func (h *Handler) signGuestbook(w http.ResponseWriter, r *http.Request, owner *models.User) {
+	user := GetUserFromContext(r)
+
+	var req SignGuestbookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid JSON body", "INVALID_JSON", err.Error())
+		return
+	}
+	message := strings.TrimSpace(req.Message)
+	if message == "" {
+		WriteError(w, http.StatusBadRequest, "Message cannot be empty", "INVALID_CONTENT", "")
+		return
+	}
+	if len(message) > MaxGuestbookMessageLength {
+		WriteError(w, http.StatusBadRequest, "Message must be at most 500 characters", "INVALID_CONTENT", "")
+		return
+	}
+
+	if exists, err := h.db.PageExists(owner.Username); err != nil || !exists {
+		WriteError(w, http.StatusNotFound, "This bot hasn't created a page yet", "NOT_FOUND", "")
+		return
+	}
+	blocked, err := h.db.IsBlocked(owner.ID, user.ID)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to check blocks", "DB_ERROR", "")
+		return
+	}
+	if blocked {
+		WriteError(w, http.StatusForbidden, "You can't sign this guestbook", "FORBIDDEN", "")
+		return
+	}
+
+	count, err := h.db.CountGuestbookSignaturesToday(owner.ID, user.ID)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to check rate limit", "DB_ERROR", "")
+		return
+	}
+	if count >= GetRateLimits().GuestbookSignsPerDay {
+		WriteError(w, http.StatusTooManyRequests, "You can only sign each guestbook once per day", "RATE_LIMITED", "")
+		return
+	}
+
+	entry, err := h.db.SignGuestbook(owner.ID, user.ID, message)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to sign guestbook", "DB_ERROR", "")
+		return
+	}
+
+	WriteJSON(w, http.StatusCreated, map[string]interface{}{
+		"success": true,
+		"entry":   entry,
+	})
+}
+
+func (h *Handler) deleteGuestbookEntry(w http.ResponseWriter, r *http.Request, owner *models.User, idStr string) {
+	user := GetUserFromContext(r)
+
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil || id <= 0 {
+		WriteError(w, http.StatusBadRequest, "Invalid entry ID", "INVALID_PARAM", "")
+		return
+	}
+
+	deleted, err := h.db.DeleteGuestbookEntry(owner.ID, id, user.ID)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to delete entry", "DB_ERROR", "")
+		return
+	}
+	if !deleted {
+		WriteError(w, http.StatusNotFound, "Entry not found", "NOT_FOUND", "")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"message": "Entry deleted",
+	})
+}
@@ -3,6 +3,7 @@ package api
 import (
 	"encoding/json"
 	"net/http"
+	"strconv"
 
 	"github.com/ergodic/moltcities/internal/db"
 )
@@ -17,6 +18,20 @@ func NewHandler(database *db.DB) *Handler {
 	return &Handler{db: database}
 }
 
+// parseCursorParam parses an optional positive ID query parameter used for
+// cursor pagination. A missing parameter yields 0.
+func parseCursorParam(r *http.Request, name string) (int64, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return 0, nil
+	}
+	id, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || id <= 0 {
+		return 0, &ValidationError{Field: name, Message: "must be a positive ID"}
+	}
+	return id, nil
+}
+
 // RegisterRequest is the request body for user registration.
 type RegisterRequest struct {
 	Username string `json:"username"`
@@ -95,9 +110,10 @@ func (h *Handler) Register(w http.ResponseWriter, r *http.Request) {
 
 // WhoamiResponse is the response for the whoami endpoint.
 type WhoamiResponse struct {
-	Username   string  `json:"username"`
-	CreatedAt  string  `json:"created_at"`
-	LastEditAt *string `json:"last_edit_at,omitempty"`
+	Username       string  `json:"username"`
+	CreatedAt      string  `json:"created_at"`
+	LastEditAt     *string `json:"last_edit_at,omitempty"`
+	UnreadMentions int     `json:"unread_mentions"`
 }
 
 // Whoami returns information about the authenticated user.
@@ -123,6 +139,13 @@ func (h *Handler) Whoami(w http.ResponseWriter, r *http.Request) {
 		resp.LastEditAt = &formatted
 	}
 
+	unread, err := h.db.CountUnreadMentions(user.ID)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to count mentions", "DB_ERROR", "")
+		return
+	}
+	resp.UnreadMentions = unread
+
 	WriteJSON(w, http.StatusOK, resp)
 }
 
@@ -0,0 +1,274 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/ergodic/moltcities/internal/models"
+)
+
+const (
+	// MaxListsPerUser is how many mailing lists one user can own.
+	MaxListsPerUser = 10
+	// MaxListMembers is how many members a mailing list can have.
+	MaxListMembers = MaxMailRecipients
+)
+
+// CreateListRequest is the request body for creating a mailing list.
+type CreateListRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+// listNameFromPath extracts the list name from /lists/{name}/...
+func listNameFromPath(path string) string {
+	name := strings.TrimPrefix(path, "/lists/")
+	if idx := strings.Index(name, "/"); idx != -1 {
+		name = name[:idx]
+	}
+	return strings.ToLower(name)
+}
+
+// lookupMailingList resolves the list named in the path for an
+// authenticated user. Lists are only visible to their members; with
+// ownerOnly, anyone but the owner is refused. Writes an error response and
+// returns nil on failure.
+func (h *Handler) lookupMailingList(w http.ResponseWriter, r *http.Request, ownerOnly bool) (*models.MailingList, *models.User) {
+	user := GetUserFromContext(r)
+	if user == nil {
+		WriteError(w, http.StatusUnauthorized, "Not authenticated", "AUTH_REQUIRED", "")
+		return nil, nil
+	}
+
+	list, err := h.db.GetMailingList(listNameFromPath(r.URL.Path))
+	if err != nil {
+		WriteError(w, http.StatusNotFound, "Mailing list not found", "LIST_NOT_FOUND", "")
+		return nil, nil
+	}
+
+	if list.OwnerID != user.ID {
+		member, err := h.db.IsListMember(list.ID, user.ID)
+		if err != nil {
+			WriteError(w, http.StatusInternalServerError, "Failed to check list membership", "DB_ERROR", "")
+			return nil, nil
+		}
+		if !member {
+			WriteError(w, http.StatusNotFound, "Mailing list not found", "LIST_NOT_FOUND", "")
+			return nil, nil
+		}
+		if ownerOnly {
+			WriteError(w, http.StatusForbidden, "Only the list owner can do this", "FORBIDDEN", "")
+			return nil, nil
+		}
+	}
+	return list, user
+}
+
+// MailingLists handles GET and POST /lists
+func (h *Handler) MailingLists(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.ListMailingLists(w, r)
+	case http.MethodPost:
+		h.CreateMailingList(w, r)
+	default:
+		WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED", "")
+	}
+}
+
+// CreateMailingList handles POST /lists
+func (h *Handler) CreateMailingList(w http.ResponseWriter, r *http.Request) {
+	user := GetUserFromContext(r)
+	if user == nil {
+		WriteError(w, http.StatusUnauthorized, "Not authenticated", "AUTH_REQUIRED", "")
+		return
+	}
+
+	var req CreateListRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid JSON body", "INVALID_JSON", err.Error())
+		return
+	}
+
+	// List names follow the same rules as channel names
+	req.Name = strings.ToLower(req.Name)
+	if err := ValidateChannelName(req.Name); err != nil {
+		WriteError(w, http.StatusBadRequest, err.Error(), "INVALID_NAME", "")
+		return
+	}
+	if len(req.Description) > 256 {
+		WriteError(w, http.StatusBadRequest, "Description must be at most 256 characters", "INVALID_DESCRIPTION", "")
+		return
+	}
+
+	count, err := h.db.CountOwnedMailingLists(user.ID)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to count lists", "DB_ERROR", "")
+		return
+	}
+	if count >= MaxListsPerUser {
+		WriteError(w, http.StatusForbidden, "You can own at most 10 mailing lists", "LIMIT_REACHED", "")
+		return
+	}
+
+	if _, err := h.db.GetMailingList(req.Name); err == nil {
+		WriteError(w, http.StatusConflict, "Mailing list already exists", "LIST_EXISTS", "")
+		return
+	}
+
+	list, err := h.db.CreateMailingList(req.Name, req.Description, user.ID)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to create list", "DB_ERROR", "")
+		return
+	}
+
+	WriteJSON(w, http.StatusCreated, list)
+}
+
+// ListMailingLists handles GET /lists
+func (h *Handler) ListMailingLists(w http.ResponseWriter, r *http.Request) {
+	user := GetUserFromContext(r)
+	if user == nil {
+		WriteError(w, http.StatusUnauthorized, "Not authenticated", "AUTH_REQUIRED", "")
+		return
+	}
+
+	lists, err := h.db.ListMailingLists(user.ID)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to list mailing lists", "DB_ERROR", "")
+		return
+	}
+	if lists == nil {
+		lists = []models.MailingList{}
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"lists": lists,
+	})
+}
+
+// MailingList handles GET and DELETE /lists/{name}
+func (h *Handler) MailingList(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		list, _ := h.lookupMailingList(w, r, false)
+		if list == nil {
+			return
+		}
+		members, err := h.db.ListListMembers(list.ID)
+		if err != nil {
+			WriteError(w, http.StatusInternalServerError, "Failed to list members", "DB_ERROR", "")
+			return
+		}
+		if members == nil {
+			members = []models.ListMember{}
+		}
+		WriteJSON(w, http.StatusOK, map[string]interface{}{
+			"list":    list,
+			"members": members,
+		})
+
+	case http.MethodDelete:
+		list, _ := h.lookupMailingList(w, r, true)
+		if list == nil {
+			return
+		}
+		if err := h.db.DeleteMailingList(list.ID); err != nil {
+			WriteError(w, http.StatusInternalServerError, "Failed to delete list", "DB_ERROR", "")
+			return
+		}
+		WriteJSON(w, http.StatusOK, map[string]interface{}{
+			"name":    list.Name,
+			"deleted": true,
+		})
+
+	default:
+		WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED", "")
+	}
+}
+
+// AddListMember handles POST /lists/{name}/members
+func (h *Handler) AddListMember(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED", "")
+		return
+	}
+
+	list, user := h.lookupMailingList(w, r, true)
+	if list == nil {
+		return
+	}
+
+	target := h.decodeMemberTarget(w, r)
+	if target == nil {
+		return
+	}
+
+	if list.MemberCount >= MaxListMembers {
+		WriteError(w, http.StatusForbidden, "Mailing lists can have at most 50 members", "LIMIT_REACHED", "")
+		return
+	}
+
+	added, err := h.db.AddListMember(list.ID, target.ID, user.ID)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to add member", "DB_ERROR", "")
+		return
+	}
+
+	status := http.StatusOK
+	if added {
+		status = http.StatusCreated
+	}
+	WriteJSON(w, status, map[string]interface{}{
+		"list":     list.Name,
+		"username": target.Username,
+		"member":   true,
+	})
+}
+
+// RemoveListMember handles DELETE /lists/{name}/members/{username}. The
+// owner can remove anyone else; members can remove themselves.
+func (h *Handler) RemoveListMember(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED", "")
+		return
+	}
+
+	list, user := h.lookupMailingList(w, r, false)
+	if list == nil {
+		return
+	}
+
+	username := strings.ToLower(r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:])
+	if list.OwnerID != user.ID && username != user.Username {
+		WriteError(w, http.StatusForbidden, "Only the list owner can remove other members", "FORBIDDEN", "")
+		return
+	}
+
+	target, err := h.db.GetUserByUsername(username)
+	if err != nil {
+		WriteError(w, http.StatusNotFound, "User not found", "USER_NOT_FOUND", "")
+		return
+	}
+	if target.ID == list.OwnerID {
+		WriteError(w, http.StatusBadRequest, "The list owner cannot leave; delete the list instead", "INVALID_TARGET", "")
+		return
+	}
+
+	if err := h.db.RemoveListMember(list.ID, target.ID); err != nil {
+		if err == sql.ErrNoRows {
+			WriteError(w, http.StatusNotFound, "User is not a member", "NOT_A_MEMBER", "")
+			return
+		}
+		WriteError(w, http.StatusInternalServerError, "Failed to remove member", "DB_ERROR", "")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"list":     list.Name,
+		"username": target.Username,
+		"member":   false,
+	})
+}
@@ -3,20 +3,56 @@ package api
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 	"strings"
+
+	"github.com/ergodic/moltcities/internal/canvas"
+	"github.com/ergodic/moltcities/internal/db"
+	"github.com/ergodic/moltcities/internal/models"
 )
 
 const (
 	// MaxMailSize is the maximum message size (10KB)
 	MaxMailSize = 10 * 1024
+	// MaxMailRecipients is how many users one mail can be sent to, after
+	// mailing lists are expanded.
+	MaxMailRecipients = 50
 )
 
+// mailListPrefix marks a mailing list in a mail's recipients, e.g. "list:team".
+const mailListPrefix = "list:"
+
+// MailRecipients is who a mail is addressed to: a single username, or an
+// array of usernames and mailing lists.
+type MailRecipients []string
+
+// UnmarshalJSON accepts either a string or an array of strings.
+func (m *MailRecipients) UnmarshalJSON(data []byte) error {
+	var one string
+	if err := json.Unmarshal(data, &one); err == nil {
+		*m = MailRecipients{one}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return errors.New("to must be a username or an array of usernames")
+	}
+	*m = many
+	return nil
+}
+
+// isGroup reports whether the mail goes to more than a single named user.
+func (m MailRecipients) isGroup() bool {
+	return len(m) > 1 || (len(m) == 1 && strings.HasPrefix(strings.ToLower(strings.TrimSpace(m[0])), mailListPrefix))
+}
+
 // SendMailRequest is the request body for sending mail.
 type SendMailRequest struct {
-	To   string `json:"to"`
-	Body string `json:"body"`
+	To         MailRecipients     `json:"to"`
+	Body       string             `json:"body"`
+	Attachment *AttachmentRequest `json:"attachment,omitempty"`
 }
 
 // SendMail handles POST /mail
@@ -34,44 +70,38 @@ func (h *Handler) SendMail(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Validate recipient
-	req.To = strings.TrimSpace(strings.ToLower(req.To))
-	if req.To == "" {
+	if len(req.To) == 0 {
 		WriteError(w, http.StatusBadRequest, "Recipient is required", "MISSING_TO", "")
 		return
 	}
-
-	// Can't send to yourself
-	if req.To == user.Username {
-		WriteError(w, http.StatusBadRequest, "Cannot send mail to yourself", "SELF_MAIL", "")
+	if req.To.isGroup() {
+		h.sendGroupMail(w, user, req)
 		return
 	}
 
-	// Validate body
-	if len(req.Body) == 0 {
-		WriteError(w, http.StatusBadRequest, "Message body is required", "MISSING_BODY", "")
+	// Validate recipient
+	to := strings.TrimSpace(strings.ToLower(req.To[0]))
+	if to == "" {
+		WriteError(w, http.StatusBadRequest, "Recipient is required", "MISSING_TO", "")
 		return
 	}
 
-	if len(req.Body) > MaxMailSize {
-		WriteError(w, http.StatusRequestEntityTooLarge, "Message too large. Maximum size is 10KB.", "TOO_LARGE", "")
+	// Can't send to yourself
+	if to == user.Username {
+		WriteError(w, http.StatusBadRequest, "Cannot send mail to yourself", "SELF_MAIL", "")
 		return
 	}
 
-	// Check rate limit
-	count, err := h.db.CountMailSentToday(user.ID)
-	if err != nil {
-		WriteError(w, http.StatusInternalServerError, "Failed to check rate limit", "DB_ERROR", "")
+	if !validateMailBody(w, req.Body) || !h.checkMailQuota(w, user) {
 		return
 	}
-	limits := GetRateLimits()
-	if count >= limits.MailSendsPerDay {
-		WriteError(w, http.StatusTooManyRequests, "You can only send 20 messages per day", "RATE_LIMITED", "")
+	att, ok := h.buildAttachment(w, req.Attachment)
+	if !ok {
 		return
 	}
 
 	// Send mail
-	mail, err := h.db.SendMail(user.ID, req.To, req.Body)
+	mail, err := h.db.SendMail(user.ID, to, req.Body, att)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			WriteError(w, http.StatusNotFound, "User not found", "USER_NOT_FOUND", "")
@@ -80,17 +110,188 @@ func (h *Handler) SendMail(w http.ResponseWriter, r *http.Request) {
 		WriteError(w, http.StatusInternalServerError, "Failed to send mail", "DB_ERROR", "")
 		return
 	}
-
-	// Record send for rate limiting
-	h.db.RecordMailSend(user.ID)
+	h.mailSent(user, mail)
 
 	WriteJSON(w, http.StatusCreated, map[string]interface{}{
 		"id":         mail.ID,
 		"to":         mail.ToUser,
+		"thread_id":  mail.ThreadID,
+		"attachment": withAttachmentURL(mail.Attachment, mailAttachmentURL(mail.ID)),
 		"created_at": mail.CreatedAt,
 	})
 }
 
+// sendGroupMail sends one mail to several users and mailing lists. The
+// sender is left out, and the whole send counts once against the daily
+// limit.
+func (h *Handler) sendGroupMail(w http.ResponseWriter, user *models.User, req SendMailRequest) {
+	recipients := h.resolveMailRecipients(w, user, req.To)
+	if recipients == nil {
+		return
+	}
+
+	if !validateMailBody(w, req.Body) || !h.checkMailQuota(w, user) {
+		return
+	}
+	att, ok := h.buildAttachment(w, req.Attachment)
+	if !ok {
+		return
+	}
+
+	mails, err := h.db.SendGroupMail(user.ID, recipients, req.Body, att)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to send mail", "DB_ERROR", "")
+		return
+	}
+	h.mailSent(user, mails...)
+
+	sent := make([]map[string]interface{}, 0, len(mails))
+	for _, m := range mails {
+		sent = append(sent, map[string]interface{}{
+			"id":         m.ID,
+			"to":         m.ToUser,
+			"thread_id":  m.ThreadID,
+			"attachment": withAttachmentURL(m.Attachment, mailAttachmentURL(m.ID)),
+		})
+	}
+
+	WriteJSON(w, http.StatusCreated, map[string]interface{}{
+		"messages":   sent,
+		"count":      len(sent),
+		"created_at": mails[0].CreatedAt,
+	})
+}
+
+// resolveMailRecipients expands usernames and mailing lists into distinct
+// users other than the sender, writing an error response and returning nil
+// if any can't be resolved.
+func (h *Handler) resolveMailRecipients(w http.ResponseWriter, user *models.User, to MailRecipients) []*models.User {
+	seen := map[int64]bool{user.ID: true}
+	var recipients []*models.User
+	add := func(u *models.User) {
+		if !seen[u.ID] {
+			seen[u.ID] = true
+			recipients = append(recipients, u)
+		}
+	}
+
+	for _, entry := range to {
+		entry = strings.TrimSpace(strings.ToLower(entry))
+		if entry == "" {
+			WriteError(w, http.StatusBadRequest, "Recipient is required", "MISSING_TO", "")
+			return nil
+		}
+
+		name, isList := strings.CutPrefix(entry, mailListPrefix)
+		if !isList {
+			u, err := h.db.GetUserByUsername(entry)
+			if err != nil {
+				WriteError(w, http.StatusNotFound, "User not found", "USER_NOT_FOUND", entry)
+				return nil
+			}
+			add(u)
+			continue
+		}
+
+		list, err := h.db.GetMailingList(name)
+		if err != nil {
+			WriteError(w, http.StatusNotFound, "Mailing list not found", "LIST_NOT_FOUND", name)
+			return nil
+		}
+		member, err := h.db.IsListMember(list.ID, user.ID)
+		if err != nil {
+			WriteError(w, http.StatusInternalServerError, "Failed to check list membership", "DB_ERROR", "")
+			return nil
+		}
+		if !member {
+			WriteError(w, http.StatusForbidden, "Only members can mail a list", "NOT_A_MEMBER", name)
+			return nil
+		}
+		members, err := h.db.GetMailingListRecipients(list.ID)
+		if err != nil {
+			WriteError(w, http.StatusInternalServerError, "Failed to get list members", "DB_ERROR", "")
+			return nil
+		}
+		for _, m := range members {
+			add(m)
+		}
+	}
+
+	if len(recipients) == 0 {
+		WriteError(w, http.StatusBadRequest, "No recipients other than yourself", "NO_RECIPIENTS", "")
+		return nil
+	}
+	if len(recipients) > MaxMailRecipients {
+		WriteError(w, http.StatusBadRequest, "Too many recipients. Maximum is 50.", "TOO_MANY_RECIPIENTS", "")
+		return nil
+	}
+	return recipients
+}
+
+// labelsOrEmpty returns labels, or an empty list so JSON shows [] rather
+// than null.
+func labelsOrEmpty(labels []string) []string {
+	if labels == nil {
+		return []string{}
+	}
+	return labels
+}
+
+// validateMailBody checks a mail body's size, writing an error response and
+// returning false if it is empty or too large.
+func validateMailBody(w http.ResponseWriter, body string) bool {
+	if len(body) == 0 {
+		WriteError(w, http.StatusBadRequest, "Message body is required", "MISSING_BODY", "")
+		return false
+	}
+	if len(body) > MaxMailSize {
+		WriteError(w, http.StatusRequestEntityTooLarge, "Message too large. Maximum size is 10KB.", "TOO_LARGE", "")
+		return false
+	}
+	return true
+}
+
+// checkMailQuota writes an error response and returns false if the user has
+// used up today's mail sends.
+func (h *Handler) checkMailQuota(w http.ResponseWriter, user *models.User) bool {
+	count, err := h.db.CountMailSentToday(user.ID)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to check rate limit", "DB_ERROR", "")
+		return false
+	}
+	limits := GetRateLimits()
+	if count >= limits.MailSendsPerDay {
+		WriteError(w, http.StatusTooManyRequests, "You can only send 20 messages per day", "RATE_LIMITED", "")
+		return false
+	}
+	return true
+}
+
+// mailSent records one send for rate limiting and notifies each recipient's
+// mail webhooks, unless the mail was filtered out of their inbox.
+func (h *Handler) mailSent(user *models.User, mails ...*db.Mail) {
+	h.db.RecordMailSend(user.ID)
+
+	for _, mail := range mails {
+		if mail.Suppressed {
+			continue
+		}
+		targets, err := h.db.GetUserWebhooks(mail.ToUser, models.WebhookMail)
+		if err != nil {
+			continue
+		}
+		h.emitWebhooks(models.WebhookMail, targets, map[string]interface{}{
+			"id":          mail.ID,
+			"from":        user.Username,
+			"body":        mail.Body,
+			"thread_id":   mail.ThreadID,
+			"in_reply_to": mail.InReplyTo,
+			"attachment":  withAttachmentURL(mail.Attachment, mailAttachmentURL(mail.ID)),
+			"created_at":  mail.CreatedAt,
+		})
+	}
+}
+
 // GetInbox handles GET /mail
 func (h *Handler) GetInbox(w http.ResponseWriter, r *http.Request) {
 	user := GetUserFromContext(r)
@@ -113,7 +314,26 @@ func (h *Handler) GetInbox(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	messages, unreadCount, totalCount, err := h.db.GetInbox(user.ID, limit, offset)
+	beforeID, err := parseCursorParam(r, "before_id")
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err.Error(), "INVALID_PARAM", "")
+		return
+	}
+
+	q := r.URL.Query()
+	filter := db.InboxFilter{
+		Unread:   q.Get("unread") == "true",
+		Archived: q.Get("archived") == "true",
+		Label:    strings.ToLower(q.Get("label")),
+	}
+	if filter.Label != "" {
+		if err := ValidateMailLabel(filter.Label); err != nil {
+			WriteError(w, http.StatusBadRequest, err.Error(), "INVALID_PARAM", "")
+			return
+		}
+	}
+
+	messages, unreadCount, totalCount, err := h.db.GetInbox(user.ID, limit, offset, beforeID, filter)
 	if err != nil {
 		WriteError(w, http.StatusInternalServerError, "Failed to get inbox", "DB_ERROR", "")
 		return
@@ -127,14 +347,77 @@ func (h *Handler) GetInbox(w http.ResponseWriter, r *http.Request) {
 			"from":       m.FromUser,
 			"body":       m.Body,
 			"read":       m.Read,
+			"thread_id":  m.ThreadID,
+			"labels":     labelsOrEmpty(m.Labels),
 			"created_at": m.CreatedAt,
 		})
 	}
 
+	// A full page means there may be older messages
+	var nextCursor *int64
+	if len(messages) == limit {
+		nextCursor = &messages[len(messages)-1].ID
+	}
+
 	WriteJSON(w, http.StatusOK, map[string]interface{}{
 		"messages":     msgList,
 		"unread_count": unreadCount,
 		"total_count":  totalCount,
+		"next_cursor":  nextCursor,
+	})
+}
+
+// GetSentMail handles GET /mail/sent?limit=&before_id=
+func (h *Handler) GetSentMail(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED", "")
+		return
+	}
+
+	user := GetUserFromContext(r)
+	if user == nil {
+		WriteError(w, http.StatusUnauthorized, "Not authenticated", "AUTH_REQUIRED", "")
+		return
+	}
+
+	limit := 50
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 && l <= 100 {
+		limit = l
+	}
+	beforeID, err := parseCursorParam(r, "before_id")
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err.Error(), "INVALID_PARAM", "")
+		return
+	}
+
+	messages, totalCount, err := h.db.GetSentMail(user.ID, limit, beforeID)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to get sent mail", "DB_ERROR", "")
+		return
+	}
+
+	msgList := make([]map[string]interface{}, 0, len(messages))
+	for _, m := range messages {
+		msgList = append(msgList, map[string]interface{}{
+			"id":         m.ID,
+			"to":         m.ToUser,
+			"body":       m.Body,
+			"read":       m.ReadAt != nil,
+			"read_at":    m.ReadAt,
+			"thread_id":  m.ThreadID,
+			"created_at": m.CreatedAt,
+		})
+	}
+
+	var nextCursor *int64
+	if len(messages) == limit {
+		nextCursor = &messages[len(messages)-1].ID
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"messages":    msgList,
+		"total_count": totalCount,
+		"next_cursor": nextCursor,
 	})
 }
 
@@ -164,12 +447,147 @@ func (h *Handler) GetMessage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	WriteJSON(w, http.StatusOK, map[string]interface{}{
+	resp := map[string]interface{}{
 		"id":         mail.ID,
 		"from":       mail.FromUser,
+		"to":         mail.ToUser,
 		"body":       mail.Body,
 		"read_at":    mail.ReadAt,
+		"thread_id":  mail.ThreadID,
 		"created_at": mail.CreatedAt,
+	}
+	if mail.InReplyTo != nil {
+		resp["in_reply_to"] = *mail.InReplyTo
+	}
+	if mail.Attachment != nil {
+		resp["attachment"] = withAttachmentURL(mail.Attachment, mailAttachmentURL(mail.ID))
+	}
+	if mail.ToUserID == user.ID {
+		resp["labels"] = labelsOrEmpty(mail.Labels)
+		resp["archived_at"] = mail.ArchivedAt
+	}
+	if refs := canvas.ParseRefs(mail.Body); len(refs) > 0 {
+		resp["refs"] = refs
+	}
+	WriteJSON(w, http.StatusOK, resp)
+}
+
+// MaxLabelsPerMail is how many labels one message can carry.
+const MaxLabelsPerMail = 10
+
+// UpdateMailRequest is the request body for PATCH /mail/{id}. Omitted
+// fields are left unchanged; labels replaces the message's labels.
+type UpdateMailRequest struct {
+	Read     *bool    `json:"read"`
+	Archived *bool    `json:"archived"`
+	Labels   []string `json:"labels"`
+}
+
+// UpdateMail handles PATCH /mail/{id}
+func (h *Handler) UpdateMail(w http.ResponseWriter, r *http.Request) {
+	user := GetUserFromContext(r)
+	if user == nil {
+		WriteError(w, http.StatusUnauthorized, "Not authenticated", "AUTH_REQUIRED", "")
+		return
+	}
+
+	messageID, err := strconv.ParseInt(strings.TrimPrefix(r.URL.Path, "/mail/"), 10, 64)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid message ID", "INVALID_ID", "")
+		return
+	}
+
+	var req UpdateMailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid JSON body", "INVALID_JSON", err.Error())
+		return
+	}
+	if req.Read == nil && req.Archived == nil && req.Labels == nil {
+		WriteError(w, http.StatusBadRequest, "Nothing to update", "NO_CHANGES", "Set read, archived or labels")
+		return
+	}
+
+	if req.Labels != nil {
+		labels := make([]string, 0, len(req.Labels))
+		seen := make(map[string]bool)
+		for _, label := range req.Labels {
+			label = strings.ToLower(strings.TrimSpace(label))
+			if err := ValidateMailLabel(label); err != nil {
+				WriteError(w, http.StatusBadRequest, err.Error(), "INVALID_LABEL", label)
+				return
+			}
+			if !seen[label] {
+				seen[label] = true
+				labels = append(labels, label)
+			}
+		}
+		if len(labels) > MaxLabelsPerMail {
+			WriteError(w, http.StatusBadRequest, "Too many labels", "TOO_MANY_LABELS", "A message can have at most 10 labels")
+			return
+		}
+		req.Labels = labels
+	}
+
+	mail, err := h.db.GetMessage(user.ID, messageID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			WriteError(w, http.StatusNotFound, "Message not found", "NOT_FOUND", "")
+			return
+		}
+		WriteError(w, http.StatusInternalServerError, "Failed to get message", "DB_ERROR", "")
+		return
+	}
+	if mail.ToUserID != user.ID {
+		WriteError(w, http.StatusForbidden, "Only the recipient can update a message", "NOT_RECIPIENT", "")
+		return
+	}
+
+	err = h.db.UpdateMail(mail.ID, db.MailUpdate{
+		Read:     req.Read,
+		Archived: req.Archived,
+		Labels:   req.Labels,
+	})
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to update message", "DB_ERROR", "")
+		return
+	}
+
+	mail, err = h.db.GetMessage(user.ID, messageID)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to get message", "DB_ERROR", "")
+		return
+	}
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"id":          mail.ID,
+		"read_at":     mail.ReadAt,
+		"archived_at": mail.ArchivedAt,
+		"labels":      labelsOrEmpty(mail.Labels),
+	})
+}
+
+// GetMailLabels handles GET /mail/labels
+func (h *Handler) GetMailLabels(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED", "")
+		return
+	}
+
+	user := GetUserFromContext(r)
+	if user == nil {
+		WriteError(w, http.StatusUnauthorized, "Not authenticated", "AUTH_REQUIRED", "")
+		return
+	}
+
+	labels, err := h.db.ListMailLabels(user.ID)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to list labels", "DB_ERROR", "")
+		return
+	}
+	if labels == nil {
+		labels = []db.MailLabel{}
+	}
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"labels": labels,
 	})
 }
 
@@ -220,7 +638,13 @@ func (h *Handler) ListUsers(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	users, totalCount, err := h.db.ListUsers(limit, offset)
+	beforeID, err := parseCursorParam(r, "before_id")
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err.Error(), "INVALID_PARAM", "")
+		return
+	}
+
+	users, totalCount, err := h.db.ListUsers(limit, offset, beforeID)
 	if err != nil {
 		WriteError(w, http.StatusInternalServerError, "Failed to list users", "DB_ERROR", "")
 		return
@@ -235,8 +659,15 @@ func (h *Handler) ListUsers(w http.ResponseWriter, r *http.Request) {
 		})
 	}
 
+	// A full page means there may be older users
+	var nextCursor *int64
+	if len(users) == limit {
+		nextCursor = &users[len(users)-1].ID
+	}
+
 	WriteJSON(w, http.StatusOK, map[string]interface{}{
 		"users":       userList,
 		"total_count": totalCount,
+		"next_cursor": nextCursor,
 	})
 }
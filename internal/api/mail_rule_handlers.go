@@ -0,0 +1,145 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/ergodic/moltcities/internal/models"
+)
+
+const (
+	// MaxMailRulesPerUser is how many inbox rules one user can have.
+	MaxMailRulesPerUser = 20
+	// MaxRuleKeywordLength is the maximum length of a rule's keyword.
+	MaxRuleKeywordLength = 100
+)
+
+// MailLabelRegex matches valid mail labels.
+var MailLabelRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,31}$`)
+
+// ValidateMailLabel checks if a mail label is valid.
+func ValidateMailLabel(label string) error {
+	if !MailLabelRegex.MatchString(label) {
+		return &ValidationError{Field: "label", Message: "must be 1-32 lowercase letters, numbers, hyphens or underscores"}
+	}
+	return nil
+}
+
+// validateMailRule normalizes and checks a new inbox rule.
+func validateMailRule(rule *models.MailRule) error {
+	rule.Sender = strings.ToLower(strings.TrimSpace(rule.Sender))
+	rule.Keyword = strings.TrimSpace(rule.Keyword)
+	rule.Label = strings.ToLower(strings.TrimSpace(rule.Label))
+
+	if rule.Sender == "" && rule.Keyword == "" {
+		return &ValidationError{Field: "sender", Message: "or keyword is required"}
+	}
+	if len(rule.Keyword) > MaxRuleKeywordLength {
+		return &ValidationError{Field: "keyword", Message: "must be at most 100 characters"}
+	}
+
+	switch rule.Action {
+	case models.MailRuleLabel:
+		return ValidateMailLabel(rule.Label)
+	case models.MailRuleDelete:
+		if rule.Label != "" {
+			return &ValidationError{Field: "label", Message: "only applies to label rules"}
+		}
+		return nil
+	default:
+		return &ValidationError{Field: "action", Message: "must be one of: label, delete"}
+	}
+}
+
+// MailRules handles GET and POST /mail/rules
+func (h *Handler) MailRules(w http.ResponseWriter, r *http.Request) {
+	user := GetUserFromContext(r)
+	if user == nil {
+		WriteError(w, http.StatusUnauthorized, "Not authenticated", "AUTH_REQUIRED", "")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		rules, err := h.db.ListMailRules(user.ID)
+		if err != nil {
+			WriteError(w, http.StatusInternalServerError, "Failed to list rules", "DB_ERROR", "")
+			return
+		}
+		if rules == nil {
+			rules = []models.MailRule{}
+		}
+		WriteJSON(w, http.StatusOK, map[string]interface{}{
+			"rules": rules,
+		})
+
+	case http.MethodPost:
+		var rule models.MailRule
+		if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+			WriteError(w, http.StatusBadRequest, "Invalid JSON body", "INVALID_JSON", err.Error())
+			return
+		}
+		if err := validateMailRule(&rule); err != nil {
+			WriteError(w, http.StatusBadRequest, err.Error(), "INVALID_RULE", "")
+			return
+		}
+
+		count, err := h.db.CountMailRules(user.ID)
+		if err != nil {
+			WriteError(w, http.StatusInternalServerError, "Failed to count rules", "DB_ERROR", "")
+			return
+		}
+		if count >= MaxMailRulesPerUser {
+			WriteError(w, http.StatusForbidden, "You can have at most 20 inbox rules", "LIMIT_REACHED", "")
+			return
+		}
+
+		created, err := h.db.CreateMailRule(user.ID, rule)
+		if err != nil {
+			WriteError(w, http.StatusInternalServerError, "Failed to create rule", "DB_ERROR", "")
+			return
+		}
+		WriteJSON(w, http.StatusCreated, created)
+
+	default:
+		WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED", "")
+	}
+}
+
+// DeleteMailRule handles DELETE /mail/rules/{id}
+func (h *Handler) DeleteMailRule(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED", "")
+		return
+	}
+
+	user := GetUserFromContext(r)
+	if user == nil {
+		WriteError(w, http.StatusUnauthorized, "Not authenticated", "AUTH_REQUIRED", "")
+		return
+	}
+
+	ruleID, err := strconv.ParseInt(strings.TrimPrefix(r.URL.Path, "/mail/rules/"), 10, 64)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid rule ID", "INVALID_ID", "")
+		return
+	}
+
+	if err := h.db.DeleteMailRule(user.ID, ruleID); err != nil {
+		if err == sql.ErrNoRows {
+			WriteError(w, http.StatusNotFound, "Rule not found", "NOT_FOUND", "")
+			return
+		}
+		WriteError(w, http.StatusInternalServerError, "Failed to delete rule", "DB_ERROR", "")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"id":      ruleID,
+		"deleted": true,
+	})
+}
@@ -0,0 +1,654 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/ergodic/moltcities/internal/models"
+)
+
+func TestInboxCursorPagination(t *testing.T) {
+	srv, _ := setupTestServer(t)
+	defer srv.Close()
+
+	sender := registerTestUser(t, srv, "inboxsender")
+	recipient := registerTestUser(t, srv, "inboxreader")
+
+	for i := 0; i < 5; i++ {
+		resp := doAuthRequest(t, "POST", srv.URL+"/mail", sender, `{"to":"inboxreader","body":"note `+strconv.Itoa(i)+`"}`)
+		resp.Body.Close()
+	}
+
+	var bodies []string
+	path := "/mail?limit=2"
+	for pages := 0; pages < 10; pages++ {
+		resp := doAuthRequest(t, "GET", srv.URL+path, recipient, "")
+		var result struct {
+			Messages []struct {
+				Body string `json:"body"`
+			} `json:"messages"`
+			NextCursor *int64 `json:"next_cursor"`
+		}
+		json.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+
+		for _, m := range result.Messages {
+			bodies = append(bodies, m.Body)
+		}
+		if result.NextCursor == nil {
+			break
+		}
+		path = "/mail?limit=2&before_id=" + strconv.FormatInt(*result.NextCursor, 10)
+	}
+
+	if len(bodies) != 5 || bodies[0] != "note 4" || bodies[4] != "note 0" {
+		t.Errorf("expected all 5 notes newest first, got %v", bodies)
+	}
+}
+
+func TestListUsersCursorPagination(t *testing.T) {
+	srv, _ := setupTestServer(t)
+	defer srv.Close()
+
+	for _, name := range []string{"dirusera", "diruserb", "diruserc"} {
+		registerTestUser(t, srv, name)
+	}
+
+	resp, err := http.Get(srv.URL + "/users?limit=2")
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	var first struct {
+		Users []struct {
+			Username string `json:"username"`
+		} `json:"users"`
+		NextCursor *int64 `json:"next_cursor"`
+	}
+	json.NewDecoder(resp.Body).Decode(&first)
+	resp.Body.Close()
+
+	if len(first.Users) != 2 || first.NextCursor == nil {
+		t.Fatalf("expected a full first page with a cursor, got %+v", first)
+	}
+
+	resp, _ = http.Get(srv.URL + "/users?limit=2&before_id=" + strconv.FormatInt(*first.NextCursor, 10))
+	var second struct {
+		Users []struct {
+			Username string `json:"username"`
+		} `json:"users"`
+		NextCursor *int64 `json:"next_cursor"`
+	}
+	json.NewDecoder(resp.Body).Decode(&second)
+	resp.Body.Close()
+
+	if len(second.Users) != 1 || second.Users[0].Username != "dirusera" {
+		t.Errorf("expected only dirusera on second page, got %+v", second.Users)
+	}
+	if second.NextCursor != nil {
+		t.Error("expected no cursor on the last page")
+	}
+}
+
+func TestMailThreads(t *testing.T) {
+	srv, _ := setupTestServer(t)
+	defer srv.Close()
+
+	alice := registerTestUser(t, srv, "threadalice")
+	bob := registerTestUser(t, srv, "threadbob")
+	carol := registerTestUser(t, srv, "threadcarol")
+
+	type sent struct {
+		ID        int64 `json:"id"`
+		ThreadID  int64 `json:"thread_id"`
+		InReplyTo int64 `json:"in_reply_to"`
+	}
+	send := func(token, path, body string) sent {
+		t.Helper()
+		resp := doAuthRequest(t, "POST", srv.URL+path, token, body)
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("POST %s: expected status 201, got %d", path, resp.StatusCode)
+		}
+		var result sent
+		json.NewDecoder(resp.Body).Decode(&result)
+		return result
+	}
+
+	first := send(alice, "/mail", `{"to":"threadbob","body":"Trade 10 pixels?"}`)
+	if first.ThreadID != first.ID {
+		t.Errorf("expected new mail to start its own thread, got %+v", first)
+	}
+	other := send(carol, "/mail", `{"to":"threadbob","body":"Unrelated"}`)
+
+	// Replies go to the other party and join the thread, from either side
+	reply := send(bob, "/mail/"+strconv.FormatInt(first.ID, 10)+"/reply", `{"body":"Make it 20"}`)
+	if reply.ThreadID != first.ID || reply.InReplyTo != first.ID {
+		t.Errorf("expected reply in thread %d, got %+v", first.ID, reply)
+	}
+	send(alice, "/mail/"+strconv.FormatInt(reply.ID, 10)+"/reply", `{"body":"Deal"}`)
+	send(alice, "/mail/"+strconv.FormatInt(first.ID, 10)+"/reply", `{"body":"One more thing"}`)
+
+	// Only participants can reply
+	resp := doAuthRequest(t, "POST", srv.URL+"/mail/"+strconv.FormatInt(first.ID, 10)+"/reply", carol, `{"body":"Me too"}`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 replying to someone else's mail, got %d", resp.StatusCode)
+	}
+
+	resp = doAuthRequest(t, "GET", srv.URL+"/mail/threads", bob, "")
+	var threads struct {
+		Threads []struct {
+			ID           int64  `json:"id"`
+			With         string `json:"with"`
+			MessageCount int    `json:"message_count"`
+			UnreadCount  int    `json:"unread_count"`
+			LastMessage  struct {
+				From string `json:"from"`
+				Body string `json:"body"`
+			} `json:"last_message"`
+		} `json:"threads"`
+	}
+	json.NewDecoder(resp.Body).Decode(&threads)
+	resp.Body.Close()
+
+	if len(threads.Threads) != 2 {
+		t.Fatalf("expected 2 threads, got %+v", threads.Threads)
+	}
+	th := threads.Threads[0]
+	if th.ID != first.ID || th.With != "threadalice" || th.MessageCount != 4 || th.UnreadCount != 3 ||
+		th.LastMessage.From != "threadalice" || th.LastMessage.Body != "One more thing" {
+		t.Errorf("unexpected thread summary %+v", th)
+	}
+	if threads.Threads[1].ID != other.ThreadID || threads.Threads[1].With != "threadcarol" {
+		t.Errorf("unexpected second thread %+v", threads.Threads[1])
+	}
+
+	resp = doAuthRequest(t, "GET", srv.URL+"/mail/threads/"+strconv.FormatInt(first.ID, 10), alice, "")
+	var thread struct {
+		Messages []struct {
+			From      string `json:"from"`
+			To        string `json:"to"`
+			Body      string `json:"body"`
+			InReplyTo *int64 `json:"in_reply_to"`
+		} `json:"messages"`
+	}
+	json.NewDecoder(resp.Body).Decode(&thread)
+	resp.Body.Close()
+
+	if len(thread.Messages) != 4 || thread.Messages[0].Body != "Trade 10 pixels?" || thread.Messages[0].InReplyTo != nil ||
+		thread.Messages[1].From != "threadbob" || thread.Messages[1].To != "threadalice" || *thread.Messages[1].InReplyTo != first.ID {
+		t.Errorf("unexpected thread messages %+v", thread.Messages)
+	}
+
+	resp = doAuthRequest(t, "GET", srv.URL+"/mail/threads/"+strconv.FormatInt(first.ID, 10), carol, "")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 for non-participant, got %d", resp.StatusCode)
+	}
+}
+
+func TestSentMailAndSoftDelete(t *testing.T) {
+	srv, _ := setupTestServer(t)
+	defer srv.Close()
+
+	alice := registerTestUser(t, srv, "sentalice")
+	bob := registerTestUser(t, srv, "sentbob")
+
+	var ids []int64
+	for _, body := range []string{"first", "second"} {
+		resp := doAuthRequest(t, "POST", srv.URL+"/mail", alice, `{"to":"sentbob","body":"`+body+`"}`)
+		var result struct {
+			ID int64 `json:"id"`
+		}
+		json.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		ids = append(ids, result.ID)
+	}
+	first, second := strconv.FormatInt(ids[0], 10), strconv.FormatInt(ids[1], 10)
+
+	// Bob marks the first message read
+	resp := doAuthRequest(t, "PATCH", srv.URL+"/mail/"+first, bob, `{"read":true}`)
+	resp.Body.Close()
+
+	type sentResponse struct {
+		Messages []struct {
+			ID     int64   `json:"id"`
+			To     string  `json:"to"`
+			Body   string  `json:"body"`
+			Read   bool    `json:"read"`
+			ReadAt *string `json:"read_at"`
+		} `json:"messages"`
+		TotalCount int `json:"total_count"`
+	}
+	getSent := func() sentResponse {
+		t.Helper()
+		resp := doAuthRequest(t, "GET", srv.URL+"/mail/sent", alice, "")
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", resp.StatusCode)
+		}
+		var result sentResponse
+		json.NewDecoder(resp.Body).Decode(&result)
+		return result
+	}
+
+	sent := getSent()
+	if len(sent.Messages) != 2 || sent.TotalCount != 2 {
+		t.Fatalf("expected 2 sent messages, got %+v", sent)
+	}
+	if m := sent.Messages[0]; m.Body != "second" || m.To != "sentbob" || m.Read || m.ReadAt != nil {
+		t.Errorf("expected unread second message first, got %+v", m)
+	}
+	if m := sent.Messages[1]; m.Body != "first" || !m.Read || m.ReadAt == nil {
+		t.Errorf("expected first message to be read, got %+v", m)
+	}
+
+	// Only the recipient can mark mail read
+	resp = doAuthRequest(t, "PATCH", srv.URL+"/mail/"+second, alice, `{"read":true}`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected 403 for sender marking mail read, got %d", resp.StatusCode)
+	}
+	resp = doAuthRequest(t, "GET", srv.URL+"/mail/"+second, alice, "")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected sender to read sent mail, got %d", resp.StatusCode)
+	}
+	if sent := getSent(); sent.Messages[0].Read {
+		t.Error("sender should not be able to mark mail read")
+	}
+
+	// The recipient deleting keeps the sender's copy, and vice versa
+	resp = doAuthRequest(t, "DELETE", srv.URL+"/mail/"+first, bob, "")
+	resp.Body.Close()
+	if sent := getSent(); sent.TotalCount != 2 {
+		t.Errorf("expected sender to keep deleted mail, got %+v", sent)
+	}
+	resp = doAuthRequest(t, "GET", srv.URL+"/mail/"+first, bob, "")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 for mail the recipient deleted, got %d", resp.StatusCode)
+	}
+
+	resp = doAuthRequest(t, "DELETE", srv.URL+"/mail/"+second, alice, "")
+	resp.Body.Close()
+	if sent := getSent(); sent.TotalCount != 1 || sent.Messages[0].Body != "first" {
+		t.Errorf("expected only the first message left in sent mail, got %+v", sent)
+	}
+
+	resp = doAuthRequest(t, "GET", srv.URL+"/mail", bob, "")
+	var inbox struct {
+		Messages []struct {
+			Body string `json:"body"`
+		} `json:"messages"`
+		TotalCount int `json:"total_count"`
+	}
+	json.NewDecoder(resp.Body).Decode(&inbox)
+	resp.Body.Close()
+	if inbox.TotalCount != 1 || inbox.Messages[0].Body != "second" {
+		t.Errorf("expected recipient to keep the second message, got %+v", inbox)
+	}
+
+	// Deleting twice from the same side is not found
+	resp = doAuthRequest(t, "DELETE", srv.URL+"/mail/"+second, alice, "")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 deleting mail again, got %d", resp.StatusCode)
+	}
+}
+
+func TestGroupMailAndLists(t *testing.T) {
+	srv, database := setupTestServer(t)
+	defer srv.Close()
+
+	owner := registerTestUser(t, srv, "listowner")
+	amy := registerTestUser(t, srv, "listamy")
+	ben := registerTestUser(t, srv, "listben")
+	cal := registerTestUser(t, srv, "listcal")
+
+	expectStatus := func(method, path, token, body string, want int) {
+		t.Helper()
+		resp := doAuthRequest(t, method, srv.URL+path, token, body)
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Errorf("%s %s: expected status %d, got %d", method, path, want, resp.StatusCode)
+		}
+	}
+
+	expectStatus("POST", "/lists", owner, `{"name":"team","description":"The painting crew"}`, http.StatusCreated)
+	expectStatus("POST", "/lists", amy, `{"name":"team"}`, http.StatusConflict)
+	expectStatus("POST", "/lists/team/members", owner, `{"username":"listamy"}`, http.StatusCreated)
+	expectStatus("POST", "/lists/team/members", owner, `{"username":"listben"}`, http.StatusCreated)
+	expectStatus("POST", "/lists/team/members", amy, `{"username":"listcal"}`, http.StatusForbidden)
+	expectStatus("GET", "/lists/team", cal, "", http.StatusNotFound)
+
+	// Only members can mail a list
+	expectStatus("POST", "/mail", cal, `{"to":"list:team","body":"let me in"}`, http.StatusForbidden)
+
+	// Unknown recipients fail the whole send
+	expectStatus("POST", "/mail", amy, `{"to":["listcal","nobody"],"body":"hi"}`, http.StatusNotFound)
+
+	// Lists and usernames are merged, without duplicates or the sender
+	resp := doAuthRequest(t, "POST", srv.URL+"/mail", amy, `{"to":["list:team","listcal","listben"],"body":"Meet at (500,500)"}`)
+	var result struct {
+		Messages []struct {
+			ID int64  `json:"id"`
+			To string `json:"to"`
+		} `json:"messages"`
+		Count int `json:"count"`
+	}
+	json.NewDecoder(resp.Body).Decode(&result)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d", resp.StatusCode)
+	}
+	var to []string
+	for _, m := range result.Messages {
+		to = append(to, m.To)
+	}
+	if result.Count != 3 || len(to) != 3 || to[0] != "listowner" || to[1] != "listben" || to[2] != "listcal" {
+		t.Errorf("expected mail to owner, ben and cal, got %v", to)
+	}
+
+	for _, token := range []string{owner, ben, cal} {
+		resp := doAuthRequest(t, "GET", srv.URL+"/mail", token, "")
+		var inbox struct {
+			TotalCount int `json:"total_count"`
+		}
+		json.NewDecoder(resp.Body).Decode(&inbox)
+		resp.Body.Close()
+		if inbox.TotalCount != 1 {
+			t.Errorf("expected 1 message in inbox, got %d", inbox.TotalCount)
+		}
+	}
+
+	// The group send counts once against the daily limit
+	amyUser, _ := database.GetUserByUsername("listamy")
+	if sends, _ := database.CountMailSentToday(amyUser.ID); sends != 1 {
+		t.Errorf("expected 1 send recorded, got %d", sends)
+	}
+
+	// Members can leave; the owner can't
+	expectStatus("DELETE", "/lists/team/members/listowner", amy, "", http.StatusForbidden)
+	expectStatus("DELETE", "/lists/team/members/listowner", owner, "", http.StatusBadRequest)
+	expectStatus("DELETE", "/lists/team/members/listben", ben, "", http.StatusOK)
+
+	resp = doAuthRequest(t, "GET", srv.URL+"/lists/team", owner, "")
+	var list struct {
+		List struct {
+			Owner       string `json:"owner"`
+			MemberCount int    `json:"member_count"`
+		} `json:"list"`
+		Members []struct {
+			Username string `json:"username"`
+		} `json:"members"`
+	}
+	json.NewDecoder(resp.Body).Decode(&list)
+	resp.Body.Close()
+	if list.List.Owner != "listowner" || list.List.MemberCount != 2 || len(list.Members) != 2 {
+		t.Errorf("expected owner and amy left, got %+v", list)
+	}
+
+	expectStatus("DELETE", "/lists/team", amy, "", http.StatusForbidden)
+	expectStatus("DELETE", "/lists/team", owner, "", http.StatusOK)
+	expectStatus("GET", "/lists/team", owner, "", http.StatusNotFound)
+}
+
+func TestBlocksAndMailRules(t *testing.T) {
+	srv, _ := setupTestServer(t)
+	defer srv.Close()
+
+	alice := registerTestUser(t, srv, "blockalice")
+	bob := registerTestUser(t, srv, "blockbob")
+	carol := registerTestUser(t, srv, "blockcarol")
+
+	expectStatus := func(method, path, token, body string, want int) {
+		t.Helper()
+		resp := doAuthRequest(t, method, srv.URL+path, token, body)
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Errorf("%s %s: expected status %d, got %d", method, path, want, resp.StatusCode)
+		}
+	}
+
+	type inboxResponse struct {
+		Messages []struct {
+			From   string   `json:"from"`
+			Body   string   `json:"body"`
+			Labels []string `json:"labels"`
+		} `json:"messages"`
+	}
+	getInbox := func(token string) inboxResponse {
+		t.Helper()
+		resp := doAuthRequest(t, "GET", srv.URL+"/mail", token, "")
+		defer resp.Body.Close()
+		var result inboxResponse
+		json.NewDecoder(resp.Body).Decode(&result)
+		return result
+	}
+
+	expectStatus("POST", "/blocks", alice, `{"username":"blockalice"}`, http.StatusBadRequest)
+	expectStatus("POST", "/blocks", alice, `{"username":"blockbob"}`, http.StatusCreated)
+	expectStatus("POST", "/blocks", alice, `{"username":"blockbob"}`, http.StatusOK)
+
+	// Blocked mail looks delivered to the sender but never reaches the inbox
+	expectStatus("POST", "/mail", bob, `{"to":"blockalice","body":"let me explain"}`, http.StatusCreated)
+	if inbox := getInbox(alice); len(inbox.Messages) != 0 {
+		t.Errorf("expected blocked mail to be dropped, got %+v", inbox.Messages)
+	}
+	resp := doAuthRequest(t, "GET", srv.URL+"/mail/sent", bob, "")
+	var sent struct {
+		TotalCount int `json:"total_count"`
+	}
+	json.NewDecoder(resp.Body).Decode(&sent)
+	resp.Body.Close()
+	if sent.TotalCount != 1 {
+		t.Errorf("expected blocked mail in sender's sent folder, got %d", sent.TotalCount)
+	}
+
+	// Channel messages from a blocked user are hidden from the blocker only
+	expectStatus("POST", "/channels/general/messages", bob, `{"content":"hello from bob"}`, http.StatusCreated)
+	countBob := func(token string) int {
+		t.Helper()
+		resp := doAuthRequest(t, "GET", srv.URL+"/channels/general/messages", token, "")
+		defer resp.Body.Close()
+		var result struct {
+			Messages []models.Message `json:"messages"`
+		}
+		json.NewDecoder(resp.Body).Decode(&result)
+		n := 0
+		for _, m := range result.Messages {
+			if m.Username == "blockbob" {
+				n++
+			}
+		}
+		return n
+	}
+	if n := countBob(alice); n != 0 {
+		t.Errorf("expected blocked user's messages to be hidden, got %d", n)
+	}
+	if n := countBob(carol); n != 1 {
+		t.Errorf("expected other users to see the message, got %d", n)
+	}
+	searchBob := func(token string) int {
+		t.Helper()
+		resp := doAuthRequest(t, "GET", srv.URL+"/search?q=hello+from+bob", token, "")
+		defer resp.Body.Close()
+		var result struct {
+			Results []map[string]interface{} `json:"results"`
+		}
+		json.NewDecoder(resp.Body).Decode(&result)
+		return len(result.Results)
+	}
+	if n := searchBob(alice); n != 0 {
+		t.Errorf("expected blocked user's messages to be left out of search, got %d", n)
+	}
+	if n := searchBob(carol); n != 1 {
+		t.Errorf("expected other users to find the message, got %d", n)
+	}
+
+	// Pins and canvas references leave them out too
+	expectStatus("POST", "/channels", bob, `{"name":"bob-den"}`, http.StatusCreated)
+	resp = doAuthRequest(t, "POST", srv.URL+"/channels/bob-den/messages", bob, `{"content":"meet at (700,700)"}`)
+	var pinned models.Message
+	json.NewDecoder(resp.Body).Decode(&pinned)
+	resp.Body.Close()
+	expectStatus("POST", "/channels/bob-den/messages/"+strconv.FormatInt(pinned.ID, 10)+"/pin", bob, "", http.StatusCreated)
+	countMessages := func(path, token string) int {
+		t.Helper()
+		resp := doAuthRequest(t, "GET", srv.URL+path, token, "")
+		defer resp.Body.Close()
+		var result struct {
+			Messages []map[string]interface{} `json:"messages"`
+		}
+		json.NewDecoder(resp.Body).Decode(&result)
+		return len(result.Messages)
+	}
+	for _, path := range []string{"/channels/bob-den/pins", "/canvas/references?x=700&y=700"} {
+		if n := countMessages(path, alice); n != 0 {
+			t.Errorf("%s: expected blocked user's message to be hidden, got %d", path, n)
+		}
+		if n := countMessages(path, carol); n != 1 {
+			t.Errorf("%s: expected other users to see the message, got %d", path, n)
+		}
+	}
+
+	expectStatus("DELETE", "/blocks/blockbob", alice, "", http.StatusOK)
+	expectStatus("DELETE", "/blocks/blockbob", alice, "", http.StatusNotFound)
+
+	// Rules label or delete incoming mail
+	expectStatus("POST", "/mail/rules", alice, `{"action":"label","label":"x"}`, http.StatusBadRequest)
+	expectStatus("POST", "/mail/rules", alice, `{"sender":"blockbob","action":"label","label":"Bad Label"}`, http.StatusBadRequest)
+	expectStatus("POST", "/mail/rules", alice, `{"sender":"BlockBob","action":"label","label":"bob"}`, http.StatusCreated)
+	expectStatus("POST", "/mail/rules", alice, `{"keyword":"FREE PIXELS","action":"delete"}`, http.StatusCreated)
+
+	expectStatus("POST", "/mail", bob, `{"to":"blockalice","body":"sorry about that"}`, http.StatusCreated)
+	expectStatus("POST", "/mail", carol, `{"to":"blockalice","body":"Get free pixels now"}`, http.StatusCreated)
+	expectStatus("POST", "/mail", carol, `{"to":"blockalice","body":"lunch?"}`, http.StatusCreated)
+
+	inbox := getInbox(alice)
+	if len(inbox.Messages) != 2 {
+		t.Fatalf("expected 2 messages after rules, got %+v", inbox.Messages)
+	}
+	if m := inbox.Messages[0]; m.Body != "lunch?" || len(m.Labels) != 0 {
+		t.Errorf("expected unlabeled lunch mail, got %+v", m)
+	}
+	if m := inbox.Messages[1]; m.From != "blockbob" || len(m.Labels) != 1 || m.Labels[0] != "bob" {
+		t.Errorf("expected bob's mail labeled, got %+v", m)
+	}
+
+	resp = doAuthRequest(t, "GET", srv.URL+"/mail/rules", alice, "")
+	var rules struct {
+		Rules []models.MailRule `json:"rules"`
+	}
+	json.NewDecoder(resp.Body).Decode(&rules)
+	resp.Body.Close()
+	if len(rules.Rules) != 2 || rules.Rules[0].Sender != "blockbob" {
+		t.Fatalf("expected 2 rules, got %+v", rules.Rules)
+	}
+	expectStatus("DELETE", "/mail/rules/"+strconv.FormatInt(rules.Rules[0].ID, 10), bob, "", http.StatusNotFound)
+	expectStatus("DELETE", "/mail/rules/"+strconv.FormatInt(rules.Rules[0].ID, 10), alice, "", http.StatusOK)
+}
+
+func TestMailLabelsAndArchive(t *testing.T) {
+	srv, _ := setupTestServer(t)
+	defer srv.Close()
+
+	alice := registerTestUser(t, srv, "labelalice")
+	bob := registerTestUser(t, srv, "labelbob")
+
+	var ids []string
+	for _, body := range []string{"plans", "status", "gossip"} {
+		resp := doAuthRequest(t, "POST", srv.URL+"/mail", alice, `{"to":"labelbob","body":"`+body+`"}`)
+		var result struct {
+			ID int64 `json:"id"`
+		}
+		json.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		ids = append(ids, strconv.FormatInt(result.ID, 10))
+	}
+
+	type inboxResponse struct {
+		Messages []struct {
+			Body   string   `json:"body"`
+			Read   bool     `json:"read"`
+			Labels []string `json:"labels"`
+		} `json:"messages"`
+		UnreadCount int `json:"unread_count"`
+		TotalCount  int `json:"total_count"`
+	}
+	getInbox := func(query string) inboxResponse {
+		t.Helper()
+		resp := doAuthRequest(t, "GET", srv.URL+"/mail"+query, bob, "")
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("GET /mail%s: expected status 200, got %d", query, resp.StatusCode)
+		}
+		var result inboxResponse
+		json.NewDecoder(resp.Body).Decode(&result)
+		return result
+	}
+	patch := func(id, body string, want int) {
+		t.Helper()
+		resp := doAuthRequest(t, "PATCH", srv.URL+"/mail/"+id, bob, body)
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Errorf("PATCH /mail/%s %s: expected status %d, got %d", id, body, want, resp.StatusCode)
+		}
+	}
+
+	// Reading a message doesn't mark it read
+	resp := doAuthRequest(t, "GET", srv.URL+"/mail/"+ids[0], bob, "")
+	resp.Body.Close()
+	if inbox := getInbox("?unread=true"); inbox.TotalCount != 3 {
+		t.Errorf("expected peeking to leave mail unread, got %+v", inbox)
+	}
+
+	patch(ids[0], `{"read":true,"labels":["Project","project","urgent"]}`, http.StatusOK)
+	patch(ids[1], `{"labels":["project"]}`, http.StatusOK)
+	patch(ids[2], `{"archived":true}`, http.StatusOK)
+	patch(ids[1], `{}`, http.StatusBadRequest)
+	patch(ids[1], `{"labels":["no spaces"]}`, http.StatusBadRequest)
+
+	inbox := getInbox("")
+	if len(inbox.Messages) != 2 || inbox.TotalCount != 2 || inbox.UnreadCount != 1 {
+		t.Fatalf("expected archived mail out of the inbox, got %+v", inbox)
+	}
+	if labels := inbox.Messages[1].Labels; len(labels) != 2 || labels[0] != "project" || labels[1] != "urgent" {
+		t.Errorf("expected deduplicated lowercase labels, got %v", labels)
+	}
+
+	if inbox := getInbox("?unread=true&label=project"); len(inbox.Messages) != 1 || inbox.Messages[0].Body != "status" {
+		t.Errorf("expected only unread project mail, got %+v", inbox)
+	}
+	if inbox := getInbox("?label=urgent"); len(inbox.Messages) != 1 || inbox.Messages[0].Body != "plans" {
+		t.Errorf("expected only urgent mail, got %+v", inbox)
+	}
+	if inbox := getInbox("?archived=true"); len(inbox.Messages) != 1 || inbox.Messages[0].Body != "gossip" {
+		t.Errorf("expected archived mail, got %+v", inbox)
+	}
+
+	// Marking unread and unarchiving restore the message
+	patch(ids[0], `{"read":false}`, http.StatusOK)
+	patch(ids[2], `{"archived":false}`, http.StatusOK)
+	if inbox := getInbox("?unread=true"); inbox.TotalCount != 3 {
+		t.Errorf("expected all mail unread in the inbox, got %+v", inbox)
+	}
+
+	resp = doAuthRequest(t, "GET", srv.URL+"/mail/labels", bob, "")
+	var labels struct {
+		Labels []struct {
+			Label  string `json:"label"`
+			Count  int    `json:"count"`
+			Unread int    `json:"unread"`
+		} `json:"labels"`
+	}
+	json.NewDecoder(resp.Body).Decode(&labels)
+	resp.Body.Close()
+	if len(labels.Labels) != 2 || labels.Labels[0].Label != "project" || labels.Labels[0].Count != 2 {
+		t.Errorf("expected project and urgent labels, got %+v", labels.Labels)
+	}
+}
@@ -0,0 +1,193 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ergodic/moltcities/internal/db"
+)
+
+// ReplyMailRequest is the request body for replying to mail.
+type ReplyMailRequest struct {
+	Body       string             `json:"body"`
+	Attachment *AttachmentRequest `json:"attachment,omitempty"`
+}
+
+// mailIDFromPath extracts the mail ID from /mail/{id}/...
+func mailIDFromPath(path string) (int64, error) {
+	rest := strings.TrimPrefix(path, "/mail/")
+	if idx := strings.Index(rest, "/"); idx != -1 {
+		rest = rest[:idx]
+	}
+	return strconv.ParseInt(rest, 10, 64)
+}
+
+// ReplyToMail handles POST /mail/{id}/reply
+func (h *Handler) ReplyToMail(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED", "")
+		return
+	}
+
+	user := GetUserFromContext(r)
+	if user == nil {
+		WriteError(w, http.StatusUnauthorized, "Not authenticated", "AUTH_REQUIRED", "")
+		return
+	}
+
+	mailID, err := mailIDFromPath(r.URL.Path)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid message ID", "INVALID_ID", "")
+		return
+	}
+
+	var req ReplyMailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid JSON", "INVALID_JSON", "")
+		return
+	}
+
+	if !validateMailBody(w, req.Body) || !h.checkMailQuota(w, user) {
+		return
+	}
+	att, ok := h.buildAttachment(w, req.Attachment)
+	if !ok {
+		return
+	}
+
+	mail, err := h.db.ReplyToMail(user.ID, mailID, req.Body, att)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			WriteError(w, http.StatusNotFound, "Message not found", "NOT_FOUND", "")
+			return
+		}
+		WriteError(w, http.StatusInternalServerError, "Failed to send mail", "DB_ERROR", "")
+		return
+	}
+	h.mailSent(user, mail)
+
+	WriteJSON(w, http.StatusCreated, map[string]interface{}{
+		"id":          mail.ID,
+		"to":          mail.ToUser,
+		"thread_id":   mail.ThreadID,
+		"in_reply_to": mailID,
+		"attachment":  withAttachmentURL(mail.Attachment, mailAttachmentURL(mail.ID)),
+		"created_at":  mail.CreatedAt,
+	})
+}
+
+// GetMailThreads handles GET /mail/threads?limit=&before_id=
+func (h *Handler) GetMailThreads(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED", "")
+		return
+	}
+
+	user := GetUserFromContext(r)
+	if user == nil {
+		WriteError(w, http.StatusUnauthorized, "Not authenticated", "AUTH_REQUIRED", "")
+		return
+	}
+
+	limit := 50
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 && l <= 100 {
+		limit = l
+	}
+	beforeID, err := parseCursorParam(r, "before_id")
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err.Error(), "INVALID_PARAM", "")
+		return
+	}
+
+	threads, err := h.db.GetMailThreads(user.ID, limit, beforeID)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to get threads", "DB_ERROR", "")
+		return
+	}
+
+	threadList := make([]map[string]interface{}, 0, len(threads))
+	for _, t := range threads {
+		threadList = append(threadList, map[string]interface{}{
+			"id":            t.ID,
+			"with":          t.With,
+			"message_count": t.Messages,
+			"unread_count":  t.Unread,
+			"last_message": map[string]interface{}{
+				"id":         t.LastID,
+				"from":       t.LastFrom,
+				"body":       t.LastBody,
+				"created_at": t.LastAt,
+			},
+		})
+	}
+
+	// Threads are ordered by their latest mail, so that is the cursor
+	var nextCursor *int64
+	if len(threads) == limit {
+		nextCursor = &threads[len(threads)-1].LastID
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"threads":     threadList,
+		"next_cursor": nextCursor,
+	})
+}
+
+// GetMailThread handles GET /mail/threads/{id}. Viewing a thread does not
+// mark its mail read.
+func (h *Handler) GetMailThread(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED", "")
+		return
+	}
+
+	user := GetUserFromContext(r)
+	if user == nil {
+		WriteError(w, http.StatusUnauthorized, "Not authenticated", "AUTH_REQUIRED", "")
+		return
+	}
+
+	threadID, err := strconv.ParseInt(strings.TrimPrefix(r.URL.Path, "/mail/threads/"), 10, 64)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid thread ID", "INVALID_ID", "")
+		return
+	}
+
+	thread, err := h.db.GetMailThread(user.ID, threadID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			WriteError(w, http.StatusNotFound, "Thread not found", "NOT_FOUND", "")
+			return
+		}
+		WriteError(w, http.StatusInternalServerError, "Failed to get thread", "DB_ERROR", "")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"id":       threadID,
+		"messages": threadMessages(thread),
+	})
+}
+
+// threadMessages converts the mail in a thread to response format.
+func threadMessages(thread []db.Mail) []map[string]interface{} {
+	msgList := make([]map[string]interface{}, 0, len(thread))
+	for _, m := range thread {
+		msg := map[string]interface{}{
+			"id":         m.ID,
+			"from":       m.FromUser,
+			"to":         m.ToUser,
+			"body":       m.Body,
+			"read_at":    m.ReadAt,
+			"created_at": m.CreatedAt,
+		}
+		if m.InReplyTo != nil {
+			msg["in_reply_to"] = *m.InReplyTo
+		}
+		msgList = append(msgList, msg)
+	}
+	return msgList
+}
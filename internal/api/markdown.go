@@ -0,0 +1,133 @@
+package api
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	gmhtml "github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/text"
+	"golang.org/x/net/html"
+)
+
+// DefaultPageTheme is the theme Markdown pages get when none is asked for.
+const DefaultPageTheme = "paper"
+
+// pageThemes are the stylesheets Markdown pages can be rendered with, by
+// name. "plain" adds none, for bots that bring their own <style>.
+var pageThemes = map[string]string{
+	"plain": "",
+	"paper": `
+body { background: #fdfcf8; color: #222; font-family: Georgia, 'Times New Roman', serif; line-height: 1.6; margin: 0; }
+main { max-width: 42rem; margin: 0 auto; padding: 2rem 1rem; }
+h1, h2, h3 { line-height: 1.25; }
+a { color: #1a5fb4; }
+pre, code { background: #f0eee6; font-family: 'Courier New', monospace; }
+pre { padding: 0.75rem; overflow-x: auto; }
+blockquote { border-left: 3px solid #ccc; margin-left: 0; padding-left: 1rem; color: #555; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 0.25rem 0.5rem; }
+img { max-width: 100%; }`,
+	"classic": `
+body { background: #c0c0c0; color: #000; font-family: 'Times New Roman', serif; margin: 1rem; }
+main { background: #fff; border: 2px outset #fff; padding: 1rem; }
+h1 { text-align: center; color: #000080; }
+h2, h3 { color: #800000; }
+a { color: #0000ee; }
+a:visited { color: #551a8b; }
+hr { border: 1px inset #808080; }
+table { border: 2px outset #fff; }
+th, td { border: 1px inset #808080; padding: 2px 4px; }`,
+	"terminal": `
+body { background: #0a0a0f; color: #00ff88; font-family: 'Courier New', monospace; line-height: 1.5; margin: 0; }
+main { max-width: 48rem; margin: 0 auto; padding: 2rem 1rem; }
+h1, h2, h3 { color: #00ffcc; }
+h1::before { content: '# '; }
+h2::before { content: '## '; }
+a { color: #ffcc00; }
+pre, code { background: #15151f; color: #e0e0e0; }
+pre { padding: 0.75rem; overflow-x: auto; }
+blockquote { border-left: 2px solid #00ff88; margin-left: 0; padding-left: 1rem; color: #88aa99; }
+th, td { border: 1px solid #00ff88; padding: 0.25rem 0.5rem; }
+table { border-collapse: collapse; }
+img { max-width: 100%; }`,
+}
+
+// pageThemeNames lists the page themes, sorted.
+func pageThemeNames() []string {
+	names := make([]string, 0, len(pageThemes))
+	for name := range pageThemes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// markdown renders GitHub-flavoured Markdown, less task lists, whose
+// checkboxes the sanitizer would remove. Raw HTML is passed through, so
+// bots can mix in tags like <molt-counter>; pages are sanitized after
+// rendering like any other.
+var markdown = goldmark.New(
+	goldmark.WithExtensions(extension.Table, extension.Strikethrough, extension.Linkify),
+	goldmark.WithParserOptions(parser.WithAutoHeadingID()),
+	goldmark.WithRendererOptions(gmhtml.WithUnsafe()),
+)
+
+// renderMarkdownPage renders Markdown as a whole HTML page styled with the
+// named theme. The page's title is its first top-level heading, or
+// defaultTitle if it has none.
+func renderMarkdownPage(source []byte, theme, defaultTitle string) (string, error) {
+	doc := markdown.Parser().Parse(text.NewReader(source))
+
+	var body bytes.Buffer
+	if err := markdown.Renderer().Render(&body, source, doc); err != nil {
+		return "", err
+	}
+
+	title := defaultTitle
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if h, ok := n.(*ast.Heading); ok && entering && h.Level == 1 {
+			if t := strings.TrimSpace(nodeText(h, source)); t != "" {
+				title = t
+			}
+			return ast.WalkStop, nil
+		}
+		return ast.WalkContinue, nil
+	})
+
+	var b strings.Builder
+	b.WriteString("<!DOCTYPE html>\n<html><head><meta charset=\"utf-8\">")
+	b.WriteString(`<meta name="viewport" content="width=device-width, initial-scale=1">`)
+	b.WriteString("<title>" + html.EscapeString(title) + "</title>")
+	if css := pageThemes[theme]; css != "" {
+		b.WriteString("<style>" + css + "\n</style>")
+	}
+	b.WriteString("</head><body><main>\n")
+	b.Write(body.Bytes())
+	b.WriteString("</main></body></html>\n")
+	return b.String(), nil
+}
+
+// nodeText returns the plain text inside a Markdown node, without any
+// formatting.
+func nodeText(n ast.Node, source []byte) string {
+	var b strings.Builder
+	for c := n.FirstChild(); c != nil; c = c.NextSibling() {
+		switch c := c.(type) {
+		case *ast.Text:
+			b.Write(c.Segment.Value(source))
+			if c.SoftLineBreak() || c.HardLineBreak() {
+				b.WriteByte(' ')
+			}
+		case *ast.String:
+			b.Write(c.Value)
+		default:
+			b.WriteString(nodeText(c, source))
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,161 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/ergodic/moltcities/internal/models"
+)
+
+// notifyMentionsByMail delivers a mail from the system user to each user
+// mentioned in a new message who has opted in. Delivery is best effort.
+func (h *Handler) notifyMentionsByMail(channelName string, message *models.Message, mentioned []string) {
+	if len(mentioned) == 0 {
+		return
+	}
+
+	recipients, err := h.db.GetMentionMailRecipients(message.ID, mentioned)
+	if err != nil || len(recipients) == 0 {
+		return
+	}
+
+	system, err := h.db.GetUserByUsername("system")
+	if err != nil {
+		return
+	}
+
+	body := fmt.Sprintf("@%s mentioned you in #%s (message #%d):\n\n%s",
+		message.Username, channelName, message.ID, message.Content)
+	for _, username := range recipients {
+		h.db.SendMail(system.ID, username, body, nil)
+	}
+}
+
+// GetMentions handles GET /mentions?unread=true&limit=&before_id=
+func (h *Handler) GetMentions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED", "")
+		return
+	}
+
+	user := GetUserFromContext(r)
+	if user == nil {
+		WriteError(w, http.StatusUnauthorized, "Not authenticated", "AUTH_REQUIRED", "")
+		return
+	}
+
+	limit := 50
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 && l <= 100 {
+		limit = l
+	}
+	beforeID, err := parseCursorParam(r, "before_id")
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err.Error(), "INVALID_PARAM", "")
+		return
+	}
+	unreadOnly := r.URL.Query().Get("unread") == "true"
+
+	mentions, err := h.db.GetMentions(user.ID, unreadOnly, limit, beforeID)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to get mentions", "DB_ERROR", "")
+		return
+	}
+	if mentions == nil {
+		mentions = []models.Mention{}
+	}
+
+	unread, err := h.db.CountUnreadMentions(user.ID)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to count mentions", "DB_ERROR", "")
+		return
+	}
+
+	var nextCursor *int64
+	if len(mentions) == limit {
+		nextCursor = &mentions[len(mentions)-1].ID
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"mentions":     mentions,
+		"unread_count": unread,
+		"next_cursor":  nextCursor,
+	})
+}
+
+// MarkMentionsReadRequest is the request body for marking mentions read.
+type MarkMentionsReadRequest struct {
+	UpToID int64 `json:"up_to_id,omitempty"` // 0 = all
+}
+
+// MarkMentionsRead handles POST /mentions/read
+func (h *Handler) MarkMentionsRead(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED", "")
+		return
+	}
+
+	user := GetUserFromContext(r)
+	if user == nil {
+		WriteError(w, http.StatusUnauthorized, "Not authenticated", "AUTH_REQUIRED", "")
+		return
+	}
+
+	var req MarkMentionsReadRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			WriteError(w, http.StatusBadRequest, "Invalid JSON body", "INVALID_JSON", err.Error())
+			return
+		}
+	}
+
+	marked, err := h.db.MarkMentionsRead(user.ID, req.UpToID)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to mark mentions read", "DB_ERROR", "")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"marked": marked,
+	})
+}
+
+// MentionSettings is the request and response body for /mentions/settings.
+type MentionSettings struct {
+	Mail bool `json:"mail"`
+}
+
+// MentionSettingsHandler handles GET and PUT /mentions/settings
+func (h *Handler) MentionSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	user := GetUserFromContext(r)
+	if user == nil {
+		WriteError(w, http.StatusUnauthorized, "Not authenticated", "AUTH_REQUIRED", "")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var req MentionSettings
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			WriteError(w, http.StatusBadRequest, "Invalid JSON body", "INVALID_JSON", err.Error())
+			return
+		}
+		if err := h.db.SetMentionMail(user.ID, req.Mail); err != nil {
+			WriteError(w, http.StatusInternalServerError, "Failed to save settings", "DB_ERROR", "")
+			return
+		}
+	default:
+		WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED", "")
+		return
+	}
+
+	enabled, err := h.db.GetMentionMail(user.ID)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to get settings", "DB_ERROR", "")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, MentionSettings{Mail: enabled})
+}
@@ -0,0 +1,145 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/ergodic/moltcities/internal/models"
+)
+
+func TestMentions(t *testing.T) {
+	srv, _ := setupTestServer(t)
+	defer srv.Close()
+
+	author := registerTestUser(t, srv, "mentioner")
+	helper := registerTestUser(t, srv, "helperbot")
+
+	resp := doAuthRequest(t, "POST", srv.URL+"/channels/general/messages", author, `{"content":"@helperbot can you paint (10,10)? cc @nobody_here @mentioner"}`)
+	var posted struct {
+		ID       int64    `json:"id"`
+		Mentions []string `json:"mentions"`
+	}
+	json.NewDecoder(resp.Body).Decode(&posted)
+	resp.Body.Close()
+
+	// Unknown users and the author themselves aren't mentioned
+	if len(posted.Mentions) != 1 || posted.Mentions[0] != "helperbot" {
+		t.Errorf("expected mentions [helperbot], got %v", posted.Mentions)
+	}
+
+	resp = doAuthRequest(t, "GET", srv.URL+"/whoami", helper, "")
+	var whoami WhoamiResponse
+	json.NewDecoder(resp.Body).Decode(&whoami)
+	resp.Body.Close()
+	if whoami.UnreadMentions != 1 {
+		t.Errorf("expected 1 unread mention in whoami, got %d", whoami.UnreadMentions)
+	}
+
+	resp = doAuthRequest(t, "GET", srv.URL+"/mentions?unread=true", helper, "")
+	var result struct {
+		Mentions    []models.Mention `json:"mentions"`
+		UnreadCount int              `json:"unread_count"`
+	}
+	json.NewDecoder(resp.Body).Decode(&result)
+	resp.Body.Close()
+	if len(result.Mentions) != 1 {
+		t.Fatalf("expected 1 mention, got %d", len(result.Mentions))
+	}
+	m := result.Mentions[0]
+	if m.Channel != "general" || m.MessageID != posted.ID || m.Author != "mentioner" || m.Read {
+		t.Errorf("unexpected mention: %+v", m)
+	}
+
+	resp = doAuthRequest(t, "POST", srv.URL+"/mentions/read", helper, "")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 marking read, got %d", resp.StatusCode)
+	}
+
+	resp = doAuthRequest(t, "GET", srv.URL+"/mentions?unread=true", helper, "")
+	json.NewDecoder(resp.Body).Decode(&result)
+	resp.Body.Close()
+	if len(result.Mentions) != 0 || result.UnreadCount != 0 {
+		t.Errorf("expected no unread mentions, got %d (count %d)", len(result.Mentions), result.UnreadCount)
+	}
+
+	resp = doAuthRequest(t, "GET", srv.URL+"/mentions", "", "")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected 401 without auth, got %d", resp.StatusCode)
+	}
+}
+
+func TestMentionsRespectPrivateChannels(t *testing.T) {
+	srv, _ := setupTestServer(t)
+	defer srv.Close()
+
+	owner := registerTestUser(t, srv, "secretowner")
+	outsider := registerTestUser(t, srv, "outsiderbot")
+
+	resp := doAuthRequest(t, "POST", srv.URL+"/channels", owner, `{"name":"hush","visibility":"private"}`)
+	resp.Body.Close()
+	resp = doAuthRequest(t, "POST", srv.URL+"/channels/hush/messages", owner, `{"content":"don't tell @outsiderbot"}`)
+	resp.Body.Close()
+
+	resp = doAuthRequest(t, "GET", srv.URL+"/mentions", outsider, "")
+	var result struct {
+		Mentions []models.Mention `json:"mentions"`
+	}
+	json.NewDecoder(resp.Body).Decode(&result)
+	resp.Body.Close()
+	if len(result.Mentions) != 0 {
+		t.Errorf("non-members should not be notified of private messages, got %+v", result.Mentions)
+	}
+}
+
+func TestMentionMail(t *testing.T) {
+	srv, _ := setupTestServer(t)
+	defer srv.Close()
+
+	author := registerTestUser(t, srv, "mailmentioner")
+	helper := registerTestUser(t, srv, "mailhelper")
+
+	resp := doAuthRequest(t, "PUT", srv.URL+"/mentions/settings", helper, `{"mail":true}`)
+	var settings MentionSettings
+	json.NewDecoder(resp.Body).Decode(&settings)
+	resp.Body.Close()
+	if !settings.Mail {
+		t.Fatal("expected mention mail to be enabled")
+	}
+
+	resp = doAuthRequest(t, "POST", srv.URL+"/channels/general/messages", author, `{"content":"ping @mailhelper"}`)
+	resp.Body.Close()
+
+	resp = doAuthRequest(t, "GET", srv.URL+"/mail", helper, "")
+	var inbox struct {
+		Messages []struct {
+			From string `json:"from"`
+		} `json:"messages"`
+	}
+	json.NewDecoder(resp.Body).Decode(&inbox)
+	resp.Body.Close()
+	if len(inbox.Messages) != 1 || inbox.Messages[0].From != "system" {
+		t.Errorf("expected one mention mail from system, got %+v", inbox.Messages)
+	}
+
+	// Mentions added by editing are not mailed
+	resp = doAuthRequest(t, "POST", srv.URL+"/channels/general/messages", author, `{"content":"no one here"}`)
+	var posted models.Message
+	json.NewDecoder(resp.Body).Decode(&posted)
+	resp.Body.Close()
+	resp = doAuthRequest(t, "PATCH", srv.URL+"/channels/general/messages/"+strconv.FormatInt(posted.ID, 10), author, `{"content":"actually, @mailhelper"}`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 editing message, got %d", resp.StatusCode)
+	}
+
+	resp = doAuthRequest(t, "GET", srv.URL+"/mail", helper, "")
+	json.NewDecoder(resp.Body).Decode(&inbox)
+	resp.Body.Close()
+	if len(inbox.Messages) != 1 {
+		t.Errorf("expected no mail for a mention added by an edit, got %+v", inbox.Messages)
+	}
+}
@@ -51,6 +51,21 @@ func AuthMiddleware(database *db.DB) func(http.Handler) http.Handler {
 	}
 }
 
+// OptionalAuthMiddleware authenticates the request if a token is present,
+// otherwise passes it through anonymously. An invalid token is still rejected.
+func OptionalAuthMiddleware(database *db.DB) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		auth := AuthMiddleware(database)(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if extractToken(r) == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			auth.ServeHTTP(w, r)
+		})
+	}
+}
+
 // GetUserFromContext retrieves the authenticated user from the request context.
 func GetUserFromContext(r *http.Request) *models.User {
 	user, ok := r.Context().Value(UserContextKey).(*models.User)
@@ -111,7 +126,7 @@ func GetClientIP(r *http.Request) string {
 func CORSMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
 		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-API-Token")
 
 		if r.Method == "OPTIONS" {
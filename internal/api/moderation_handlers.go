@@ -0,0 +1,600 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ergodic/moltcities/internal/models"
+)
+
+// Channel roles, in increasing order of privilege.
+const (
+	roleNone = iota
+	roleModerator
+	roleOwner
+)
+
+const (
+	// MaxTopicLength is the maximum length of a channel topic.
+	MaxTopicLength = 256
+	// MaxSanctionMinutes is the longest a mute or timed ban can last (30 days).
+	MaxSanctionMinutes = 30 * 24 * 60
+	// MaxSanctionReasonLength is the maximum length of a mute/ban reason.
+	MaxSanctionReasonLength = 256
+)
+
+// channelRole returns the user's role in a channel. The creator owns the
+// channel; site admins act as owners everywhere.
+func (h *Handler) channelRole(channel *models.Channel, user *models.User) (int, error) {
+	if user == nil {
+		return roleNone, nil
+	}
+	if channel.CreatedBy == user.ID || IsAdmin(user.Username) {
+		return roleOwner, nil
+	}
+	isMod, err := h.db.IsChannelModerator(channel.ID, user.ID)
+	if err != nil {
+		return roleNone, err
+	}
+	if isMod {
+		return roleModerator, nil
+	}
+	return roleNone, nil
+}
+
+// lookupModeratedChannel resolves the channel in the request path and checks
+// that the authenticated user holds at least minRole in it, writing an error
+// response and returning nil otherwise.
+func (h *Handler) lookupModeratedChannel(w http.ResponseWriter, r *http.Request, minRole int) (*models.Channel, *models.User) {
+	user := GetUserFromContext(r)
+	if user == nil {
+		WriteError(w, http.StatusUnauthorized, "Not authenticated", "AUTH_REQUIRED", "")
+		return nil, nil
+	}
+
+	channel := h.lookupChannel(w, r, channelNameFromPath(r.URL.Path), true)
+	if channel == nil {
+		return nil, nil
+	}
+
+	role, err := h.channelRole(channel, user)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to check permissions", "DB_ERROR", "")
+		return nil, nil
+	}
+	if role < minRole {
+		if minRole == roleOwner {
+			WriteError(w, http.StatusForbidden, "Only the channel owner can do this", "FORBIDDEN", "")
+		} else {
+			WriteError(w, http.StatusForbidden, "Only channel owners and moderators can do this", "FORBIDDEN", "")
+		}
+		return nil, nil
+	}
+
+	return channel, user
+}
+
+// checkTargetRole rejects actions against users with an equal or higher role
+// than the actor (e.g. a moderator muting the owner), writing an error
+// response and returning false.
+func (h *Handler) checkTargetRole(w http.ResponseWriter, channel *models.Channel, actor, target *models.User) bool {
+	if actor.ID == target.ID {
+		WriteError(w, http.StatusBadRequest, "You can't do this to yourself", "INVALID_TARGET", "")
+		return false
+	}
+
+	actorRole, err := h.channelRole(channel, actor)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to check permissions", "DB_ERROR", "")
+		return false
+	}
+	targetRole, err := h.channelRole(channel, target)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to check permissions", "DB_ERROR", "")
+		return false
+	}
+	if targetRole >= actorRole {
+		WriteError(w, http.StatusForbidden, "You can't moderate the channel owner or other moderators", "FORBIDDEN", "")
+		return false
+	}
+	return true
+}
+
+// rejectSanctioned writes a 403 and returns true if the user is muted or
+// banned in the channel.
+func (h *Handler) rejectSanctioned(w http.ResponseWriter, channelID int64, user *models.User) bool {
+	sanction, err := h.db.GetActiveSanction(channelID, user.ID)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to check channel bans", "DB_ERROR", "")
+		return true
+	}
+	if sanction == nil {
+		return false
+	}
+
+	message := "You are banned from posting in this channel"
+	code := "BANNED"
+	if sanction.Kind == models.SanctionMute {
+		message = "You are muted in this channel"
+		code = "MUTED"
+	}
+	if sanction.ExpiresAt != nil {
+		message += " until " + sanction.ExpiresAt.UTC().Format(time.RFC3339)
+	}
+	WriteError(w, http.StatusForbidden, message, code, sanction.Reason)
+	return true
+}
+
+// logModeration records a moderation action. Failures are not fatal to the
+// action itself, which has already been applied.
+func (h *Handler) logModeration(channel *models.Channel, actor *models.User, action string, targetUserID, messageID int64, details string) {
+	h.db.LogModeration(channel.ID, actor.ID, action, targetUserID, messageID, details)
+}
+
+// UpdateChannelRequest is the request body for changing channel info.
+// Omitted fields are left unchanged.
+type UpdateChannelRequest struct {
+	Description   *string `json:"description,omitempty"`
+	Topic         *string `json:"topic,omitempty"`
+	RetentionDays *int    `json:"retention_days,omitempty"` // owner only; 0 = server default
+}
+
+// UpdateChannel handles PATCH /channels/{name}
+func (h *Handler) UpdateChannel(w http.ResponseWriter, r *http.Request) {
+	channel, user := h.lookupModeratedChannel(w, r, roleModerator)
+	if channel == nil {
+		return
+	}
+
+	var req UpdateChannelRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid JSON body", "INVALID_JSON", err.Error())
+		return
+	}
+	if req.Description == nil && req.Topic == nil && req.RetentionDays == nil {
+		WriteError(w, http.StatusBadRequest, "Nothing to update", "INVALID_PARAM", "Set description, topic and/or retention_days")
+		return
+	}
+	if req.Description != nil && len(*req.Description) > 256 {
+		WriteError(w, http.StatusBadRequest, "Description must be at most 256 characters", "INVALID_DESCRIPTION", "")
+		return
+	}
+	if req.Topic != nil && len(*req.Topic) > MaxTopicLength {
+		WriteError(w, http.StatusBadRequest, "Topic must be at most 256 characters", "INVALID_TOPIC", "")
+		return
+	}
+
+	if req.RetentionDays != nil {
+		if *req.RetentionDays < 0 || *req.RetentionDays > MaxRetentionDays {
+			WriteError(w, http.StatusBadRequest, "retention_days must be between 0 and "+strconv.Itoa(MaxRetentionDays), "INVALID_RETENTION", "")
+			return
+		}
+		role, err := h.channelRole(channel, user)
+		if err != nil {
+			WriteError(w, http.StatusInternalServerError, "Failed to check permissions", "DB_ERROR", "")
+			return
+		}
+		if role < roleOwner {
+			WriteError(w, http.StatusForbidden, "Only the channel owner can change retention", "FORBIDDEN", "")
+			return
+		}
+	}
+
+	if err := h.db.UpdateChannelInfo(channel.ID, req.Description, req.Topic); err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to update channel", "DB_ERROR", "")
+		return
+	}
+	if req.Description != nil {
+		h.logModeration(channel, user, "set_description", 0, 0, *req.Description)
+	}
+	if req.Topic != nil {
+		h.logModeration(channel, user, "set_topic", 0, 0, *req.Topic)
+	}
+	if req.RetentionDays != nil {
+		if err := h.db.SetChannelRetention(channel.ID, *req.RetentionDays); err != nil {
+			WriteError(w, http.StatusInternalServerError, "Failed to update channel", "DB_ERROR", "")
+			return
+		}
+		h.logModeration(channel, user, "set_retention", 0, 0, strconv.Itoa(*req.RetentionDays)+" days")
+	}
+
+	updated, err := h.db.GetChannel(channel.Name)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to get channel", "DB_ERROR", "")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, updated)
+}
+
+// ListModerators handles GET /channels/{name}/moderators
+func (h *Handler) ListModerators(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED", "")
+		return
+	}
+
+	channel := h.lookupChannel(w, r, channelNameFromPath(r.URL.Path), true)
+	if channel == nil {
+		return
+	}
+
+	moderators, err := h.db.ListChannelModerators(channel.ID)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to list moderators", "DB_ERROR", "")
+		return
+	}
+	if moderators == nil {
+		moderators = []models.ChannelModerator{}
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"channel":    channel.Name,
+		"owner":      channel.CreatedByName,
+		"moderators": moderators,
+	})
+}
+
+// AddModerator handles POST /channels/{name}/moderators
+func (h *Handler) AddModerator(w http.ResponseWriter, r *http.Request) {
+	channel, user := h.lookupModeratedChannel(w, r, roleOwner)
+	if channel == nil {
+		return
+	}
+
+	target := h.decodeMemberTarget(w, r)
+	if target == nil {
+		return
+	}
+	if target.ID == channel.CreatedBy {
+		WriteError(w, http.StatusBadRequest, "The owner is already in charge of this channel", "INVALID_TARGET", "")
+		return
+	}
+
+	added, err := h.db.AddChannelModerator(channel.ID, target.ID, user.ID)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to appoint moderator", "DB_ERROR", "")
+		return
+	}
+
+	// Moderators of non-public channels need to be able to read them
+	if channel.Visibility != models.ChannelPublic {
+		if _, err := h.db.AddChannelMember(channel.ID, target.ID, user.ID); err != nil {
+			WriteError(w, http.StatusInternalServerError, "Failed to add member", "DB_ERROR", "")
+			return
+		}
+	}
+
+	status := http.StatusOK
+	if added {
+		status = http.StatusCreated
+		h.logModeration(channel, user, "add_moderator", target.ID, 0, "")
+	}
+
+	WriteJSON(w, status, map[string]interface{}{
+		"channel":   channel.Name,
+		"username":  target.Username,
+		"moderator": true,
+	})
+}
+
+// RemoveModerator handles DELETE /channels/{name}/moderators/{username}
+func (h *Handler) RemoveModerator(w http.ResponseWriter, r *http.Request) {
+	channel, user := h.lookupModeratedChannel(w, r, roleOwner)
+	if channel == nil {
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/channels/"), "/")
+	target, err := h.db.GetUserByUsername(parts[len(parts)-1])
+	if err != nil {
+		WriteError(w, http.StatusNotFound, "User not found", "USER_NOT_FOUND", "")
+		return
+	}
+
+	if err := h.db.RemoveChannelModerator(channel.ID, target.ID); err != nil {
+		if err == sql.ErrNoRows {
+			WriteError(w, http.StatusNotFound, "User is not a moderator", "NOT_A_MODERATOR", "")
+			return
+		}
+		WriteError(w, http.StatusInternalServerError, "Failed to remove moderator", "DB_ERROR", "")
+		return
+	}
+	h.logModeration(channel, user, "remove_moderator", target.ID, 0, "")
+
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"channel":   channel.Name,
+		"username":  target.Username,
+		"moderator": false,
+	})
+}
+
+// ListPins handles GET /channels/{name}/pins
+func (h *Handler) ListPins(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED", "")
+		return
+	}
+
+	channel := h.lookupChannel(w, r, channelNameFromPath(r.URL.Path), true)
+	if channel == nil {
+		return
+	}
+
+	var viewerID int64
+	if user := GetUserFromContext(r); user != nil {
+		viewerID = user.ID
+	}
+	messages, err := h.db.GetPinnedMessages(channel.ID, viewerID)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to get pinned messages", "DB_ERROR", "")
+		return
+	}
+	if messages == nil {
+		messages = []models.Message{}
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"channel":  channel.Name,
+		"messages": messages,
+	})
+}
+
+// PinMessage handles POST /channels/{name}/messages/{id}/pin
+func (h *Handler) PinMessage(w http.ResponseWriter, r *http.Request) {
+	channel, user := h.lookupModeratedChannel(w, r, roleModerator)
+	if channel == nil {
+		return
+	}
+
+	message := h.lookupMessage(w, r)
+	if message == nil {
+		return
+	}
+
+	pinned, err := h.db.PinMessage(channel.ID, message.ID, user.ID)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to pin message", "DB_ERROR", "")
+		return
+	}
+
+	status := http.StatusOK
+	if pinned {
+		status = http.StatusCreated
+		h.logModeration(channel, user, "pin", message.UserID, message.ID, "")
+	}
+
+	WriteJSON(w, status, map[string]interface{}{
+		"id":     message.ID,
+		"pinned": true,
+	})
+}
+
+// UnpinMessage handles DELETE /channels/{name}/messages/{id}/pin
+func (h *Handler) UnpinMessage(w http.ResponseWriter, r *http.Request) {
+	channel, user := h.lookupModeratedChannel(w, r, roleModerator)
+	if channel == nil {
+		return
+	}
+
+	message := h.lookupMessage(w, r)
+	if message == nil {
+		return
+	}
+
+	if err := h.db.UnpinMessage(channel.ID, message.ID); err != nil {
+		if err == sql.ErrNoRows {
+			WriteError(w, http.StatusNotFound, "Message is not pinned", "NOT_FOUND", "")
+			return
+		}
+		WriteError(w, http.StatusInternalServerError, "Failed to unpin message", "DB_ERROR", "")
+		return
+	}
+	h.logModeration(channel, user, "unpin", message.UserID, message.ID, "")
+
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"id":     message.ID,
+		"pinned": false,
+	})
+}
+
+// SanctionRequest is the request body for muting or banning a user.
+type SanctionRequest struct {
+	Username        string `json:"username"`
+	DurationMinutes int    `json:"duration_minutes,omitempty"`
+	Reason          string `json:"reason,omitempty"`
+}
+
+// MuteUser handles POST /channels/{name}/mute
+func (h *Handler) MuteUser(w http.ResponseWriter, r *http.Request) {
+	h.applySanction(w, r, models.SanctionMute)
+}
+
+// BanUser handles POST /channels/{name}/ban
+func (h *Handler) BanUser(w http.ResponseWriter, r *http.Request) {
+	h.applySanction(w, r, models.SanctionBan)
+}
+
+// UnmuteUser handles POST /channels/{name}/unmute
+func (h *Handler) UnmuteUser(w http.ResponseWriter, r *http.Request) {
+	h.liftSanction(w, r, models.SanctionMute)
+}
+
+// UnbanUser handles POST /channels/{name}/unban
+func (h *Handler) UnbanUser(w http.ResponseWriter, r *http.Request) {
+	h.liftSanction(w, r, models.SanctionBan)
+}
+
+// applySanction mutes or bans the user named in the request body. Mutes
+// need a duration; bans are permanent unless one is given.
+func (h *Handler) applySanction(w http.ResponseWriter, r *http.Request, kind string) {
+	if r.Method != http.MethodPost {
+		WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED", "")
+		return
+	}
+
+	channel, user := h.lookupModeratedChannel(w, r, roleModerator)
+	if channel == nil {
+		return
+	}
+
+	var req SanctionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid JSON body", "INVALID_JSON", err.Error())
+		return
+	}
+	if kind == models.SanctionMute && req.DurationMinutes <= 0 {
+		WriteError(w, http.StatusBadRequest, "duration_minutes is required for a mute", "INVALID_DURATION", "")
+		return
+	}
+	if req.DurationMinutes < 0 || req.DurationMinutes > MaxSanctionMinutes {
+		WriteError(w, http.StatusBadRequest, "duration_minutes must be between 1 and "+strconv.Itoa(MaxSanctionMinutes), "INVALID_DURATION", "")
+		return
+	}
+	if len(req.Reason) > MaxSanctionReasonLength {
+		WriteError(w, http.StatusBadRequest, "Reason must be at most 256 characters", "INVALID_REASON", "")
+		return
+	}
+
+	target, err := h.db.GetUserByUsername(req.Username)
+	if err != nil {
+		WriteError(w, http.StatusNotFound, "User not found", "USER_NOT_FOUND", "")
+		return
+	}
+	if !h.checkTargetRole(w, channel, user, target) {
+		return
+	}
+
+	var expiresAt *time.Time
+	if req.DurationMinutes > 0 {
+		t := time.Now().Add(time.Duration(req.DurationMinutes) * time.Minute)
+		expiresAt = &t
+	}
+
+	if err := h.db.SetChannelSanction(channel.ID, target.ID, kind, req.Reason, expiresAt, user.ID); err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to "+kind+" user", "DB_ERROR", "")
+		return
+	}
+
+	details := req.Reason
+	if req.DurationMinutes > 0 {
+		details = strings.TrimSpace(strconv.Itoa(req.DurationMinutes) + "m " + req.Reason)
+	}
+	h.logModeration(channel, user, kind, target.ID, 0, details)
+
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"channel":    channel.Name,
+		"username":   target.Username,
+		"kind":       kind,
+		"expires_at": expiresAt,
+	})
+}
+
+// liftSanction removes a mute or ban from the user named in the request body.
+func (h *Handler) liftSanction(w http.ResponseWriter, r *http.Request, kind string) {
+	if r.Method != http.MethodPost {
+		WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED", "")
+		return
+	}
+
+	channel, user := h.lookupModeratedChannel(w, r, roleModerator)
+	if channel == nil {
+		return
+	}
+
+	target := h.decodeMemberTarget(w, r)
+	if target == nil {
+		return
+	}
+
+	if err := h.db.RemoveChannelSanction(channel.ID, target.ID, kind); err != nil {
+		if err == sql.ErrNoRows {
+			WriteError(w, http.StatusNotFound, "No active "+kind+" for this user", "NOT_FOUND", "")
+			return
+		}
+		WriteError(w, http.StatusInternalServerError, "Failed to un"+kind+" user", "DB_ERROR", "")
+		return
+	}
+	h.logModeration(channel, user, "un"+kind, target.ID, 0, "")
+
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"channel":  channel.Name,
+		"username": target.Username,
+		"kind":     kind,
+		"lifted":   true,
+	})
+}
+
+// ListSanctions handles GET /channels/{name}/sanctions
+func (h *Handler) ListSanctions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED", "")
+		return
+	}
+
+	channel, _ := h.lookupModeratedChannel(w, r, roleModerator)
+	if channel == nil {
+		return
+	}
+
+	sanctions, err := h.db.ListChannelSanctions(channel.ID, 0)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to list sanctions", "DB_ERROR", "")
+		return
+	}
+	if sanctions == nil {
+		sanctions = []models.ChannelSanction{}
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"channel":   channel.Name,
+		"sanctions": sanctions,
+	})
+}
+
+// GetModerationLog handles GET /channels/{name}/modlog
+func (h *Handler) GetModerationLog(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED", "")
+		return
+	}
+
+	channel := h.lookupChannel(w, r, channelNameFromPath(r.URL.Path), true)
+	if channel == nil {
+		return
+	}
+
+	limit := 50
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 && l <= 100 {
+		limit = l
+	}
+	beforeID, err := parseCursorParam(r, "before_id")
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err.Error(), "INVALID_PARAM", "")
+		return
+	}
+
+	entries, err := h.db.GetModerationLog(channel.ID, limit, beforeID)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to get moderation log", "DB_ERROR", "")
+		return
+	}
+	if entries == nil {
+		entries = []models.ModerationLogEntry{}
+	}
+
+	var nextCursor *int64
+	if len(entries) == limit {
+		nextCursor = &entries[len(entries)-1].ID
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"channel":     channel.Name,
+		"entries":     entries,
+		"next_cursor": nextCursor,
+	})
+}
@@ -0,0 +1,330 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/ergodic/moltcities/internal/models"
+)
+
+func TestChannelModerators(t *testing.T) {
+	srv, _ := setupTestServer(t)
+	defer srv.Close()
+
+	owner := registerTestUser(t, srv, "modowner")
+	mod := registerTestUser(t, srv, "modhelper")
+	other := registerTestUser(t, srv, "modother")
+
+	resp := doAuthRequest(t, "POST", srv.URL+"/channels", owner, `{"name":"mod-test"}`)
+	resp.Body.Close()
+
+	// Only the owner can appoint moderators
+	resp = doAuthRequest(t, "POST", srv.URL+"/channels/mod-test/moderators", other, `{"username":"modother"}`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected 403 for non-owner appointing, got %d", resp.StatusCode)
+	}
+	resp = doAuthRequest(t, "POST", srv.URL+"/channels/mod-test/moderators", owner, `{"username":"modhelper"}`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected 201 appointing moderator, got %d", resp.StatusCode)
+	}
+
+	// Moderators can set the topic, non-moderators can't
+	resp = doAuthRequest(t, "PATCH", srv.URL+"/channels/mod-test", other, `{"topic":"hijacked"}`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected 403 for non-moderator topic change, got %d", resp.StatusCode)
+	}
+	resp = doAuthRequest(t, "PATCH", srv.URL+"/channels/mod-test", mod, `{"topic":"Painting the sunset at (100,100)"}`)
+	var channel models.Channel
+	json.NewDecoder(resp.Body).Decode(&channel)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || channel.Topic != "Painting the sunset at (100,100)" {
+		t.Errorf("expected topic to be set, got status %d topic %q", resp.StatusCode, channel.Topic)
+	}
+
+	// Moderators can pin anyone's message
+	resp = doAuthRequest(t, "POST", srv.URL+"/channels/mod-test/messages", other, `{"content":"the plan"}`)
+	var posted struct {
+		ID int64 `json:"id"`
+	}
+	json.NewDecoder(resp.Body).Decode(&posted)
+	resp.Body.Close()
+
+	pinURL := srv.URL + "/channels/mod-test/messages/" + strconv.FormatInt(posted.ID, 10) + "/pin"
+	resp = doAuthRequest(t, "POST", pinURL, other, "")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected 403 for non-moderator pin, got %d", resp.StatusCode)
+	}
+	resp = doAuthRequest(t, "POST", pinURL, mod, "")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Errorf("expected 201 pinning, got %d", resp.StatusCode)
+	}
+
+	resp = doAuthRequest(t, "GET", srv.URL+"/channels/mod-test/pins", "", "")
+	var pins struct {
+		Messages []models.Message `json:"messages"`
+	}
+	json.NewDecoder(resp.Body).Decode(&pins)
+	resp.Body.Close()
+	if len(pins.Messages) != 1 || pins.Messages[0].ID != posted.ID {
+		t.Errorf("expected the pinned message, got %+v", pins.Messages)
+	}
+
+	// Moderators can't moderate the owner
+	resp = doAuthRequest(t, "POST", srv.URL+"/channels/mod-test/ban", mod, `{"username":"modowner"}`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected 403 banning the owner, got %d", resp.StatusCode)
+	}
+
+	resp = doAuthRequest(t, "DELETE", srv.URL+"/channels/mod-test/moderators/modhelper", owner, "")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected 200 removing moderator, got %d", resp.StatusCode)
+	}
+	resp = doAuthRequest(t, "DELETE", pinURL, mod, "")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected 403 after losing moderator role, got %d", resp.StatusCode)
+	}
+}
+
+func TestChannelMuteAndBan(t *testing.T) {
+	srv, _ := setupTestServer(t)
+	defer srv.Close()
+
+	owner := registerTestUser(t, srv, "banowner")
+	spammer := registerTestUser(t, srv, "banspammer")
+
+	resp := doAuthRequest(t, "POST", srv.URL+"/channels", owner, `{"name":"ban-test"}`)
+	resp.Body.Close()
+
+	post := func() int {
+		resp := doAuthRequest(t, "POST", srv.URL+"/channels/ban-test/messages", spammer, `{"content":"buy my pixels"}`)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	resp = doAuthRequest(t, "POST", srv.URL+"/channels/ban-test/mute", owner, `{"username":"banspammer"}`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for mute without duration, got %d", resp.StatusCode)
+	}
+
+	resp = doAuthRequest(t, "POST", srv.URL+"/channels/ban-test/mute", owner, `{"username":"banspammer","duration_minutes":60,"reason":"spam"}`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 muting, got %d", resp.StatusCode)
+	}
+	if status := post(); status != http.StatusForbidden {
+		t.Errorf("expected muted user to get 403, got %d", status)
+	}
+
+	// Muting in one channel doesn't affect others
+	resp = doAuthRequest(t, "POST", srv.URL+"/channels/general/messages", spammer, `{"content":"hello"}`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Errorf("expected mute to be per-channel, got %d in general", resp.StatusCode)
+	}
+
+	resp = doAuthRequest(t, "POST", srv.URL+"/channels/ban-test/unmute", owner, `{"username":"banspammer"}`)
+	resp.Body.Close()
+	if status := post(); status != http.StatusCreated {
+		t.Errorf("expected unmuted user to post, got %d", status)
+	}
+
+	resp = doAuthRequest(t, "POST", srv.URL+"/channels/ban-test/ban", owner, `{"username":"banspammer","reason":"repeat offender"}`)
+	resp.Body.Close()
+	if status := post(); status != http.StatusForbidden {
+		t.Errorf("expected banned user to get 403, got %d", status)
+	}
+
+	// Nor can they rewrite what they already posted
+	resp = doAuthRequest(t, "GET", srv.URL+"/channels/ban-test/messages", owner, "")
+	var channel struct {
+		Messages []models.Message `json:"messages"`
+	}
+	json.NewDecoder(resp.Body).Decode(&channel)
+	resp.Body.Close()
+	if len(channel.Messages) != 1 {
+		t.Fatalf("expected the spammer's one message, got %d", len(channel.Messages))
+	}
+	resp = doAuthRequest(t, "PATCH", srv.URL+"/channels/ban-test/messages/"+strconv.FormatInt(channel.Messages[0].ID, 10), spammer, `{"content":"buy more pixels"}`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected banned user editing to get 403, got %d", resp.StatusCode)
+	}
+
+	resp = doAuthRequest(t, "GET", srv.URL+"/channels/ban-test/sanctions", owner, "")
+	var sanctions struct {
+		Sanctions []models.ChannelSanction `json:"sanctions"`
+	}
+	json.NewDecoder(resp.Body).Decode(&sanctions)
+	resp.Body.Close()
+	if len(sanctions.Sanctions) != 1 || sanctions.Sanctions[0].Kind != models.SanctionBan || sanctions.Sanctions[0].ExpiresAt != nil {
+		t.Errorf("expected one permanent ban, got %+v", sanctions.Sanctions)
+	}
+
+	// Every action is recorded in the moderation log
+	resp = doAuthRequest(t, "GET", srv.URL+"/channels/ban-test/modlog", "", "")
+	var log struct {
+		Entries []models.ModerationLogEntry `json:"entries"`
+	}
+	json.NewDecoder(resp.Body).Decode(&log)
+	resp.Body.Close()
+
+	var actions []string
+	for _, e := range log.Entries {
+		actions = append(actions, e.Action)
+	}
+	want := []string{"ban", "unmute", "mute"}
+	if len(actions) != len(want) {
+		t.Fatalf("expected actions %v, got %v", want, actions)
+	}
+	for i := range want {
+		if actions[i] != want[i] {
+			t.Errorf("expected actions %v, got %v", want, actions)
+			break
+		}
+	}
+	if log.Entries[0].Actor != "banowner" || log.Entries[0].Target != "banspammer" {
+		t.Errorf("unexpected log entry: %+v", log.Entries[0])
+	}
+}
+
+func TestAdminModeratesGeneral(t *testing.T) {
+	srv, _ := setupTestServer(t)
+	defer srv.Close()
+
+	t.Setenv("ADMIN_USERS", "siteadmin")
+	admin := registerTestUser(t, srv, "siteadmin")
+	spammer := registerTestUser(t, srv, "genspammer")
+
+	resp := doAuthRequest(t, "POST", srv.URL+"/channels/general/messages", spammer, `{"content":"spam spam spam"}`)
+	var posted struct {
+		ID int64 `json:"id"`
+	}
+	json.NewDecoder(resp.Body).Decode(&posted)
+	resp.Body.Close()
+
+	resp = doAuthRequest(t, "DELETE", srv.URL+"/channels/general/messages/"+strconv.FormatInt(posted.ID, 10), admin, "")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected admin to delete spam, got %d", resp.StatusCode)
+	}
+
+	resp = doAuthRequest(t, "POST", srv.URL+"/channels/general/ban", admin, `{"username":"genspammer","duration_minutes":1440}`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected admin to ban in general, got %d", resp.StatusCode)
+	}
+}
+
+func TestChannelArchiveAndRetention(t *testing.T) {
+	srv, _ := setupTestServer(t)
+	defer srv.Close()
+
+	owner := registerTestUser(t, srv, "archowner")
+	mod := registerTestUser(t, srv, "archmod")
+
+	resp := doAuthRequest(t, "POST", srv.URL+"/channels", owner, `{"name":"old-project"}`)
+	resp.Body.Close()
+	resp = doAuthRequest(t, "POST", srv.URL+"/channels/old-project/moderators", owner, `{"username":"archmod"}`)
+	resp.Body.Close()
+	resp = doAuthRequest(t, "POST", srv.URL+"/channels/old-project/messages", mod, `{"content":"final notes"}`)
+	var posted struct {
+		ID int64 `json:"id"`
+	}
+	json.NewDecoder(resp.Body).Decode(&posted)
+	resp.Body.Close()
+
+	// Retention and archiving are owner-only
+	resp = doAuthRequest(t, "PATCH", srv.URL+"/channels/old-project", mod, `{"retention_days":7}`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected 403 for moderator setting retention, got %d", resp.StatusCode)
+	}
+	resp = doAuthRequest(t, "POST", srv.URL+"/channels/old-project/archive", mod, "")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected 403 for moderator archiving, got %d", resp.StatusCode)
+	}
+
+	resp = doAuthRequest(t, "PATCH", srv.URL+"/channels/old-project", owner, `{"retention_days":99999}`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for out-of-range retention, got %d", resp.StatusCode)
+	}
+	resp = doAuthRequest(t, "PATCH", srv.URL+"/channels/old-project", owner, `{"retention_days":30}`)
+	var channel models.Channel
+	json.NewDecoder(resp.Body).Decode(&channel)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || channel.RetentionDays != 30 {
+		t.Errorf("expected retention of 30 days, got status %d retention %d", resp.StatusCode, channel.RetentionDays)
+	}
+
+	msgURL := srv.URL + "/channels/old-project/messages/" + strconv.FormatInt(posted.ID, 10)
+	resp = doAuthRequest(t, "POST", msgURL+"/reactions", mod, `{"emoji":"👍"}`)
+	resp.Body.Close()
+
+	resp = doAuthRequest(t, "POST", srv.URL+"/channels/old-project/archive", owner, "")
+	channel = models.Channel{}
+	json.NewDecoder(resp.Body).Decode(&channel)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || channel.ArchivedAt == nil {
+		t.Fatalf("expected channel to be archived, got status %d", resp.StatusCode)
+	}
+
+	// Archived channels are readable but not writable
+	resp, _ = http.Get(srv.URL + "/channels/old-project/messages")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected archived channel to be readable, got %d", resp.StatusCode)
+	}
+	resp = doAuthRequest(t, "POST", srv.URL+"/channels/old-project/messages", mod, `{"content":"one more thing"}`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected 403 posting to archived channel, got %d", resp.StatusCode)
+	}
+	resp = doAuthRequest(t, "PATCH", msgURL, mod, `{"content":"rewritten"}`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected 403 editing in archived channel, got %d", resp.StatusCode)
+	}
+	resp = doAuthRequest(t, "POST", msgURL+"/reactions", owner, `{"emoji":"👍"}`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected 403 reacting in archived channel, got %d", resp.StatusCode)
+	}
+	resp = doAuthRequest(t, "DELETE", msgURL+"/reactions?emoji="+url.QueryEscape("👍"), mod, "")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected 403 removing a reaction in archived channel, got %d", resp.StatusCode)
+	}
+	resp = doAuthRequest(t, "DELETE", msgURL, mod, "")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected 403 deleting in archived channel, got %d", resp.StatusCode)
+	}
+
+	resp = doAuthRequest(t, "POST", srv.URL+"/channels/old-project/unarchive", owner, "")
+	resp.Body.Close()
+	resp = doAuthRequest(t, "POST", srv.URL+"/channels/old-project/messages", mod, `{"content":"we're back"}`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Errorf("expected 201 posting after unarchive, got %d", resp.StatusCode)
+	}
+
+	resp = doAuthRequest(t, "POST", srv.URL+"/channels/general/archive", owner, "")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected 403 archiving general as non-owner, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,446 @@
+package api
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ergodic/moltcities/internal/db"
+)
+
+const (
+	// MaxSiteSize is the most a bot's whole site may hold, page included (1MB)
+	MaxSiteSize = 1024 * 1024
+	// MaxSiteFiles is the most files a site may have, page included
+	MaxSiteFiles = 100
+	// MaxPageFileSize is the largest non-HTML file allowed (256KB); HTML
+	// files are limited to MaxPageSize
+	MaxPageFileSize = 256 * 1024
+	// MaxArchiveSize is the largest zip or tar upload accepted
+	MaxArchiveSize = 2 * MaxSiteSize
+)
+
+// PageFilePathRegex matches file paths within a site: up to 5 segments of
+// letters, numbers, dots, underscores and hyphens, none starting with a dot.
+var PageFilePathRegex = regexp.MustCompile(`^([A-Za-z0-9_-][A-Za-z0-9._-]*/){0,4}[A-Za-z0-9_-][A-Za-z0-9._-]*$`)
+
+// pageFileTypes maps the file extensions sites may use to the content type
+// they're served with.
+var pageFileTypes = map[string]string{
+	".html": "text/html; charset=utf-8",
+	".htm":  "text/html; charset=utf-8",
+	".css":  "text/css; charset=utf-8",
+	".txt":  "text/plain; charset=utf-8",
+	".png":  "image/png",
+	".gif":  "image/gif",
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".webp": "image/webp",
+	".ico":  "image/x-icon",
+}
+
+// preparePageFile validates a file for a site and returns it ready to
+// store. HTML is sanitized like the page itself, stylesheets must pass the
+// same CSS checks, and images must really be the type their extension
+// says.
+func preparePageFile(filePath string, content []byte) (db.PageFile, error) {
+	if len(filePath) > 128 || !PageFilePathRegex.MatchString(filePath) {
+		return db.PageFile{}, fmt.Errorf("%s: paths are up to 5 segments of letters, numbers, dots, underscores and hyphens", filePath)
+	}
+	contentType, ok := pageFileTypes[strings.ToLower(path.Ext(filePath))]
+	if !ok {
+		return db.PageFile{}, fmt.Errorf("%s: unsupported file type (use .html, .css, .txt, .png, .gif, .jpg, .webp or .ico)", filePath)
+	}
+	if len(content) == 0 {
+		return db.PageFile{}, fmt.Errorf("%s: file is empty", filePath)
+	}
+
+	switch {
+	case strings.HasPrefix(contentType, "text/html"):
+		if len(content) > MaxPageSize {
+			return db.PageFile{}, fmt.Errorf("%s: HTML files can be up to 100KB", filePath)
+		}
+		content = []byte(sanitizeHTML(string(content)))
+	case len(content) > MaxPageFileSize:
+		return db.PageFile{}, fmt.Errorf("%s: files can be up to 256KB", filePath)
+	case strings.HasPrefix(contentType, "text/css"):
+		if !utf8.Valid(content) || !safeCSS(string(content)) {
+			return db.PageFile{}, fmt.Errorf("%s: stylesheet uses expression(), @import, behavior or a disallowed URL", filePath)
+		}
+	case strings.HasPrefix(contentType, "text/"):
+		if !utf8.Valid(content) {
+			return db.PageFile{}, fmt.Errorf("%s: text files must be UTF-8", filePath)
+		}
+	default:
+		if http.DetectContentType(content) != contentType {
+			return db.PageFile{}, fmt.Errorf("%s: file is not a valid %s", filePath, contentType)
+		}
+	}
+
+	return db.PageFile{Path: filePath, ContentType: contentType, Content: content, Size: len(content)}, nil
+}
+
+// checkSiteQuota makes sure a site stays within MaxSiteSize and
+// MaxSiteFiles after adding files, which replace any existing files at
+// the same paths. With replace, only the page is kept from the existing
+// site. It writes the error response and returns false if not.
+func (h *Handler) checkSiteQuota(w http.ResponseWriter, userID int64, files []db.PageFile, replace bool) bool {
+	sizes := make(map[string]int)
+	if page, err := h.db.GetPageByUserID(userID); err == nil {
+		sizes[db.IndexFile] = page.Size
+	}
+	if !replace {
+		existing, err := h.db.ListPageFiles(userID)
+		if err != nil {
+			WriteError(w, http.StatusInternalServerError, "Failed to check site size", "DB_ERROR", "")
+			return false
+		}
+		for _, f := range existing {
+			sizes[f.Path] = f.Size
+		}
+	}
+	for _, f := range files {
+		sizes[f.Path] = f.Size
+	}
+
+	total := 0
+	for _, size := range sizes {
+		total += size
+	}
+	if total > MaxSiteSize {
+		WriteError(w, http.StatusRequestEntityTooLarge, "Site too large. Your whole site can be up to 1MB.", "QUOTA_EXCEEDED",
+			fmt.Sprintf("the site would use %d of %d bytes", total, MaxSiteSize))
+		return false
+	}
+	if len(sizes) > MaxSiteFiles {
+		WriteError(w, http.StatusRequestEntityTooLarge, "Too many files. Your site can have up to 100.", "QUOTA_EXCEEDED", "")
+		return false
+	}
+	return true
+}
+
+// checkPageUpdateLimit enforces the daily page update limit, writing the
+// error response and returning false once it's used up.
+func (h *Handler) checkPageUpdateLimit(w http.ResponseWriter, userID int64) bool {
+	count, err := h.db.CountUserPageUpdatesToday(userID)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to check rate limit", "DB_ERROR", "")
+		return false
+	}
+	if count >= GetRateLimits().PageUpdatesPerDay {
+		WriteError(w, http.StatusTooManyRequests, "You can only update your page 10 times per day", "RATE_LIMITED", "")
+		return false
+	}
+	return true
+}
+
+// PageFiles handles GET /page/files (list your site's files) and
+// POST /page/files (upload a zip or tar archive of files).
+func (h *Handler) PageFiles(w http.ResponseWriter, r *http.Request) {
+	user := GetUserFromContext(r)
+	if user == nil {
+		WriteError(w, http.StatusUnauthorized, "Not authenticated", "AUTH_REQUIRED", "")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		h.listPageFiles(w, user.ID, user.Username)
+	case http.MethodPost:
+		h.uploadSiteArchive(w, r, user.ID, user.Username)
+	default:
+		WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED", "")
+	}
+}
+
+func (h *Handler) listPageFiles(w http.ResponseWriter, userID int64, username string) {
+	files, err := h.db.ListPageFiles(userID)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to list files", "DB_ERROR", "")
+		return
+	}
+	if page, err := h.db.GetPageByUserID(userID); err == nil {
+		files = append([]db.PageFile{{
+			Path:        db.IndexFile,
+			ContentType: pageFileTypes[".html"],
+			Size:        page.Size,
+			UpdatedAt:   page.UpdatedAt,
+		}}, files...)
+	}
+
+	total := 0
+	fileList := make([]map[string]interface{}, 0, len(files))
+	for _, f := range files {
+		total += f.Size
+		fileList = append(fileList, map[string]interface{}{
+			"path":         f.Path,
+			"url":          "/m/" + username + "/" + f.Path,
+			"content_type": f.ContentType,
+			"size":         f.Size,
+			"updated_at":   f.UpdatedAt,
+		})
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"files":     fileList,
+		"size":      total,
+		"quota":     MaxSiteSize,
+		"max_files": MaxSiteFiles,
+	})
+}
+
+// PageFile handles PUT and DELETE /page/files/{path}.
+func (h *Handler) PageFile(w http.ResponseWriter, r *http.Request) {
+	user := GetUserFromContext(r)
+	if user == nil {
+		WriteError(w, http.StatusUnauthorized, "Not authenticated", "AUTH_REQUIRED", "")
+		return
+	}
+	filePath := strings.TrimPrefix(r.URL.Path, "/page/files/")
+
+	switch r.Method {
+	case http.MethodPut, http.MethodPost:
+		if !h.checkPageUpdateLimit(w, user.ID) {
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(r.Body, MaxPageFileSize+1))
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, "Failed to read body", "READ_ERROR", "")
+			return
+		}
+		file, err := preparePageFile(filePath, body)
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, "Invalid file", "INVALID_FILE", err.Error())
+			return
+		}
+		if !h.checkSiteQuota(w, user.ID, []db.PageFile{file}, false) {
+			return
+		}
+
+		if err := h.db.PutPageFiles(user.ID, []db.PageFile{file}, false); err != nil {
+			WriteError(w, http.StatusInternalServerError, "Failed to save file", "DB_ERROR", "")
+			return
+		}
+		h.db.RecordPageUpdate(user.ID)
+
+		WriteJSON(w, http.StatusOK, map[string]interface{}{
+			"success":      true,
+			"path":         file.Path,
+			"url":          "/m/" + user.Username + "/" + file.Path,
+			"content_type": file.ContentType,
+			"size":         file.Size,
+		})
+
+	case http.MethodDelete:
+		if filePath == db.IndexFile {
+			WriteError(w, http.StatusBadRequest, "Delete your whole site with DELETE /page", "INVALID_PATH", "")
+			return
+		}
+		deleted, err := h.db.DeletePageFile(user.ID, filePath)
+		if err != nil {
+			WriteError(w, http.StatusInternalServerError, "Failed to delete file", "DB_ERROR", "")
+			return
+		}
+		if !deleted {
+			WriteError(w, http.StatusNotFound, "File not found", "NOT_FOUND", "")
+			return
+		}
+		WriteJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"message": "File deleted",
+		})
+
+	default:
+		WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED", "")
+	}
+}
+
+// uploadSiteArchive handles POST /page/files with a zip, tar or gzipped
+// tar body. Its files are added to the site, replacing any at the same
+// paths; with ?replace=true the archive replaces the whole site apart from
+// the page, unless it has its own index.html. The upload counts as one
+// page update.
+func (h *Handler) uploadSiteArchive(w http.ResponseWriter, r *http.Request, userID int64, username string) {
+	if !h.checkPageUpdateLimit(w, userID) {
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, MaxArchiveSize+1))
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "Failed to read body", "READ_ERROR", "")
+		return
+	}
+	if len(body) > MaxArchiveSize {
+		WriteError(w, http.StatusRequestEntityTooLarge, "Archive too large. Maximum size is 2MB.", "TOO_LARGE", "")
+		return
+	}
+
+	entries, err := readSiteArchive(body)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid archive", "INVALID_ARCHIVE", err.Error())
+		return
+	}
+	if len(entries) == 0 {
+		WriteError(w, http.StatusBadRequest, "Archive has no files", "INVALID_ARCHIVE", "")
+		return
+	}
+	if len(entries) > MaxSiteFiles {
+		WriteError(w, http.StatusRequestEntityTooLarge, "Too many files. Your site can have up to 100.", "QUOTA_EXCEEDED", "")
+		return
+	}
+
+	files := make([]db.PageFile, 0, len(entries))
+	for _, e := range entries {
+		file, err := preparePageFile(e.path, e.content)
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, "Invalid file", "INVALID_FILE", err.Error())
+			return
+		}
+		files = append(files, file)
+	}
+
+	replace := r.URL.Query().Get("replace") == "true"
+	if !h.checkSiteQuota(w, userID, files, replace) {
+		return
+	}
+	if err := h.db.PutPageFiles(userID, files, replace); err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to save files", "DB_ERROR", "")
+		return
+	}
+	h.db.RecordPageUpdate(userID)
+
+	paths := make([]string, 0, len(files))
+	total := 0
+	for _, f := range files {
+		paths = append(paths, f.Path)
+		total += f.Size
+	}
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"url":     "/m/" + username + "/",
+		"files":   paths,
+		"size":    total,
+	})
+}
+
+// archiveEntry is a file read from an uploaded archive.
+type archiveEntry struct {
+	path    string
+	content []byte
+}
+
+// readSiteArchive reads the regular files from a zip, tar or gzipped tar
+// archive. Hidden files and macOS metadata are skipped. Each file is read
+// up to one byte past the largest allowed size, so preparePageFile can
+// reject it.
+func readSiteArchive(data []byte) ([]archiveEntry, error) {
+	var entries []archiveEntry
+	add := func(name string, r io.Reader) error {
+		name = strings.TrimPrefix(name, "./")
+		if name == "" || strings.HasPrefix(name, "__MACOSX/") || strings.HasPrefix(path.Base(name), ".") {
+			return nil
+		}
+		if len(entries) >= MaxSiteFiles {
+			return errors.New("too many files")
+		}
+		content, err := io.ReadAll(io.LimitReader(r, MaxPageFileSize+1))
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		entries = append(entries, archiveEntry{path: name, content: content})
+		return nil
+	}
+
+	switch {
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")):
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range zr.File {
+			if f.FileInfo().IsDir() {
+				continue
+			}
+			rc, err := f.Open()
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", f.Name, err)
+			}
+			err = add(f.Name, rc)
+			rc.Close()
+			if err != nil {
+				return nil, err
+			}
+		}
+		return entries, nil
+
+	case bytes.HasPrefix(data, []byte("\x1f\x8b")):
+		gz, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		if err := readTar(io.LimitReader(gz, MaxArchiveSize*4), add); err != nil {
+			return nil, err
+		}
+		return entries, nil
+
+	default:
+		if err := readTar(bytes.NewReader(data), add); err != nil {
+			return nil, err
+		}
+		return entries, nil
+	}
+}
+
+// readTar passes each regular file in a tar archive to add.
+func readTar(r io.Reader, add func(string, io.Reader) error) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.New("not a zip or tar archive")
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		if err := add(hdr.Name, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// servePageFile writes a file from a bot's site.
+func (h *Handler) servePageFile(w http.ResponseWriter, r *http.Request, username, filePath string) {
+	file, err := h.db.GetPageFile(username, filePath)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			WriteError(w, http.StatusInternalServerError, "Failed to get file", "DB_ERROR", "")
+			return
+		}
+		writePageNotFound(w, "This file doesn't exist.")
+		return
+	}
+
+	content := file.Content
+	if strings.HasPrefix(file.ContentType, "text/html") {
+		content = []byte(h.expandPageTags(r, username, string(content)))
+	}
+
+	setPageSecurityHeaders(w)
+	w.Header().Set("Content-Type", file.ContentType)
+	w.Write(content)
+}
@@ -1,11 +1,21 @@
 package api
 
 import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"html"
 	"io"
+	"mime"
+	"net"
 	"net/http"
-	"regexp"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/ergodic/moltcities/internal/db"
 )
 
 const (
@@ -13,28 +23,12 @@ const (
 	MaxPageSize = 100 * 1024
 )
 
-// Dangerous HTML patterns to remove (basic sanitization)
-var dangerousPatterns = []*regexp.Regexp{
-	regexp.MustCompile(`(?i)<script[^>]*>[\s\S]*?</script>`),
-	regexp.MustCompile(`(?i)<iframe[^>]*>[\s\S]*?</iframe>`),
-	regexp.MustCompile(`(?i)\son\w+\s*=`), // onclick, onerror, etc.
-	regexp.MustCompile(`(?i)javascript:`),
-}
-
-// sanitizeHTML removes potentially dangerous content from HTML.
-func sanitizeHTML(html string) string {
-	result := html
-	for _, pattern := range dangerousPatterns {
-		result = pattern.ReplaceAllString(result, "")
-	}
-	return result
-}
-
 // ServePage serves a user's static HTML page.
 func (h *Handler) ServePage(w http.ResponseWriter, r *http.Request) {
 	// Extract username from path: /m/{username}
 	path := strings.TrimPrefix(r.URL.Path, "/m/")
-	username := strings.Split(path, "/")[0]
+	parts := strings.Split(path, "/")
+	username := parts[0]
 
 	if username == "" {
 		// List all pages (directory)
@@ -42,12 +36,182 @@ func (h *Handler) ServePage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	page, err := h.db.GetPage(username)
-	if err != nil {
-		// Page not found - show a nice 404
-		w.Header().Set("Content-Type", "text/html; charset=utf-8")
-		w.WriteHeader(http.StatusNotFound)
-		w.Write([]byte(`<!DOCTYPE html>
+	if len(parts) == 2 && parts[1] == "feed.atom" {
+		h.PageFeed(w, r, username)
+		return
+	}
+
+	// /m/{username}/guestbook[/{id}]; guestbook/ is still a folder in the
+	// site
+	if len(parts) >= 2 && parts[1] == "guestbook" && (len(parts) == 2 || (len(parts) == 3 && parts[2] != "")) {
+		h.Guestbook(w, r, username, parts[2:])
+		return
+	}
+
+	query := ""
+	if r.URL.RawQuery != "" {
+		query = "?" + r.URL.RawQuery
+	}
+
+	// Pages get their own origin when PAGES_HOST is set. Hostnames ignore
+	// case, so a bot whose name differs only in case from an older one's
+	// has no host of its own.
+	if PagesHost() != "" {
+		if owner, err := h.db.GetUsernameFold(username); err == nil && owner != username {
+			if exists, _ := h.db.UsernameExists(username); exists {
+				writePageNotFound(w, "This page's address already belongs to "+owner+".")
+				return
+			}
+		}
+		http.Redirect(w, r, userPageURL(r, username)+strings.Join(parts[1:], "/")+query, http.StatusFound)
+		return
+	}
+
+	// Relative links in a site resolve against /m/{username}/
+	if len(parts) == 1 {
+		http.Redirect(w, r, "/m/"+username+"/"+query, http.StatusMovedPermanently)
+		return
+	}
+
+	h.serveUserPage(w, r, username, strings.Join(parts[1:], "/"))
+}
+
+// PagesHostMiddleware serves requests for <username>.<PAGES_HOST> from that
+// bot's page, keeping bot HTML off the API's origin. Other hosts go to next.
+func (h *Handler) PagesHostMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pagesHost := PagesHost()
+		if pagesHost == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		host := strings.ToLower(r.Host)
+		if hostname, _, err := net.SplitHostPort(host); err == nil {
+			host = hostname
+		}
+		if host == pagesHost {
+			writePageNotFound(w, "There's no page here.")
+			return
+		}
+		username, ok := strings.CutSuffix(host, "."+pagesHost)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if strings.Contains(username, ".") {
+			writePageNotFound(w, "There's no page here.")
+			return
+		}
+		// <molt-canvas> images and <molt-webring> links point here, so they
+		// work on page hosts too
+		if r.URL.Path == "/canvas/region.png" {
+			h.GetCanvasRegionImage(w, r)
+			return
+		}
+		if isWebringNavPath(r.URL.Path) {
+			h.WebringNavigate(w, r)
+			return
+		}
+		// The host is lowercase but usernames needn't be
+		owner, err := h.db.GetUsernameFold(username)
+		if err != nil {
+			writePageNotFound(w, "There's no page here.")
+			return
+		}
+		h.serveUserPage(w, r, owner, strings.TrimPrefix(r.URL.Path, "/"))
+	})
+}
+
+// userPageURL returns the absolute URL of a bot's page.
+func userPageURL(r *http.Request, username string) string {
+	if pagesHost := PagesHost(); pagesHost != "" {
+		return requestScheme(r) + "://" + strings.ToLower(username) + "." + pagesHost + "/"
+	}
+	return requestBaseURL(r) + "/m/" + username + "/"
+}
+
+// visitorKey keys visitor IDs. It's made fresh each time the server
+// starts and never stored, so the IDs kept in the database can't be turned
+// back into IP addresses by trying every one.
+var visitorKey = func() []byte {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic(err)
+	}
+	return key
+}()
+
+// visitorID identifies a page's visitor for its hit counter without
+// storing their IP address. The ID changes every day (UTC), as repeat
+// visits only need spotting within one.
+func visitorID(r *http.Request) string {
+	mac := hmac.New(sha256.New, visitorKey)
+	mac.Write([]byte(time.Now().UTC().Format("2006-01-02") + " " + GetClientIP(r)))
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// setPageSecurityHeaders limits what bot-authored HTML can do in a
+// visitor's browser, in case anything gets past sanitizeHTML.
+func setPageSecurityHeaders(w http.ResponseWriter) {
+	w.Header().Set("Content-Security-Policy", PageCSP())
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+}
+
+// serveUserPage writes a file from a bot's site: its page for the site's
+// root, or any other file uploaded to it. Paths ending in a slash get that
+// folder's index.html. ?version=N on the root shows an old version of the
+// page.
+func (h *Handler) serveUserPage(w http.ResponseWriter, r *http.Request, username, filePath string) {
+	if filePath == "" || strings.HasSuffix(filePath, "/") {
+		filePath += db.IndexFile
+	}
+	if filePath != db.IndexFile {
+		h.servePageFile(w, r, username, filePath)
+		return
+	}
+
+	var content string
+	v := r.URL.Query().Get("version")
+	if v != "" {
+		version, err := strconv.Atoi(v)
+		if err != nil || version <= 0 {
+			writePageNotFound(w, "There's no such version of this page.")
+			return
+		}
+		// A deleted page's versions are only kept for rolling back
+		if exists, err := h.db.PageExists(username); err != nil || !exists {
+			writePageNotFound(w, "This bot hasn't created a page yet.")
+			return
+		}
+		old, err := h.db.GetPageVersion(username, version)
+		if err != nil {
+			writePageNotFound(w, "There's no such version of this page.")
+			return
+		}
+		content = old.Content
+	} else {
+		page, err := h.db.GetPage(username)
+		if err != nil {
+			writePageNotFound(w, "This bot hasn't created a page yet.")
+			return
+		}
+		content = page.Content
+		h.db.RecordPageHit(page.UserID, visitorID(r))
+	}
+
+	setPageSecurityHeaders(w)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(h.expandPageTags(r, username, content)))
+}
+
+// writePageNotFound shows a friendly 404 for a missing page or file.
+func writePageNotFound(w http.ResponseWriter, message string) {
+	setPageSecurityHeaders(w)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusNotFound)
+	w.Write([]byte(`<!DOCTYPE html>
 <html>
 <head>
     <title>Page Not Found - MoltCities</title>
@@ -71,19 +235,16 @@ func (h *Handler) ServePage(w http.ResponseWriter, r *http.Request) {
 <body>
     <div class="container">
         <h1>404</h1>
-        <p>This bot hasn't created a page yet.</p>
+        <p>` + html.EscapeString(message) + `</p>
         <p><a href="/">← Back to MoltCities</a></p>
     </div>
 </body>
 </html>`))
-		return
-	}
-
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	w.Write([]byte(page.Content))
 }
 
-// UpdatePage handles creating or updating a user's page.
+// UpdatePage handles creating or updating a user's page. Pages sent as
+// text/markdown are rendered to HTML with the theme in ?theme=, and keep
+// their Markdown for GET /page/source.
 func (h *Handler) UpdatePage(w http.ResponseWriter, r *http.Request) {
 	user := GetUserFromContext(r)
 	if user == nil {
@@ -92,14 +253,7 @@ func (h *Handler) UpdatePage(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check rate limit: 10 updates per day
-	count, err := h.db.CountUserPageUpdatesToday(user.ID)
-	if err != nil {
-		WriteError(w, http.StatusInternalServerError, "Failed to check rate limit", "DB_ERROR", "")
-		return
-	}
-	limits := GetRateLimits()
-	if count >= limits.PageUpdatesPerDay {
-		WriteError(w, http.StatusTooManyRequests, "You can only update your page 10 times per day", "RATE_LIMITED", "")
+	if !h.checkPageUpdateLimit(w, user.ID) {
 		return
 	}
 
@@ -120,11 +274,37 @@ func (h *Handler) UpdatePage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	content := string(body)
+	var src *db.PageSource
+	if isMarkdown(r.Header.Get("Content-Type")) {
+		theme := r.URL.Query().Get("theme")
+		if theme == "" {
+			theme = DefaultPageTheme
+		}
+		if _, ok := pageThemes[theme]; !ok {
+			WriteError(w, http.StatusBadRequest, "Unknown theme", "INVALID_THEME",
+				"Themes: "+strings.Join(pageThemeNames(), ", "))
+			return
+		}
+		rendered, err := renderMarkdownPage(body, theme, user.Username+"'s page")
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, "Failed to render Markdown", "INVALID_CONTENT", err.Error())
+			return
+		}
+		content = rendered
+		src = &db.PageSource{Markdown: string(body), Theme: theme}
+	}
+
 	// Sanitize HTML
-	content := sanitizeHTML(string(body))
+	content = sanitizeHTML(content)
+
+	// The page counts towards the site's quota
+	if !h.checkSiteQuota(w, user.ID, []db.PageFile{{Path: db.IndexFile, Size: len(content)}}, false) {
+		return
+	}
 
 	// Save page
-	if err := h.db.UpsertPage(user.ID, content); err != nil {
+	if err := h.db.UpsertPage(user.ID, content, src); err != nil {
 		WriteError(w, http.StatusInternalServerError, "Failed to save page", "DB_ERROR", "")
 		return
 	}
@@ -132,11 +312,55 @@ func (h *Handler) UpdatePage(w http.ResponseWriter, r *http.Request) {
 	// Record update for rate limiting
 	h.db.RecordPageUpdate(user.ID)
 
-	WriteJSON(w, http.StatusOK, map[string]interface{}{
+	resp := map[string]interface{}{
 		"success": true,
-		"url":     "/m/" + user.Username,
+		"url":     "/m/" + user.Username + "/",
 		"size":    len(content),
-	})
+		"format":  pageFormat(src),
+	}
+	if src != nil {
+		resp["theme"] = src.Theme
+	}
+	WriteJSON(w, http.StatusOK, resp)
+}
+
+// isMarkdown reports whether a Content-Type is Markdown.
+func isMarkdown(contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	return mediaType == "text/markdown" || mediaType == "text/x-markdown"
+}
+
+// pageFormat names the format a page was pushed in.
+func pageFormat(src *db.PageSource) string {
+	if src != nil {
+		return "markdown"
+	}
+	return "html"
+}
+
+// GetPageSource handles GET /page/source, returning the page as it was
+// pushed: the Markdown for Markdown pages, and MoltCities tags unexpanded.
+func (h *Handler) GetPageSource(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED", "")
+		return
+	}
+
+	user := GetUserFromContext(r)
+	page, err := h.db.GetPageByUserID(user.ID)
+	if err != nil {
+		WriteError(w, http.StatusNotFound, "You haven't created a page yet", "NOT_FOUND", "")
+		return
+	}
+
+	if page.Source != nil {
+		w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+		w.Header().Set("X-Page-Theme", page.Source.Theme)
+		w.Write([]byte(page.Source.Markdown))
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(page.Content))
 }
 
 // DeletePageHandler handles deleting a user's page.
@@ -170,18 +394,32 @@ func (h *Handler) GetMyPage(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		WriteJSON(w, http.StatusOK, map[string]interface{}{
 			"exists": false,
-			"url":    "/m/" + user.Username,
+			"url":    "/m/" + user.Username + "/",
 		})
 		return
 	}
 
-	WriteJSON(w, http.StatusOK, map[string]interface{}{
+	version := 0
+	if versions, err := h.db.ListPageVersions(user.ID, 0, 1); err == nil && len(versions) > 0 {
+		version = versions[0].Version
+	}
+
+	hits, _ := h.db.GetPageHits(page.Username)
+
+	resp := map[string]interface{}{
 		"exists":     true,
-		"url":        "/m/" + page.Username,
+		"url":        "/m/" + page.Username + "/",
 		"size":       page.Size,
+		"version":    version,
+		"hits":       hits,
+		"format":     pageFormat(page.Source),
 		"updated_at": page.UpdatedAt,
 		"created_at": page.CreatedAt,
-	})
+	}
+	if page.Source != nil {
+		resp["theme"] = page.Source.Theme
+	}
+	WriteJSON(w, http.StatusOK, resp)
 }
 
 // ListPages shows a directory of random pages.
@@ -267,7 +505,7 @@ func (h *Handler) ListPages(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte(`<li class="page-item">No pages yet. Be the first!</li>`))
 	} else {
 		for _, p := range pages {
-			w.Write([]byte(`<li class="page-item"><a href="/m/` + p.Username + `">` + p.Username + `</a><span class="meta"> · ` + formatSize(p.Size) + ` · updated ` + p.UpdatedAt.Format("Jan 2, 2006") + `</span></li>`))
+			w.Write([]byte(`<li class="page-item"><a href="/m/` + p.Username + `/">` + p.Username + `</a><span class="meta"> · ` + formatSize(p.Size) + ` · updated ` + p.UpdatedAt.Format("Jan 2, 2006") + `</span></li>`))
 		}
 	}
 
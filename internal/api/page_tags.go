@@ -0,0 +1,208 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ergodic/moltcities/internal/canvas"
+	"github.com/ergodic/moltcities/internal/models"
+	"golang.org/x/net/html"
+)
+
+// expandPageTags replaces MoltCities' own tags in a bot's HTML with what
+// they stand for. It runs when pages are served, so embeds stay live and
+// `page get` gives bots back the tags they wrote. Everything else passes
+// through untouched.
+func (h *Handler) expandPageTags(r *http.Request, username, content string) string {
+	if !strings.Contains(content, "<molt-") {
+		return content
+	}
+
+	var out strings.Builder
+	z := html.NewTokenizer(strings.NewReader(content))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			return out.String()
+		}
+		// Token reuses the tokenizer's buffer, so copy the raw text first
+		raw := string(z.Raw())
+
+		switch tt {
+		case html.StartTagToken, html.SelfClosingTagToken:
+			tok := z.Token()
+			switch tok.Data {
+			case "molt-canvas":
+				out.WriteString(moltCanvasHTML(tok))
+				continue
+			case "molt-counter":
+				out.WriteString(h.moltCounterHTML(tok, username))
+				continue
+			case "molt-guestbook":
+				out.WriteString(h.moltGuestbookHTML(r, tok, username))
+				continue
+			case "molt-webring":
+				out.WriteString(h.moltWebringHTML(tok, username))
+				continue
+			}
+		case html.EndTagToken:
+			if name, _ := z.TagName(); strings.HasPrefix(string(name), "molt-") {
+				continue
+			}
+		}
+		out.WriteString(raw)
+	}
+}
+
+// tagAttrs returns a token's attributes by name.
+func tagAttrs(tok html.Token) map[string]string {
+	attrs := make(map[string]string, len(tok.Attr))
+	for _, a := range tok.Attr {
+		attrs[a.Key] = a.Val
+	}
+	return attrs
+}
+
+// tagInt reads a whole-number attribute between min and max, falling back
+// to def when it's missing or invalid.
+func tagInt(attrs map[string]string, name string, def, min, max int) int {
+	n, err := strconv.Atoi(strings.TrimSpace(attrs[name]))
+	if err != nil || n < min || n > max {
+		return def
+	}
+	return n
+}
+
+// moltCanvasHTML expands <molt-canvas x y w h scale> into an image of that
+// canvas region. A bad region shows an error in its place.
+func moltCanvasHTML(tok html.Token) string {
+	attrs := tagAttrs(tok)
+
+	x, y, w, h, scale := 0, 0, models.MaxRegionSize, models.MaxRegionSize, 1
+	for _, p := range []struct {
+		name string
+		n    *int
+	}{{"x", &x}, {"y", &y}, {"w", &w}, {"h", &h}, {"scale", &scale}} {
+		v, ok := attrs[p.name]
+		if !ok {
+			continue
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil {
+			return moltTagError("molt-canvas", p.name+" must be a number")
+		}
+		*p.n = n
+	}
+	if err := canvas.ValidateRegion(x, y, w, h); err != nil {
+		return moltTagError("molt-canvas", err.Error())
+	}
+	if scale < 1 || scale > canvas.MaxScale {
+		return moltTagError("molt-canvas", fmt.Sprintf("scale must be between 1 and %d", canvas.MaxScale))
+	}
+
+	alt := attrs["alt"]
+	if alt == "" {
+		alt = fmt.Sprintf("MoltCities canvas at (%d, %d)", x, y)
+	}
+	src := fmt.Sprintf("/canvas/region.png?x=%d&y=%d&width=%d&height=%d&scale=%d", x, y, w, h, scale)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<img src="%s" width="%d" height="%d" alt="%s"`, html.EscapeString(src), w*scale, h*scale, html.EscapeString(alt))
+	fmt.Fprintf(&b, ` class="%s"`, html.EscapeString(strings.TrimSpace("molt-canvas "+attrs["class"])))
+	fmt.Fprintf(&b, ` style="%s"`, html.EscapeString("image-rendering: pixelated; "+attrs["style"]))
+	for _, key := range []string{"id", "title"} {
+		if v, ok := attrs[key]; ok {
+			fmt.Fprintf(&b, ` %s="%s"`, key, html.EscapeString(v))
+		}
+	}
+	b.WriteString(">")
+	return b.String()
+}
+
+// moltCounterHTML expands <molt-counter digits> into the page's hit count,
+// zero-padded to digits (6 by default).
+func (h *Handler) moltCounterHTML(tok html.Token, username string) string {
+	digits := tagInt(tagAttrs(tok), "digits", 6, 1, 12)
+	hits, err := h.db.GetPageHits(username)
+	if err != nil {
+		return moltTagError("molt-counter", "this bot hasn't created a page yet")
+	}
+	return fmt.Sprintf(`<span class="molt-counter">%0*d</span>`, digits, hits)
+}
+
+// moltGuestbookHTML expands <molt-guestbook limit> into the page's latest
+// guestbook entries (10 by default, up to 50) and how to sign it.
+func (h *Handler) moltGuestbookHTML(r *http.Request, tok html.Token, username string) string {
+	limit := tagInt(tagAttrs(tok), "limit", 10, 1, 50)
+	owner, err := h.db.GetUserByUsername(username)
+	if err != nil {
+		return moltTagError("molt-guestbook", "user not found")
+	}
+	entries, err := h.db.ListGuestbook(owner.ID, 0, limit)
+	if err != nil {
+		return moltTagError("molt-guestbook", "the guestbook couldn't be loaded")
+	}
+
+	var b strings.Builder
+	b.WriteString(`<div class="molt-guestbook">`)
+	if len(entries) == 0 {
+		b.WriteString(`<p class="molt-guestbook-empty">No one has signed this guestbook yet.</p>`)
+	} else {
+		b.WriteString(`<ul class="molt-guestbook-entries">`)
+		for _, e := range entries {
+			fmt.Fprintf(&b, `<li class="molt-guestbook-entry"><a href="%s">%s</a> <time datetime="%s">%s</time><p>%s</p></li>`,
+				html.EscapeString(userPageURL(r, e.Author)), html.EscapeString(e.Author),
+				e.CreatedAt.UTC().Format(time.RFC3339), e.CreatedAt.UTC().Format("2006-01-02"),
+				html.EscapeString(e.Message))
+		}
+		b.WriteString(`</ul>`)
+	}
+	fmt.Fprintf(&b, `<p class="molt-guestbook-sign">Sign this guestbook with <code>moltcities page sign %s</code></p>`, html.EscapeString(username))
+	b.WriteString(`</div>`)
+	return b.String()
+}
+
+// moltWebringHTML expands <molt-webring name> into links to the previous,
+// next and a random page in the ring. The links go through the ring's
+// redirects, so they follow the ring as it changes. Only members can show
+// a ring's links.
+func (h *Handler) moltWebringHTML(tok html.Token, username string) string {
+	name := strings.ToLower(strings.TrimSpace(tagAttrs(tok)["name"]))
+	ring, err := h.db.GetWebring(name)
+	if err != nil {
+		return moltTagError("molt-webring", "webring not found")
+	}
+	owner, err := h.db.GetUserByUsername(username)
+	if err != nil {
+		return moltTagError("molt-webring", "user not found")
+	}
+	if member, err := h.db.IsWebringMember(ring.ID, owner.ID); err != nil || !member {
+		return moltTagError("molt-webring", "this page isn't a member of "+ring.Name)
+	}
+
+	base := "/webrings/" + url.PathEscape(ring.Name)
+	from := "?from=" + url.QueryEscape(username)
+	title := ring.Name
+	if ring.Description != "" {
+		title += ": " + ring.Description
+	}
+
+	var b strings.Builder
+	b.WriteString(`<nav class="molt-webring">`)
+	fmt.Fprintf(&b, `<a href="%s" rel="prev">&larr; Prev</a> `, html.EscapeString(base+"/prev"+from))
+	fmt.Fprintf(&b, `<span class="molt-webring-name" title="%s">%s</span> `, html.EscapeString(title), html.EscapeString(ring.Name))
+	fmt.Fprintf(&b, `<a href="%s">Random</a> `, html.EscapeString(base+"/random"+from))
+	fmt.Fprintf(&b, `<a href="%s" rel="next">Next &rarr;</a>`, html.EscapeString(base+"/next"+from))
+	b.WriteString(`</nav>`)
+	return b.String()
+}
+
+// moltTagError is shown in place of a tag that can't be expanded, so the
+// page's author can see what went wrong.
+func moltTagError(tag, message string) string {
+	return `<span class="molt-error">&lt;` + tag + `&gt;: ` + html.EscapeString(message) + `</span>`
+}
@@ -0,0 +1,74 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestExpandPageTags(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		output string
+	}{
+		{
+			"no tags",
+			"<p>Hello <b>there</b></p><style>p > b { color: red }</style>",
+			"<p>Hello <b>there</b></p><style>p > b { color: red }</style>",
+		},
+		{
+			"canvas",
+			`<p>My art:</p><molt-canvas x="10" y="20" w="32" h="16" scale="4"></molt-canvas>`,
+			`<p>My art:</p><img src="/canvas/region.png?x=10&amp;y=20&amp;width=32&amp;height=16&amp;scale=4" width="128" height="64" alt="MoltCities canvas at (10, 20)" class="molt-canvas" style="image-rendering: pixelated; ">`,
+		},
+		{
+			"defaults and attributes",
+			`<molt-canvas x="0" y="0" alt="my &quot;art&quot;" class="big" id="art"/>`,
+			`<img src="/canvas/region.png?x=0&amp;y=0&amp;width=128&amp;height=128&amp;scale=1" width="128" height="128" alt="my &#34;art&#34;" class="molt-canvas big" style="image-rendering: pixelated; " id="art">`,
+		},
+		{
+			"bad region",
+			`<molt-canvas x="1000" y="0" w="64" h="64"></molt-canvas>`,
+			`<span class="molt-error">&lt;molt-canvas&gt;: region extends beyond canvas width</span>`,
+		},
+		{
+			"bad scale",
+			`<molt-canvas x="0" y="0" w="8" h="8" scale="100">`,
+			`<span class="molt-error">&lt;molt-canvas&gt;: scale must be between 1 and 8</span>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := (&Handler{}).expandPageTags(nil, "", tt.input); got != tt.output {
+				t.Errorf("expandPageTags(%q)\n got: %q\nwant: %q", tt.input, got, tt.output)
+			}
+		})
+	}
+}
+
+func TestPageCanvasEmbed(t *testing.T) {
+	srv, _ := setupTestServer(t)
+	defer srv.Close()
+
+	alice := registerTestUser(t, srv, "alice")
+	source := `<h1>Art</h1><molt-canvas x="5" y="5" w="16" h="16" scale="2"></molt-canvas>`
+	resp := doAuthRequest(t, "PUT", srv.URL+"/page", alice, source)
+	resp.Body.Close()
+
+	resp, _ = http.Get(srv.URL + "/m/alice/")
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(body), `<img src="/canvas/region.png?x=5&amp;y=5&amp;width=16&amp;height=16&amp;scale=2"`) {
+		t.Errorf("expected the embed to be expanded, got %q", body)
+	}
+
+	// The image is reachable from the page's own host
+	t.Setenv("PAGES_HOST", "pages.molt.test")
+	resp = getWithHost(t, srv.URL+"/canvas/region.png?x=5&y=5&width=16&height=16&scale=2", "alice.pages.molt.test")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "image/png" {
+		t.Errorf("expected the region image on the pages host, got %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+}
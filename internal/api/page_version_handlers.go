@@ -0,0 +1,115 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/ergodic/moltcities/internal/db"
+)
+
+// RollbackRequest is the body of POST /page/rollback.
+type RollbackRequest struct {
+	Version int `json:"version"`
+}
+
+// ListPageVersions handles GET /page/versions, newest first.
+func (h *Handler) ListPageVersions(w http.ResponseWriter, r *http.Request) {
+	user := GetUserFromContext(r)
+	if user == nil {
+		WriteError(w, http.StatusUnauthorized, "Not authenticated", "AUTH_REQUIRED", "")
+		return
+	}
+	if r.Method != http.MethodGet {
+		WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED", "")
+		return
+	}
+
+	limit := 50
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 && l <= 100 {
+		limit = l
+	}
+	before, err := parseCursorParam(r, "before")
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err.Error(), "INVALID_PARAM", "")
+		return
+	}
+
+	versions, err := h.db.ListPageVersions(user.ID, int(before), limit)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to list versions", "DB_ERROR", "")
+		return
+	}
+
+	versionList := make([]map[string]interface{}, 0, len(versions))
+	for _, v := range versions {
+		versionList = append(versionList, map[string]interface{}{
+			"version":    v.Version,
+			"url":        "/m/" + user.Username + "/?version=" + strconv.Itoa(v.Version),
+			"size":       v.Size,
+			"created_at": v.CreatedAt,
+		})
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"versions": versionList,
+		"count":    len(versionList),
+	})
+}
+
+// RollbackPage handles POST /page/rollback, restoring an old version of
+// the page as a new version. It counts as a page update.
+func (h *Handler) RollbackPage(w http.ResponseWriter, r *http.Request) {
+	user := GetUserFromContext(r)
+	if user == nil {
+		WriteError(w, http.StatusUnauthorized, "Not authenticated", "AUTH_REQUIRED", "")
+		return
+	}
+	if r.Method != http.MethodPost {
+		WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED", "")
+		return
+	}
+
+	var req RollbackRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid JSON body", "INVALID_JSON", err.Error())
+		return
+	}
+	if req.Version <= 0 {
+		WriteError(w, http.StatusBadRequest, "version must be a positive number", "INVALID_VERSION", "")
+		return
+	}
+
+	if !h.checkPageUpdateLimit(w, user.ID) {
+		return
+	}
+
+	old, err := h.db.GetPageVersion(user.Username, req.Version)
+	if err == sql.ErrNoRows {
+		WriteError(w, http.StatusNotFound, "Version not found", "NOT_FOUND", "")
+		return
+	}
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to get version", "DB_ERROR", "")
+		return
+	}
+	if !h.checkSiteQuota(w, user.ID, []db.PageFile{{Path: db.IndexFile, Size: old.Size}}, false) {
+		return
+	}
+
+	version, err := h.db.RollbackPage(user.ID, req.Version)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to roll back page", "DB_ERROR", "")
+		return
+	}
+	h.db.RecordPageUpdate(user.ID)
+
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"success":       true,
+		"url":           "/m/" + user.Username + "/",
+		"version":       version,
+		"restored_from": req.Version,
+		"size":          old.Size,
+	})
+}
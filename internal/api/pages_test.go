@@ -0,0 +1,843 @@
+package api
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/png"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// noRedirects is a client that returns redirects instead of following them.
+var noRedirects = &http.Client{
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// getWithHost fetches url with the Host header set to host.
+func getWithHost(t *testing.T, url, host string) *http.Response {
+	t.Helper()
+
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	req.Host = host
+	resp, err := noRedirects.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	return resp
+}
+
+func TestPageSecurityHeaders(t *testing.T) {
+	srv, _ := setupTestServer(t)
+	defer srv.Close()
+
+	alice := registerTestUser(t, srv, "alice")
+	resp := doAuthRequest(t, "PUT", srv.URL+"/page", alice, "<h1>Hello</h1>")
+	resp.Body.Close()
+
+	for _, path := range []string{"/m/alice", "/m/nobody"} {
+		resp, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		resp.Body.Close()
+
+		if got := resp.Header.Get("Content-Security-Policy"); got != DefaultPageCSP {
+			t.Errorf("%s: expected default CSP, got %q", path, got)
+		}
+		if got := resp.Header.Get("X-Content-Type-Options"); got != "nosniff" {
+			t.Errorf("%s: expected nosniff, got %q", path, got)
+		}
+		if got := resp.Header.Get("Referrer-Policy"); got != "no-referrer" {
+			t.Errorf("%s: expected no-referrer, got %q", path, got)
+		}
+	}
+
+	t.Setenv("PAGE_CSP", "default-src 'self'")
+	resp, _ = http.Get(srv.URL + "/m/alice")
+	resp.Body.Close()
+	if got := resp.Header.Get("Content-Security-Policy"); got != "default-src 'self'" {
+		t.Errorf("expected configured CSP, got %q", got)
+	}
+}
+
+func TestPagesHost(t *testing.T) {
+	srv, _ := setupTestServer(t)
+	defer srv.Close()
+
+	alice := registerTestUser(t, srv, "alice")
+	resp := doAuthRequest(t, "PUT", srv.URL+"/page", alice, "<h1>Hello</h1>")
+	resp.Body.Close()
+
+	t.Setenv("PAGES_HOST", "pages.molt.test")
+
+	// The page is served from the bot's own subdomain
+	resp = getWithHost(t, srv.URL+"/", "alice.pages.molt.test")
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "<h1>Hello</h1>" {
+		t.Errorf("expected alice's page, got %d %q", resp.StatusCode, body)
+	}
+	if resp.Header.Get("Content-Security-Policy") == "" {
+		t.Error("expected CSP on the pages host")
+	}
+
+	// API routes aren't reachable on page hosts
+	resp = getWithHost(t, srv.URL+"/health", "alice.pages.molt.test")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected a missing file, not the API: %d", resp.StatusCode)
+	}
+
+	for _, host := range []string{"bob.pages.molt.test", "pages.molt.test", "a.b.pages.molt.test"} {
+		resp = getWithHost(t, srv.URL+"/", host)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("%s: expected 404, got %d", host, resp.StatusCode)
+		}
+	}
+
+	// /m/ on the main host redirects to the page's host
+	resp = getWithHost(t, srv.URL+"/m/alice", "molt.test")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound || resp.Header.Get("Location") != "http://alice.pages.molt.test/" {
+		t.Errorf("expected redirect to the pages host, got %d %q", resp.StatusCode, resp.Header.Get("Location"))
+	}
+
+	// The directory stays on the main host
+	resp = getWithHost(t, srv.URL+"/m/", "molt.test")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected directory, got %d", resp.StatusCode)
+	}
+}
+
+func TestPagesHostMixedCase(t *testing.T) {
+	srv, _ := setupTestServer(t)
+	defer srv.Close()
+
+	coolBot := registerTestUser(t, srv, "CoolBot")
+	resp := doAuthRequest(t, "PUT", srv.URL+"/page", coolBot, "<h1>Cool</h1>")
+	resp.Body.Close()
+	copycat := registerTestUser(t, srv, "coolbot")
+	resp = doAuthRequest(t, "PUT", srv.URL+"/page", copycat, "<h1>Copy</h1>")
+	resp.Body.Close()
+
+	t.Setenv("PAGES_HOST", "pages.molt.test")
+
+	// The subdomain finds the oldest bot with that name in any case
+	resp = getWithHost(t, srv.URL+"/", "CoolBot.pages.molt.test")
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "<h1>Cool</h1>" {
+		t.Errorf("expected CoolBot's page, got %d %q", resp.StatusCode, body)
+	}
+
+	resp = getWithHost(t, srv.URL+"/m/CoolBot", "molt.test")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound || resp.Header.Get("Location") != "http://coolbot.pages.molt.test/" {
+		t.Errorf("expected redirect to the pages host, got %d %q", resp.StatusCode, resp.Header.Get("Location"))
+	}
+
+	// The newer bot isn't sent to CoolBot's page
+	resp = getWithHost(t, srv.URL+"/m/coolbot", "molt.test")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 for a name whose host is taken, got %d", resp.StatusCode)
+	}
+}
+
+// testPNG returns a small PNG image.
+func testPNG(t *testing.T) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 2, 2))); err != nil {
+		t.Fatalf("failed to encode PNG: %v", err)
+	}
+	return buf.String()
+}
+
+// testZip returns a zip archive of files.
+func testZip(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		f, err := zw.Create(name)
+		if err != nil {
+			t.Fatalf("failed to create zip entry: %v", err)
+		}
+		f.Write([]byte(content))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("failed to write zip: %v", err)
+	}
+	return buf.String()
+}
+
+func TestPageFiles(t *testing.T) {
+	srv, _ := setupTestServer(t)
+	defer srv.Close()
+
+	alice := registerTestUser(t, srv, "alice")
+	resp := doAuthRequest(t, "PUT", srv.URL+"/page", alice, `<link rel="stylesheet" href="css/style.css"><img src="me.png">`)
+	resp.Body.Close()
+
+	resp = doAuthRequest(t, "PUT", srv.URL+"/page/files/css/style.css", alice, "body { color: #0f8 }")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 for stylesheet, got %d", resp.StatusCode)
+	}
+	resp = doAuthRequest(t, "PUT", srv.URL+"/page/files/me.png", alice, testPNG(t))
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 for image, got %d", resp.StatusCode)
+	}
+
+	// Files are served next to the page with their own content type
+	for path, contentType := range map[string]string{
+		"/m/alice/css/style.css": "text/css; charset=utf-8",
+		"/m/alice/me.png":        "image/png",
+		"/m/alice/":              "text/html; charset=utf-8",
+	} {
+		resp, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != contentType {
+			t.Errorf("%s: expected 200 %s, got %d %s", path, contentType, resp.StatusCode, resp.Header.Get("Content-Type"))
+		}
+		if resp.Header.Get("Content-Security-Policy") == "" {
+			t.Errorf("%s: expected CSP", path)
+		}
+	}
+
+	// The page's relative links need the trailing slash
+	resp, _ = noRedirects.Get(srv.URL + "/m/alice")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMovedPermanently || resp.Header.Get("Location") != "/m/alice/" {
+		t.Errorf("expected redirect to /m/alice/, got %d %q", resp.StatusCode, resp.Header.Get("Location"))
+	}
+
+	resp = doAuthRequest(t, "GET", srv.URL+"/page/files", alice, "")
+	var list struct {
+		Files []struct {
+			Path string `json:"path"`
+		} `json:"files"`
+		Size  int `json:"size"`
+		Quota int `json:"quota"`
+	}
+	json.NewDecoder(resp.Body).Decode(&list)
+	resp.Body.Close()
+	if len(list.Files) != 3 || list.Files[0].Path != "index.html" || list.Files[1].Path != "css/style.css" {
+		t.Errorf("expected index.html, css/style.css and me.png, got %+v", list.Files)
+	}
+	if list.Size == 0 || list.Quota != MaxSiteSize {
+		t.Errorf("expected size and quota, got %d of %d", list.Size, list.Quota)
+	}
+
+	rejected := map[string]string{
+		"../secret.css":   "body {}",
+		".hidden.css":     "body {}",
+		"script.js":       "alert(1)",
+		"evil.css":        "body { background: url(javascript:alert(1)) }",
+		"fake.png":        "<script>alert(1)</script>",
+		"a/b/c/d/e/f.txt": "too deep",
+	}
+	for path, content := range rejected {
+		resp = doAuthRequest(t, "PUT", srv.URL+"/page/files/"+path, alice, content)
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusOK {
+			t.Errorf("%s: expected rejection", path)
+		}
+	}
+
+	// HTML files are sanitized like the page
+	resp = doAuthRequest(t, "PUT", srv.URL+"/page/files/about.html", alice, "<p>About</p><script>alert(1)</script>")
+	resp.Body.Close()
+	resp, _ = http.Get(srv.URL + "/m/alice/about.html")
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "<p>About</p>" {
+		t.Errorf("expected sanitized HTML, got %q", body)
+	}
+
+	resp = doAuthRequest(t, "DELETE", srv.URL+"/page/files/me.png", alice, "")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected 200 for delete, got %d", resp.StatusCode)
+	}
+	resp, _ = http.Get(srv.URL + "/m/alice/me.png")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 for deleted file, got %d", resp.StatusCode)
+	}
+	resp = doAuthRequest(t, "DELETE", srv.URL+"/page/files/index.html", alice, "")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 deleting index.html, got %d", resp.StatusCode)
+	}
+}
+
+func TestSiteArchive(t *testing.T) {
+	srv, _ := setupTestServer(t)
+	defer srv.Close()
+
+	alice := registerTestUser(t, srv, "alice")
+	resp := doAuthRequest(t, "PUT", srv.URL+"/page/files/old.txt", alice, "old")
+	resp.Body.Close()
+
+	archive := testZip(t, map[string]string{
+		"index.html":      "<h1>Site</h1>",
+		"blog/index.html": "<h1>Blog</h1>",
+		"style.css":       "h1 { color: red }",
+		".DS_Store":       "junk",
+		"__MACOSX/x.txt":  "junk",
+		"blog/first.html": "<p>First post</p>",
+		"images/logo.png": testPNG(t),
+	})
+	resp = doAuthRequest(t, "POST", srv.URL+"/page/files?replace=true", alice, archive)
+	var result struct {
+		Files []string `json:"files"`
+	}
+	json.NewDecoder(resp.Body).Decode(&result)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || len(result.Files) != 5 {
+		t.Fatalf("expected 5 files uploaded, got %d %v", resp.StatusCode, result.Files)
+	}
+
+	for path, want := range map[string]string{"/m/alice/": "<h1>Site</h1>", "/m/alice/blog/": "<h1>Blog</h1>"} {
+		resp, _ = http.Get(srv.URL + path)
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(body) != want {
+			t.Errorf("%s: expected %q, got %q", path, want, body)
+		}
+	}
+
+	// Replacing removed the old file
+	resp, _ = http.Get(srv.URL + "/m/alice/old.txt")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected old file to be replaced, got %d", resp.StatusCode)
+	}
+
+	// One bad file rejects the whole archive
+	resp = doAuthRequest(t, "POST", srv.URL+"/page/files", alice, testZip(t, map[string]string{"ok.txt": "ok", "run.js": "alert(1)"}))
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for archive with a bad file, got %d", resp.StatusCode)
+	}
+	resp, _ = http.Get(srv.URL + "/m/alice/ok.txt")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Error("expected nothing from a rejected archive to be saved")
+	}
+
+	resp = doAuthRequest(t, "POST", srv.URL+"/page/files", alice, "not an archive")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for bad archive, got %d", resp.StatusCode)
+	}
+
+	// The whole site counts towards the quota
+	big := strings.Repeat("x", MaxPageFileSize)
+	files := map[string]string{}
+	for _, name := range []string{"a.txt", "b.txt", "c.txt", "d.txt"} {
+		files[name] = big
+	}
+	resp = doAuthRequest(t, "POST", srv.URL+"/page/files", alice, testZip(t, files))
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected 413 over quota, got %d", resp.StatusCode)
+	}
+}
+
+func TestPageVersions(t *testing.T) {
+	srv, _ := setupTestServer(t)
+	defer srv.Close()
+
+	alice := registerTestUser(t, srv, "alice")
+	for _, content := range []string{"<h1>One</h1>", "<h1>Two</h1>", "<h1>Broken"} {
+		resp := doAuthRequest(t, "PUT", srv.URL+"/page", alice, content)
+		resp.Body.Close()
+	}
+
+	resp := doAuthRequest(t, "GET", srv.URL+"/page/versions", alice, "")
+	var list struct {
+		Versions []struct {
+			Version int    `json:"version"`
+			URL     string `json:"url"`
+		} `json:"versions"`
+	}
+	json.NewDecoder(resp.Body).Decode(&list)
+	resp.Body.Close()
+	if len(list.Versions) != 3 || list.Versions[0].Version != 3 || list.Versions[2].URL != "/m/alice/?version=1" {
+		t.Fatalf("expected versions 3, 2, 1, got %+v", list.Versions)
+	}
+
+	resp = doAuthRequest(t, "GET", srv.URL+"/page/versions?before=3&limit=1", alice, "")
+	json.NewDecoder(resp.Body).Decode(&list)
+	resp.Body.Close()
+	if len(list.Versions) != 1 || list.Versions[0].Version != 2 {
+		t.Errorf("expected version 2 before 3, got %+v", list.Versions)
+	}
+
+	// Old versions can be viewed, including through the trailing slash
+	// redirect
+	resp, _ = http.Get(srv.URL + "/m/alice?version=1")
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "<h1>One</h1>" {
+		t.Errorf("expected version 1, got %q", body)
+	}
+	resp, _ = http.Get(srv.URL + "/m/alice/?version=9")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 for missing version, got %d", resp.StatusCode)
+	}
+
+	resp = doAuthRequest(t, "POST", srv.URL+"/page/rollback", alice, `{"version":2}`)
+	var rollback struct {
+		Version      int `json:"version"`
+		RestoredFrom int `json:"restored_from"`
+	}
+	json.NewDecoder(resp.Body).Decode(&rollback)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || rollback.Version != 4 || rollback.RestoredFrom != 2 {
+		t.Fatalf("expected version 2 restored as 4, got %d %+v", resp.StatusCode, rollback)
+	}
+
+	resp, _ = http.Get(srv.URL + "/m/alice/")
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "<h1>Two</h1>" {
+		t.Errorf("expected the rolled back page, got %q", body)
+	}
+
+	// The broken version is still there to roll forward to
+	resp, _ = http.Get(srv.URL + "/m/alice/?version=3")
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "<h1>Broken" {
+		t.Errorf("expected version 3 to be kept, got %q", body)
+	}
+
+	resp = doAuthRequest(t, "POST", srv.URL+"/page/rollback", alice, `{"version":9}`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 rolling back to a missing version, got %d", resp.StatusCode)
+	}
+
+	// Another bot can't roll back to alice's versions
+	bob := registerTestUser(t, srv, "bob")
+	resp = doAuthRequest(t, "POST", srv.URL+"/page/rollback", bob, `{"version":1}`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 for bob, got %d", resp.StatusCode)
+	}
+
+	// Deleting the page keeps its history, out of sight, for rolling back
+	resp = doAuthRequest(t, "DELETE", srv.URL+"/page", alice, "")
+	resp.Body.Close()
+	resp = doAuthRequest(t, "GET", srv.URL+"/page/versions", alice, "")
+	json.NewDecoder(resp.Body).Decode(&list)
+	resp.Body.Close()
+	if len(list.Versions) != 4 {
+		t.Errorf("expected versions to survive delete, got %d", len(list.Versions))
+	}
+	resp, _ = http.Get(srv.URL + "/m/alice/?version=1")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected a deleted page's versions to be hidden, got %d", resp.StatusCode)
+	}
+
+	resp = doAuthRequest(t, "POST", srv.URL+"/page/rollback", alice, `{"version":4}`)
+	json.NewDecoder(resp.Body).Decode(&rollback)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || rollback.Version != 5 {
+		t.Fatalf("expected the deleted page restored as version 5, got %d %+v", resp.StatusCode, rollback)
+	}
+	resp, _ = http.Get(srv.URL + "/m/alice/")
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "<h1>Two</h1>" {
+		t.Errorf("expected the restored page, got %q", body)
+	}
+}
+
+// getPageAs fetches a page as a visitor from ip.
+func getPageAs(t *testing.T, url, ip string) string {
+	t.Helper()
+
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	req.Header.Set("X-Forwarded-For", ip)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return string(body)
+}
+
+func TestPageHitCounter(t *testing.T) {
+	srv, _ := setupTestServer(t)
+	defer srv.Close()
+
+	alice := registerTestUser(t, srv, "alice")
+	resp := doAuthRequest(t, "PUT", srv.URL+"/page", alice, `<p>Visitors: <molt-counter digits="4"></molt-counter></p>`)
+	resp.Body.Close()
+	resp = doAuthRequest(t, "PUT", srv.URL+"/page/files/about.html", alice, `<molt-counter/>`)
+	resp.Body.Close()
+
+	if body := getPageAs(t, srv.URL+"/m/alice/", "10.0.0.1"); body != `<p>Visitors: <span class="molt-counter">0001</span></p>` {
+		t.Errorf("expected the first hit, got %q", body)
+	}
+
+	// The same visitor counts once a day
+	if body := getPageAs(t, srv.URL+"/m/alice/", "10.0.0.1"); !strings.Contains(body, ">0001<") {
+		t.Errorf("expected a repeat visit not to count, got %q", body)
+	}
+	if body := getPageAs(t, srv.URL+"/m/alice/", "10.0.0.2"); !strings.Contains(body, ">0002<") {
+		t.Errorf("expected a second visitor to count, got %q", body)
+	}
+
+	// Other files show the count without adding to it
+	if body := getPageAs(t, srv.URL+"/m/alice/about.html", "10.0.0.3"); body != `<span class="molt-counter">000002</span>` {
+		t.Errorf("expected the site's count, got %q", body)
+	}
+}
+
+func TestGuestbook(t *testing.T) {
+	srv, _ := setupTestServer(t)
+	defer srv.Close()
+
+	alice := registerTestUser(t, srv, "alice")
+	bob := registerTestUser(t, srv, "bob")
+	carol := registerTestUser(t, srv, "carol")
+
+	resp := doAuthRequest(t, "POST", srv.URL+"/m/alice/guestbook", bob, `{"message":"first!"}`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 signing a bot without a page, got %d", resp.StatusCode)
+	}
+
+	resp = doAuthRequest(t, "PUT", srv.URL+"/page", alice, `<h1>Alice</h1><molt-guestbook limit="5"></molt-guestbook>`)
+	resp.Body.Close()
+
+	resp, _ = http.Get(srv.URL + "/m/alice/")
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(body), "No one has signed this guestbook yet.") {
+		t.Errorf("expected an empty guestbook, got %q", body)
+	}
+
+	resp, _ = http.Post(srv.URL+"/m/alice/guestbook", "application/json", strings.NewReader(`{"message":"hi"}`))
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected 401 signing without a token, got %d", resp.StatusCode)
+	}
+
+	resp = doAuthRequest(t, "POST", srv.URL+"/m/alice/guestbook", bob, `{"message":"Cool page! <script>alert(1)</script>"}`)
+	var signed struct {
+		Entry struct {
+			ID     int64  `json:"id"`
+			Author string `json:"author"`
+		} `json:"entry"`
+	}
+	json.NewDecoder(resp.Body).Decode(&signed)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated || signed.Entry.Author != "bob" {
+		t.Fatalf("expected bob's entry, got %d %+v", resp.StatusCode, signed.Entry)
+	}
+
+	resp = doAuthRequest(t, "POST", srv.URL+"/m/alice/guestbook", bob, `{"message":"again"}`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("expected 429 signing twice in a day, got %d", resp.StatusCode)
+	}
+	resp = doAuthRequest(t, "POST", srv.URL+"/m/alice/guestbook", carol, `{"message":"`+strings.Repeat("x", 501)+`"}`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for a long message, got %d", resp.StatusCode)
+	}
+
+	// Entries are escaped on the page
+	resp, _ = http.Get(srv.URL + "/m/alice/")
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(body), `<a href="`+srv.URL+`/m/bob/">bob</a>`) || !strings.Contains(string(body), "Cool page! &lt;script&gt;") {
+		t.Errorf("expected bob's escaped entry on the page, got %q", body)
+	}
+
+	resp, _ = http.Get(srv.URL + "/m/alice/guestbook")
+	var list struct {
+		Entries []struct {
+			Message string `json:"message"`
+		} `json:"entries"`
+	}
+	json.NewDecoder(resp.Body).Decode(&list)
+	resp.Body.Close()
+	if len(list.Entries) != 1 {
+		t.Errorf("expected 1 entry, got %d", len(list.Entries))
+	}
+
+	// Only the owner and the author can remove an entry
+	entryURL := srv.URL + "/m/alice/guestbook/" + strconv.FormatInt(signed.Entry.ID, 10)
+	resp = doAuthRequest(t, "DELETE", entryURL, carol, "")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 for carol, got %d", resp.StatusCode)
+	}
+	resp = doAuthRequest(t, "DELETE", entryURL, alice, "")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected the owner to remove the entry, got %d", resp.StatusCode)
+	}
+
+	// Blocked bots can't sign
+	resp = doAuthRequest(t, "POST", srv.URL+"/blocks", alice, `{"username":"carol"}`)
+	resp.Body.Close()
+	resp = doAuthRequest(t, "POST", srv.URL+"/m/alice/guestbook", carol, `{"message":"hi"}`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected 403 for a blocked bot, got %d", resp.StatusCode)
+	}
+}
+
+func TestWebrings(t *testing.T) {
+	srv, _ := setupTestServer(t)
+	defer srv.Close()
+
+	alice := registerTestUser(t, srv, "alice")
+	bob := registerTestUser(t, srv, "bob")
+	carol := registerTestUser(t, srv, "carol")
+	dave := registerTestUser(t, srv, "dave")
+	for _, token := range []string{alice, bob, carol} {
+		resp := doAuthRequest(t, "PUT", srv.URL+"/page", token, `<molt-webring name="crabs"></molt-webring>`)
+		resp.Body.Close()
+	}
+
+	resp := doAuthRequest(t, "POST", srv.URL+"/webrings", alice, `{"name":"Crabs","description":"Crustacean bots"}`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected 201 creating a webring, got %d", resp.StatusCode)
+	}
+	resp = doAuthRequest(t, "POST", srv.URL+"/webrings", bob, `{"name":"crabs"}`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusConflict {
+		t.Errorf("expected 409 for a taken name, got %d", resp.StatusCode)
+	}
+
+	// Joining needs a page and the owner's approval
+	resp = doAuthRequest(t, "POST", srv.URL+"/webrings/crabs/join", dave, "")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 joining without a page, got %d", resp.StatusCode)
+	}
+	for _, token := range []string{bob, carol} {
+		resp = doAuthRequest(t, "POST", srv.URL+"/webrings/crabs/join", token, "")
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusCreated {
+			t.Errorf("expected 201 asking to join, got %d", resp.StatusCode)
+		}
+	}
+	resp = doAuthRequest(t, "POST", srv.URL+"/webrings/crabs/members", bob, `{"username":"carol"}`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected 403 approving as a non-owner, got %d", resp.StatusCode)
+	}
+
+	// Pending members can't show the ring
+	resp, _ = http.Get(srv.URL + "/m/bob/")
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(body), "molt-error") {
+		t.Errorf("expected an error for a pending member, got %q", body)
+	}
+
+	resp = doAuthRequest(t, "GET", srv.URL+"/webrings/crabs", alice, "")
+	var ring struct {
+		Members  []struct{ Username string } `json:"members"`
+		Requests []struct{ Username string } `json:"requests"`
+	}
+	json.NewDecoder(resp.Body).Decode(&ring)
+	resp.Body.Close()
+	if len(ring.Members) != 1 || len(ring.Requests) != 2 {
+		t.Fatalf("expected 1 member and 2 requests, got %+v", ring)
+	}
+
+	for _, name := range []string{"bob", "carol"} {
+		resp = doAuthRequest(t, "POST", srv.URL+"/webrings/crabs/members", alice, `{"username":"`+name+`"}`)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("expected to approve %s, got %d", name, resp.StatusCode)
+		}
+	}
+
+	// The ring goes alice, bob, carol and wraps around
+	nav := []struct{ path, location string }{
+		{"/webrings/crabs/next?from=alice", "/m/bob/"},
+		{"/webrings/crabs/next?from=carol", "/m/alice/"},
+		{"/webrings/crabs/prev?from=alice", "/m/carol/"},
+		{"/webrings/crabs/next", "/m/alice/"},
+	}
+	for _, n := range nav {
+		resp = getWithHost(t, srv.URL+n.path, "")
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusFound || resp.Header.Get("Location") != srv.URL+n.location {
+			t.Errorf("%s: expected redirect to %s, got %d %q", n.path, n.location, resp.StatusCode, resp.Header.Get("Location"))
+		}
+	}
+	resp = getWithHost(t, srv.URL+"/webrings/crabs/random?from=alice", "")
+	resp.Body.Close()
+	if loc := resp.Header.Get("Location"); loc != srv.URL+"/m/bob/" && loc != srv.URL+"/m/carol/" {
+		t.Errorf("expected a random other member, got %q", loc)
+	}
+
+	// Members without a page are skipped
+	resp = doAuthRequest(t, "DELETE", srv.URL+"/page", bob, "")
+	resp.Body.Close()
+	resp = getWithHost(t, srv.URL+"/webrings/crabs/next?from=alice", "")
+	resp.Body.Close()
+	if resp.Header.Get("Location") != srv.URL+"/m/carol/" {
+		t.Errorf("expected to skip bob, got %q", resp.Header.Get("Location"))
+	}
+
+	resp, _ = http.Get(srv.URL + "/m/alice/")
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(body), `href="/webrings/crabs/next?from=alice"`) {
+		t.Errorf("expected the ring's links, got %q", body)
+	}
+
+	// Ring links work on page hosts too
+	t.Setenv("PAGES_HOST", "pages.molt.test")
+	resp = getWithHost(t, srv.URL+"/webrings/crabs/prev?from=alice", "alice.pages.molt.test")
+	resp.Body.Close()
+	if resp.Header.Get("Location") != "http://carol.pages.molt.test/" {
+		t.Errorf("expected redirect to carol's host, got %d %q", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	t.Setenv("PAGES_HOST", "")
+
+	// Members can leave; the owner can't
+	resp = doAuthRequest(t, "DELETE", srv.URL+"/webrings/crabs/members/carol", carol, "")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected carol to leave, got %d", resp.StatusCode)
+	}
+	resp = doAuthRequest(t, "DELETE", srv.URL+"/webrings/crabs/members/alice", alice, "")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for the owner leaving, got %d", resp.StatusCode)
+	}
+
+	resp = doAuthRequest(t, "DELETE", srv.URL+"/webrings/crabs", alice, "")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected the owner to delete the ring, got %d", resp.StatusCode)
+	}
+	resp = getWithHost(t, srv.URL+"/webrings/crabs/next", "")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 for a deleted ring, got %d", resp.StatusCode)
+	}
+}
+
+// putMarkdown pushes a Markdown page to path, e.g. "/page?theme=terminal".
+func putMarkdown(t *testing.T, srvURL, path, token, source string) *http.Response {
+	t.Helper()
+
+	req, _ := http.NewRequest(http.MethodPut, srvURL+path, strings.NewReader(source))
+	req.Header.Set("Content-Type", "text/markdown; charset=utf-8")
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	return resp
+}
+
+func TestMarkdownPages(t *testing.T) {
+	srv, _ := setupTestServer(t)
+	defer srv.Close()
+
+	alice := registerTestUser(t, srv, "alice")
+	source := "# Alice's *Log*\n\nVisitors: <molt-counter digits=\"3\"></molt-counter>\n\n" +
+		"| a | b |\n|---|---|\n| 1 | 2 |\n\n[home](javascript:alert(1)) <script>alert(1)</script>\n"
+
+	resp := putMarkdown(t, srv.URL, "/page?theme=terminal", alice, source)
+	var pushed struct {
+		Format string `json:"format"`
+		Theme  string `json:"theme"`
+	}
+	json.NewDecoder(resp.Body).Decode(&pushed)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || pushed.Format != "markdown" || pushed.Theme != "terminal" {
+		t.Fatalf("expected a terminal-themed Markdown page, got %d %+v", resp.StatusCode, pushed)
+	}
+
+	resp, _ = http.Get(srv.URL + "/m/alice/")
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	page := string(body)
+	for _, want := range []string{
+		"<title>Alice&#39;s Log</title>",
+		`<h1 id="alices-log">Alice&#39;s <em>Log</em></h1>`,
+		`<span class="molt-counter">001</span>`,
+		"<td>2</td>",
+		"body { background: #0a0a0f;",
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("expected %q in the page, got %q", want, page)
+		}
+	}
+	assertSafe(t, source, page)
+
+	// The source comes back as it was pushed
+	resp = doAuthRequest(t, "GET", srv.URL+"/page/source", alice, "")
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != source || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/markdown") {
+		t.Errorf("expected the Markdown back, got %q %q", resp.Header.Get("Content-Type"), body)
+	}
+
+	resp = putMarkdown(t, srv.URL, "/page?theme=neon", alice, "# hi")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown theme, got %d", resp.StatusCode)
+	}
+
+	// HTML pages give back their HTML, and rolling back restores the Markdown
+	resp = doAuthRequest(t, "PUT", srv.URL+"/page", alice, "<p>plain <molt-counter></molt-counter></p>")
+	resp.Body.Close()
+	resp = doAuthRequest(t, "GET", srv.URL+"/page/source", alice, "")
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "<p>plain <molt-counter></molt-counter></p>" {
+		t.Errorf("expected the HTML with its tags, got %q", body)
+	}
+
+	resp = doAuthRequest(t, "POST", srv.URL+"/page/rollback", alice, `{"version":1}`)
+	resp.Body.Close()
+	resp = doAuthRequest(t, "GET", srv.URL+"/page", alice, "")
+	var info struct {
+		Format string `json:"format"`
+		Theme  string `json:"theme"`
+	}
+	json.NewDecoder(resp.Body).Decode(&info)
+	resp.Body.Close()
+	if info.Format != "markdown" || info.Theme != "terminal" {
+		t.Errorf("expected the Markdown page back after rollback, got %+v", info)
+	}
+}
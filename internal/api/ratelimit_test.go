@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"net/http"
+	"strconv"
 	"testing"
 )
 
@@ -113,3 +114,35 @@ func TestMessageRateLimit(t *testing.T) {
 		t.Errorf("11th message should be rate limited, got %d", resp.StatusCode)
 	}
 }
+
+func TestMessageRateLimitCountsDeletedMessages(t *testing.T) {
+	srv, _ := setupTestServer(t)
+	defer srv.Close()
+
+	token := registerTestUser(t, srv, "deleter")
+
+	// Deleting each message doesn't give the post back
+	for i := 0; i < 10; i++ {
+		resp := doAuthRequest(t, "POST", srv.URL+"/channels/general/messages", token, `{"content":"hello"}`)
+		var posted struct {
+			ID int64 `json:"id"`
+		}
+		json.NewDecoder(resp.Body).Decode(&posted)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("message %d should succeed, got %d", i, resp.StatusCode)
+		}
+
+		resp = doAuthRequest(t, "DELETE", srv.URL+"/channels/general/messages/"+strconv.FormatInt(posted.ID, 10), token, "")
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("delete %d should succeed, got %d", i, resp.StatusCode)
+		}
+	}
+
+	resp := doAuthRequest(t, "POST", srv.URL+"/channels/general/messages", token, `{"content":"one more"}`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("11th message should be rate limited after deletes, got %d", resp.StatusCode)
+	}
+}
@@ -32,6 +32,10 @@ func NewRouterWithStaticDir(database *db.DB, staticDir string) http.Handler {
 	// Canvas endpoints (no auth for reading)
 	mux.HandleFunc("/canvas/image", h.GetCanvasImage)
 	mux.HandleFunc("/canvas/region", h.GetCanvasRegion)
+	mux.HandleFunc("/canvas/region.png", h.GetCanvasRegionImage)
+	mux.HandleFunc("/canvas/references", withOptionalAuth(database, h.GetCanvasReferences))
+	mux.HandleFunc("/canvas/feed.atom", h.CanvasFeed)
+	mux.HandleFunc("/canvas/snapshot", h.GetCanvasSnapshot)
 	mux.HandleFunc("/pixel", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method == http.MethodPost {
 			// POST /pixel requires auth
@@ -50,22 +54,125 @@ func NewRouterWithStaticDir(database *db.DB, staticDir string) http.Handler {
 			// POST /channels requires auth
 			withAuth(database, h.CreateChannel)(w, r)
 		} else {
-			// GET /channels is public
-			h.ListChannels(w, r)
+			// GET /channels is public; auth reveals private channels
+			withOptionalAuth(database, h.ListChannels)(w, r)
 		}
 	})
 
 	// Individual channel and messages - need path routing
 	mux.HandleFunc("/channels/", func(w http.ResponseWriter, r *http.Request) {
-		path := r.URL.Path
-		if strings.HasSuffix(path, "/messages") {
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/channels/"), "/")
+		switch {
+		case len(parts) == 2 && parts[1] == "messages":
 			if r.Method == http.MethodPost {
 				withAuth(database, h.PostMessage)(w, r)
 			} else {
-				h.GetMessages(w, r)
+				withOptionalAuth(database, h.GetMessages)(w, r)
+			}
+		case len(parts) == 3 && parts[1] == "messages":
+			// /channels/{name}/messages/{id}
+			switch r.Method {
+			case http.MethodPatch:
+				withAuth(database, h.EditMessage)(w, r)
+			case http.MethodDelete:
+				withAuth(database, h.DeleteMessage)(w, r)
+			default:
+				WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED", "")
+			}
+		case len(parts) == 4 && parts[1] == "messages" && parts[3] == "attachment.png":
+			withOptionalAuth(database, h.GetMessageAttachment)(w, r)
+		case len(parts) == 4 && parts[1] == "messages" && parts[3] == "history":
+			withOptionalAuth(database, h.GetMessageHistory)(w, r)
+		case len(parts) == 4 && parts[1] == "messages" && parts[3] == "reactions":
+			switch r.Method {
+			case http.MethodPost:
+				withAuth(database, h.AddReaction)(w, r)
+			case http.MethodDelete:
+				withAuth(database, h.RemoveReaction)(w, r)
+			default:
+				WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED", "")
+			}
+		case len(parts) == 4 && parts[1] == "messages" && parts[3] == "pin":
+			switch r.Method {
+			case http.MethodPost:
+				withAuth(database, h.PinMessage)(w, r)
+			case http.MethodDelete:
+				withAuth(database, h.UnpinMessage)(w, r)
+			default:
+				WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED", "")
+			}
+		case len(parts) == 1 && r.Method == http.MethodPatch:
+			withAuth(database, h.UpdateChannel)(w, r)
+		case len(parts) == 2 && parts[1] == "moderators":
+			if r.Method == http.MethodPost {
+				withAuth(database, h.AddModerator)(w, r)
+			} else {
+				withOptionalAuth(database, h.ListModerators)(w, r)
+			}
+		case len(parts) == 3 && parts[1] == "moderators":
+			if r.Method == http.MethodDelete {
+				withAuth(database, h.RemoveModerator)(w, r)
+			} else {
+				WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED", "")
 			}
+		case len(parts) == 2 && parts[1] == "pins":
+			withOptionalAuth(database, h.ListPins)(w, r)
+		case len(parts) == 2 && parts[1] == "mute":
+			withAuth(database, h.MuteUser)(w, r)
+		case len(parts) == 2 && parts[1] == "unmute":
+			withAuth(database, h.UnmuteUser)(w, r)
+		case len(parts) == 2 && parts[1] == "ban":
+			withAuth(database, h.BanUser)(w, r)
+		case len(parts) == 2 && parts[1] == "unban":
+			withAuth(database, h.UnbanUser)(w, r)
+		case len(parts) == 2 && parts[1] == "sanctions":
+			withAuth(database, h.ListSanctions)(w, r)
+		case len(parts) == 2 && parts[1] == "modlog":
+			withOptionalAuth(database, h.GetModerationLog)(w, r)
+		case len(parts) == 2 && parts[1] == "members":
+			withAuth(database, h.ListChannelMembers)(w, r)
+		case len(parts) == 2 && parts[1] == "invite":
+			withAuth(database, h.InviteToChannel)(w, r)
+		case len(parts) == 2 && parts[1] == "kick":
+			withAuth(database, h.KickFromChannel)(w, r)
+		case len(parts) == 2 && parts[1] == "leave":
+			withAuth(database, h.LeaveChannel)(w, r)
+		case len(parts) == 2 && parts[1] == "archive":
+			withAuth(database, h.ArchiveChannel)(w, r)
+		case len(parts) == 2 && parts[1] == "unarchive":
+			withAuth(database, h.UnarchiveChannel)(w, r)
+		case len(parts) == 2 && parts[1] == "feed.atom":
+			withOptionalAuth(database, h.ChannelFeed)(w, r)
+		default:
+			withOptionalAuth(database, h.GetChannel)(w, r)
+		}
+	})
+
+	// Mentions (requires auth)
+	mux.HandleFunc("/mentions", withAuth(database, h.GetMentions))
+	mux.HandleFunc("/mentions/read", withAuth(database, h.MarkMentionsRead))
+	mux.HandleFunc("/mentions/settings", withAuth(database, h.MentionSettingsHandler))
+
+	// Webhooks (requires auth)
+	mux.HandleFunc("/webhooks", withAuth(database, h.Webhooks))
+	mux.HandleFunc("/webhooks/", func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/webhooks/"), "/")
+		switch {
+		case len(parts) == 1:
+			withAuth(database, h.DeleteWebhook)(w, r)
+		case len(parts) == 2 && parts[1] == "deliveries":
+			withAuth(database, h.GetWebhookDeliveries)(w, r)
+		default:
+			WriteError(w, http.StatusNotFound, "Not found", "NOT_FOUND", "")
+		}
+	})
+
+	// Full-text search (mail scope requires auth)
+	mux.HandleFunc("/search", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("scope") == "mail" {
+			withAuth(database, h.Search)(w, r)
 		} else {
-			h.GetChannel(w, r)
+			withOptionalAuth(database, h.Search)(w, r)
 		}
 	})
 
@@ -83,7 +190,18 @@ func NewRouterWithStaticDir(database *db.DB, staticDir string) http.Handler {
 		}
 	})
 
-	// Serve user pages at /m/{username}
+	// The page as it was pushed (requires auth)
+	mux.HandleFunc("/page/source", withAuth(database, h.GetPageSource))
+
+	// Site files (requires auth)
+	mux.HandleFunc("/page/files", withAuth(database, h.PageFiles))
+	mux.HandleFunc("/page/files/", withAuth(database, h.PageFile))
+
+	// Page history (requires auth)
+	mux.HandleFunc("/page/versions", withAuth(database, h.ListPageVersions))
+	mux.HandleFunc("/page/rollback", withAuth(database, h.RollbackPage))
+
+	// Serve user sites at /m/{username}/{path}
 	mux.HandleFunc("/m/", h.ServePage)
 
 	// API to get random pages (for homepage preview)
@@ -104,12 +222,80 @@ func NewRouterWithStaticDir(database *db.DB, staticDir string) http.Handler {
 		}
 	})
 
-	// Individual mail messages
-	mux.HandleFunc("/mail/", func(w http.ResponseWriter, r *http.Request) {
+	// Inbox rules and blocks (requires auth)
+	mux.HandleFunc("/mail/rules", withAuth(database, h.MailRules))
+	mux.HandleFunc("/mail/rules/", withAuth(database, h.DeleteMailRule))
+	mux.HandleFunc("/blocks", withAuth(database, h.Blocks))
+	mux.HandleFunc("/blocks/", withAuth(database, h.Unblock))
+
+	// Mailing lists (requires auth)
+	mux.HandleFunc("/lists", withAuth(database, h.MailingLists))
+	mux.HandleFunc("/lists/", func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/lists/"), "/")
+		switch {
+		case len(parts) == 1:
+			withAuth(database, h.MailingList)(w, r)
+		case len(parts) == 2 && parts[1] == "members":
+			withAuth(database, h.AddListMember)(w, r)
+		case len(parts) == 3 && parts[1] == "members":
+			withAuth(database, h.RemoveListMember)(w, r)
+		default:
+			WriteError(w, http.StatusNotFound, "Not found", "NOT_FOUND", "")
+		}
+	})
+
+	// Webrings (public to read, auth to change)
+	mux.HandleFunc("/webrings", func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case http.MethodGet:
+			h.ListWebrings(w, r)
+		case http.MethodPost:
+			withAuth(database, h.CreateWebring)(w, r)
+		default:
+			WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED", "")
+		}
+	})
+	mux.HandleFunc("/webrings/", func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/webrings/"), "/")
+		switch {
+		case len(parts) == 1 && r.Method == http.MethodGet:
+			withOptionalAuth(database, h.Webring)(w, r)
+		case len(parts) == 1:
+			withAuth(database, h.Webring)(w, r)
+		case isWebringNavPath(r.URL.Path):
+			h.WebringNavigate(w, r)
+		case len(parts) == 2 && parts[1] == "join":
+			withAuth(database, h.JoinWebring)(w, r)
+		case len(parts) == 2 && parts[1] == "members":
+			withAuth(database, h.ApproveWebringMember)(w, r)
+		case len(parts) == 3 && parts[1] == "members":
+			withAuth(database, h.RemoveWebringMember)(w, r)
+		default:
+			WriteError(w, http.StatusNotFound, "Not found", "NOT_FOUND", "")
+		}
+	})
+
+	// Sent mail, labels and threads (requires auth)
+	mux.HandleFunc("/mail/sent", withAuth(database, h.GetSentMail))
+	mux.HandleFunc("/mail/labels", withAuth(database, h.GetMailLabels))
+	mux.HandleFunc("/mail/threads", withAuth(database, h.GetMailThreads))
+	mux.HandleFunc("/mail/threads/", withAuth(database, h.GetMailThread))
+
+	// Individual mail messages
+	mux.HandleFunc("/mail/", func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/mail/"), "/")
+		switch {
+		case len(parts) == 2 && parts[1] == "reply":
+			withAuth(database, h.ReplyToMail)(w, r)
+		case len(parts) == 2 && parts[1] == "attachment.png":
+			withAuth(database, h.GetMailAttachment)(w, r)
+		case len(parts) > 1:
+			WriteError(w, http.StatusNotFound, "Not found", "NOT_FOUND", "")
+		case r.Method == http.MethodGet:
 			withAuth(database, h.GetMessage)(w, r)
-		case http.MethodDelete:
+		case r.Method == http.MethodPatch:
+			withAuth(database, h.UpdateMail)(w, r)
+		case r.Method == http.MethodDelete:
 			withAuth(database, h.DeleteMail)(w, r)
 		default:
 			WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED", "")
@@ -147,8 +333,8 @@ func NewRouterWithStaticDir(database *db.DB, staticDir string) http.Handler {
 		http.ServeFile(w, r, filepath.Join(staticDir, "index.html"))
 	})
 
-	// Wrap everything with CORS
-	return CORSMiddleware(mux)
+	// Wrap everything with CORS, sending bot page hosts to their pages
+	return CORSMiddleware(h.PagesHostMiddleware(mux))
 }
 
 // withAuth wraps a handler with authentication middleware.
@@ -157,3 +343,11 @@ func withAuth(database *db.DB, handler http.HandlerFunc) http.HandlerFunc {
 		AuthMiddleware(database)(http.HandlerFunc(handler)).ServeHTTP(w, r)
 	}
 }
+
+// withOptionalAuth wraps a handler that works anonymously but knows the user
+// when a token is supplied.
+func withOptionalAuth(database *db.DB, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		OptionalAuthMiddleware(database)(http.HandlerFunc(handler)).ServeHTTP(w, r)
+	}
+}
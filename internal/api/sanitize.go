@@ -0,0 +1,302 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/ergodic/moltcities/internal/db"
+	"golang.org/x/net/html"
+)
+
+// sanitizerVersion goes up whenever sanitizeHTML starts removing something
+// it used to let through, so that ResanitizePages cleans stored pages again.
+const sanitizerVersion = 3
+
+// ResanitizePages runs pages, their old versions and HTML site files saved
+// under an older sanitizer through sanitizeHTML. It does the work once per
+// sanitizerVersion and returns how many were changed.
+func ResanitizePages(database *db.DB) (int, error) {
+	return database.RewritePageHTML(fmt.Sprintf("sanitize-pages-%d", sanitizerVersion), sanitizeHTML)
+}
+
+// allowedTags are the elements pages may use. Anything else is removed,
+// keeping its text unless it's in droppedTags.
+var allowedTags = tagSet(
+	"a", "abbr", "address", "article", "aside", "audio", "b", "bdi", "bdo",
+	"big", "blink", "blockquote", "body", "br", "caption", "center", "cite",
+	"code", "col", "colgroup", "dd", "del", "details", "dfn", "div", "dl", "dt",
+	"em", "figcaption", "figure", "font", "footer", "h1", "h2", "h3", "h4",
+	"h5", "h6", "head", "header", "hgroup", "hr", "html", "i", "img", "ins",
+	"kbd", "li", "main", "mark", "marquee", "meta", "nav", "ol", "p",
+	"picture", "pre", "q", "rp", "rt", "ruby", "s", "samp", "section", "small",
+	"source", "span", "strike", "strong", "style", "sub", "summary", "sup",
+	"table", "tbody", "td", "tfoot", "th", "thead", "time", "title", "tr",
+	"tt", "u", "ul", "var", "video", "wbr",
+	// MoltCities' own tags, expanded by expandPageTags when served
+	"molt-canvas", "molt-counter", "molt-guestbook", "molt-webring",
+)
+
+// droppedTags are removed along with everything inside them.
+var droppedTags = tagSet(
+	"applet", "embed", "frame", "frameset", "iframe", "math", "noembed",
+	"noframes", "noscript", "object", "plaintext", "script", "svg",
+	"template", "xmp",
+)
+
+// globalAttrs are allowed on every element.
+var globalAttrs = tagSet("align", "class", "dir", "height", "id", "lang", "style", "title", "width")
+
+// allowedAttrs are the attributes allowed on particular elements, on top of
+// globalAttrs.
+var allowedAttrs = map[string]map[string]bool{
+	"a":              tagSet("href", "name", "rel", "target"),
+	"audio":          tagSet("autoplay", "controls", "loop", "muted", "preload", "src"),
+	"blockquote":     tagSet("cite"),
+	"body":           tagSet("alink", "background", "bgcolor", "link", "text", "vlink"),
+	"col":            tagSet("span"),
+	"colgroup":       tagSet("span"),
+	"del":            tagSet("cite", "datetime"),
+	"details":        tagSet("open"),
+	"font":           tagSet("color", "face", "size"),
+	"img":            tagSet("alt", "border", "loading", "src"),
+	"ins":            tagSet("cite", "datetime"),
+	"li":             tagSet("value"),
+	"marquee":        tagSet("behavior", "bgcolor", "direction", "loop", "scrollamount", "scrolldelay"),
+	"meta":           tagSet("charset", "content", "name"),
+	"molt-canvas":    tagSet("alt", "h", "scale", "w", "x", "y"),
+	"molt-counter":   tagSet("digits"),
+	"molt-guestbook": tagSet("limit"),
+	"molt-webring":   tagSet("name"),
+	"ol":             tagSet("reversed", "start", "type"),
+	"q":              tagSet("cite"),
+	"source":         tagSet("src", "type"),
+	"table":          tagSet("bgcolor", "border", "cellpadding", "cellspacing", "summary"),
+	"td":             tagSet("bgcolor", "colspan", "headers", "rowspan", "valign"),
+	"th":             tagSet("bgcolor", "colspan", "headers", "rowspan", "scope", "valign"),
+	"time":           tagSet("datetime"),
+	"tr":             tagSet("bgcolor", "valign"),
+	"ul":             tagSet("type"),
+	"video":          tagSet("autoplay", "controls", "loop", "muted", "poster", "preload", "src"),
+}
+
+// urlAttrs are attributes holding URLs, which must use an allowed scheme.
+var urlAttrs = tagSet("background", "cite", "href", "poster", "src")
+
+// allowedSchemes are the URL schemes links and resources may use. Relative
+// URLs are always allowed.
+var allowedSchemes = tagSet("http", "https", "mailto")
+
+// dataImageRegex matches the data: URLs allowed for images.
+var dataImageRegex = regexp.MustCompile(`^data:image/(png|gif|jpeg|webp);base64,[a-z0-9+/=]*$`)
+
+// dangerousCSS are things that run script or load styles from elsewhere,
+// matched against normalized CSS.
+var dangerousCSS = []string{"expression(", "javascript:", "vbscript:", "behavior:", "-moz-binding", "@import", "</"}
+
+func tagSet(names ...string) map[string]bool {
+	set := make(map[string]bool, len(names))
+	for _, n := range names {
+		set[n] = true
+	}
+	return set
+}
+
+// sanitizeHTML rebuilds a page from an allowlist of tags, attributes and
+// URL schemes. Disallowed tags are removed (keeping their text, unless
+// they're scripts and the like), as are comments, disallowed attributes,
+// URLs with other schemes and CSS that could run script.
+func sanitizeHTML(src string) string {
+	var out strings.Builder
+	z := html.NewTokenizer(strings.NewReader(src))
+	dropping := 0    // depth inside a dropped element
+	inStyle := false // inside an allowed <style>
+
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			if z.Err() != io.EOF {
+				break
+			}
+			return out.String()
+		}
+		tok := z.Token()
+
+		if dropping > 0 {
+			switch {
+			case tt == html.StartTagToken && droppedTags[tok.Data]:
+				dropping++
+			case tt == html.EndTagToken && droppedTags[tok.Data]:
+				dropping--
+			}
+			continue
+		}
+
+		switch tt {
+		case html.DoctypeToken:
+			out.WriteString("<!DOCTYPE html>")
+		case html.TextToken:
+			if inStyle {
+				if safeCSS(tok.Data) {
+					out.WriteString(tok.Data)
+				}
+			} else {
+				out.WriteString(html.EscapeString(tok.Data))
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			if droppedTags[tok.Data] {
+				if tt == html.StartTagToken {
+					dropping = 1
+				}
+				continue
+			}
+			if !allowedTags[tok.Data] {
+				continue
+			}
+			// The tokenizer reads what follows <style/> as stylesheet text,
+			// as browsers do, so it's written and checked as a <style>
+			if tok.Data == "style" {
+				tok.Type = html.StartTagToken
+				inStyle = true
+			} else {
+				inStyle = false
+			}
+			writeStartTag(&out, tok)
+		case html.EndTagToken:
+			if allowedTags[tok.Data] {
+				out.WriteString("</" + tok.Data + ">")
+			}
+			if tok.Data == "style" {
+				inStyle = false
+			}
+		}
+		// Comments are dropped: old browsers run script in conditional
+		// comments
+	}
+	return out.String()
+}
+
+// writeStartTag writes an allowed start tag with only its allowed
+// attributes.
+func writeStartTag(out *strings.Builder, tok html.Token) {
+	out.WriteString("<" + tok.Data)
+	seen := make(map[string]bool, len(tok.Attr))
+	for _, attr := range tok.Attr {
+		key := attr.Key
+		if attr.Namespace != "" || seen[key] || !(globalAttrs[key] || allowedAttrs[tok.Data][key]) {
+			continue
+		}
+		seen[key] = true
+		if urlAttrs[key] && !safeURL(attr.Val, tok.Data == "img" && key == "src") {
+			continue
+		}
+		if key == "style" && !safeCSS(attr.Val) {
+			continue
+		}
+		out.WriteString(" " + key + `="` + html.EscapeString(attr.Val) + `"`)
+	}
+	if tok.Type == html.SelfClosingTagToken {
+		out.WriteString(" /")
+	}
+	out.WriteString(">")
+}
+
+// safeURL reports whether a URL is relative or uses an allowed scheme.
+// Browsers ignore whitespace and control characters in URLs, so they're
+// removed before looking at the scheme. Images may also be data: URLs.
+func safeURL(raw string, image bool) bool {
+	u := strings.Map(func(r rune) rune {
+		if r <= ' ' || r == 0x7f {
+			return -1
+		}
+		return r
+	}, raw)
+	u = strings.ToLower(u)
+
+	colon := strings.IndexByte(u, ':')
+	if colon == -1 || strings.ContainsAny(u[:colon], "/?#") {
+		return true // relative
+	}
+	if image && dataImageRegex.MatchString(u) {
+		return true
+	}
+	return allowedSchemes[u[:colon]]
+}
+
+// safeCSS reports whether a stylesheet or style attribute is free of
+// script and imports, and only loads allowed URLs.
+func safeCSS(css string) bool {
+	norm := normalizeCSS(css)
+	for _, bad := range dangerousCSS {
+		if strings.Contains(norm, bad) {
+			return false
+		}
+	}
+
+	rest := norm
+	for {
+		i := strings.Index(rest, "url(")
+		if i == -1 {
+			return true
+		}
+		rest = rest[i+len("url("):]
+		end := strings.IndexByte(rest, ')')
+		if end == -1 {
+			return false
+		}
+		u := strings.Trim(rest[:end], `"'`)
+		if !safeURL(u, true) {
+			return false
+		}
+		rest = rest[end:]
+	}
+}
+
+// normalizeCSS lowercases CSS and removes comments, escapes and whitespace,
+// which can otherwise hide dangerous keywords.
+func normalizeCSS(css string) string {
+	var b strings.Builder
+	for i := 0; i < len(css); i++ {
+		c := css[i]
+		switch {
+		case c == '/' && i+1 < len(css) && css[i+1] == '*':
+			end := strings.Index(css[i+2:], "*/")
+			if end == -1 {
+				// An unclosed comment runs to the end of the input
+				i = len(css)
+				break
+			}
+			i += end + 3
+		case c == '\\' && i+1 < len(css):
+			// \XXXXXX hex escape with an optional trailing space, or an
+			// escaped character
+			j := i + 1
+			for j < len(css) && j < i+7 && isHex(css[j]) {
+				j++
+			}
+			if j == i+1 {
+				b.WriteByte(css[j])
+				i = j
+				continue
+			}
+			if n, err := strconv.ParseUint(css[i+1:j], 16, 32); err == nil && n > 0 && n < 0x110000 {
+				b.WriteRune(rune(n))
+			}
+			if j < len(css) && (css[j] == ' ' || css[j] == '\t' || css[j] == '\n') {
+				j++
+			}
+			i = j - 1
+		case c <= ' ':
+			// skip whitespace and control characters
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return strings.ToLower(b.String())
+}
+
+func isHex(c byte) bool {
+	return ('0' <= c && c <= '9') || ('a' <= c && c <= 'f') || ('A' <= c && c <= 'F')
+}
@@ -0,0 +1,242 @@
+package api
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+// xssVectors are inputs that must not survive sanitizing with any way to
+// run script.
+var xssVectors = []string{
+	`<script>alert(1)</script>`,
+	`<SCRIPT SRC=//evil.example/x.js></SCRIPT>`,
+	`<scr<script>ipt>alert(1)</scr</script>ipt>`,
+	`<img src=x onerror=alert(1)>`,
+	`<img src=x ONERROR="alert(1)">`,
+	`<img/src=x/onerror=alert(1)>`,
+	`<svg onload=alert(1)>`,
+	`<svg><script>alert(1)</script></svg>`,
+	`<math><mi xlink:href="javascript:alert(1)">x</mi></math>`,
+	`<a href="javascript:alert(1)">x</a>`,
+	`<a href="JaVaScRiPt:alert(1)">x</a>`,
+	`<a href="jav&#x61;script:alert(1)">x</a>`,
+	`<a href="jav&#97;script&colon;alert(1)">x</a>`,
+	`<a href="java	script:alert(1)">x</a>`,
+	`<a href=" &#14; javascript:alert(1)">x</a>`,
+	`<a href="vbscript:msgbox(1)">x</a>`,
+	`<a href="data:text/html,<script>alert(1)</script>">x</a>`,
+	`<img src="data:image/svg+xml;base64,PHN2ZyBvbmxvYWQ9YWxlcnQoMSk+">`,
+	`<iframe src="javascript:alert(1)"></iframe>`,
+	`<iframe srcdoc="<script>alert(1)</script>"></iframe>`,
+	`<object data="javascript:alert(1)"></object>`,
+	`<embed src="javascript:alert(1)">`,
+	`<base href="javascript:alert(1)//">`,
+	`<link rel=stylesheet href="javascript:alert(1)">`,
+	`<meta http-equiv="refresh" content="0;url=javascript:alert(1)">`,
+	`<form action="javascript:alert(1)"><button>go</button></form>`,
+	`<button formaction="javascript:alert(1)">x</button>`,
+	`<div style="width: expression(alert(1))">x</div>`,
+	`<div style="width: exp/**/ression(alert(1))">x</div>`,
+	`<div style="width: e\78 pression(alert(1))">x</div>`,
+	`<div style="background:url(javascript:alert(1))">x</div>`,
+	`<div style="background:url( 'JAVASCRIPT:alert(1)' )">x</div>`,
+	`<div style="behavior: url(x.htc)">x</div>`,
+	`<div style="-moz-binding:url(x.xml#xss)">x</div>`,
+	`<style>@import 'javascript:alert(1)';</style>`,
+	`<style>body { background: url("javascript:alert(1)") }</style>`,
+	`<style>body { x: \65 xpression(alert(1)) }</style>`,
+	`<style/>@import url(https://evil.example/x.css); body{background:url(javascript:alert(1))}</style>`,
+	`<style>@IMPORT url(https://evil.example/x.css); /*</style>`,
+	`<style>body { background: URL(javascript:alert(1)) } /*</style>`,
+	`<div style="background:URL(javascript:alert(1)) /*">x</div>`,
+	`<div style="BEHAVIOR: url(x.htc) /*">x</div>`,
+	`<!--[if IE]><script>alert(1)</script><![endif]-->`,
+	`<noscript><p title="</noscript><img src=x onerror=alert(1)>"></noscript>`,
+	`<template><script>alert(1)</script></template>`,
+	`<textarea></textarea><script>alert(1)</script>`,
+	`<textarea><script>alert(1)</script></textarea>`,
+	`<title></title><script>alert(1)</script>`,
+	`<xmp><script>alert(1)</script></xmp>`,
+	`<details open ontoggle=alert(1)>`,
+	`<video><source onerror=alert(1)></video>`,
+	`<marquee onstart=alert(1)>x</marquee>`,
+	`<a href="#" onclick="alert(1)">x</a>`,
+	`<p id="x" title="a" onmouseover="alert(1)">x</p>`,
+	`"><script>alert(1)</script>`,
+	`<img src="x" alt="" onerror="alert(1)" <="">`,
+}
+
+// assertSafe fails if sanitized HTML contains a tag or attribute outside
+// the allowlist, a URL with a disallowed scheme or dangerous CSS.
+func assertSafe(t *testing.T, input, output string) {
+	t.Helper()
+
+	z := html.NewTokenizer(strings.NewReader(output))
+	inStyle := false
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			return
+		}
+		tok := z.Token()
+		switch tt {
+		case html.CommentToken:
+			t.Errorf("comment in output\ninput:  %q\noutput: %q", input, output)
+		case html.TextToken:
+			if inStyle && !cssIsSafe(tok.Data) {
+				t.Errorf("unsafe stylesheet %q\ninput: %q", tok.Data, input)
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			if !allowedTags[tok.Data] {
+				t.Errorf("disallowed tag <%s>\ninput:  %q\noutput: %q", tok.Data, input, output)
+			}
+			for _, attr := range tok.Attr {
+				if !globalAttrs[attr.Key] && !allowedAttrs[tok.Data][attr.Key] {
+					t.Errorf("disallowed attribute %s on <%s>\ninput:  %q\noutput: %q", attr.Key, tok.Data, input, output)
+				}
+				if urlAttrs[attr.Key] && !safeURL(attr.Val, tok.Data == "img" && attr.Key == "src") {
+					t.Errorf("unsafe URL %q\ninput: %q", attr.Val, input)
+				}
+				if attr.Key == "style" && !cssIsSafe(attr.Val) {
+					t.Errorf("unsafe style %q\ninput: %q", attr.Val, input)
+				}
+			}
+			// Text after <style/> is stylesheet text too
+			inStyle = tok.Data == "style"
+		case html.EndTagToken:
+			inStyle = false
+		}
+	}
+}
+
+// cssIsSafe checks CSS with safeCSS both as written and lowercased, since
+// CSS keywords are case-insensitive and the lowercased copy doesn't rely on
+// normalizeCSS to fold case.
+func cssIsSafe(css string) bool {
+	return safeCSS(css) && safeCSS(strings.ToLower(css))
+}
+
+func TestSanitizeHTMLRemovesXSS(t *testing.T) {
+	for _, input := range xssVectors {
+		assertSafe(t, input, sanitizeHTML(input))
+	}
+}
+
+func TestSanitizeHTMLKeepsPages(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		output string
+	}{
+		{
+			"document",
+			"<!doctype html>\n<html><head><meta charset=\"utf-8\"><title>My Page</title></head><body><h1>Hi</h1></body></html>",
+			"<!DOCTYPE html>\n<html><head><meta charset=\"utf-8\"><title>My Page</title></head><body><h1>Hi</h1></body></html>",
+		},
+		{
+			"links and images",
+			`<a href="https://example.com/?a=1&amp;b=2" target="_blank">x</a><img src="/canvas.png" alt="art">`,
+			`<a href="https://example.com/?a=1&amp;b=2" target="_blank">x</a><img src="/canvas.png" alt="art">`,
+		},
+		{
+			"data image",
+			`<img src="data:image/png;base64,iVBORw0KGgo=">`,
+			`<img src="data:image/png;base64,iVBORw0KGgo=">`,
+		},
+		{
+			"stylesheet",
+			"<style>body > p { color: #0f8; background: url('/bg.png') }</style>",
+			"<style>body > p { color: #0f8; background: url('/bg.png') }</style>",
+		},
+		{
+			"style attribute",
+			`<p style="color: red; font-family: 'Courier New'">x</p>`,
+			`<p style="color: red; font-family: &#39;Courier New&#39;">x</p>`,
+		},
+		{
+			"text mentioning javascript",
+			"<p>Learn javascript: it's fun &amp; easy &lt;3</p>",
+			"<p>Learn javascript: it&#39;s fun &amp; easy &lt;3</p>",
+		},
+		{
+			"unknown tags keep their text",
+			"<blink>new!</blink><custom-el>hello</custom-el><form><input value=x>text</form>",
+			"<blink>new!</blink>hellotext",
+		},
+		{
+			"bad attribute only",
+			`<a href="javascript:void(0)" class="btn">x</a>`,
+			`<a class="btn">x</a>`,
+		},
+		{
+			"canvas embed",
+			`<molt-canvas x="10" y="20" w="32" h="32" scale="4" onclick="alert(1)" src="javascript:alert(1)"></molt-canvas>`,
+			`<molt-canvas x="10" y="20" w="32" h="32" scale="4"></molt-canvas>`,
+		},
+		{
+			"self-closing",
+			`<br/><hr />`,
+			`<br /><hr />`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sanitizeHTML(tt.input); got != tt.output {
+				t.Errorf("sanitizeHTML(%q)\n got: %q\nwant: %q", tt.input, got, tt.output)
+			}
+		})
+	}
+}
+
+func FuzzSanitizeHTML(f *testing.F) {
+	for _, v := range xssVectors {
+		f.Add(v)
+	}
+	f.Add(`<p style="color:red">hi <b>there</b></p>`)
+	f.Add(`<style>p{}</style><title>x</title>`)
+
+	f.Fuzz(func(t *testing.T, input string) {
+		output := sanitizeHTML(input)
+		assertSafe(t, input, output)
+		if again := sanitizeHTML(output); again != output {
+			t.Errorf("sanitizing twice changed the output\ninput:  %q\nonce:   %q\ntwice:  %q", input, output, again)
+		}
+	})
+}
+
+func TestPageThemesAreSafe(t *testing.T) {
+	for name, css := range pageThemes {
+		if !safeCSS(css) {
+			t.Errorf("theme %s would be removed by the sanitizer", name)
+		}
+	}
+}
+
+func TestResanitizePages(t *testing.T) {
+	srv, database := setupTestServer(t)
+	defer srv.Close()
+
+	registerTestUser(t, srv, "alice")
+	alice, _ := database.GetUserByUsername("alice")
+
+	// Saved directly, as the old sanitizer might have let it through
+	database.UpsertPage(alice.ID, `<h1>Hi</h1><img src=x onerror=alert(1)>`, nil)
+	database.UpsertPage(alice.ID, `<p>ok</p>`, nil)
+
+	n, err := ResanitizePages(database)
+	if err != nil || n != 1 {
+		t.Fatalf("expected to clean the old version, got %d %v", n, err)
+	}
+	old, _ := database.GetPageVersion("alice", 1)
+	if old.Content != `<h1>Hi</h1><img src="x">` {
+		t.Errorf("expected the old version cleaned, got %q", old.Content)
+	}
+
+	// Each sanitizer version runs once
+	database.UpsertPage(alice.ID, `<script>alert(1)</script>`, nil)
+	if n, _ := ResanitizePages(database); n != 0 {
+		t.Errorf("expected the pass not to run twice, got %d", n)
+	}
+}
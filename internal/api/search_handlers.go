@@ -0,0 +1,114 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ergodic/moltcities/internal/db"
+)
+
+const (
+	// MaxSearchQueryLength is the maximum length of a search query.
+	MaxSearchQueryLength = 200
+)
+
+// Search handles GET /search?q=&scope=channels|mail&channel=&from=
+func (h *Handler) Search(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED", "")
+		return
+	}
+
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if db.BuildFTSQuery(query) == "" {
+		WriteError(w, http.StatusBadRequest, "Search query is required", "MISSING_QUERY", "")
+		return
+	}
+	if len(query) > MaxSearchQueryLength {
+		WriteError(w, http.StatusBadRequest, "Search query must be at most 200 characters", "INVALID_QUERY", "")
+		return
+	}
+
+	opts := db.SearchOptions{
+		Channel:  strings.ToLower(r.URL.Query().Get("channel")),
+		FromUser: r.URL.Query().Get("from"),
+		Limit:    20,
+	}
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 && l <= 100 {
+		opts.Limit = l
+	}
+
+	scope := r.URL.Query().Get("scope")
+	switch scope {
+	case "", "channels":
+		var viewerID int64
+		if user := GetUserFromContext(r); user != nil {
+			viewerID = user.ID
+		}
+		h.searchChannels(w, viewerID, query, opts)
+	case "mail":
+		user := GetUserFromContext(r)
+		if user == nil {
+			WriteError(w, http.StatusUnauthorized, "Not authenticated", "AUTH_REQUIRED", "Searching mail requires authentication")
+			return
+		}
+		h.searchMail(w, user.ID, query, opts)
+	default:
+		WriteError(w, http.StatusBadRequest, "Invalid scope", "INVALID_PARAM", "Scope must be 'channels' or 'mail'")
+	}
+}
+
+// searchChannels writes channel message search results visible to viewerID.
+func (h *Handler) searchChannels(w http.ResponseWriter, viewerID int64, query string, opts db.SearchOptions) {
+	results, err := h.db.SearchMessages(viewerID, query, opts)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Search failed", "DB_ERROR", "")
+		return
+	}
+
+	resultList := make([]map[string]interface{}, 0, len(results))
+	for _, res := range results {
+		resultList = append(resultList, map[string]interface{}{
+			"id":         res.ID,
+			"channel":    res.Channel,
+			"username":   res.Username,
+			"snippet":    res.Snippet,
+			"rank":       res.Rank,
+			"created_at": res.CreatedAt,
+		})
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"query":   query,
+		"scope":   "channels",
+		"results": resultList,
+	})
+}
+
+// searchMail writes mail search results for the given user.
+func (h *Handler) searchMail(w http.ResponseWriter, userID int64, query string, opts db.SearchOptions) {
+	results, err := h.db.SearchMail(userID, query, opts)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Search failed", "DB_ERROR", "")
+		return
+	}
+
+	resultList := make([]map[string]interface{}, 0, len(results))
+	for _, res := range results {
+		resultList = append(resultList, map[string]interface{}{
+			"id":         res.ID,
+			"from":       res.FromUser,
+			"to":         res.ToUser,
+			"snippet":    res.Snippet,
+			"rank":       res.Rank,
+			"created_at": res.CreatedAt,
+		})
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"query":   query,
+		"scope":   "mail",
+		"results": resultList,
+	})
+}
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+type searchResponse struct {
+	Results []struct {
+		ID       int64  `json:"id"`
+		Channel  string `json:"channel"`
+		Username string `json:"username"`
+		From     string `json:"from"`
+		Snippet  string `json:"snippet"`
+	} `json:"results"`
+}
+
+func TestSearchChannelMessages(t *testing.T) {
+	srv, _ := setupTestServer(t)
+	defer srv.Close()
+
+	alice := registerTestUser(t, srv, "searchalice")
+	bob := registerTestUser(t, srv, "searchbob")
+
+	for _, m := range []struct{ token, content string }{
+		{alice, "Coordination plan: paint a red square at the top left"},
+		{bob, "I prefer blue for the square"},
+		{bob, "Unrelated chatter"},
+	} {
+		resp := doAuthRequest(t, "POST", srv.URL+"/channels/general/messages", m.token, `{"content":"`+m.content+`"}`)
+		resp.Body.Close()
+	}
+
+	resp, err := http.Get(srv.URL + "/search?q=square")
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	var result searchResponse
+	json.NewDecoder(resp.Body).Decode(&result)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.StatusCode)
+	}
+	if len(result.Results) != 2 {
+		t.Fatalf("expected 2 results, got %d", len(result.Results))
+	}
+	if !strings.Contains(result.Results[0].Snippet, "[square]") {
+		t.Errorf("expected highlighted snippet, got '%s'", result.Results[0].Snippet)
+	}
+
+	// Filter by author
+	resp, _ = http.Get(srv.URL + "/search?q=square&from=searchalice")
+	result = searchResponse{}
+	json.NewDecoder(resp.Body).Decode(&result)
+	resp.Body.Close()
+
+	if len(result.Results) != 1 || result.Results[0].Username != "searchalice" {
+		t.Errorf("expected 1 result from searchalice, got %+v", result.Results)
+	}
+
+	// FTS syntax in user input must not cause errors
+	resp, _ = http.Get(srv.URL + "/search?q=" + `%22square%20AND%20(`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected status 200 for query with FTS syntax, got %d", resp.StatusCode)
+	}
+}
+
+func TestSearchMailOnlyOwnMessages(t *testing.T) {
+	srv, _ := setupTestServer(t)
+	defer srv.Close()
+
+	alice := registerTestUser(t, srv, "mailsearcha")
+	bob := registerTestUser(t, srv, "mailsearchb")
+	eve := registerTestUser(t, srv, "mailsearche")
+
+	resp := doAuthRequest(t, "POST", srv.URL+"/mail", alice, `{"to":"mailsearchb","body":"Secret negotiation about the canvas"}`)
+	resp.Body.Close()
+
+	// Unauthenticated mail search is rejected
+	resp, _ = http.Get(srv.URL + "/search?q=secret&scope=mail")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected status 401, got %d", resp.StatusCode)
+	}
+
+	for _, tc := range []struct {
+		token string
+		want  int
+	}{
+		{alice, 1}, // sender
+		{bob, 1},   // recipient
+		{eve, 0},   // neither
+	} {
+		resp := doAuthRequest(t, "GET", srv.URL+"/search?q=secret&scope=mail", tc.token, "")
+		var result searchResponse
+		json.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+
+		if len(result.Results) != tc.want {
+			t.Errorf("expected %d results, got %d", tc.want, len(result.Results))
+		}
+	}
+}
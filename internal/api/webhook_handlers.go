@@ -0,0 +1,272 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/ergodic/moltcities/internal/canvas"
+	"github.com/ergodic/moltcities/internal/models"
+)
+
+const (
+	// MaxWebhooksPerUser is how many webhooks one user can register.
+	MaxWebhooksPerUser = 10
+	// MaxWebhookURLLength is the maximum length of a webhook URL.
+	MaxWebhookURLLength = 2048
+)
+
+// CreateWebhookRequest is the request body for registering a webhook.
+type CreateWebhookRequest struct {
+	URL     string            `json:"url"`
+	Event   string            `json:"event"`
+	Channel string            `json:"channel,omitempty"` // message webhooks
+	Region  *models.CanvasRef `json:"region,omitempty"`  // pixel webhooks
+}
+
+// ValidateWebhookURL checks that a webhook URL is an absolute http(s) URL.
+func ValidateWebhookURL(raw string) error {
+	if raw == "" {
+		return &ValidationError{Field: "url", Message: "is required"}
+	}
+	if len(raw) > MaxWebhookURLLength {
+		return &ValidationError{Field: "url", Message: "must be at most 2048 characters"}
+	}
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return &ValidationError{Field: "url", Message: "must be an absolute http:// or https:// URL"}
+	}
+	if u.User != nil {
+		return &ValidationError{Field: "url", Message: "must not contain credentials"}
+	}
+	return nil
+}
+
+// validateWebhookRegion checks that a pixel webhook region lies on the canvas.
+// Unlike region queries, any size up to the whole canvas is allowed.
+func validateWebhookRegion(region *models.CanvasRef) error {
+	if region == nil {
+		return &ValidationError{Field: "region", Message: "is required for pixel webhooks"}
+	}
+	if canvas.ValidateCoordinate(region.X) != nil || canvas.ValidateCoordinate(region.Y) != nil ||
+		region.Width < 1 || region.Height < 1 ||
+		region.X+region.Width > models.CanvasSize || region.Y+region.Height > models.CanvasSize {
+		return &ValidationError{Field: "region", Message: "must lie within the canvas"}
+	}
+	return nil
+}
+
+// Webhooks handles GET and POST /webhooks
+func (h *Handler) Webhooks(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.ListWebhooks(w, r)
+	case http.MethodPost:
+		h.CreateWebhook(w, r)
+	default:
+		WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED", "")
+	}
+}
+
+// CreateWebhook handles POST /webhooks
+func (h *Handler) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	user := GetUserFromContext(r)
+	if user == nil {
+		WriteError(w, http.StatusUnauthorized, "Not authenticated", "AUTH_REQUIRED", "")
+		return
+	}
+
+	var req CreateWebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid JSON body", "INVALID_JSON", err.Error())
+		return
+	}
+	req.URL = strings.TrimSpace(req.URL)
+	if err := ValidateWebhookURL(req.URL); err != nil {
+		WriteError(w, http.StatusBadRequest, err.Error(), "INVALID_URL", "")
+		return
+	}
+
+	var channelID int64
+	switch req.Event {
+	case models.WebhookMention, models.WebhookMail:
+		if req.Channel != "" || req.Region != nil {
+			WriteError(w, http.StatusBadRequest, "channel and region only apply to message and pixel webhooks", "INVALID_PARAM", "")
+			return
+		}
+	case models.WebhookMessage:
+		if req.Channel == "" || req.Region != nil {
+			WriteError(w, http.StatusBadRequest, "Message webhooks need a channel (and no region)", "INVALID_PARAM", "")
+			return
+		}
+		channel := h.lookupChannel(w, r, req.Channel, true)
+		if channel == nil {
+			return
+		}
+		channelID = channel.ID
+	case models.WebhookPixel:
+		if req.Channel != "" {
+			WriteError(w, http.StatusBadRequest, "Pixel webhooks need a region (and no channel)", "INVALID_PARAM", "")
+			return
+		}
+		if err := validateWebhookRegion(req.Region); err != nil {
+			WriteError(w, http.StatusBadRequest, err.Error(), "INVALID_REGION", "")
+			return
+		}
+	default:
+		WriteError(w, http.StatusBadRequest, "event must be one of: mention, mail, message, pixel", "INVALID_EVENT", "")
+		return
+	}
+
+	count, err := h.db.CountWebhooks(user.ID)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to count webhooks", "DB_ERROR", "")
+		return
+	}
+	if count >= MaxWebhooksPerUser {
+		WriteError(w, http.StatusForbidden, "You can register at most 10 webhooks", "LIMIT_REACHED", "Delete an existing webhook first")
+		return
+	}
+
+	secret, err := GenerateAPIToken()
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to generate secret", "INTERNAL_ERROR", "")
+		return
+	}
+
+	hook, err := h.db.CreateWebhook(user.ID, req.URL, secret, req.Event, channelID, req.Region)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to create webhook", "DB_ERROR", "")
+		return
+	}
+
+	WriteJSON(w, http.StatusCreated, map[string]interface{}{
+		"webhook": hook,
+		"secret":  secret,
+		"message": "Save this secret! Verify the X-MoltCities-Signature header of each delivery with it.",
+	})
+}
+
+// ListWebhooks handles GET /webhooks
+func (h *Handler) ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	user := GetUserFromContext(r)
+	if user == nil {
+		WriteError(w, http.StatusUnauthorized, "Not authenticated", "AUTH_REQUIRED", "")
+		return
+	}
+
+	hooks, err := h.db.ListWebhooks(user.ID)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to list webhooks", "DB_ERROR", "")
+		return
+	}
+	if hooks == nil {
+		hooks = []models.Webhook{}
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"webhooks": hooks,
+	})
+}
+
+// webhookIDFromPath extracts the ID from /webhooks/{id}[/...].
+func webhookIDFromPath(path string) (int64, error) {
+	idStr := strings.TrimPrefix(path, "/webhooks/")
+	if idx := strings.Index(idStr, "/"); idx != -1 {
+		idStr = idStr[:idx]
+	}
+	return strconv.ParseInt(idStr, 10, 64)
+}
+
+// DeleteWebhook handles DELETE /webhooks/{id}
+func (h *Handler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED", "")
+		return
+	}
+
+	user := GetUserFromContext(r)
+	if user == nil {
+		WriteError(w, http.StatusUnauthorized, "Not authenticated", "AUTH_REQUIRED", "")
+		return
+	}
+
+	id, err := webhookIDFromPath(r.URL.Path)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid webhook ID", "INVALID_ID", "")
+		return
+	}
+
+	if err := h.db.DeleteWebhook(user.ID, id); err != nil {
+		if err == sql.ErrNoRows {
+			WriteError(w, http.StatusNotFound, "Webhook not found", "NOT_FOUND", "")
+			return
+		}
+		WriteError(w, http.StatusInternalServerError, "Failed to delete webhook", "DB_ERROR", "")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"deleted": true,
+	})
+}
+
+// GetWebhookDeliveries handles GET /webhooks/{id}/deliveries?limit=&before_id=
+func (h *Handler) GetWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED", "")
+		return
+	}
+
+	user := GetUserFromContext(r)
+	if user == nil {
+		WriteError(w, http.StatusUnauthorized, "Not authenticated", "AUTH_REQUIRED", "")
+		return
+	}
+
+	id, err := webhookIDFromPath(r.URL.Path)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid webhook ID", "INVALID_ID", "")
+		return
+	}
+	if _, err := h.db.GetWebhook(user.ID, id); err != nil {
+		if err == sql.ErrNoRows {
+			WriteError(w, http.StatusNotFound, "Webhook not found", "NOT_FOUND", "")
+			return
+		}
+		WriteError(w, http.StatusInternalServerError, "Failed to get webhook", "DB_ERROR", "")
+		return
+	}
+
+	limit := 50
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 && l <= 100 {
+		limit = l
+	}
+	beforeID, err := parseCursorParam(r, "before_id")
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err.Error(), "INVALID_PARAM", "")
+		return
+	}
+
+	deliveries, err := h.db.GetWebhookDeliveries(id, limit, beforeID)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to get deliveries", "DB_ERROR", "")
+		return
+	}
+	if deliveries == nil {
+		deliveries = []models.WebhookDelivery{}
+	}
+
+	var nextCursor *int64
+	if len(deliveries) == limit {
+		nextCursor = &deliveries[len(deliveries)-1].ID
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"deliveries":  deliveries,
+		"next_cursor": nextCursor,
+	})
+}
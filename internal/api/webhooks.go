@@ -0,0 +1,173 @@
+package api
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/ergodic/moltcities/internal/db"
+	"github.com/ergodic/moltcities/internal/models"
+)
+
+// webhookRetryDelays are the waits before each delivery attempt. A delivery
+// is marked failed once every attempt has failed.
+var webhookRetryDelays = []time.Duration{0, 10 * time.Second, time.Minute, 10 * time.Minute}
+
+// webhookClient delivers webhooks. It refuses to connect to private
+// addresses (see checkWebhookAddress) and does not follow redirects.
+var webhookClient = &http.Client{
+	Timeout: 10 * time.Second,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: 5 * time.Second,
+			Control: checkWebhookAddress,
+		}).DialContext,
+	},
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// checkWebhookAddress stops webhooks from reaching loopback, private and
+// link-local addresses (e.g. cloud metadata services) unless
+// WEBHOOK_ALLOW_PRIVATE is set. It runs after DNS resolution, so hostnames
+// that resolve to private addresses are caught too.
+func checkWebhookAddress(network, address string, c syscall.RawConn) error {
+	if AllowPrivateWebhooks() {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() {
+		return errors.New("webhook address " + host + " is not publicly routable")
+	}
+	return nil
+}
+
+// SignWebhookPayload returns the X-MoltCities-Signature header value for a
+// payload: "sha256=" followed by the hex HMAC-SHA256 of the body.
+func SignWebhookPayload(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// emitWebhooks queues an event for delivery to each target. Deliveries run
+// in the background; failures are recorded in the delivery log.
+func (h *Handler) emitWebhooks(event string, targets []db.WebhookTarget, data interface{}) {
+	if len(targets) == 0 {
+		return
+	}
+
+	payload, err := json.Marshal(map[string]interface{}{
+		"event":      event,
+		"created_at": time.Now().UTC(),
+		"data":       data,
+	})
+	if err != nil {
+		return
+	}
+
+	for _, target := range targets {
+		id, err := h.db.CreateWebhookDelivery(target.ID, event, string(payload))
+		if err != nil {
+			continue
+		}
+		go h.deliverWebhook(target, id, event, payload)
+	}
+}
+
+// deliverWebhook POSTs a payload, retrying per webhookRetryDelays until the
+// receiver answers with a 2xx status.
+func (h *Handler) deliverWebhook(target db.WebhookTarget, deliveryID int64, event string, payload []byte) {
+	for i, delay := range webhookRetryDelays {
+		time.Sleep(delay)
+
+		code, err := postWebhook(target, deliveryID, event, payload)
+		attempts := i + 1
+		if err == nil {
+			h.db.UpdateWebhookDelivery(deliveryID, "delivered", attempts, code, "")
+			return
+		}
+
+		status := "pending"
+		if attempts == len(webhookRetryDelays) {
+			status = "failed"
+		}
+		h.db.UpdateWebhookDelivery(deliveryID, status, attempts, code, err.Error())
+	}
+}
+
+// postWebhook makes a single delivery attempt, returning the response status
+// code (0 if there was no response).
+func postWebhook(target db.WebhookTarget, deliveryID int64, event string, payload []byte) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, target.URL, bytes.NewReader(payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "MoltCities-Webhook/1.0")
+	req.Header.Set("X-MoltCities-Event", event)
+	req.Header.Set("X-MoltCities-Delivery", strconv.FormatInt(deliveryID, 10))
+	req.Header.Set("X-MoltCities-Signature", SignWebhookPayload(target.Secret, payload))
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("receiver responded with status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// messageWebhookData is the payload data for mention and message events.
+func messageWebhookData(channelName string, message *models.Message) map[string]interface{} {
+	data := map[string]interface{}{
+		"channel":    channelName,
+		"id":         message.ID,
+		"username":   message.Username,
+		"content":    message.Content,
+		"refs":       message.Refs,
+		"created_at": message.CreatedAt,
+	}
+	if message.Attachment != nil {
+		data["attachment"] = withAttachmentURL(message.Attachment, messageAttachmentURL(channelName, message.ID))
+	}
+	return data
+}
+
+// notifyMessageWebhooks delivers mention events to newly mentioned users
+// and, for new messages, message events to the channel's subscribers.
+func (h *Handler) notifyMessageWebhooks(channelName string, message *models.Message, mentioned []string, isNew bool) {
+	data := messageWebhookData(channelName, message)
+
+	for _, username := range mentioned {
+		targets, err := h.db.GetUserWebhooks(username, models.WebhookMention)
+		if err == nil {
+			h.emitWebhooks(models.WebhookMention, targets, data)
+		}
+	}
+
+	if isNew {
+		targets, err := h.db.GetChannelWebhooks(message.ChannelID, message.UserID)
+		if err == nil {
+			h.emitWebhooks(models.WebhookMessage, targets, data)
+		}
+	}
+}
@@ -0,0 +1,274 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ergodic/moltcities/internal/models"
+)
+
+// webhookRequest is a delivery captured by a test receiver.
+type webhookRequest struct {
+	event     string
+	signature string
+	body      []byte
+}
+
+// newWebhookReceiver starts a server that records deliveries and responds
+// with the status returned by status (200 if nil).
+func newWebhookReceiver(t *testing.T, status func() int) (*httptest.Server, chan webhookRequest) {
+	t.Helper()
+	received := make(chan webhookRequest, 16)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- webhookRequest{
+			event:     r.Header.Get("X-MoltCities-Event"),
+			signature: r.Header.Get("X-MoltCities-Signature"),
+			body:      body,
+		}
+		if status != nil {
+			w.WriteHeader(status())
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, received
+}
+
+// waitForWebhook returns the next delivery, failing the test after a timeout.
+func waitForWebhook(t *testing.T, received chan webhookRequest) webhookRequest {
+	t.Helper()
+	select {
+	case req := <-received:
+		return req
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for webhook delivery")
+		return webhookRequest{}
+	}
+}
+
+// createTestWebhook registers a webhook and returns its ID and secret.
+func createTestWebhook(t *testing.T, srv *httptest.Server, token, body string) (int64, string) {
+	t.Helper()
+	resp := doAuthRequest(t, "POST", srv.URL+"/webhooks", token, body)
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("failed to create webhook %s: status %d", body, resp.StatusCode)
+	}
+	var result struct {
+		Webhook models.Webhook `json:"webhook"`
+		Secret  string         `json:"secret"`
+	}
+	json.NewDecoder(resp.Body).Decode(&result)
+	return result.Webhook.ID, result.Secret
+}
+
+func TestWebhookEvents(t *testing.T) {
+	t.Setenv("WEBHOOK_ALLOW_PRIVATE", "true")
+	srv, _ := setupTestServer(t)
+	defer srv.Close()
+	receiver, received := newWebhookReceiver(t, nil)
+
+	alice := registerTestUser(t, srv, "hookalice")
+	bob := registerTestUser(t, srv, "hookbob")
+
+	_, mentionSecret := createTestWebhook(t, srv, bob, `{"url":"`+receiver.URL+`/mention","event":"mention"}`)
+	createTestWebhook(t, srv, bob, `{"url":"`+receiver.URL+`/mail","event":"mail"}`)
+	createTestWebhook(t, srv, bob, `{"url":"`+receiver.URL+`/message","event":"message","channel":"general"}`)
+	createTestWebhook(t, srv, bob, `{"url":"`+receiver.URL+`/pixel","event":"pixel","region":{"x":100,"y":100,"width":50,"height":50}}`)
+
+	// A mention in general fires both the mention and the channel message webhook
+	resp := doAuthRequest(t, "POST", srv.URL+"/channels/general/messages", alice, `{"content":"@hookbob look at (120,130)"}`)
+	resp.Body.Close()
+
+	events := map[string]webhookRequest{}
+	for i := 0; i < 2; i++ {
+		req := waitForWebhook(t, received)
+		events[req.event] = req
+	}
+	mention, ok := events[models.WebhookMention]
+	if !ok {
+		t.Fatalf("expected a mention delivery, got %v", events)
+	}
+	if _, ok := events[models.WebhookMessage]; !ok {
+		t.Fatalf("expected a message delivery, got %v", events)
+	}
+	if mention.signature != SignWebhookPayload(mentionSecret, mention.body) {
+		t.Errorf("signature %q does not match payload", mention.signature)
+	}
+	var payload struct {
+		Event string `json:"event"`
+		Data  struct {
+			Channel  string             `json:"channel"`
+			Username string             `json:"username"`
+			Refs     []models.CanvasRef `json:"refs"`
+		} `json:"data"`
+	}
+	json.Unmarshal(mention.body, &payload)
+	if payload.Event != "mention" || payload.Data.Channel != "general" || payload.Data.Username != "hookalice" || len(payload.Data.Refs) != 1 {
+		t.Errorf("unexpected mention payload: %s", mention.body)
+	}
+
+	// Bob's own messages don't trigger his channel webhook
+	resp = doAuthRequest(t, "POST", srv.URL+"/channels/general/messages", bob, `{"content":"talking to myself"}`)
+	resp.Body.Close()
+
+	resp = doAuthRequest(t, "POST", srv.URL+"/mail", alice, `{"to":"hookbob","body":"hello by mail"}`)
+	resp.Body.Close()
+	if req := waitForWebhook(t, received); req.event != models.WebhookMail {
+		t.Errorf("expected mail delivery, got %q: %s", req.event, req.body)
+	}
+
+	// Only pixels inside the region are delivered
+	resp = doAuthRequest(t, "POST", srv.URL+"/pixel", alice, `{"x":120,"y":149,"color":"#FF0000"}`)
+	resp.Body.Close()
+	if req := waitForWebhook(t, received); req.event != models.WebhookPixel {
+		t.Errorf("expected pixel delivery, got %q: %s", req.event, req.body)
+	}
+
+	// Once Bob blocks Alice, her messages no longer reach his channel webhook
+	resp = doAuthRequest(t, "POST", srv.URL+"/blocks", bob, `{"username":"hookalice"}`)
+	resp.Body.Close()
+	resp = doAuthRequest(t, "POST", srv.URL+"/channels/general/messages", alice, `{"content":"can you hear me?"}`)
+	resp.Body.Close()
+
+	select {
+	case req := <-received:
+		t.Errorf("unexpected extra delivery %q: %s", req.event, req.body)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestWebhookRetriesAndDeliveryLog(t *testing.T) {
+	t.Setenv("WEBHOOK_ALLOW_PRIVATE", "true")
+	saved := webhookRetryDelays
+	webhookRetryDelays = []time.Duration{0, 10 * time.Millisecond, 10 * time.Millisecond}
+	defer func() { webhookRetryDelays = saved }()
+
+	srv, _ := setupTestServer(t)
+	defer srv.Close()
+
+	// Fail the first attempt, accept the second
+	var calls int32
+	receiver, received := newWebhookReceiver(t, func() int {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			return http.StatusInternalServerError
+		}
+		return http.StatusNoContent
+	})
+
+	alice := registerTestUser(t, srv, "retryalice")
+	bob := registerTestUser(t, srv, "retrybob")
+	id, _ := createTestWebhook(t, srv, bob, `{"url":"`+receiver.URL+`","event":"mail"}`)
+
+	resp := doAuthRequest(t, "POST", srv.URL+"/mail", alice, `{"to":"retrybob","body":"try again"}`)
+	resp.Body.Close()
+	waitForWebhook(t, received)
+	waitForWebhook(t, received)
+
+	logURL := srv.URL + "/webhooks/" + strconv.FormatInt(id, 10) + "/deliveries"
+	var delivery models.WebhookDelivery
+	for i := 0; i < 50; i++ {
+		resp = doAuthRequest(t, "GET", logURL, bob, "")
+		var result struct {
+			Deliveries []models.WebhookDelivery `json:"deliveries"`
+		}
+		json.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if len(result.Deliveries) == 1 && result.Deliveries[0].Status != "pending" {
+			delivery = result.Deliveries[0]
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if delivery.Status != "delivered" || delivery.Attempts != 2 || delivery.ResponseCode != http.StatusNoContent {
+		t.Errorf("expected delivery on second attempt, got %+v", delivery)
+	}
+
+	// Other users can't see the log or delete the webhook
+	resp = doAuthRequest(t, "GET", logURL, alice, "")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 for another user's delivery log, got %d", resp.StatusCode)
+	}
+	resp = doAuthRequest(t, "DELETE", srv.URL+"/webhooks/"+strconv.FormatInt(id, 10), alice, "")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 deleting another user's webhook, got %d", resp.StatusCode)
+	}
+	resp = doAuthRequest(t, "DELETE", srv.URL+"/webhooks/"+strconv.FormatInt(id, 10), bob, "")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected 200 deleting own webhook, got %d", resp.StatusCode)
+	}
+}
+
+func TestWebhookValidation(t *testing.T) {
+	srv, _ := setupTestServer(t)
+	defer srv.Close()
+
+	owner := registerTestUser(t, srv, "hookowner")
+	other := registerTestUser(t, srv, "hookother")
+
+	resp := doAuthRequest(t, "POST", srv.URL+"/channels", owner, `{"name":"hook-secret","visibility":"private"}`)
+	resp.Body.Close()
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"bad scheme", `{"url":"ftp://example.com","event":"mail"}`, http.StatusBadRequest},
+		{"relative url", `{"url":"/hook","event":"mail"}`, http.StatusBadRequest},
+		{"unknown event", `{"url":"https://example.com","event":"everything"}`, http.StatusBadRequest},
+		{"message without channel", `{"url":"https://example.com","event":"message"}`, http.StatusBadRequest},
+		{"pixel without region", `{"url":"https://example.com","event":"pixel"}`, http.StatusBadRequest},
+		{"region off canvas", `{"url":"https://example.com","event":"pixel","region":{"x":1000,"y":0,"width":50,"height":1}}`, http.StatusBadRequest},
+		{"private channel", `{"url":"https://example.com","event":"message","channel":"hook-secret"}`, http.StatusNotFound},
+		{"whole canvas", `{"url":"https://example.com","event":"pixel","region":{"x":0,"y":0,"width":1024,"height":1024}}`, http.StatusCreated},
+	}
+	for _, tt := range tests {
+		resp := doAuthRequest(t, "POST", srv.URL+"/webhooks", other, tt.body)
+		resp.Body.Close()
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.status, resp.StatusCode)
+		}
+	}
+
+	// Without WEBHOOK_ALLOW_PRIVATE, loopback receivers are refused at delivery
+	receiver, received := newWebhookReceiver(t, nil)
+	saved := webhookRetryDelays
+	webhookRetryDelays = []time.Duration{0}
+	defer func() { webhookRetryDelays = saved }()
+
+	id, _ := createTestWebhook(t, srv, other, `{"url":"`+receiver.URL+`","event":"mail"}`)
+	resp = doAuthRequest(t, "POST", srv.URL+"/mail", owner, `{"to":"hookother","body":"ssrf?"}`)
+	resp.Body.Close()
+
+	var delivery models.WebhookDelivery
+	for i := 0; i < 50 && delivery.Status != "failed"; i++ {
+		time.Sleep(10 * time.Millisecond)
+		resp = doAuthRequest(t, "GET", srv.URL+"/webhooks/"+strconv.FormatInt(id, 10)+"/deliveries", other, "")
+		var result struct {
+			Deliveries []models.WebhookDelivery `json:"deliveries"`
+		}
+		json.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if len(result.Deliveries) == 1 {
+			delivery = result.Deliveries[0]
+		}
+	}
+	if delivery.Status != "failed" || delivery.Error == "" {
+		t.Errorf("expected delivery to a loopback address to fail, got %+v", delivery)
+	}
+	select {
+	case <-received:
+		t.Error("loopback receiver should not have been contacted")
+	default:
+	}
+}
@@ -0,0 +1,390 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"strings"
+
+	"github.com/ergodic/moltcities/internal/models"
+)
+
+const (
+	// MaxWebringsPerUser is how many webrings one user can own.
+	MaxWebringsPerUser = 5
+	// MaxWebringMembers is how many approved members a webring can have.
+	MaxWebringMembers = 100
+)
+
+// CreateWebringRequest is the request body for creating a webring.
+type CreateWebringRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+// webringNameFromPath extracts the ring name from /webrings/{name}/...
+func webringNameFromPath(path string) string {
+	name := strings.TrimPrefix(path, "/webrings/")
+	if idx := strings.Index(name, "/"); idx != -1 {
+		name = name[:idx]
+	}
+	return strings.ToLower(name)
+}
+
+// lookupWebring resolves the webring named in the path. Webrings are
+// public; with ownerOnly, anyone but the owner is refused. Writes an error
+// response and returns nil on failure.
+func (h *Handler) lookupWebring(w http.ResponseWriter, r *http.Request, ownerOnly bool) *models.Webring {
+	ring, err := h.db.GetWebring(webringNameFromPath(r.URL.Path))
+	if err != nil {
+		WriteError(w, http.StatusNotFound, "Webring not found", "WEBRING_NOT_FOUND", "")
+		return nil
+	}
+	if ownerOnly {
+		user := GetUserFromContext(r)
+		if user == nil {
+			WriteError(w, http.StatusUnauthorized, "Not authenticated", "AUTH_REQUIRED", "")
+			return nil
+		}
+		if ring.OwnerID != user.ID {
+			WriteError(w, http.StatusForbidden, "Only the webring owner can do this", "FORBIDDEN", "")
+			return nil
+		}
+	}
+	return ring
+}
+
+// CreateWebring handles POST /webrings
+func (h *Handler) CreateWebring(w http.ResponseWriter, r *http.Request) {
+	user := GetUserFromContext(r)
+	if user == nil {
+		WriteError(w, http.StatusUnauthorized, "Not authenticated", "AUTH_REQUIRED", "")
+		return
+	}
+
+	var req CreateWebringRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid JSON body", "INVALID_JSON", err.Error())
+		return
+	}
+
+	// Webring names follow the same rules as channel names
+	req.Name = strings.ToLower(req.Name)
+	if err := ValidateChannelName(req.Name); err != nil {
+		WriteError(w, http.StatusBadRequest, err.Error(), "INVALID_NAME", "")
+		return
+	}
+	if len(req.Description) > 256 {
+		WriteError(w, http.StatusBadRequest, "Description must be at most 256 characters", "INVALID_DESCRIPTION", "")
+		return
+	}
+
+	count, err := h.db.CountOwnedWebrings(user.ID)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to count webrings", "DB_ERROR", "")
+		return
+	}
+	if count >= MaxWebringsPerUser {
+		WriteError(w, http.StatusForbidden, "You can own at most 5 webrings", "LIMIT_REACHED", "")
+		return
+	}
+
+	if _, err := h.db.GetWebring(req.Name); err == nil {
+		WriteError(w, http.StatusConflict, "Webring already exists", "WEBRING_EXISTS", "")
+		return
+	}
+
+	ring, err := h.db.CreateWebring(req.Name, req.Description, user.ID)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to create webring", "DB_ERROR", "")
+		return
+	}
+
+	WriteJSON(w, http.StatusCreated, ring)
+}
+
+// ListWebrings handles GET /webrings
+func (h *Handler) ListWebrings(w http.ResponseWriter, r *http.Request) {
+	rings, err := h.db.ListWebrings()
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to list webrings", "DB_ERROR", "")
+		return
+	}
+	if rings == nil {
+		rings = []models.Webring{}
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"webrings": rings,
+	})
+}
+
+// Webring handles GET and DELETE /webrings/{name}. Anyone can see a ring's
+// members in order; its owner also sees requests to join.
+func (h *Handler) Webring(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		ring := h.lookupWebring(w, r, false)
+		if ring == nil {
+			return
+		}
+		members, err := h.db.ListWebringMembers(ring.ID, models.WebringStatusMember)
+		if err != nil {
+			WriteError(w, http.StatusInternalServerError, "Failed to list members", "DB_ERROR", "")
+			return
+		}
+		if members == nil {
+			members = []models.WebringMember{}
+		}
+		resp := map[string]interface{}{
+			"webring": ring,
+			"members": members,
+		}
+		if user := GetUserFromContext(r); user != nil && user.ID == ring.OwnerID {
+			requests, err := h.db.ListWebringMembers(ring.ID, models.WebringStatusPending)
+			if err != nil {
+				WriteError(w, http.StatusInternalServerError, "Failed to list requests", "DB_ERROR", "")
+				return
+			}
+			if requests == nil {
+				requests = []models.WebringMember{}
+			}
+			resp["requests"] = requests
+		}
+		WriteJSON(w, http.StatusOK, resp)
+
+	case http.MethodDelete:
+		ring := h.lookupWebring(w, r, true)
+		if ring == nil {
+			return
+		}
+		if err := h.db.DeleteWebring(ring.ID); err != nil {
+			WriteError(w, http.StatusInternalServerError, "Failed to delete webring", "DB_ERROR", "")
+			return
+		}
+		WriteJSON(w, http.StatusOK, map[string]interface{}{
+			"name":    ring.Name,
+			"deleted": true,
+		})
+
+	default:
+		WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED", "")
+	}
+}
+
+// JoinWebring handles POST /webrings/{name}/join. The request waits for
+// the owner's approval; only bots with a page can ask.
+func (h *Handler) JoinWebring(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED", "")
+		return
+	}
+
+	user := GetUserFromContext(r)
+	ring := h.lookupWebring(w, r, false)
+	if ring == nil {
+		return
+	}
+
+	if _, err := h.db.GetPage(user.Username); err != nil {
+		WriteError(w, http.StatusBadRequest, "Create a page before joining a webring", "NO_PAGE", "")
+		return
+	}
+
+	status, created, err := h.db.RequestWebringJoin(ring.ID, user.ID)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to request to join", "DB_ERROR", "")
+		return
+	}
+
+	code := http.StatusOK
+	if created {
+		code = http.StatusCreated
+	}
+	WriteJSON(w, code, map[string]interface{}{
+		"webring":  ring.Name,
+		"username": user.Username,
+		"status":   status,
+	})
+}
+
+// ApproveWebringMember handles POST /webrings/{name}/members, approving a
+// bot's request to join.
+func (h *Handler) ApproveWebringMember(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED", "")
+		return
+	}
+
+	ring := h.lookupWebring(w, r, true)
+	if ring == nil {
+		return
+	}
+
+	target := h.decodeMemberTarget(w, r)
+	if target == nil {
+		return
+	}
+
+	if ring.MemberCount >= MaxWebringMembers {
+		WriteError(w, http.StatusForbidden, "Webrings can have at most 100 members", "LIMIT_REACHED", "")
+		return
+	}
+
+	err := h.db.ApproveWebringMember(ring.ID, target.ID)
+	if err == sql.ErrNoRows {
+		WriteError(w, http.StatusNotFound, "This user hasn't asked to join", "REQUEST_NOT_FOUND", "")
+		return
+	}
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to approve member", "DB_ERROR", "")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"webring":  ring.Name,
+		"username": target.Username,
+		"status":   models.WebringStatusMember,
+	})
+}
+
+// RemoveWebringMember handles DELETE /webrings/{name}/members/{username}.
+// The owner can remove members or turn down requests; bots can leave or
+// withdraw their own request.
+func (h *Handler) RemoveWebringMember(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED", "")
+		return
+	}
+
+	user := GetUserFromContext(r)
+	ring := h.lookupWebring(w, r, false)
+	if ring == nil {
+		return
+	}
+
+	username := strings.ToLower(r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:])
+	if ring.OwnerID != user.ID && username != user.Username {
+		WriteError(w, http.StatusForbidden, "Only the webring owner can remove other members", "FORBIDDEN", "")
+		return
+	}
+
+	target, err := h.db.GetUserByUsername(username)
+	if err != nil {
+		WriteError(w, http.StatusNotFound, "User not found", "USER_NOT_FOUND", "")
+		return
+	}
+	if target.ID == ring.OwnerID {
+		WriteError(w, http.StatusBadRequest, "The webring owner cannot leave; delete the webring instead", "INVALID_TARGET", "")
+		return
+	}
+
+	err = h.db.RemoveWebringMember(ring.ID, target.ID)
+	if err == sql.ErrNoRows {
+		WriteError(w, http.StatusNotFound, "Not a member of this webring", "NOT_A_MEMBER", "")
+		return
+	}
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to remove member", "DB_ERROR", "")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"webring":  ring.Name,
+		"username": target.Username,
+		"removed":  true,
+	})
+}
+
+// isWebringNavPath reports whether path is /webrings/{name}/next, /prev or
+// /random.
+func isWebringNavPath(path string) bool {
+	parts := strings.Split(strings.TrimPrefix(path, "/webrings/"), "/")
+	if !strings.HasPrefix(path, "/webrings/") || len(parts) != 2 {
+		return false
+	}
+	switch parts[1] {
+	case "next", "prev", "random":
+		return true
+	}
+	return false
+}
+
+// WebringNavigate handles GET /webrings/{name}/next, /prev and /random,
+// redirecting to a member's page. next and prev step around the ring from
+// the member named by ?from=, wrapping at the ends; random picks any other
+// member. Members without a page are skipped.
+func (h *Handler) WebringNavigate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED", "")
+		return
+	}
+
+	ring := h.lookupWebring(w, r, false)
+	if ring == nil {
+		return
+	}
+	members, err := h.db.ListWebringMembers(ring.ID, models.WebringStatusMember)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to list members", "DB_ERROR", "")
+		return
+	}
+
+	from := strings.ToLower(r.URL.Query().Get("from"))
+	var target string
+	switch r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:] {
+	case "next":
+		target = webringStep(members, from, 1)
+	case "prev":
+		target = webringStep(members, from, -1)
+	case "random":
+		target = webringRandom(members, from)
+	}
+	if target == "" {
+		WriteError(w, http.StatusNotFound, "This webring has no pages yet", "NOT_FOUND", "")
+		return
+	}
+
+	http.Redirect(w, r, userPageURL(r, target), http.StatusFound)
+}
+
+// webringStep returns the member step places after from (before, for a
+// negative step), skipping members without a page. When from isn't in the
+// ring, next starts at the first member and prev at the last. Returns ""
+// if no member has a page.
+func webringStep(members []models.WebringMember, from string, step int) string {
+	n := len(members)
+	start := -1
+	if step < 0 {
+		start = n
+	}
+	for i, m := range members {
+		if m.Username == from {
+			start = i
+			break
+		}
+	}
+	for i := 1; i <= n; i++ {
+		m := members[((start+i*step)%n+n)%n]
+		if m.HasPage {
+			return m.Username
+		}
+	}
+	return ""
+}
+
+// webringRandom returns a random member with a page other than from, or
+// from itself if it's the only one.
+func webringRandom(members []models.WebringMember, from string) string {
+	var candidates []string
+	for _, m := range members {
+		if m.HasPage && m.Username != from {
+			candidates = append(candidates, m.Username)
+		}
+	}
+	if len(candidates) == 0 {
+		return webringStep(members, from, 1)
+	}
+	return candidates[rand.Intn(len(candidates))]
+}
@@ -0,0 +1,55 @@
+package canvas
+
+import (
+	"regexp"
+	"strconv"
+
+	"github.com/ergodic/moltcities/internal/models"
+)
+
+// MaxRefsPerText caps how many canvas references are extracted from one text.
+const MaxRefsPerText = 20
+
+// refRegex matches point references like (512,300) and region references
+// like [512,300 64x64].
+var refRegex = regexp.MustCompile(`\(\s*(\d{1,4})\s*,\s*(\d{1,4})\s*\)|\[\s*(\d{1,4})\s*,\s*(\d{1,4})\s+(\d{1,4})\s*[xX]\s*(\d{1,4})\s*\]`)
+
+// ParseRefs extracts the distinct canvas references in text, in order of
+// appearance. References outside the canvas are ignored.
+func ParseRefs(text string) []models.CanvasRef {
+	var refs []models.CanvasRef
+	seen := make(map[models.CanvasRef]bool)
+	for _, m := range refRegex.FindAllStringSubmatch(text, -1) {
+		var ref models.CanvasRef
+		if m[1] != "" {
+			ref.X, _ = strconv.Atoi(m[1])
+			ref.Y, _ = strconv.Atoi(m[2])
+		} else {
+			ref.X, _ = strconv.Atoi(m[3])
+			ref.Y, _ = strconv.Atoi(m[4])
+			ref.Width, _ = strconv.Atoi(m[5])
+			ref.Height, _ = strconv.Atoi(m[6])
+		}
+		if !validRef(ref) || seen[ref] {
+			continue
+		}
+		seen[ref] = true
+		refs = append(refs, ref)
+		if len(refs) == MaxRefsPerText {
+			break
+		}
+	}
+	return refs
+}
+
+// validRef checks that a reference lies entirely on the canvas.
+func validRef(ref models.CanvasRef) bool {
+	if ValidateCoordinate(ref.X) != nil || ValidateCoordinate(ref.Y) != nil {
+		return false
+	}
+	if ref.Width == 0 && ref.Height == 0 {
+		return true
+	}
+	return ref.Width >= 1 && ref.Height >= 1 &&
+		ref.X+ref.Width <= models.CanvasSize && ref.Y+ref.Height <= models.CanvasSize
+}
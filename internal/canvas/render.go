@@ -5,12 +5,16 @@ import (
 	"fmt"
 	"image"
 	"image/color"
+	"image/draw"
 	"image/png"
 	"io"
 
 	"github.com/ergodic/moltcities/internal/models"
 )
 
+// MaxScale is the largest factor a region image can be scaled up by.
+const MaxScale = 8
+
 // Render generates a PNG image of the canvas.
 func Render(pixels map[[2]int]string, w io.Writer) error {
 	img := image.NewRGBA(image.Rect(0, 0, models.CanvasSize, models.CanvasSize))
@@ -37,13 +41,22 @@ func Render(pixels map[[2]int]string, w io.Writer) error {
 
 // RenderRegion generates a PNG image of a canvas region.
 func RenderRegion(pixels [][]string, w io.Writer) error {
+	return RenderRegionScaled(pixels, 1, w)
+}
+
+// RenderRegionScaled generates a PNG image of a canvas region with each
+// pixel drawn as a scale x scale square, so small pieces stay crisp.
+func RenderRegionScaled(pixels [][]string, scale int, w io.Writer) error {
 	height := len(pixels)
 	if height == 0 {
 		return fmt.Errorf("empty region")
 	}
 	width := len(pixels[0])
+	if scale < 1 || scale > MaxScale {
+		return fmt.Errorf("scale must be between 1 and %d", MaxScale)
+	}
 
-	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	img := image.NewRGBA(image.Rect(0, 0, width*scale, height*scale))
 
 	for y, row := range pixels {
 		for x, hex := range row {
@@ -51,7 +64,7 @@ func RenderRegion(pixels [][]string, w io.Writer) error {
 			if err != nil {
 				c = color.RGBA{255, 255, 255, 255} // Default to white
 			}
-			img.Set(x, y, c)
+			draw.Draw(img, image.Rect(x*scale, y*scale, (x+1)*scale, (y+1)*scale), image.NewUniform(c), image.Point{}, draw.Src)
 		}
 	}
 
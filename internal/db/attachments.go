@@ -0,0 +1,78 @@
+package db
+
+import (
+	"database/sql"
+	"strings"
+
+	"github.com/ergodic/moltcities/internal/models"
+)
+
+// Attachment is a canvas attachment together with its frozen pixels.
+type Attachment struct {
+	models.CanvasAttachment
+	PNG []byte
+}
+
+// insertAttachment stores an attachment for the row id in table, which is
+// mail_attachments (keyed by mail_id) or message_attachments (keyed by
+// message_id).
+func insertAttachment(tx *sql.Tx, table, column string, id int64, att *Attachment) error {
+	_, err := tx.Exec(`
+		INSERT INTO `+table+` (`+column+`, x, y, width, height, proposed, png)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, id, att.X, att.Y, att.Width, att.Height, att.Proposed, att.PNG)
+	return err
+}
+
+// getAttachments returns the attachments of the given rows, keyed by ID,
+// without their pixels.
+func (d *DB) getAttachments(table, column string, ids []int64) (map[int64]*models.CanvasAttachment, error) {
+	attachments := make(map[int64]*models.CanvasAttachment)
+	if len(ids) == 0 {
+		return attachments, nil
+	}
+
+	placeholders := strings.Repeat("?,", len(ids))
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	rows, err := d.conn.Query(`
+		SELECT `+column+`, x, y, width, height, proposed FROM `+table+`
+		WHERE `+column+` IN (`+placeholders[:len(placeholders)-1]+`)
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		var a models.CanvasAttachment
+		if err := rows.Scan(&id, &a.X, &a.Y, &a.Width, &a.Height, &a.Proposed); err != nil {
+			return nil, err
+		}
+		attachments[id] = &a
+	}
+	return attachments, rows.Err()
+}
+
+// GetMailAttachmentPNG returns the frozen pixels attached to a mail.
+// Callers must check the user can see the mail.
+func (d *DB) GetMailAttachmentPNG(mailID int64) ([]byte, error) {
+	var png []byte
+	err := d.conn.QueryRow("SELECT png FROM mail_attachments WHERE mail_id = ?", mailID).Scan(&png)
+	return png, err
+}
+
+// GetMessageAttachmentPNG returns the frozen pixels attached to a message
+// in a channel.
+func (d *DB) GetMessageAttachmentPNG(channelID, messageID int64) ([]byte, error) {
+	var png []byte
+	err := d.conn.QueryRow(`
+		SELECT a.png FROM message_attachments a
+		JOIN messages m ON a.message_id = m.id
+		WHERE a.message_id = ? AND m.channel_id = ?
+	`, messageID, channelID).Scan(&png)
+	return png, err
+}
@@ -0,0 +1,77 @@
+package db
+
+import (
+	"database/sql"
+
+	"github.com/ergodic/moltcities/internal/models"
+)
+
+// BlockUser blocks a user. Returns false if they were already blocked.
+func (d *DB) BlockUser(userID, blockedID int64) (bool, error) {
+	result, err := d.conn.Exec(
+		"INSERT OR IGNORE INTO user_blocks (user_id, blocked_id) VALUES (?, ?)",
+		userID, blockedID,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, _ := result.RowsAffected()
+	return n > 0, nil
+}
+
+// UnblockUser removes a block. Returns sql.ErrNoRows if there was none.
+func (d *DB) UnblockUser(userID, blockedID int64) error {
+	result, err := d.conn.Exec(
+		"DELETE FROM user_blocks WHERE user_id = ? AND blocked_id = ?",
+		userID, blockedID,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// IsBlocked reports whether userID has blocked blockedID.
+func (d *DB) IsBlocked(userID, blockedID int64) (bool, error) {
+	var count int
+	err := d.conn.QueryRow(
+		"SELECT COUNT(*) FROM user_blocks WHERE user_id = ? AND blocked_id = ?",
+		userID, blockedID,
+	).Scan(&count)
+	return count > 0, err
+}
+
+// ListBlocks returns the users a user has blocked, most recent first.
+func (d *DB) ListBlocks(userID int64) ([]models.Block, error) {
+	rows, err := d.conn.Query(`
+		SELECT u.username, b.created_at
+		FROM user_blocks b
+		JOIN users u ON b.blocked_id = u.id
+		WHERE b.user_id = ?
+		ORDER BY b.created_at DESC, u.username
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var blocks []models.Block
+	for rows.Next() {
+		var b models.Block
+		if err := rows.Scan(&b.Username, &b.CreatedAt); err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, b)
+	}
+	return blocks, rows.Err()
+}
+
+// CountBlocks returns how many users a user has blocked.
+func (d *DB) CountBlocks(userID int64) (int, error) {
+	var count int
+	err := d.conn.QueryRow("SELECT COUNT(*) FROM user_blocks WHERE user_id = ?", userID).Scan(&count)
+	return count, err
+}
@@ -2,16 +2,25 @@ package db
 
 import (
 	"database/sql"
+	"strings"
 	"time"
 
+	"github.com/ergodic/moltcities/internal/canvas"
 	"github.com/ergodic/moltcities/internal/models"
 )
 
-// CreateChannel creates a new channel.
-func (d *DB) CreateChannel(name, description string, userID int64) (*models.Channel, error) {
-	result, err := d.conn.Exec(
-		`INSERT INTO channels (name, description, created_by) VALUES (?, ?, ?)`,
-		name, description, userID,
+// CreateChannel creates a new channel. The creator of a non-public channel
+// is added as its first member.
+func (d *DB) CreateChannel(name, description, visibility string, userID int64) (*models.Channel, error) {
+	tx, err := d.conn.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(
+		`INSERT INTO channels (name, description, visibility, created_by) VALUES (?, ?, ?, ?)`,
+		name, description, visibility, userID,
 	)
 	if err != nil {
 		return nil, err
@@ -22,6 +31,20 @@ func (d *DB) CreateChannel(name, description string, userID int64) (*models.Chan
 		return nil, err
 	}
 
+	if visibility != models.ChannelPublic {
+		_, err = tx.Exec(
+			`INSERT INTO channel_members (channel_id, user_id, added_by) VALUES (?, ?, ?)`,
+			id, userID, userID,
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
 	// Get username
 	var username string
 	d.conn.QueryRow("SELECT username FROM users WHERE id = ?", userID).Scan(&username)
@@ -30,6 +53,7 @@ func (d *DB) CreateChannel(name, description string, userID int64) (*models.Chan
 		ID:            id,
 		Name:          name,
 		Description:   description,
+		Visibility:    visibility,
 		CreatedBy:     userID,
 		CreatedByName: username,
 		CreatedAt:     time.Now(),
@@ -39,20 +63,25 @@ func (d *DB) CreateChannel(name, description string, userID int64) (*models.Chan
 // GetChannel retrieves a channel by name.
 func (d *DB) GetChannel(name string) (*models.Channel, error) {
 	var channel models.Channel
-	var description sql.NullString
+	var description, topic sql.NullString
+	var archivedAt sql.NullTime
 
 	err := d.conn.QueryRow(`
-		SELECT c.id, c.name, c.description, c.created_by, u.username, c.created_at
+		SELECT c.id, c.name, c.description, c.topic, c.visibility, c.archived_at, c.retention_days,
+		       c.created_by, u.username, c.created_at
 		FROM channels c
 		JOIN users u ON c.created_by = u.id
 		WHERE c.name = ?
-	`, name).Scan(&channel.ID, &channel.Name, &description, &channel.CreatedBy, &channel.CreatedByName, &channel.CreatedAt)
+	`, name).Scan(&channel.ID, &channel.Name, &description, &topic, &channel.Visibility, &archivedAt, &channel.RetentionDays,
+		&channel.CreatedBy, &channel.CreatedByName, &channel.CreatedAt)
 	if err != nil {
 		return nil, err
 	}
 
-	if description.Valid {
-		channel.Description = description.String
+	channel.Description = description.String
+	channel.Topic = topic.String
+	if archivedAt.Valid {
+		channel.ArchivedAt = &archivedAt.Time
 	}
 
 	// Get message count
@@ -61,14 +90,19 @@ func (d *DB) GetChannel(name string) (*models.Channel, error) {
 	return &channel, nil
 }
 
-// ListChannels returns all channels.
-func (d *DB) ListChannels() ([]models.Channel, error) {
+// ListChannels returns all channels visible to a user: public and
+// invite-only channels, plus private channels the user is a member of.
+// Pass viewerID 0 for anonymous visitors.
+func (d *DB) ListChannels(viewerID int64) ([]models.Channel, error) {
 	rows, err := d.conn.Query(`
-		SELECT c.id, c.name, c.description, c.created_by, u.username, c.created_at
+		SELECT c.id, c.name, c.description, c.topic, c.visibility, c.archived_at, c.retention_days,
+		       c.created_by, u.username, c.created_at
 		FROM channels c
 		JOIN users u ON c.created_by = u.id
+		WHERE c.visibility != 'private'
+		   OR c.id IN (SELECT channel_id FROM channel_members WHERE user_id = ?)
 		ORDER BY c.created_at ASC
-	`)
+	`, viewerID)
 	if err != nil {
 		return nil, err
 	}
@@ -77,12 +111,16 @@ func (d *DB) ListChannels() ([]models.Channel, error) {
 	var channels []models.Channel
 	for rows.Next() {
 		var ch models.Channel
-		var description sql.NullString
-		if err := rows.Scan(&ch.ID, &ch.Name, &description, &ch.CreatedBy, &ch.CreatedByName, &ch.CreatedAt); err != nil {
+		var description, topic sql.NullString
+		var archivedAt sql.NullTime
+		if err := rows.Scan(&ch.ID, &ch.Name, &description, &topic, &ch.Visibility, &archivedAt, &ch.RetentionDays,
+			&ch.CreatedBy, &ch.CreatedByName, &ch.CreatedAt); err != nil {
 			return nil, err
 		}
-		if description.Valid {
-			ch.Description = description.String
+		ch.Description = description.String
+		ch.Topic = topic.String
+		if archivedAt.Valid {
+			ch.ArchivedAt = &archivedAt.Time
 		}
 		channels = append(channels, ch)
 	}
@@ -90,6 +128,74 @@ func (d *DB) ListChannels() ([]models.Channel, error) {
 	return channels, rows.Err()
 }
 
+// IsChannelMember checks if a user is a member of a channel.
+func (d *DB) IsChannelMember(channelID, userID int64) (bool, error) {
+	var count int
+	err := d.conn.QueryRow(
+		"SELECT COUNT(*) FROM channel_members WHERE channel_id = ? AND user_id = ?",
+		channelID, userID,
+	).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// AddChannelMember adds a user to a channel. Returns false if the user was
+// already a member.
+func (d *DB) AddChannelMember(channelID, userID, addedBy int64) (bool, error) {
+	result, err := d.conn.Exec(`
+		INSERT OR IGNORE INTO channel_members (channel_id, user_id, added_by)
+		VALUES (?, ?, ?)
+	`, channelID, userID, addedBy)
+	if err != nil {
+		return false, err
+	}
+	n, _ := result.RowsAffected()
+	return n > 0, nil
+}
+
+// RemoveChannelMember removes a user from a channel.
+func (d *DB) RemoveChannelMember(channelID, userID int64) error {
+	result, err := d.conn.Exec(
+		"DELETE FROM channel_members WHERE channel_id = ? AND user_id = ?",
+		channelID, userID,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// ListChannelMembers returns the members of a channel in join order.
+func (d *DB) ListChannelMembers(channelID int64) ([]models.ChannelMember, error) {
+	rows, err := d.conn.Query(`
+		SELECT u.username, COALESCE(a.username, ''), cm.joined_at
+		FROM channel_members cm
+		JOIN users u ON cm.user_id = u.id
+		LEFT JOIN users a ON cm.added_by = a.id
+		WHERE cm.channel_id = ?
+		ORDER BY cm.joined_at ASC
+	`, channelID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var members []models.ChannelMember
+	for rows.Next() {
+		var m models.ChannelMember
+		if err := rows.Scan(&m.Username, &m.AddedBy, &m.JoinedAt); err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+	return members, rows.Err()
+}
+
 // ChannelExists checks if a channel name is already taken.
 func (d *DB) ChannelExists(name string) (bool, error) {
 	var count int
@@ -100,9 +206,16 @@ func (d *DB) ChannelExists(name string) (bool, error) {
 	return count > 0, nil
 }
 
-// CreateMessage creates a new message in a channel.
-func (d *DB) CreateMessage(channelID, userID int64, content string) (*models.Message, error) {
-	result, err := d.conn.Exec(
+// CreateMessage creates a new message in a channel, with an optional
+// canvas attachment.
+func (d *DB) CreateMessage(channelID, userID int64, content string, att *Attachment) (*models.Message, error) {
+	tx, err := d.conn.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(
 		`INSERT INTO messages (channel_id, user_id, content) VALUES (?, ?, ?)`,
 		channelID, userID, content,
 	)
@@ -115,45 +228,89 @@ func (d *DB) CreateMessage(channelID, userID int64, content string) (*models.Mes
 		return nil, err
 	}
 
+	// Count the post for rate limiting, even if the message is deleted
+	if _, err := tx.Exec("INSERT INTO message_posts (user_id) VALUES (?)", userID); err != nil {
+		return nil, err
+	}
+
+	mentions, err := insertMentions(tx, channelID, id, userID, content)
+	if err != nil {
+		return nil, err
+	}
+
+	refs := canvas.ParseRefs(content)
+	if err := insertMessageRefs(tx, channelID, id, refs); err != nil {
+		return nil, err
+	}
+
+	var attachment *models.CanvasAttachment
+	if att != nil {
+		if err := insertAttachment(tx, "message_attachments", "message_id", id, att); err != nil {
+			return nil, err
+		}
+		attachment = &att.CanvasAttachment
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
 	// Get username
 	var username string
 	d.conn.QueryRow("SELECT username FROM users WHERE id = ?", userID).Scan(&username)
 
 	return &models.Message{
-		ID:        id,
-		ChannelID: channelID,
-		UserID:    userID,
-		Username:  username,
-		Content:   content,
-		CreatedAt: time.Now(),
+		ID:         id,
+		ChannelID:  channelID,
+		UserID:     userID,
+		Username:   username,
+		Content:    content,
+		Mentions:   mentions,
+		Refs:       refs,
+		Attachment: attachment,
+		CreatedAt:  time.Now(),
 	}, nil
 }
 
 // GetChannelMessages retrieves messages from a channel.
-func (d *DB) GetChannelMessages(channelID int64, limit int, since *time.Time) ([]models.Message, error) {
-	var rows *sql.Rows
-	var err error
+//
+// Messages are always returned oldest first. With afterID or since set, the
+// page starts just after that point and moves forward in time; otherwise it
+// holds the most recent messages (before beforeID, if set). Paging uses
+// message IDs rather than timestamps so that messages posted in the same
+// second are never skipped. Messages from users the viewer has blocked are
+// left out.
+func (d *DB) GetChannelMessages(channelID, viewerID int64, limit int, since *time.Time, beforeID, afterID int64) ([]models.Message, error) {
+	query := `
+		SELECT m.id, m.channel_id, m.user_id, u.username, m.content, m.edited_at, m.created_at
+		FROM messages m
+		JOIN users u ON m.user_id = u.id
+		WHERE m.channel_id = ?
+		  AND m.user_id NOT IN (SELECT blocked_id FROM user_blocks WHERE user_id = ?)`
+	args := []interface{}{channelID, viewerID}
 
 	if since != nil {
-		rows, err = d.conn.Query(`
-			SELECT m.id, m.channel_id, m.user_id, u.username, m.content, m.created_at
-			FROM messages m
-			JOIN users u ON m.user_id = u.id
-			WHERE m.channel_id = ? AND m.created_at > ?
-			ORDER BY m.created_at ASC
-			LIMIT ?
-		`, channelID, since, limit)
+		query += " AND m.created_at > ?"
+		args = append(args, since)
+	}
+	if beforeID > 0 {
+		query += " AND m.id < ?"
+		args = append(args, beforeID)
+	}
+	if afterID > 0 {
+		query += " AND m.id > ?"
+		args = append(args, afterID)
+	}
+
+	forward := since != nil || afterID > 0
+	if forward {
+		query += " ORDER BY m.id ASC LIMIT ?"
 	} else {
-		rows, err = d.conn.Query(`
-			SELECT m.id, m.channel_id, m.user_id, u.username, m.content, m.created_at
-			FROM messages m
-			JOIN users u ON m.user_id = u.id
-			WHERE m.channel_id = ?
-			ORDER BY m.created_at DESC
-			LIMIT ?
-		`, channelID, limit)
+		query += " ORDER BY m.id DESC LIMIT ?"
 	}
+	args = append(args, limit)
 
+	rows, err := d.conn.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -161,21 +318,274 @@ func (d *DB) GetChannelMessages(channelID int64, limit int, since *time.Time) ([
 
 	var messages []models.Message
 	for rows.Next() {
-		var msg models.Message
-		if err := rows.Scan(&msg.ID, &msg.ChannelID, &msg.UserID, &msg.Username, &msg.Content, &msg.CreatedAt); err != nil {
+		msg, err := scanMessage(rows)
+		if err != nil {
 			return nil, err
 		}
-		messages = append(messages, msg)
+		messages = append(messages, *msg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
 	}
 
 	// Reverse if we queried DESC (for recent messages)
-	if since == nil && len(messages) > 1 {
+	if !forward && len(messages) > 1 {
 		for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
 			messages[i], messages[j] = messages[j], messages[i]
 		}
 	}
 
-	return messages, rows.Err()
+	if err := d.attachReactions(messages); err != nil {
+		return nil, err
+	}
+
+	ids := make([]int64, len(messages))
+	for i, msg := range messages {
+		ids[i] = msg.ID
+	}
+	attachments, err := d.getAttachments("message_attachments", "message_id", ids)
+	if err != nil {
+		return nil, err
+	}
+	for i := range messages {
+		messages[i].Attachment = attachments[messages[i].ID]
+	}
+
+	return messages, nil
+}
+
+// scanner is implemented by *sql.Row and *sql.Rows.
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanMessage scans a message row selected as
+// id, channel_id, user_id, username, content, edited_at, created_at.
+func scanMessage(row scanner) (*models.Message, error) {
+	var msg models.Message
+	var editedAt sql.NullTime
+	if err := row.Scan(&msg.ID, &msg.ChannelID, &msg.UserID, &msg.Username, &msg.Content, &editedAt, &msg.CreatedAt); err != nil {
+		return nil, err
+	}
+	if editedAt.Valid {
+		msg.EditedAt = &editedAt.Time
+	}
+	msg.Refs = canvas.ParseRefs(msg.Content)
+	return &msg, nil
+}
+
+// GetChannelMessage retrieves a single message from a channel.
+func (d *DB) GetChannelMessage(channelID, messageID int64) (*models.Message, error) {
+	msg, err := scanMessage(d.conn.QueryRow(`
+		SELECT m.id, m.channel_id, m.user_id, u.username, m.content, m.edited_at, m.created_at
+		FROM messages m
+		JOIN users u ON m.user_id = u.id
+		WHERE m.channel_id = ? AND m.id = ?
+	`, channelID, messageID))
+	if err != nil {
+		return nil, err
+	}
+
+	messages := []models.Message{*msg}
+	if err := d.attachReactions(messages); err != nil {
+		return nil, err
+	}
+	attachments, err := d.getAttachments("message_attachments", "message_id", []int64{msg.ID})
+	if err != nil {
+		return nil, err
+	}
+	messages[0].Attachment = attachments[msg.ID]
+	return &messages[0], nil
+}
+
+// UpdateChannelMessage replaces a message's content, keeping the previous
+// version in the edit history. Returns any users newly @mentioned by the edit.
+func (d *DB) UpdateChannelMessage(messageID int64, content string) ([]string, error) {
+	tx, err := d.conn.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var channelID, authorID int64
+	err = tx.QueryRow("SELECT channel_id, user_id FROM messages WHERE id = ?", messageID).Scan(&channelID, &authorID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Save the current version before overwriting it
+	_, err = tx.Exec(`
+		INSERT INTO message_edits (message_id, content)
+		SELECT id, content FROM messages WHERE id = ?
+	`, messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE messages SET content = ?, edited_at = CURRENT_TIMESTAMP WHERE id = ?
+	`, content, messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	mentions, err := insertMentions(tx, channelID, messageID, authorID, content)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec("DELETE FROM message_refs WHERE message_id = ?", messageID); err != nil {
+		return nil, err
+	}
+	if err := insertMessageRefs(tx, channelID, messageID, canvas.ParseRefs(content)); err != nil {
+		return nil, err
+	}
+
+	return mentions, tx.Commit()
+}
+
+// messageChildTables lists the tables holding per-message rows that must be
+// removed along with a channel message.
+var messageChildTables = []string{
+	"message_reactions",
+	"message_edits",
+	"channel_pins",
+	"mentions",
+	"message_refs",
+	"message_attachments",
+}
+
+// DeleteChannelMessage removes a message along with its edit history,
+// reactions, pins, mentions, canvas references and attachment.
+func (d *DB) DeleteChannelMessage(messageID int64) error {
+	tx, err := d.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, table := range messageChildTables {
+		if _, err := tx.Exec("DELETE FROM "+table+" WHERE message_id = ?", messageID); err != nil {
+			return err
+		}
+	}
+
+	result, err := tx.Exec("DELETE FROM messages WHERE id = ?", messageID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+
+	return tx.Commit()
+}
+
+// GetMessageEdits returns the previous versions of a message, oldest first.
+func (d *DB) GetMessageEdits(messageID int64) ([]models.MessageEdit, error) {
+	rows, err := d.conn.Query(`
+		SELECT content, edited_at FROM message_edits
+		WHERE message_id = ?
+		ORDER BY edited_at ASC, id ASC
+	`, messageID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var edits []models.MessageEdit
+	for rows.Next() {
+		var e models.MessageEdit
+		if err := rows.Scan(&e.Content, &e.EditedAt); err != nil {
+			return nil, err
+		}
+		edits = append(edits, e)
+	}
+	return edits, rows.Err()
+}
+
+// AddReaction adds an emoji reaction from a user to a message.
+// Returns false if the user had already reacted with that emoji.
+func (d *DB) AddReaction(messageID, userID int64, emoji string) (bool, error) {
+	result, err := d.conn.Exec(`
+		INSERT OR IGNORE INTO message_reactions (message_id, user_id, emoji)
+		VALUES (?, ?, ?)
+	`, messageID, userID, emoji)
+	if err != nil {
+		return false, err
+	}
+	n, _ := result.RowsAffected()
+	return n > 0, nil
+}
+
+// RemoveReaction removes a user's emoji reaction from a message.
+func (d *DB) RemoveReaction(messageID, userID int64, emoji string) error {
+	result, err := d.conn.Exec(`
+		DELETE FROM message_reactions WHERE message_id = ? AND user_id = ? AND emoji = ?
+	`, messageID, userID, emoji)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// attachReactions loads aggregated reactions for the given messages in place.
+func (d *DB) attachReactions(messages []models.Message) error {
+	if len(messages) == 0 {
+		return nil
+	}
+
+	index := make(map[int64]int, len(messages))
+	placeholders := make([]string, len(messages))
+	args := make([]interface{}, len(messages))
+	for i, msg := range messages {
+		index[msg.ID] = i
+		placeholders[i] = "?"
+		args[i] = msg.ID
+	}
+
+	rows, err := d.conn.Query(`
+		SELECT r.message_id, r.emoji, u.username
+		FROM message_reactions r
+		JOIN users u ON r.user_id = u.id
+		WHERE r.message_id IN (`+strings.Join(placeholders, ",")+`)
+		ORDER BY r.created_at ASC
+	`, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var messageID int64
+		var emoji, username string
+		if err := rows.Scan(&messageID, &emoji, &username); err != nil {
+			return err
+		}
+
+		msg := &messages[index[messageID]]
+		found := false
+		for i := range msg.Reactions {
+			if msg.Reactions[i].Emoji == emoji {
+				msg.Reactions[i].Count++
+				msg.Reactions[i].Users = append(msg.Reactions[i].Users, username)
+				found = true
+				break
+			}
+		}
+		if !found {
+			msg.Reactions = append(msg.Reactions, models.Reaction{
+				Emoji: emoji,
+				Count: 1,
+				Users: []string{username},
+			})
+		}
+	}
+
+	return rows.Err()
 }
 
 // CountUserChannelsToday counts channels created by a user today.
@@ -188,11 +598,12 @@ func (d *DB) CountUserChannelsToday(userID int64) (int, error) {
 	return count, err
 }
 
-// CountUserMessagesLastHour counts messages sent by a user in the last hour.
+// CountUserMessagesLastHour counts messages posted by a user in the last
+// hour, including any they've since deleted.
 func (d *DB) CountUserMessagesLastHour(userID int64) (int, error) {
 	var count int
 	err := d.conn.QueryRow(`
-		SELECT COUNT(*) FROM messages 
+		SELECT COUNT(*) FROM message_posts
 		WHERE user_id = ? AND created_at > datetime('now', '-1 hour')
 	`, userID).Scan(&count)
 	return count, err
@@ -30,7 +30,13 @@ func New(path string) (*DB, error) {
 		}
 	}
 
-	conn, err := sql.Open("sqlite", path)
+	// Per-connection pragmas go in the DSN so that every connection in the
+	// pool gets them, not just the first one. Transactions take the write
+	// lock when they begin: a transaction that reads before writing can't
+	// wait out busy_timeout if another write commits in between, and fails
+	// with SQLITE_BUSY instead.
+	dsn := path + "?_pragma=busy_timeout(5000)&_pragma=foreign_keys(1)&_txlock=immediate"
+	conn, err := sql.Open("sqlite", dsn)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
@@ -41,18 +47,6 @@ func New(path string) (*DB, error) {
 		return nil, fmt.Errorf("failed to enable WAL mode: %w", err)
 	}
 
-	// Set busy timeout to handle concurrent access
-	if _, err := conn.Exec("PRAGMA busy_timeout=5000"); err != nil {
-		conn.Close()
-		return nil, fmt.Errorf("failed to set busy timeout: %w", err)
-	}
-
-	// Enable foreign keys
-	if _, err := conn.Exec("PRAGMA foreign_keys=ON"); err != nil {
-		conn.Close()
-		return nil, fmt.Errorf("failed to enable foreign keys: %w", err)
-	}
-
 	db := &DB{conn: conn, path: path}
 
 	// Run migrations
@@ -70,9 +64,115 @@ func New(path string) (*DB, error) {
 	return db, nil
 }
 
+// columnMigrations lists columns added to tables after their initial
+// release. CREATE TABLE IF NOT EXISTS leaves existing tables untouched, so
+// these are applied with ALTER TABLE on databases created before the column
+// existed. New databases get the column from schema.sql directly.
+var columnMigrations = []struct {
+	table      string
+	column     string
+	definition string
+}{
+	{"messages", "edited_at", "TIMESTAMP"},
+	{"channels", "visibility", "TEXT NOT NULL DEFAULT 'public'"},
+	{"channels", "topic", "TEXT"},
+	{"users", "mention_mail", "INTEGER NOT NULL DEFAULT 0"},
+	{"channels", "archived_at", "TIMESTAMP"},
+	{"channels", "retention_days", "INTEGER NOT NULL DEFAULT 0"},
+	{"mail", "in_reply_to", "INTEGER"},
+	{"mail", "thread_id", "INTEGER"},
+	{"mail", "sender_deleted_at", "TIMESTAMP"},
+	{"mail", "recipient_deleted_at", "TIMESTAMP"},
+	{"mail", "archived_at", "TIMESTAMP"},
+	{"pages", "hits", "INTEGER NOT NULL DEFAULT 0"},
+	{"pages", "source", "TEXT"},
+	{"pages", "theme", "TEXT"},
+	{"page_versions", "source", "TEXT"},
+	{"page_versions", "theme", "TEXT"},
+}
+
+// ftsTables lists full-text indexes that must be rebuilt from their content
+// table when they are first created on a database that already has rows.
+var ftsTables = []string{"messages_fts", "mail_fts"}
+
 // migrate applies the database schema.
 func (d *DB) migrate() error {
-	_, err := d.conn.Exec(schema)
+	// Add missing columns first so that indexes in schema.sql which
+	// reference them can be created on older databases.
+	for _, m := range columnMigrations {
+		if err := d.ensureColumn(m.table, m.column, m.definition); err != nil {
+			return fmt.Errorf("failed to add %s.%s: %w", m.table, m.column, err)
+		}
+	}
+
+	// Note which search indexes are new before the schema creates them
+	var newFTS []string
+	for _, table := range ftsTables {
+		var count int
+		if err := d.conn.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE name = ?", table).Scan(&count); err != nil {
+			return err
+		}
+		if count == 0 {
+			newFTS = append(newFTS, table)
+		}
+	}
+
+	if _, err := d.conn.Exec(schema); err != nil {
+		return err
+	}
+
+	// Mail sent before threads existed starts a thread of its own
+	if _, err := d.conn.Exec("UPDATE mail SET thread_id = id WHERE thread_id IS NULL"); err != nil {
+		return fmt.Errorf("failed to backfill mail threads: %w", err)
+	}
+
+	// Pages saved before versions existed start at version 1
+	if _, err := d.conn.Exec(`
+		INSERT INTO page_versions (user_id, version, content, created_at)
+		SELECT user_id, 1, content, updated_at FROM pages
+		WHERE user_id NOT IN (SELECT user_id FROM page_versions)
+	`); err != nil {
+		return fmt.Errorf("failed to backfill page versions: %w", err)
+	}
+
+	// Index rows that existed before the search index did
+	for _, table := range newFTS {
+		if _, err := d.conn.Exec(fmt.Sprintf("INSERT INTO %s(%s) VALUES ('rebuild')", table, table)); err != nil {
+			return fmt.Errorf("failed to rebuild %s: %w", table, err)
+		}
+	}
+
+	return nil
+}
+
+// ensureColumn adds a column to an existing table if it is missing.
+// Tables that don't exist yet are skipped; schema.sql creates them.
+func (d *DB) ensureColumn(table, column, definition string) error {
+	rows, err := d.conn.Query("SELECT name FROM pragma_table_info(?)", table)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	tableExists := false
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		tableExists = true
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if !tableExists {
+		return nil
+	}
+
+	_, err = d.conn.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
 	return err
 }
 
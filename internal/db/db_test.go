@@ -4,6 +4,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 )
 
 // TestNew verifies database creation and migrations.
@@ -125,6 +126,7 @@ func TestIndexes(t *testing.T) {
 		"idx_messages_channel",
 		"idx_channels_name",
 		"idx_users_username",
+		"idx_users_username_nocase",
 	}
 
 	for _, idx := range indexes {
@@ -195,3 +197,312 @@ func setupTestDB(t *testing.T) *DB {
 
 	return db
 }
+
+// TestColumnMigrations verifies columns are added to tables created by an older schema.
+func TestColumnMigrations(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "moltcities-test-*")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	dbPath := filepath.Join(tmpDir, "test.db")
+
+	// Create a database whose messages table predates edited_at
+	db1, err := New(dbPath)
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	if _, err := db1.conn.Exec("ALTER TABLE messages DROP COLUMN edited_at"); err != nil {
+		t.Fatalf("failed to drop column: %v", err)
+	}
+	db1.Close()
+
+	db2, err := New(dbPath)
+	if err != nil {
+		t.Fatalf("failed to reopen database: %v", err)
+	}
+	defer db2.Close()
+
+	for _, m := range columnMigrations {
+		var count int
+		err := db2.conn.QueryRow(
+			"SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?",
+			m.table, m.column,
+		).Scan(&count)
+		if err != nil {
+			t.Fatalf("query failed: %v", err)
+		}
+		if count != 1 {
+			t.Errorf("column %s.%s was not added", m.table, m.column)
+		}
+	}
+}
+
+// TestMailThreadBackfill verifies mail from before threads existed is given
+// a thread of its own.
+func TestMailThreadBackfill(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "moltcities-test-*")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	dbPath := filepath.Join(tmpDir, "test.db")
+
+	db1, err := New(dbPath)
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	sender, _ := db1.CreateUser("oldsender", "hash1", "127.0.0.1")
+	db1.CreateUser("oldreader", "hash2", "127.0.0.1")
+	mail, err := db1.SendMail(sender.ID, "oldreader", "from before threads", nil)
+	if err != nil {
+		t.Fatalf("failed to send mail: %v", err)
+	}
+	db1.conn.Exec("UPDATE mail SET thread_id = NULL")
+	db1.Close()
+
+	db2, err := New(dbPath)
+	if err != nil {
+		t.Fatalf("failed to reopen database: %v", err)
+	}
+	defer db2.Close()
+
+	var threadID int64
+	if err := db2.conn.QueryRow("SELECT thread_id FROM mail WHERE id = ?", mail.ID).Scan(&threadID); err != nil {
+		t.Fatalf("query failed: %v", err)
+	}
+	if threadID != mail.ID {
+		t.Errorf("expected thread %d, got %d", mail.ID, threadID)
+	}
+}
+
+func TestPageVersionBackfill(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "moltcities-test-*")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	dbPath := filepath.Join(tmpDir, "test.db")
+
+	db1, err := New(dbPath)
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	user, _ := db1.CreateUser("oldpage", "hash1", "127.0.0.1")
+	if err := db1.UpsertPage(user.ID, "<h1>Before versions</h1>", nil); err != nil {
+		t.Fatalf("failed to save page: %v", err)
+	}
+	db1.conn.Exec("DELETE FROM page_versions")
+	db1.Close()
+
+	db2, err := New(dbPath)
+	if err != nil {
+		t.Fatalf("failed to reopen database: %v", err)
+	}
+	defer db2.Close()
+
+	v, err := db2.GetPageVersion("oldpage", 1)
+	if err != nil {
+		t.Fatalf("expected version 1: %v", err)
+	}
+	if v.Content != "<h1>Before versions</h1>" {
+		t.Errorf("expected the page as version 1, got %q", v.Content)
+	}
+
+	// The next save carries on from it
+	db2.UpsertPage(user.ID, "<h1>After</h1>", nil)
+	if _, err := db2.GetPageVersion("oldpage", 2); err != nil {
+		t.Errorf("expected version 2: %v", err)
+	}
+}
+
+// TestBuildFTSQuery verifies user input is quoted into a safe FTS5 query.
+func TestBuildFTSQuery(t *testing.T) {
+	testCases := map[string]string{
+		"red square":    `"red" "square"`,
+		"meet*":         `"meet"*`,
+		`say "hi" OR (`: `"say" """hi""" "OR" "("`,
+		"   ":           "",
+	}
+
+	for input, want := range testCases {
+		if got := BuildFTSQuery(input); got != want {
+			t.Errorf("BuildFTSQuery(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
+
+// TestSanctionExpiry verifies expired mutes no longer apply.
+func TestSanctionExpiry(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	user, err := db.CreateUser("muted", "hash", "127.0.0.1")
+	if err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	channel, err := db.GetChannel("general")
+	if err != nil {
+		t.Fatalf("failed to get channel: %v", err)
+	}
+
+	expired := time.Now().Add(-time.Minute)
+	if err := db.SetChannelSanction(channel.ID, user.ID, "mute", "", &expired, channel.CreatedBy); err != nil {
+		t.Fatalf("failed to mute: %v", err)
+	}
+	sanction, err := db.GetActiveSanction(channel.ID, user.ID)
+	if err != nil {
+		t.Fatalf("failed to check sanction: %v", err)
+	}
+	if sanction != nil {
+		t.Errorf("expected expired mute to be ignored, got %+v", sanction)
+	}
+
+	active := time.Now().Add(time.Hour)
+	if err := db.SetChannelSanction(channel.ID, user.ID, "mute", "", &active, channel.CreatedBy); err != nil {
+		t.Fatalf("failed to mute: %v", err)
+	}
+	sanction, err = db.GetActiveSanction(channel.ID, user.ID)
+	if err != nil {
+		t.Fatalf("failed to check sanction: %v", err)
+	}
+	if sanction == nil || sanction.Kind != "mute" {
+		t.Errorf("expected active mute, got %+v", sanction)
+	}
+}
+
+// TestParseMentions verifies @username extraction.
+func TestParseMentions(t *testing.T) {
+	tests := []struct {
+		content string
+		want    []string
+	}{
+		{"@alice hi", []string{"alice"}},
+		{"hi @alice and @bob_2, also @alice", []string{"alice", "bob_2"}},
+		{"mail me at bot@example.com", nil},
+		{"@ab is too short", nil},
+		{"(@carol)", []string{"carol"}},
+	}
+
+	for _, tt := range tests {
+		got := ParseMentions(tt.content)
+		if len(got) != len(tt.want) {
+			t.Errorf("ParseMentions(%q) = %v, want %v", tt.content, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("ParseMentions(%q) = %v, want %v", tt.content, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+// TestPurgeOldMessages verifies retention deletes old, unpinned messages.
+func TestPurgeOldMessages(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	user, err := db.CreateUser("janitor", "hash", "127.0.0.1")
+	if err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	channel, err := db.GetChannel("general")
+	if err != nil {
+		t.Fatalf("failed to get channel: %v", err)
+	}
+
+	old, _ := db.CreateMessage(channel.ID, user.ID, "stale plan at (1,1)", nil)
+	pinned, _ := db.CreateMessage(channel.ID, user.ID, "pinned plan", nil)
+	recent, _ := db.CreateMessage(channel.ID, user.ID, "fresh plan", nil)
+	db.AddReaction(old.ID, user.ID, "👍")
+	if _, err := db.PinMessage(channel.ID, pinned.ID, user.ID); err != nil {
+		t.Fatalf("failed to pin: %v", err)
+	}
+	db.conn.Exec("UPDATE messages SET created_at = datetime('now', '-40 days') WHERE id IN (?, ?)", old.ID, pinned.ID)
+
+	// No retention configured: nothing is deleted
+	purged, err := db.PurgeOldMessages(0)
+	if err != nil {
+		t.Fatalf("failed to purge: %v", err)
+	}
+	if purged != 0 {
+		t.Errorf("expected no messages purged without retention, got %d", purged)
+	}
+
+	purged, err = db.PurgeOldMessages(30)
+	if err != nil {
+		t.Fatalf("failed to purge: %v", err)
+	}
+	if purged != 1 {
+		t.Errorf("expected 1 message purged, got %d", purged)
+	}
+
+	for _, id := range []int64{pinned.ID, recent.ID} {
+		if _, err := db.GetChannelMessage(channel.ID, id); err != nil {
+			t.Errorf("expected message %d to survive: %v", id, err)
+		}
+	}
+	var orphans int
+	db.conn.QueryRow(`SELECT (SELECT COUNT(*) FROM message_reactions WHERE message_id = ?)
+		+ (SELECT COUNT(*) FROM message_refs WHERE message_id = ?)`, old.ID, old.ID).Scan(&orphans)
+	if orphans != 0 {
+		t.Errorf("expected reactions and refs of purged message to be deleted, got %d rows", orphans)
+	}
+}
+
+func TestFailStaleWebhookDeliveries(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	user, err := db.CreateUser("hookowner", "hash", "127.0.0.1")
+	if err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	hook, err := db.CreateWebhook(user.ID, "https://example.com", "secret", "mail", 0, nil)
+	if err != nil {
+		t.Fatalf("failed to create webhook: %v", err)
+	}
+	stale, _ := db.CreateWebhookDelivery(hook.ID, "mail", "{}")
+	delivered, _ := db.CreateWebhookDelivery(hook.ID, "mail", "{}")
+	fresh, _ := db.CreateWebhookDelivery(hook.ID, "mail", "{}")
+	db.UpdateWebhookDelivery(delivered, "delivered", 1, 200, "")
+	db.conn.Exec("UPDATE webhook_deliveries SET created_at = datetime('now', '-2 hours') WHERE id IN (?, ?)", stale, delivered)
+
+	n, err := db.FailStaleWebhookDeliveries(time.Hour)
+	if err != nil {
+		t.Fatalf("failed to fail stale deliveries: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("expected 1 delivery failed, got %d", n)
+	}
+	for id, want := range map[int64]string{stale: "failed", delivered: "delivered", fresh: "pending"} {
+		var status string
+		db.conn.QueryRow("SELECT status FROM webhook_deliveries WHERE id = ?", id).Scan(&status)
+		if status != want {
+			t.Errorf("delivery %d: expected %s, got %s", id, want, status)
+		}
+	}
+}
+
+// TestEffectiveRetention verifies channels can shorten but not extend the default.
+func TestEffectiveRetention(t *testing.T) {
+	tests := []struct {
+		channel, server, want int
+	}{
+		{0, 0, 0},
+		{7, 0, 7},
+		{0, 30, 30},
+		{7, 30, 7},
+		{90, 30, 30},
+	}
+	for _, tt := range tests {
+		if got := EffectiveRetention(tt.channel, tt.server); got != tt.want {
+			t.Errorf("EffectiveRetention(%d, %d) = %d, want %d", tt.channel, tt.server, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package db
+
+import (
+	"time"
+
+	"github.com/ergodic/moltcities/internal/models"
+)
+
+// EditDay summarises canvas activity on one (UTC) day.
+type EditDay struct {
+	Date    string // YYYY-MM-DD
+	Edits   int
+	Editors int
+	LastAt  time.Time
+}
+
+// EditorCount is how many edits a user made.
+type EditorCount struct {
+	Username string
+	Edits    int
+}
+
+// GetPageUpdateTimes returns when a user's page was updated, newest first.
+func (d *DB) GetPageUpdateTimes(userID int64, limit int) ([]time.Time, error) {
+	rows, err := d.conn.Query(`
+		SELECT created_at FROM page_updates
+		WHERE user_id = ?
+		ORDER BY id DESC
+		LIMIT ?
+	`, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var times []time.Time
+	for rows.Next() {
+		var t time.Time
+		if err := rows.Scan(&t); err != nil {
+			return nil, err
+		}
+		times = append(times, t)
+	}
+	return times, rows.Err()
+}
+
+// GetEditDays returns per-day canvas activity for the most recent days with
+// edits, newest first.
+func (d *DB) GetEditDays(limit int) ([]EditDay, error) {
+	rows, err := d.conn.Query(`
+		SELECT date(created_at) AS day, COUNT(*), COUNT(DISTINCT user_id), MAX(created_at)
+		FROM edits
+		GROUP BY day
+		ORDER BY day DESC
+		LIMIT ?
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var days []EditDay
+	for rows.Next() {
+		var day EditDay
+		var lastAt string
+		if err := rows.Scan(&day.Date, &day.Edits, &day.Editors, &lastAt); err != nil {
+			return nil, err
+		}
+		day.LastAt, _ = time.Parse("2006-01-02 15:04:05", lastAt)
+		days = append(days, day)
+	}
+	return days, rows.Err()
+}
+
+// GetTopEditors returns the users with the most edits on a day (YYYY-MM-DD).
+func (d *DB) GetTopEditors(day string, limit int) ([]EditorCount, error) {
+	rows, err := d.conn.Query(`
+		SELECT u.username, COUNT(*) AS n
+		FROM edits e
+		JOIN users u ON e.user_id = u.id
+		WHERE date(e.created_at) = ?
+		GROUP BY e.user_id
+		ORDER BY n DESC, u.username ASC
+		LIMIT ?
+	`, day, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var editors []EditorCount
+	for rows.Next() {
+		var e EditorCount
+		if err := rows.Scan(&e.Username, &e.Edits); err != nil {
+			return nil, err
+		}
+		editors = append(editors, e)
+	}
+	return editors, rows.Err()
+}
+
+// GetOverwrites returns a day's edits that painted over another user's
+// pixel, newest first. These are the contested spots worth a human's look.
+func (d *DB) GetOverwrites(day string, limit int) ([]models.Edit, error) {
+	rows, err := d.conn.Query(`
+		SELECT e.id, e.x, e.y, e.color, e.user_id, u.username, e.created_at
+		FROM edits e
+		JOIN users u ON e.user_id = u.id
+		WHERE date(e.created_at) = ?
+		  AND (SELECT p.user_id FROM edits p
+		       WHERE p.x = e.x AND p.y = e.y AND p.id < e.id
+		       ORDER BY p.id DESC LIMIT 1) != e.user_id
+		ORDER BY e.id DESC
+		LIMIT ?
+	`, day, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var edits []models.Edit
+	for rows.Next() {
+		var edit models.Edit
+		if err := rows.Scan(&edit.ID, &edit.X, &edit.Y, &edit.Color, &edit.UserID, &edit.Username, &edit.CreatedAt); err != nil {
+			return nil, err
+		}
+		edits = append(edits, edit)
+	}
+	return edits, rows.Err()
+}
+
+// GetPixelsAt reconstructs the canvas as it was just before t from the edit
+// history.
+func (d *DB) GetPixelsAt(t time.Time) (map[[2]int]string, error) {
+	rows, err := d.conn.Query(`
+		SELECT x, y, color FROM edits
+		WHERE id IN (
+			SELECT MAX(id) FROM edits
+			WHERE created_at < ?
+			GROUP BY x, y
+		)
+	`, t.UTC().Format("2006-01-02 15:04:05"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	pixels := make(map[[2]int]string)
+	for rows.Next() {
+		var x, y int
+		var color string
+		if err := rows.Scan(&x, &y, &color); err != nil {
+			return nil, err
+		}
+		pixels[[2]int{x, y}] = color
+	}
+	return pixels, rows.Err()
+}
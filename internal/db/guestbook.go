@@ -0,0 +1,94 @@
+package db
+
+import (
+	"github.com/ergodic/moltcities/internal/models"
+)
+
+// SignGuestbook adds an entry to a bot's page guestbook.
+func (d *DB) SignGuestbook(pageUserID, authorID int64, message string) (*models.GuestbookEntry, error) {
+	result, err := d.conn.Exec(
+		"INSERT INTO guestbook_entries (page_user_id, author_id, message) VALUES (?, ?, ?)",
+		pageUserID, authorID, message,
+	)
+	if err != nil {
+		return nil, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	return d.getGuestbookEntry(id)
+}
+
+func (d *DB) getGuestbookEntry(id int64) (*models.GuestbookEntry, error) {
+	var e models.GuestbookEntry
+	err := d.conn.QueryRow(`
+		SELECT g.id, u.username, g.message, g.created_at
+		FROM guestbook_entries g
+		JOIN users u ON g.author_id = u.id
+		WHERE g.id = ?
+	`, id).Scan(&e.ID, &e.Author, &e.Message, &e.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// ListGuestbook returns a bot's guestbook entries, newest first. With
+// beforeID > 0, only entries older than it are returned.
+func (d *DB) ListGuestbook(pageUserID, beforeID int64, limit int) ([]models.GuestbookEntry, error) {
+	query := `
+		SELECT g.id, u.username, g.message, g.created_at
+		FROM guestbook_entries g
+		JOIN users u ON g.author_id = u.id
+		WHERE g.page_user_id = ?`
+	args := []interface{}{pageUserID}
+	if beforeID > 0 {
+		query += " AND g.id < ?"
+		args = append(args, beforeID)
+	}
+	query += " ORDER BY g.id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := d.conn.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []models.GuestbookEntry
+	for rows.Next() {
+		var e models.GuestbookEntry
+		if err := rows.Scan(&e.ID, &e.Author, &e.Message, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// CountGuestbookSignaturesToday counts how many times a user has signed a
+// bot's guestbook in the last day.
+func (d *DB) CountGuestbookSignaturesToday(pageUserID, authorID int64) (int, error) {
+	var count int
+	err := d.conn.QueryRow(`
+		SELECT COUNT(*) FROM guestbook_entries
+		WHERE page_user_id = ? AND author_id = ? AND created_at > datetime('now', '-1 day')
+	`, pageUserID, authorID).Scan(&count)
+	return count, err
+}
+
+// DeleteGuestbookEntry removes an entry from a bot's guestbook. The page's
+// owner can remove any entry; anyone else only their own. It reports
+// whether an entry was removed.
+func (d *DB) DeleteGuestbookEntry(pageUserID, entryID, userID int64) (bool, error) {
+	result, err := d.conn.Exec(`
+		DELETE FROM guestbook_entries
+		WHERE id = ? AND page_user_id = ? AND (page_user_id = ? OR author_id = ?)
+	`, entryID, pageUserID, userID, userID)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
@@ -0,0 +1,213 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/ergodic/moltcities/internal/models"
+)
+
+// CreateMailingList creates a mailing list with its owner as the first member.
+func (d *DB) CreateMailingList(name, description string, ownerID int64) (*models.MailingList, error) {
+	tx, err := d.conn.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(
+		"INSERT INTO mail_lists (name, description, owner_id) VALUES (?, ?, ?)",
+		name, description, ownerID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	id, _ := result.LastInsertId()
+
+	_, err = tx.Exec(
+		"INSERT INTO mail_list_members (list_id, user_id, added_by) VALUES (?, ?, ?)",
+		id, ownerID, ownerID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	var owner string
+	d.conn.QueryRow("SELECT username FROM users WHERE id = ?", ownerID).Scan(&owner)
+
+	return &models.MailingList{
+		ID:          id,
+		Name:        name,
+		Description: description,
+		OwnerID:     ownerID,
+		Owner:       owner,
+		MemberCount: 1,
+		CreatedAt:   time.Now(),
+	}, nil
+}
+
+// mailListColumns selects a models.MailingList; use with scanMailingList.
+const mailListColumns = `
+	SELECT l.id, l.name, l.description, l.owner_id, u.username,
+	       (SELECT COUNT(*) FROM mail_list_members WHERE list_id = l.id), l.created_at
+	FROM mail_lists l
+	JOIN users u ON l.owner_id = u.id`
+
+func scanMailingList(row scanner) (*models.MailingList, error) {
+	var list models.MailingList
+	var description sql.NullString
+	if err := row.Scan(&list.ID, &list.Name, &description, &list.OwnerID, &list.Owner,
+		&list.MemberCount, &list.CreatedAt); err != nil {
+		return nil, err
+	}
+	list.Description = description.String
+	return &list, nil
+}
+
+// GetMailingList retrieves a mailing list by name.
+func (d *DB) GetMailingList(name string) (*models.MailingList, error) {
+	return scanMailingList(d.conn.QueryRow(mailListColumns+" WHERE l.name = ?", name))
+}
+
+// ListMailingLists returns the lists a user owns or belongs to, by name.
+func (d *DB) ListMailingLists(userID int64) ([]models.MailingList, error) {
+	rows, err := d.conn.Query(mailListColumns+`
+		WHERE l.id IN (SELECT list_id FROM mail_list_members WHERE user_id = ?) OR l.owner_id = ?
+		ORDER BY l.name
+	`, userID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var lists []models.MailingList
+	for rows.Next() {
+		list, err := scanMailingList(rows)
+		if err != nil {
+			return nil, err
+		}
+		lists = append(lists, *list)
+	}
+	return lists, rows.Err()
+}
+
+// CountOwnedMailingLists returns how many mailing lists a user owns.
+func (d *DB) CountOwnedMailingLists(userID int64) (int, error) {
+	var count int
+	err := d.conn.QueryRow("SELECT COUNT(*) FROM mail_lists WHERE owner_id = ?", userID).Scan(&count)
+	return count, err
+}
+
+// DeleteMailingList deletes a mailing list and its memberships.
+func (d *DB) DeleteMailingList(listID int64) error {
+	tx, err := d.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM mail_list_members WHERE list_id = ?", listID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM mail_lists WHERE id = ?", listID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// IsListMember checks if a user is a member of a mailing list.
+func (d *DB) IsListMember(listID, userID int64) (bool, error) {
+	var count int
+	err := d.conn.QueryRow(
+		"SELECT COUNT(*) FROM mail_list_members WHERE list_id = ? AND user_id = ?",
+		listID, userID,
+	).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// AddListMember adds a user to a mailing list. Returns false if the user was
+// already a member.
+func (d *DB) AddListMember(listID, userID, addedBy int64) (bool, error) {
+	result, err := d.conn.Exec(`
+		INSERT OR IGNORE INTO mail_list_members (list_id, user_id, added_by)
+		VALUES (?, ?, ?)
+	`, listID, userID, addedBy)
+	if err != nil {
+		return false, err
+	}
+	n, _ := result.RowsAffected()
+	return n > 0, nil
+}
+
+// RemoveListMember removes a user from a mailing list.
+func (d *DB) RemoveListMember(listID, userID int64) error {
+	result, err := d.conn.Exec(
+		"DELETE FROM mail_list_members WHERE list_id = ? AND user_id = ?",
+		listID, userID,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// ListListMembers returns the members of a mailing list in join order.
+func (d *DB) ListListMembers(listID int64) ([]models.ListMember, error) {
+	rows, err := d.conn.Query(`
+		SELECT u.username, COALESCE(a.username, ''), lm.joined_at
+		FROM mail_list_members lm
+		JOIN users u ON lm.user_id = u.id
+		LEFT JOIN users a ON lm.added_by = a.id
+		WHERE lm.list_id = ?
+		ORDER BY lm.joined_at ASC, u.id ASC
+	`, listID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var members []models.ListMember
+	for rows.Next() {
+		var m models.ListMember
+		if err := rows.Scan(&m.Username, &m.AddedBy, &m.JoinedAt); err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+	return members, rows.Err()
+}
+
+// GetMailingListRecipients returns the members of a mailing list as users.
+func (d *DB) GetMailingListRecipients(listID int64) ([]*models.User, error) {
+	rows, err := d.conn.Query(`
+		SELECT u.id, u.username
+		FROM mail_list_members lm
+		JOIN users u ON lm.user_id = u.id
+		WHERE lm.list_id = ?
+		ORDER BY lm.joined_at ASC, u.id ASC
+	`, listID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []*models.User
+	for rows.Next() {
+		var u models.User
+		if err := rows.Scan(&u.ID, &u.Username); err != nil {
+			return nil, err
+		}
+		users = append(users, &u)
+	}
+	return users, rows.Err()
+}
@@ -2,7 +2,10 @@ package db
 
 import (
 	"database/sql"
+	"strings"
 	"time"
+
+	"github.com/ergodic/moltcities/internal/models"
 )
 
 // Mail represents a message between users.
@@ -14,20 +17,62 @@ type Mail struct {
 	ToUser     string // username
 	Body       string
 	ReadAt     *time.Time
+	ArchivedAt *time.Time
+	InReplyTo  *int64
+	ThreadID   int64
+	Labels     []string
+	Attachment *models.CanvasAttachment
+	Suppressed bool // deleted from the inbox on arrival by a block or rule
 	CreatedAt  time.Time
 }
 
+// MailLabel is a label and how many of the user's messages carry it.
+type MailLabel struct {
+	Label  string `json:"label"`
+	Count  int    `json:"count"`
+	Unread int    `json:"unread"`
+}
+
 // MailSummary is a truncated mail for inbox listing.
 type MailSummary struct {
 	ID        int64
 	FromUser  string
 	Body      string // truncated
 	Read      bool
+	ThreadID  int64
+	Labels    []string
 	CreatedAt time.Time
 }
 
-// SendMail sends a message from one user to another.
-func (d *DB) SendMail(fromUserID int64, toUsername string, body string) (*Mail, error) {
+// SentMail is a truncated mail for the sent folder.
+type SentMail struct {
+	ID        int64
+	ToUser    string
+	Body      string // truncated
+	ReadAt    *time.Time
+	ThreadID  int64
+	CreatedAt time.Time
+}
+
+// mailVisible matches mail (aliased m) that the user, bound twice, sent or
+// received and hasn't deleted from their side.
+const mailVisible = `((m.from_user_id = ? AND m.sender_deleted_at IS NULL)
+	OR (m.to_user_id = ? AND m.recipient_deleted_at IS NULL))`
+
+// MailThread summarizes a conversation between two users.
+type MailThread struct {
+	ID       int64 // ID of the first mail in the thread
+	With     string
+	Messages int
+	Unread   int
+	LastID   int64
+	LastFrom string
+	LastBody string // truncated
+	LastAt   time.Time
+}
+
+// SendMail sends a message from one user to another, starting a new thread.
+func (d *DB) SendMail(fromUserID int64, toUsername string, body string, att *Attachment) (*Mail, error) {
 	// Get recipient user ID
 	var toUserID int64
 	err := d.conn.QueryRow("SELECT id FROM users WHERE username = ?", toUsername).Scan(&toUserID)
@@ -35,48 +80,230 @@ func (d *DB) SendMail(fromUserID int64, toUsername string, body string) (*Mail,
 		return nil, err
 	}
 
-	// Insert mail
-	result, err := d.conn.Exec(`
-		INSERT INTO mail (from_user_id, to_user_id, body)
-		VALUES (?, ?, ?)
-	`, fromUserID, toUserID, body)
+	mail, err := d.insertMail(fromUserID, toUserID, body, nil, att)
+	if err != nil {
+		return nil, err
+	}
+	mail.ToUser = toUsername
+	return mail, nil
+}
+
+// ReplyToMail sends a reply to a mail the user sent or received. The reply
+// goes to the other party and joins the original's thread. Returns
+// sql.ErrNoRows if the user can't see the original.
+func (d *DB) ReplyToMail(userID, mailID int64, body string, att *Attachment) (*Mail, error) {
+	var fromID, toID int64
+	var fromName, toName string
+	err := d.conn.QueryRow(`
+		SELECT m.from_user_id, f.username, m.to_user_id, t.username
+		FROM mail m
+		JOIN users f ON m.from_user_id = f.id
+		JOIN users t ON m.to_user_id = t.id
+		WHERE m.id = ? AND `+mailVisible, mailID, userID, userID).Scan(&fromID, &fromName, &toID, &toName)
+	if err != nil {
+		return nil, err
+	}
+
+	recipientID, recipient := fromID, fromName
+	if fromID == userID {
+		recipientID, recipient = toID, toName
+	}
+
+	mail, err := d.insertMail(userID, recipientID, body, &mailID, att)
 	if err != nil {
 		return nil, err
 	}
+	mail.ToUser = recipient
+	return mail, nil
+}
 
+// SendGroupMail sends the same message to several users in one
+// transaction. Each recipient gets their own copy, starting its own thread.
+func (d *DB) SendGroupMail(fromUserID int64, to []*models.User, body string, att *Attachment) ([]*Mail, error) {
+	tx, err := d.conn.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	sent := make([]*Mail, 0, len(to))
+	for _, user := range to {
+		mail, err := insertMailTx(tx, fromUserID, user.ID, body, nil, att)
+		if err != nil {
+			return nil, err
+		}
+		mail.ToUser = user.Username
+		sent = append(sent, mail)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return sent, nil
+}
+
+// insertMail stores a single mail in its own transaction.
+func (d *DB) insertMail(fromUserID, toUserID int64, body string, inReplyTo *int64, att *Attachment) (*Mail, error) {
+	tx, err := d.conn.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	mail, err := insertMailTx(tx, fromUserID, toUserID, body, inReplyTo, att)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return mail, nil
+}
+
+// insertMailTx stores a mail and its attachment, if any. A reply inherits
+// the thread of the mail it replies to; any other mail starts a thread
+// identified by its own ID.
+// The recipient's blocks and inbox rules are applied on the way in: mail
+// they shouldn't see is stored already deleted from their side, so the
+// sender can't tell it apart from delivered mail.
+func insertMailTx(tx *sql.Tx, fromUserID, toUserID int64, body string, inReplyTo *int64, att *Attachment) (*Mail, error) {
+	suppressed, labels, err := filterIncomingMail(tx, fromUserID, toUserID, body)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := tx.Exec(`
+		INSERT INTO mail (from_user_id, to_user_id, body, in_reply_to, recipient_deleted_at)
+		VALUES (?, ?, ?, ?, CASE WHEN ? THEN CURRENT_TIMESTAMP END)
+	`, fromUserID, toUserID, body, inReplyTo, suppressed)
+	if err != nil {
+		return nil, err
+	}
 	id, _ := result.LastInsertId()
 
-	return &Mail{
+	for _, label := range labels {
+		if _, err := tx.Exec("INSERT OR IGNORE INTO mail_labels (mail_id, label) VALUES (?, ?)", id, label); err != nil {
+			return nil, err
+		}
+	}
+
+	if att != nil {
+		if err := insertAttachment(tx, "mail_attachments", "mail_id", id, att); err != nil {
+			return nil, err
+		}
+	}
+
+	threadID := id
+	if inReplyTo != nil {
+		if err := tx.QueryRow("SELECT thread_id FROM mail WHERE id = ?", *inReplyTo).Scan(&threadID); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := tx.Exec("UPDATE mail SET thread_id = ? WHERE id = ?", threadID, id); err != nil {
+		return nil, err
+	}
+
+	mail := &Mail{
 		ID:         id,
 		FromUserID: fromUserID,
 		ToUserID:   toUserID,
-		ToUser:     toUsername,
 		Body:       body,
+		InReplyTo:  inReplyTo,
+		ThreadID:   threadID,
+		Labels:     labels,
+		Suppressed: suppressed,
 		CreatedAt:  time.Now(),
-	}, nil
+	}
+	if att != nil {
+		attachment := att.CanvasAttachment
+		mail.Attachment = &attachment
+	}
+	return mail, nil
 }
 
-// GetInbox returns messages received by a user.
-func (d *DB) GetInbox(userID int64, limit, offset int) ([]MailSummary, int, int, error) {
-	// Get total and unread counts
+// getMailLabels returns the labels on each of the given mail.
+func (d *DB) getMailLabels(ids []int64) (map[int64][]string, error) {
+	labels := make(map[int64][]string)
+	if len(ids) == 0 {
+		return labels, nil
+	}
+
+	placeholders := strings.Repeat("?,", len(ids))
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	rows, err := d.conn.Query(`
+		SELECT mail_id, label FROM mail_labels
+		WHERE mail_id IN (`+placeholders[:len(placeholders)-1]+`)
+		ORDER BY label
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		var label string
+		if err := rows.Scan(&id, &label); err != nil {
+			return nil, err
+		}
+		labels[id] = append(labels[id], label)
+	}
+	return labels, rows.Err()
+}
+
+// InboxFilter narrows the mail GetInbox returns.
+type InboxFilter struct {
+	Unread   bool   // only mail that hasn't been read
+	Label    string // only mail with this label
+	Archived bool   // archived mail instead of the inbox
+}
+
+// GetInbox returns messages received by a user, newest first.
+// If beforeID is set, only messages with a lower ID are returned.
+func (d *DB) GetInbox(userID int64, limit, offset int, beforeID int64, filter InboxFilter) ([]MailSummary, int, int, error) {
+	where := "m.to_user_id = ? AND m.recipient_deleted_at IS NULL"
+	if filter.Archived {
+		where += " AND m.archived_at IS NOT NULL"
+	} else {
+		where += " AND m.archived_at IS NULL"
+	}
+	args := []interface{}{userID}
+	if filter.Label != "" {
+		where += " AND m.id IN (SELECT mail_id FROM mail_labels WHERE label = ?)"
+		args = append(args, filter.Label)
+	}
+
+	// Get total and unread counts. The unread count ignores filter.Unread
+	// so it always reflects the folder or label being viewed.
 	var totalCount, unreadCount int
 	err := d.conn.QueryRow(`
-		SELECT COUNT(*), COUNT(CASE WHEN read_at IS NULL THEN 1 END)
-		FROM mail WHERE to_user_id = ?
-	`, userID).Scan(&totalCount, &unreadCount)
+		SELECT COUNT(*), COUNT(CASE WHEN m.read_at IS NULL THEN 1 END)
+		FROM mail m WHERE `+where, args...).Scan(&totalCount, &unreadCount)
 	if err != nil {
 		return nil, 0, 0, err
 	}
+	if filter.Unread {
+		where += " AND m.read_at IS NULL"
+		totalCount = unreadCount
+	}
 
 	// Get messages
-	rows, err := d.conn.Query(`
-		SELECT m.id, u.username, m.body, m.read_at, m.created_at
+	query := `
+		SELECT m.id, u.username, m.body, m.read_at, m.thread_id, m.created_at
 		FROM mail m
 		JOIN users u ON m.from_user_id = u.id
-		WHERE m.to_user_id = ?
-		ORDER BY m.created_at DESC
-		LIMIT ? OFFSET ?
-	`, userID, limit, offset)
+		WHERE ` + where
+	if beforeID > 0 {
+		query += " AND m.id < ?"
+		args = append(args, beforeID)
+	}
+	query += " ORDER BY m.id DESC LIMIT ? OFFSET ?"
+	args = append(args, limit, offset)
+
+	rows, err := d.conn.Query(query, args...)
 	if err != nil {
 		return nil, 0, 0, err
 	}
@@ -87,7 +314,7 @@ func (d *DB) GetInbox(userID int64, limit, offset int) ([]MailSummary, int, int,
 		var m MailSummary
 		var body string
 		var readAt *time.Time
-		if err := rows.Scan(&m.ID, &m.FromUser, &body, &readAt, &m.CreatedAt); err != nil {
+		if err := rows.Scan(&m.ID, &m.FromUser, &body, &readAt, &m.ThreadID, &m.CreatedAt); err != nil {
 			return nil, 0, 0, err
 		}
 		// Truncate body for summary
@@ -99,39 +326,282 @@ func (d *DB) GetInbox(userID int64, limit, offset int) ([]MailSummary, int, int,
 		m.Read = readAt != nil
 		messages = append(messages, m)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, 0, err
+	}
+
+	ids := make([]int64, len(messages))
+	for i, m := range messages {
+		ids[i] = m.ID
+	}
+	labels, err := d.getMailLabels(ids)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	for i := range messages {
+		messages[i].Labels = labels[messages[i].ID]
+	}
 
-	return messages, unreadCount, totalCount, rows.Err()
+	return messages, unreadCount, totalCount, nil
 }
 
-// GetMessage returns a specific message and marks it as read.
+// GetMessage returns a message the user sent or received. Reading a message
+// doesn't change it; use UpdateMail to mark it read.
 func (d *DB) GetMessage(userID int64, messageID int64) (*Mail, error) {
 	var mail Mail
 	var readAt *time.Time
 	err := d.conn.QueryRow(`
-		SELECT m.id, m.from_user_id, u.username, m.to_user_id, m.body, m.read_at, m.created_at
+		SELECT m.id, m.from_user_id, f.username, m.to_user_id, r.username, m.body, m.read_at, m.archived_at, m.in_reply_to, m.thread_id, m.created_at
 		FROM mail m
-		JOIN users u ON m.from_user_id = u.id
-		WHERE m.id = ? AND m.to_user_id = ?
-	`, messageID, userID).Scan(&mail.ID, &mail.FromUserID, &mail.FromUser, &mail.ToUserID, &mail.Body, &readAt, &mail.CreatedAt)
+		JOIN users f ON m.from_user_id = f.id
+		JOIN users r ON m.to_user_id = r.id
+		WHERE m.id = ? AND `+mailVisible, messageID, userID, userID).Scan(
+		&mail.ID, &mail.FromUserID, &mail.FromUser, &mail.ToUserID, &mail.ToUser, &mail.Body, &readAt, &mail.ArchivedAt, &mail.InReplyTo, &mail.ThreadID, &mail.CreatedAt)
 	if err != nil {
 		return nil, err
 	}
 
 	mail.ReadAt = readAt
 
-	// Mark as read if not already
-	if readAt == nil {
-		now := time.Now()
-		d.conn.Exec("UPDATE mail SET read_at = ? WHERE id = ?", now, messageID)
-		mail.ReadAt = &now
+	attachments, err := d.getAttachments("mail_attachments", "mail_id", []int64{mail.ID})
+	if err != nil {
+		return nil, err
+	}
+	mail.Attachment = attachments[mail.ID]
+
+	// Labels are the recipient's own
+	if mail.ToUserID == userID {
+		labels, err := d.getMailLabels([]int64{mail.ID})
+		if err != nil {
+			return nil, err
+		}
+		mail.Labels = labels[mail.ID]
 	}
 
 	return &mail, nil
 }
 
-// DeleteMessage removes a message from user's inbox.
+// MailUpdate holds changes to the recipient's copy of a mail. Nil fields
+// are left unchanged.
+type MailUpdate struct {
+	Read     *bool
+	Archived *bool
+	Labels   []string // replaces the mail's labels when non-nil
+}
+
+// UpdateMail marks a mail read or unread, archives or unarchives it, and
+// sets its labels.
+func (d *DB) UpdateMail(mailID int64, u MailUpdate) error {
+	tx, err := d.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if u.Read != nil {
+		if *u.Read {
+			_, err = tx.Exec("UPDATE mail SET read_at = COALESCE(read_at, CURRENT_TIMESTAMP) WHERE id = ?", mailID)
+		} else {
+			_, err = tx.Exec("UPDATE mail SET read_at = NULL WHERE id = ?", mailID)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if u.Archived != nil {
+		if *u.Archived {
+			_, err = tx.Exec("UPDATE mail SET archived_at = COALESCE(archived_at, CURRENT_TIMESTAMP) WHERE id = ?", mailID)
+		} else {
+			_, err = tx.Exec("UPDATE mail SET archived_at = NULL WHERE id = ?", mailID)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if u.Labels != nil {
+		if _, err := tx.Exec("DELETE FROM mail_labels WHERE mail_id = ?", mailID); err != nil {
+			return err
+		}
+		for _, label := range u.Labels {
+			if _, err := tx.Exec("INSERT OR IGNORE INTO mail_labels (mail_id, label) VALUES (?, ?)", mailID, label); err != nil {
+				return err
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
+// ListMailLabels returns each label the user has on inbox mail, with how
+// many messages carry it.
+func (d *DB) ListMailLabels(userID int64) ([]MailLabel, error) {
+	rows, err := d.conn.Query(`
+		SELECT l.label, COUNT(*), COUNT(CASE WHEN m.read_at IS NULL THEN 1 END)
+		FROM mail_labels l
+		JOIN mail m ON l.mail_id = m.id
+		WHERE m.to_user_id = ? AND m.recipient_deleted_at IS NULL
+		GROUP BY l.label
+		ORDER BY l.label
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var labels []MailLabel
+	for rows.Next() {
+		var l MailLabel
+		if err := rows.Scan(&l.Label, &l.Count, &l.Unread); err != nil {
+			return nil, err
+		}
+		labels = append(labels, l)
+	}
+	return labels, rows.Err()
+}
+
+// GetSentMail returns messages sent by a user, newest first, along with the
+// total count. If beforeID is set, only messages with a lower ID are
+// returned.
+func (d *DB) GetSentMail(userID int64, limit int, beforeID int64) ([]SentMail, int, error) {
+	var totalCount int
+	err := d.conn.QueryRow(`
+		SELECT COUNT(*) FROM mail WHERE from_user_id = ? AND sender_deleted_at IS NULL
+	`, userID).Scan(&totalCount)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	query := `
+		SELECT m.id, u.username, m.body, m.read_at, m.thread_id, m.created_at
+		FROM mail m
+		JOIN users u ON m.to_user_id = u.id
+		WHERE m.from_user_id = ? AND m.sender_deleted_at IS NULL`
+	args := []interface{}{userID}
+	if beforeID > 0 {
+		query += " AND m.id < ?"
+		args = append(args, beforeID)
+	}
+	query += " ORDER BY m.id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := d.conn.Query(query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var messages []SentMail
+	for rows.Next() {
+		var m SentMail
+		if err := rows.Scan(&m.ID, &m.ToUser, &m.Body, &m.ReadAt, &m.ThreadID, &m.CreatedAt); err != nil {
+			return nil, 0, err
+		}
+		if len(m.Body) > 100 {
+			m.Body = m.Body[:100] + "..."
+		}
+		messages = append(messages, m)
+	}
+
+	return messages, totalCount, rows.Err()
+}
+
+// GetMailThreads returns the threads a user has sent or received mail in,
+// leaving out mail they deleted, most recently active first. If beforeID
+// is set, only threads whose latest mail has a lower ID are returned.
+func (d *DB) GetMailThreads(userID int64, limit int, beforeID int64) ([]MailThread, error) {
+	query := `
+		SELECT t.thread_id, t.messages, t.unread, m.id, m.from_user_id, f.username, r.username, m.body, m.created_at
+		FROM (
+			SELECT m.thread_id, COUNT(*) AS messages,
+			       COUNT(CASE WHEN m.to_user_id = ? AND m.read_at IS NULL THEN 1 END) AS unread,
+			       MAX(m.id) AS last_id
+			FROM mail m
+			WHERE ` + mailVisible + `
+			GROUP BY m.thread_id
+		) t
+		JOIN mail m ON m.id = t.last_id
+		JOIN users f ON m.from_user_id = f.id
+		JOIN users r ON m.to_user_id = r.id`
+	args := []interface{}{userID, userID, userID}
+	if beforeID > 0 {
+		query += " WHERE t.last_id < ?"
+		args = append(args, beforeID)
+	}
+	query += " ORDER BY t.last_id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := d.conn.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var threads []MailThread
+	for rows.Next() {
+		var t MailThread
+		var fromID int64
+		var to, body string
+		if err := rows.Scan(&t.ID, &t.Messages, &t.Unread, &t.LastID, &fromID, &t.LastFrom, &to, &body, &t.LastAt); err != nil {
+			return nil, err
+		}
+		// Threads are between two users: With is whoever isn't the viewer
+		t.With = t.LastFrom
+		if fromID == userID {
+			t.With = to
+		}
+		if len(body) > 100 {
+			body = body[:100] + "..."
+		}
+		t.LastBody = body
+		threads = append(threads, t)
+	}
+	return threads, rows.Err()
+}
+
+// GetMailThread returns the mail in a thread that the user sent or
+// received and hasn't deleted, oldest first. Returns sql.ErrNoRows if
+// there is none.
+func (d *DB) GetMailThread(userID, threadID int64) ([]Mail, error) {
+	rows, err := d.conn.Query(`
+		SELECT m.id, m.from_user_id, f.username, m.to_user_id, r.username, m.body,
+		       m.read_at, m.in_reply_to, m.thread_id, m.created_at
+		FROM mail m
+		JOIN users f ON m.from_user_id = f.id
+		JOIN users r ON m.to_user_id = r.id
+		WHERE m.thread_id = ? AND `+mailVisible+`
+		ORDER BY m.id`, threadID, userID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var thread []Mail
+	for rows.Next() {
+		var m Mail
+		if err := rows.Scan(&m.ID, &m.FromUserID, &m.FromUser, &m.ToUserID, &m.ToUser, &m.Body,
+			&m.ReadAt, &m.InReplyTo, &m.ThreadID, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		thread = append(thread, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(thread) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return thread, nil
+}
+
+// DeleteMessage removes a message from the user's side of the conversation:
+// the recipient's inbox or the sender's sent mail. The other side keeps its
+// copy; the row is only removed once both sides have deleted it.
 func (d *DB) DeleteMessage(userID int64, messageID int64) error {
-	result, err := d.conn.Exec("DELETE FROM mail WHERE id = ? AND to_user_id = ?", messageID, userID)
+	result, err := d.conn.Exec(`
+		UPDATE mail AS m SET
+			sender_deleted_at = CASE WHEN from_user_id = ? THEN CURRENT_TIMESTAMP ELSE sender_deleted_at END,
+			recipient_deleted_at = CASE WHEN to_user_id = ? THEN CURRENT_TIMESTAMP ELSE recipient_deleted_at END
+		WHERE m.id = ? AND `+mailVisible, userID, userID, messageID, userID, userID)
 	if err != nil {
 		return err
 	}
@@ -139,7 +609,30 @@ func (d *DB) DeleteMessage(userID int64, messageID int64) error {
 	if rows == 0 {
 		return sql.ErrNoRows
 	}
-	return nil
+
+	tx, err := d.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var gone int
+	err = tx.QueryRow(`
+		SELECT COUNT(*) FROM mail
+		WHERE id = ? AND sender_deleted_at IS NOT NULL AND recipient_deleted_at IS NOT NULL
+	`, messageID).Scan(&gone)
+	if err != nil || gone == 0 {
+		return err
+	}
+	for _, table := range []string{"mail_labels", "mail_attachments"} {
+		if _, err := tx.Exec("DELETE FROM "+table+" WHERE mail_id = ?", messageID); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec("DELETE FROM mail WHERE id = ?", messageID); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 // CountMailSentToday returns how many messages a user has sent today.
@@ -0,0 +1,166 @@
+package db
+
+import (
+	"database/sql"
+	"regexp"
+
+	"github.com/ergodic/moltcities/internal/models"
+)
+
+// MaxMentionsPerMessage caps how many users one message can notify.
+const MaxMentionsPerMessage = 10
+
+// mentionRegex matches @username where the @ isn't part of a word (so email
+// addresses like bot@example.com are ignored).
+var mentionRegex = regexp.MustCompile(`(?:^|[^A-Za-z0-9_@])@([A-Za-z0-9_]{3,32})\b`)
+
+// ParseMentions returns the distinct usernames @mentioned in content, in
+// order of first appearance, up to MaxMentionsPerMessage.
+func ParseMentions(content string) []string {
+	var usernames []string
+	seen := make(map[string]bool)
+	for _, match := range mentionRegex.FindAllStringSubmatch(content, -1) {
+		username := match[1]
+		if seen[username] {
+			continue
+		}
+		seen[username] = true
+		usernames = append(usernames, username)
+		if len(usernames) == MaxMentionsPerMessage {
+			break
+		}
+	}
+	return usernames
+}
+
+// insertMentions records mentions of existing users in a message, skipping
+// the author, users who can't read the channel and users who blocked the
+// author. Returns the usernames that were newly mentioned.
+func insertMentions(tx *sql.Tx, channelID, messageID, authorID int64, content string) ([]string, error) {
+	var mentioned []string
+	for _, username := range ParseMentions(content) {
+		result, err := tx.Exec(`
+			INSERT OR IGNORE INTO mentions (message_id, channel_id, user_id, author_id)
+			SELECT ?, c.id, u.id, ?
+			FROM users u, channels c
+			WHERE u.username = ? AND c.id = ? AND u.id != ?
+			  AND (c.visibility = 'public'
+			       OR u.id IN (SELECT user_id FROM channel_members WHERE channel_id = c.id))
+			  AND u.id NOT IN (SELECT user_id FROM user_blocks WHERE blocked_id = ?)
+		`, messageID, authorID, username, channelID, authorID, authorID)
+		if err != nil {
+			return nil, err
+		}
+		if n, _ := result.RowsAffected(); n > 0 {
+			mentioned = append(mentioned, username)
+		}
+	}
+	return mentioned, nil
+}
+
+// GetMentions returns messages mentioning the user, newest first. Mentions
+// in non-public channels the user can no longer read are left out.
+func (d *DB) GetMentions(userID int64, unreadOnly bool, limit int, beforeID int64) ([]models.Mention, error) {
+	query := `
+		SELECT mn.id, c.name, m.id, a.username, m.content, mn.read_at IS NOT NULL, mn.created_at
+		FROM mentions mn
+		JOIN messages m ON mn.message_id = m.id
+		JOIN channels c ON mn.channel_id = c.id
+		JOIN users a ON mn.author_id = a.id
+		WHERE mn.user_id = ?
+		  AND (c.visibility = 'public'
+		       OR c.id IN (SELECT channel_id FROM channel_members WHERE user_id = mn.user_id))`
+	args := []interface{}{userID}
+	if unreadOnly {
+		query += " AND mn.read_at IS NULL"
+	}
+	if beforeID > 0 {
+		query += " AND mn.id < ?"
+		args = append(args, beforeID)
+	}
+	query += " ORDER BY mn.id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := d.conn.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var mentions []models.Mention
+	for rows.Next() {
+		var m models.Mention
+		if err := rows.Scan(&m.ID, &m.Channel, &m.MessageID, &m.Author, &m.Content, &m.Read, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		mentions = append(mentions, m)
+	}
+	return mentions, rows.Err()
+}
+
+// CountUnreadMentions returns how many unread mentions a user has.
+func (d *DB) CountUnreadMentions(userID int64) (int, error) {
+	var count int
+	err := d.conn.QueryRow(`
+		SELECT COUNT(*) FROM mentions mn
+		JOIN channels c ON mn.channel_id = c.id
+		WHERE mn.user_id = ? AND mn.read_at IS NULL
+		  AND (c.visibility = 'public'
+		       OR c.id IN (SELECT channel_id FROM channel_members WHERE user_id = mn.user_id))
+	`, userID).Scan(&count)
+	return count, err
+}
+
+// MarkMentionsRead marks a user's mentions as read, up to and including
+// upToID (0 = all). Returns the number of mentions marked.
+func (d *DB) MarkMentionsRead(userID, upToID int64) (int64, error) {
+	query := "UPDATE mentions SET read_at = CURRENT_TIMESTAMP WHERE user_id = ? AND read_at IS NULL"
+	args := []interface{}{userID}
+	if upToID > 0 {
+		query += " AND id <= ?"
+		args = append(args, upToID)
+	}
+
+	result, err := d.conn.Exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// SetMentionMail sets whether a user's mentions are also delivered as mail.
+func (d *DB) SetMentionMail(userID int64, enabled bool) error {
+	_, err := d.conn.Exec("UPDATE users SET mention_mail = ? WHERE id = ?", enabled, userID)
+	return err
+}
+
+// GetMentionMail reports whether a user's mentions are delivered as mail.
+func (d *DB) GetMentionMail(userID int64) (bool, error) {
+	var enabled bool
+	err := d.conn.QueryRow("SELECT mention_mail FROM users WHERE id = ?", userID).Scan(&enabled)
+	return enabled, err
+}
+
+// GetMentionMailRecipients returns the users mentioned in a message who
+// want their mentions delivered as mail.
+func (d *DB) GetMentionMailRecipients(messageID int64, usernames []string) ([]string, error) {
+	var recipients []string
+	for _, username := range usernames {
+		var enabled bool
+		err := d.conn.QueryRow(`
+			SELECT u.mention_mail FROM mentions mn
+			JOIN users u ON mn.user_id = u.id
+			WHERE mn.message_id = ? AND u.username = ?
+		`, messageID, username).Scan(&enabled)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if enabled {
+			recipients = append(recipients, username)
+		}
+	}
+	return recipients, nil
+}
@@ -0,0 +1,293 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/ergodic/moltcities/internal/models"
+)
+
+// IsChannelModerator checks if a user is a moderator of a channel.
+func (d *DB) IsChannelModerator(channelID, userID int64) (bool, error) {
+	var count int
+	err := d.conn.QueryRow(
+		"SELECT COUNT(*) FROM channel_moderators WHERE channel_id = ? AND user_id = ?",
+		channelID, userID,
+	).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// AddChannelModerator appoints a moderator. Returns false if the user
+// already was one.
+func (d *DB) AddChannelModerator(channelID, userID, appointedBy int64) (bool, error) {
+	result, err := d.conn.Exec(`
+		INSERT OR IGNORE INTO channel_moderators (channel_id, user_id, appointed_by)
+		VALUES (?, ?, ?)
+	`, channelID, userID, appointedBy)
+	if err != nil {
+		return false, err
+	}
+	n, _ := result.RowsAffected()
+	return n > 0, nil
+}
+
+// RemoveChannelModerator removes a moderator.
+func (d *DB) RemoveChannelModerator(channelID, userID int64) error {
+	result, err := d.conn.Exec(
+		"DELETE FROM channel_moderators WHERE channel_id = ? AND user_id = ?",
+		channelID, userID,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// ListChannelModerators returns the moderators of a channel.
+func (d *DB) ListChannelModerators(channelID int64) ([]models.ChannelModerator, error) {
+	rows, err := d.conn.Query(`
+		SELECT u.username, a.username, cm.appointed_at
+		FROM channel_moderators cm
+		JOIN users u ON cm.user_id = u.id
+		JOIN users a ON cm.appointed_by = a.id
+		WHERE cm.channel_id = ?
+		ORDER BY cm.appointed_at ASC
+	`, channelID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var moderators []models.ChannelModerator
+	for rows.Next() {
+		var m models.ChannelModerator
+		if err := rows.Scan(&m.Username, &m.AppointedBy, &m.AppointedAt); err != nil {
+			return nil, err
+		}
+		moderators = append(moderators, m)
+	}
+	return moderators, rows.Err()
+}
+
+// UpdateChannelInfo sets a channel's description and/or topic. Nil values
+// are left unchanged.
+func (d *DB) UpdateChannelInfo(channelID int64, description, topic *string) error {
+	if description != nil {
+		if _, err := d.conn.Exec("UPDATE channels SET description = ? WHERE id = ?", *description, channelID); err != nil {
+			return err
+		}
+	}
+	if topic != nil {
+		if _, err := d.conn.Exec("UPDATE channels SET topic = ? WHERE id = ?", *topic, channelID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PinMessage pins a message in its channel. Returns false if it was already pinned.
+func (d *DB) PinMessage(channelID, messageID, userID int64) (bool, error) {
+	result, err := d.conn.Exec(`
+		INSERT OR IGNORE INTO channel_pins (channel_id, message_id, pinned_by)
+		VALUES (?, ?, ?)
+	`, channelID, messageID, userID)
+	if err != nil {
+		return false, err
+	}
+	n, _ := result.RowsAffected()
+	return n > 0, nil
+}
+
+// UnpinMessage unpins a message.
+func (d *DB) UnpinMessage(channelID, messageID int64) error {
+	result, err := d.conn.Exec(
+		"DELETE FROM channel_pins WHERE channel_id = ? AND message_id = ?",
+		channelID, messageID,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// GetPinnedMessages returns a channel's pinned messages, most recently pinned first.
+// Messages from users the viewer has blocked are left out.
+func (d *DB) GetPinnedMessages(channelID, viewerID int64) ([]models.Message, error) {
+	rows, err := d.conn.Query(`
+		SELECT m.id, m.channel_id, m.user_id, u.username, m.content, m.edited_at, m.created_at
+		FROM channel_pins p
+		JOIN messages m ON p.message_id = m.id
+		JOIN users u ON m.user_id = u.id
+		WHERE p.channel_id = ?
+		  AND m.user_id NOT IN (SELECT blocked_id FROM user_blocks WHERE user_id = ?)
+		ORDER BY p.pinned_at DESC, m.id DESC
+	`, channelID, viewerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []models.Message
+	for rows.Next() {
+		msg, err := scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, *msg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := d.attachReactions(messages); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// SetChannelSanction mutes or bans a user in a channel, replacing any
+// existing sanction of the same kind. A nil expiresAt never expires.
+func (d *DB) SetChannelSanction(channelID, userID int64, kind, reason string, expiresAt *time.Time, createdBy int64) error {
+	_, err := d.conn.Exec(`
+		INSERT OR REPLACE INTO channel_sanctions (channel_id, user_id, kind, reason, expires_at, created_by, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, channelID, userID, kind, reason, expiresAt, createdBy, time.Now())
+	return err
+}
+
+// RemoveChannelSanction lifts a mute or ban.
+func (d *DB) RemoveChannelSanction(channelID, userID int64, kind string) error {
+	result, err := d.conn.Exec(
+		"DELETE FROM channel_sanctions WHERE channel_id = ? AND user_id = ? AND kind = ?",
+		channelID, userID, kind,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// ListChannelSanctions returns the mutes and bans in effect in a channel.
+// When userID is non-zero only that user's sanctions are returned.
+func (d *DB) ListChannelSanctions(channelID, userID int64) ([]models.ChannelSanction, error) {
+	query := `
+		SELECT u.username, s.kind, COALESCE(s.reason, ''), s.expires_at, c.username, s.created_at
+		FROM channel_sanctions s
+		JOIN users u ON s.user_id = u.id
+		JOIN users c ON s.created_by = c.id
+		WHERE s.channel_id = ?`
+	args := []interface{}{channelID}
+	if userID != 0 {
+		query += " AND s.user_id = ?"
+		args = append(args, userID)
+	}
+	query += " ORDER BY s.created_at DESC"
+
+	rows, err := d.conn.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	var sanctions []models.ChannelSanction
+	for rows.Next() {
+		var s models.ChannelSanction
+		var expiresAt sql.NullTime
+		if err := rows.Scan(&s.Username, &s.Kind, &s.Reason, &expiresAt, &s.CreatedBy, &s.CreatedAt); err != nil {
+			return nil, err
+		}
+		if expiresAt.Valid {
+			if !expiresAt.Time.After(now) {
+				continue
+			}
+			s.ExpiresAt = &expiresAt.Time
+		}
+		sanctions = append(sanctions, s)
+	}
+	return sanctions, rows.Err()
+}
+
+// GetActiveSanction returns the sanction currently stopping a user from
+// posting in a channel, preferring a ban over a mute, or nil if there is none.
+func (d *DB) GetActiveSanction(channelID, userID int64) (*models.ChannelSanction, error) {
+	sanctions, err := d.ListChannelSanctions(channelID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var active *models.ChannelSanction
+	for i := range sanctions {
+		if active == nil || sanctions[i].Kind == models.SanctionBan {
+			active = &sanctions[i]
+		}
+	}
+	return active, nil
+}
+
+// LogModeration records a moderation action. targetUserID and messageID
+// are optional (0 = none).
+func (d *DB) LogModeration(channelID, actorID int64, action string, targetUserID, messageID int64, details string) error {
+	var target, message interface{}
+	if targetUserID != 0 {
+		target = targetUserID
+	}
+	if messageID != 0 {
+		message = messageID
+	}
+
+	_, err := d.conn.Exec(`
+		INSERT INTO channel_mod_log (channel_id, actor_id, action, target_user_id, message_id, details)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, channelID, actorID, action, target, message, details)
+	return err
+}
+
+// GetModerationLog returns a channel's moderation log, newest first.
+func (d *DB) GetModerationLog(channelID int64, limit int, beforeID int64) ([]models.ModerationLogEntry, error) {
+	query := `
+		SELECT l.id, a.username, l.action, COALESCE(t.username, ''), l.message_id, COALESCE(l.details, ''), l.created_at
+		FROM channel_mod_log l
+		JOIN users a ON l.actor_id = a.id
+		LEFT JOIN users t ON l.target_user_id = t.id
+		WHERE l.channel_id = ?`
+	args := []interface{}{channelID}
+	if beforeID > 0 {
+		query += " AND l.id < ?"
+		args = append(args, beforeID)
+	}
+	query += " ORDER BY l.id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := d.conn.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []models.ModerationLogEntry
+	for rows.Next() {
+		var e models.ModerationLogEntry
+		var messageID sql.NullInt64
+		if err := rows.Scan(&e.ID, &e.Actor, &e.Action, &e.Target, &messageID, &e.Details, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		if messageID.Valid {
+			e.MessageID = &messageID.Int64
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
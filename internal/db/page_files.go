@@ -0,0 +1,108 @@
+package db
+
+import (
+	"time"
+)
+
+// IndexFile is the path of a site's main page, which is stored in pages
+// rather than page_files.
+const IndexFile = "index.html"
+
+// PageFile is a file in a bot's site, served at /m/{username}/{path}.
+type PageFile struct {
+	Path        string
+	ContentType string
+	Content     []byte
+	Size        int
+	UpdatedAt   time.Time
+}
+
+// GetPageFile returns a file from a user's site. The site's index.html is
+// not a page file; use GetPage for it.
+func (d *DB) GetPageFile(username, path string) (*PageFile, error) {
+	var f PageFile
+	err := d.conn.QueryRow(`
+		SELECT f.path, f.content_type, f.content, LENGTH(f.content), f.updated_at
+		FROM page_files f
+		JOIN users u ON f.user_id = u.id
+		WHERE u.username = ? AND f.path = ?
+	`, username, path).Scan(&f.Path, &f.ContentType, &f.Content, &f.Size, &f.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+// ListPageFiles returns the files in a user's site, without their content,
+// sorted by path. The site's index.html is not included.
+func (d *DB) ListPageFiles(userID int64) ([]PageFile, error) {
+	rows, err := d.conn.Query(`
+		SELECT path, content_type, LENGTH(content), updated_at
+		FROM page_files
+		WHERE user_id = ?
+		ORDER BY path
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var files []PageFile
+	for rows.Next() {
+		var f PageFile
+		if err := rows.Scan(&f.Path, &f.ContentType, &f.Size, &f.UpdatedAt); err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	return files, rows.Err()
+}
+
+// PutPageFiles adds or replaces files in a user's site in one transaction.
+// A file at IndexFile becomes the user's page. With replace, every other
+// file not in files is removed first; the page itself is kept unless files
+// includes a new one.
+func (d *DB) PutPageFiles(userID int64, files []PageFile, replace bool) error {
+	tx, err := d.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if replace {
+		if _, err := tx.Exec("DELETE FROM page_files WHERE user_id = ?", userID); err != nil {
+			return err
+		}
+	}
+
+	for _, f := range files {
+		if f.Path == IndexFile {
+			err = upsertPage(tx, userID, string(f.Content), nil)
+		} else {
+			_, err = tx.Exec(`
+				INSERT INTO page_files (user_id, path, content_type, content)
+				VALUES (?, ?, ?, ?)
+				ON CONFLICT (user_id, path) DO UPDATE SET
+					content_type = excluded.content_type,
+					content = excluded.content,
+					updated_at = CURRENT_TIMESTAMP
+			`, userID, f.Path, f.ContentType, f.Content)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// DeletePageFile removes a file from a user's site. It reports whether the
+// file existed.
+func (d *DB) DeletePageFile(userID int64, path string) (bool, error) {
+	res, err := d.conn.Exec("DELETE FROM page_files WHERE user_id = ? AND path = ?", userID, path)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
@@ -0,0 +1,45 @@
+package db
+
+// RecordPageHit counts a visit to a user's page, once per visitor per day,
+// and returns the page's hit count. Visits from earlier days are cleared
+// out as it goes, since only today's are needed to spot repeat visitors.
+func (d *DB) RecordPageHit(userID int64, visitor string) (int64, error) {
+	tx, err := d.conn.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM page_visits WHERE user_id = ? AND day < date('now')", userID); err != nil {
+		return 0, err
+	}
+	result, err := tx.Exec(
+		"INSERT OR IGNORE INTO page_visits (user_id, day, visitor) VALUES (?, date('now'), ?)",
+		userID, visitor,
+	)
+	if err != nil {
+		return 0, err
+	}
+	if n, _ := result.RowsAffected(); n > 0 {
+		if _, err := tx.Exec("UPDATE pages SET hits = hits + 1 WHERE user_id = ?", userID); err != nil {
+			return 0, err
+		}
+	}
+
+	var hits int64
+	if err := tx.QueryRow("SELECT hits FROM pages WHERE user_id = ?", userID).Scan(&hits); err != nil {
+		return 0, err
+	}
+	return hits, tx.Commit()
+}
+
+// GetPageHits returns a user's page hit count.
+func (d *DB) GetPageHits(username string) (int64, error) {
+	var hits int64
+	err := d.conn.QueryRow(`
+		SELECT p.hits FROM pages p
+		JOIN users u ON p.user_id = u.id
+		WHERE u.username = ?
+	`, username).Scan(&hits)
+	return hits, err
+}
@@ -0,0 +1,92 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+)
+
+// PageVersion is a saved version of a user's page.
+type PageVersion struct {
+	Version   int
+	Content   string
+	Size      int
+	CreatedAt time.Time
+}
+
+// ListPageVersions returns a user's page versions without their content,
+// newest first. With before > 0, only versions older than it are returned.
+func (d *DB) ListPageVersions(userID int64, before, limit int) ([]PageVersion, error) {
+	query := `
+		SELECT version, LENGTH(content), created_at
+		FROM page_versions
+		WHERE user_id = ?`
+	args := []interface{}{userID}
+	if before > 0 {
+		query += " AND version < ?"
+		args = append(args, before)
+	}
+	query += " ORDER BY version DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := d.conn.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var versions []PageVersion
+	for rows.Next() {
+		var v PageVersion
+		if err := rows.Scan(&v.Version, &v.Size, &v.CreatedAt); err != nil {
+			return nil, err
+		}
+		versions = append(versions, v)
+	}
+	return versions, rows.Err()
+}
+
+// GetPageVersion returns one version of a user's page.
+func (d *DB) GetPageVersion(username string, version int) (*PageVersion, error) {
+	var v PageVersion
+	err := d.conn.QueryRow(`
+		SELECT pv.version, pv.content, LENGTH(pv.content), pv.created_at
+		FROM page_versions pv
+		JOIN users u ON pv.user_id = u.id
+		WHERE u.username = ? AND pv.version = ?
+	`, username, version).Scan(&v.Version, &v.Content, &v.Size, &v.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// RollbackPage makes an old version the user's page again. The restored
+// page is saved as a new version, so the rollback can itself be undone. It
+// returns the new version's number, or sql.ErrNoRows if the version
+// doesn't exist.
+func (d *DB) RollbackPage(userID int64, version int) (int, error) {
+	tx, err := d.conn.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var content string
+	var source, theme sql.NullString
+	err = tx.QueryRow(
+		"SELECT content, source, theme FROM page_versions WHERE user_id = ? AND version = ?",
+		userID, version,
+	).Scan(&content, &source, &theme)
+	if err != nil {
+		return 0, err
+	}
+	if err := upsertPage(tx, userID, content, pageSource(source, theme)); err != nil {
+		return 0, err
+	}
+
+	var latest int
+	if err := tx.QueryRow("SELECT MAX(version) FROM page_versions WHERE user_id = ?", userID).Scan(&latest); err != nil {
+		return 0, err
+	}
+	return latest, tx.Commit()
+}
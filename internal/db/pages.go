@@ -11,23 +11,49 @@ type Page struct {
 	UserID    int64
 	Username  string
 	Content   string
+	Source    *PageSource
 	Size      int
 	UpdatedAt time.Time
 	CreatedAt time.Time
 }
 
+// PageSource is the Markdown a page was rendered from and the theme it was
+// rendered with. Pages pushed as HTML have none.
+type PageSource struct {
+	Markdown string
+	Theme    string
+}
+
+// pageSource builds a PageSource from nullable source and theme columns.
+func pageSource(source, theme sql.NullString) *PageSource {
+	if !source.Valid {
+		return nil
+	}
+	return &PageSource{Markdown: source.String, Theme: theme.String}
+}
+
+// sourceArgs returns a PageSource as the values of source and theme columns.
+func sourceArgs(src *PageSource) (interface{}, interface{}) {
+	if src == nil {
+		return nil, nil
+	}
+	return src.Markdown, src.Theme
+}
+
 // GetPage retrieves a page by username.
 func (d *DB) GetPage(username string) (*Page, error) {
 	var page Page
+	var source, theme sql.NullString
 	err := d.conn.QueryRow(`
-		SELECT p.id, p.user_id, u.username, p.content, LENGTH(p.content), p.updated_at, p.created_at
+		SELECT p.id, p.user_id, u.username, p.content, p.source, p.theme, LENGTH(p.content), p.updated_at, p.created_at
 		FROM pages p
 		JOIN users u ON p.user_id = u.id
 		WHERE u.username = ?
-	`, username).Scan(&page.ID, &page.UserID, &page.Username, &page.Content, &page.Size, &page.UpdatedAt, &page.CreatedAt)
+	`, username).Scan(&page.ID, &page.UserID, &page.Username, &page.Content, &source, &theme, &page.Size, &page.UpdatedAt, &page.CreatedAt)
 	if err != nil {
 		return nil, err
 	}
+	page.Source = pageSource(source, theme)
 	return &page, nil
 }
 
@@ -35,35 +61,87 @@ func (d *DB) GetPage(username string) (*Page, error) {
 func (d *DB) GetPageByUserID(userID int64) (*Page, error) {
 	var page Page
 	var username string
+	var source, theme sql.NullString
 	err := d.conn.QueryRow(`
-		SELECT p.id, p.user_id, u.username, p.content, LENGTH(p.content), p.updated_at, p.created_at
+		SELECT p.id, p.user_id, u.username, p.content, p.source, p.theme, LENGTH(p.content), p.updated_at, p.created_at
 		FROM pages p
 		JOIN users u ON p.user_id = u.id
 		WHERE p.user_id = ?
-	`, userID).Scan(&page.ID, &page.UserID, &username, &page.Content, &page.Size, &page.UpdatedAt, &page.CreatedAt)
+	`, userID).Scan(&page.ID, &page.UserID, &username, &page.Content, &source, &theme, &page.Size, &page.UpdatedAt, &page.CreatedAt)
 	if err != nil {
 		return nil, err
 	}
 	page.Username = username
+	page.Source = pageSource(source, theme)
 	return &page, nil
 }
 
-// UpsertPage creates or updates a user's page.
-func (d *DB) UpsertPage(userID int64, content string) error {
-	_, err := d.conn.Exec(`
-		INSERT INTO pages (user_id, content, updated_at, created_at)
-		VALUES (?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+// UpsertPage creates or updates a user's page, saving it as a new version.
+// src is the Markdown the page was rendered from, or nil for HTML.
+func (d *DB) UpsertPage(userID int64, content string, src *PageSource) error {
+	tx, err := d.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := upsertPage(tx, userID, content, src); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// execer is satisfied by both *sql.DB and *sql.Tx.
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// upsertPage saves a user's page and adds it to their page versions. Run
+// it in a transaction so the two stay in step.
+func upsertPage(e execer, userID int64, content string, src *PageSource) error {
+	source, theme := sourceArgs(src)
+	_, err := e.Exec(`
+		INSERT INTO pages (user_id, content, source, theme, updated_at, created_at)
+		VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
 		ON CONFLICT (user_id) DO UPDATE SET
 			content = excluded.content,
+			source = excluded.source,
+			theme = excluded.theme,
 			updated_at = CURRENT_TIMESTAMP
-	`, userID, content)
+	`, userID, content, source, theme)
+	if err != nil {
+		return err
+	}
+
+	_, err = e.Exec(`
+		INSERT INTO page_versions (user_id, version, content, source, theme)
+		SELECT ?, COALESCE(MAX(version), 0) + 1, ?, ?, ? FROM page_versions WHERE user_id = ?
+	`, userID, content, source, theme, userID)
 	return err
 }
 
-// DeletePage removes a user's page.
+// DeletePage removes a user's page, guestbook and hit count, and the rest
+// of their site. Its versions are kept so that RollbackPage can bring back
+// a page deleted by mistake.
 func (d *DB) DeletePage(userID int64) error {
-	_, err := d.conn.Exec("DELETE FROM pages WHERE user_id = ?", userID)
-	return err
+	tx, err := d.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, table := range []string{"page_files", "page_visits"} {
+		if _, err := tx.Exec("DELETE FROM "+table+" WHERE user_id = ?", userID); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec("DELETE FROM guestbook_entries WHERE page_user_id = ?", userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM pages WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 // PageExists checks if a user has a page.
@@ -157,3 +235,72 @@ func (d *DB) ListRandomPages(limit int) ([]Page, int, error) {
 	}
 	return pages, totalCount, rows.Err()
 }
+
+// pageHTMLTables are the tables holding bots' HTML, with the condition
+// that picks out the HTML rows. Page files keep their content as bytes.
+var pageHTMLTables = []struct {
+	table string
+	where string
+	blob  bool
+}{
+	{"pages", "1", false},
+	{"page_versions", "1", false},
+	{"page_files", "content_type LIKE 'text/html%'", true},
+}
+
+// RewritePageHTML runs rewrite over every stored page, page version and
+// HTML file, saving any that change, in one transaction. It runs once per
+// name, so it can re-sanitize pages after the sanitizer changes; later
+// calls with the same name do nothing. It returns how many rows changed.
+func (d *DB) RewritePageHTML(name string, rewrite func(string) string) (int, error) {
+	tx, err := d.conn.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("INSERT OR IGNORE INTO data_migrations (name) VALUES (?)", name)
+	if err != nil {
+		return 0, err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return 0, nil
+	}
+
+	changed := 0
+	for _, t := range pageHTMLTables {
+		rows, err := tx.Query("SELECT id, content FROM " + t.table + " WHERE " + t.where)
+		if err != nil {
+			return 0, err
+		}
+		updates := map[int64]string{}
+		for rows.Next() {
+			var id int64
+			var content []byte
+			if err := rows.Scan(&id, &content); err != nil {
+				rows.Close()
+				return 0, err
+			}
+			if clean := rewrite(string(content)); clean != string(content) {
+				updates[id] = clean
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return 0, err
+		}
+
+		for id, clean := range updates {
+			var content interface{} = clean
+			if t.blob {
+				content = []byte(clean)
+			}
+			if _, err := tx.Exec("UPDATE "+t.table+" SET content = ? WHERE id = ?", content, id); err != nil {
+				return 0, err
+			}
+		}
+		changed += len(updates)
+	}
+
+	return changed, tx.Commit()
+}
@@ -111,5 +111,10 @@ func (d *DB) CleanupOldRateLimits() error {
 	}
 
 	_, err = d.conn.Exec(`DELETE FROM user_rate_limits WHERE window_start < ?`, cutoff)
+	if err != nil {
+		return err
+	}
+
+	_, err = d.conn.Exec(`DELETE FROM message_posts WHERE created_at < datetime('now', '-1 day')`)
 	return err
 }
@@ -0,0 +1,71 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/ergodic/moltcities/internal/models"
+)
+
+// CanvasRefResult is a channel message that references a canvas location.
+type CanvasRefResult struct {
+	ID        int64
+	Channel   string
+	Username  string
+	Content   string
+	CreatedAt time.Time
+}
+
+// insertMessageRefs indexes the canvas references in a message.
+func insertMessageRefs(tx *sql.Tx, channelID, messageID int64, refs []models.CanvasRef) error {
+	for _, ref := range refs {
+		if _, err := tx.Exec(`
+			INSERT INTO message_refs (message_id, channel_id, x, y, width, height)
+			VALUES (?, ?, ?, ?, ?, ?)
+		`, messageID, channelID, ref.X, ref.Y, ref.Width, ref.Height); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetCanvasReferences returns messages referencing a point or region that
+// overlaps the given area, newest first. Messages in non-public channels are
+// only included if viewerID is a member, and messages from users the viewer
+// has blocked are left out.
+func (d *DB) GetCanvasReferences(viewerID int64, x, y, width, height, limit int, beforeID int64) ([]CanvasRefResult, error) {
+	query := `
+		SELECT DISTINCT m.id, c.name, u.username, m.content, m.created_at
+		FROM message_refs r
+		JOIN messages m ON r.message_id = m.id
+		JOIN channels c ON r.channel_id = c.id
+		JOIN users u ON m.user_id = u.id
+		WHERE r.x < ? AND r.x + MAX(r.width, 1) > ?
+		  AND r.y < ? AND r.y + MAX(r.height, 1) > ?
+		  AND (c.visibility = 'public'
+		       OR c.id IN (SELECT channel_id FROM channel_members WHERE user_id = ?))
+		  AND m.user_id NOT IN (SELECT blocked_id FROM user_blocks WHERE user_id = ?)`
+	args := []interface{}{x + width, x, y + height, y, viewerID, viewerID}
+	if beforeID > 0 {
+		query += " AND m.id < ?"
+		args = append(args, beforeID)
+	}
+	query += " ORDER BY m.id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := d.conn.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []CanvasRefResult
+	for rows.Next() {
+		var r CanvasRefResult
+		if err := rows.Scan(&r.ID, &r.Channel, &r.Username, &r.Content, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
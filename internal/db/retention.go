@@ -0,0 +1,114 @@
+package db
+
+import (
+	"time"
+)
+
+// SetChannelArchived archives (makes read-only) or unarchives a channel.
+func (d *DB) SetChannelArchived(channelID int64, archived bool) error {
+	var archivedAt interface{}
+	if archived {
+		archivedAt = time.Now().UTC()
+	}
+	_, err := d.conn.Exec("UPDATE channels SET archived_at = ? WHERE id = ?", archivedAt, channelID)
+	return err
+}
+
+// IsChannelArchived checks if a channel is archived.
+func (d *DB) IsChannelArchived(channelID int64) (bool, error) {
+	var archived bool
+	err := d.conn.QueryRow("SELECT archived_at IS NOT NULL FROM channels WHERE id = ?", channelID).Scan(&archived)
+	return archived, err
+}
+
+// SetChannelRetention sets how many days a channel keeps its messages
+// (0 = server default).
+func (d *DB) SetChannelRetention(channelID int64, days int) error {
+	_, err := d.conn.Exec("UPDATE channels SET retention_days = ? WHERE id = ?", days, channelID)
+	return err
+}
+
+// EffectiveRetention returns the number of days a channel keeps messages:
+// the shorter of its own setting and the server default, ignoring zeros
+// (0 = keep forever).
+func EffectiveRetention(channelDays, defaultDays int) int {
+	if channelDays > 0 && (defaultDays <= 0 || channelDays < defaultDays) {
+		return channelDays
+	}
+	if defaultDays > 0 {
+		return defaultDays
+	}
+	return 0
+}
+
+// PurgeOldMessages deletes channel messages older than each channel's
+// effective retention period, along with their reactions, edits, mentions
+// and canvas references. Pinned messages are kept. Returns the number of
+// messages deleted.
+func (d *DB) PurgeOldMessages(defaultDays int) (int64, error) {
+	rows, err := d.conn.Query("SELECT id, retention_days FROM channels")
+	if err != nil {
+		return 0, err
+	}
+	type channelRetention struct {
+		id   int64
+		days int
+	}
+	var channels []channelRetention
+	for rows.Next() {
+		var c channelRetention
+		if err := rows.Scan(&c.id, &c.days); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		channels = append(channels, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	var purged int64
+	for _, c := range channels {
+		days := EffectiveRetention(c.days, defaultDays)
+		if days == 0 {
+			continue
+		}
+		cutoff := time.Now().UTC().AddDate(0, 0, -days)
+		n, err := d.purgeChannelMessages(c.id, cutoff)
+		if err != nil {
+			return purged, err
+		}
+		purged += n
+	}
+	return purged, nil
+}
+
+// purgeChannelMessages deletes a channel's unpinned messages created before cutoff.
+func (d *DB) purgeChannelMessages(channelID int64, cutoff time.Time) (int64, error) {
+	tx, err := d.conn.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// created_at is stored by SQLite as UTC "YYYY-MM-DD HH:MM:SS" text
+	expired := `
+		SELECT id FROM messages
+		WHERE channel_id = ? AND created_at < ?
+		  AND id NOT IN (SELECT message_id FROM channel_pins)`
+	args := []interface{}{channelID, cutoff.Format("2006-01-02 15:04:05")}
+
+	for _, table := range messageChildTables {
+		if _, err := tx.Exec("DELETE FROM "+table+" WHERE message_id IN ("+expired+")", args...); err != nil {
+			return 0, err
+		}
+	}
+
+	result, err := tx.Exec("DELETE FROM messages WHERE id IN ("+expired+")", args...)
+	if err != nil {
+		return 0, err
+	}
+	n, _ := result.RowsAffected()
+	return n, tx.Commit()
+}
@@ -0,0 +1,137 @@
+package db
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/ergodic/moltcities/internal/models"
+)
+
+// CreateMailRule adds an inbox rule for a user.
+func (d *DB) CreateMailRule(userID int64, rule models.MailRule) (*models.MailRule, error) {
+	result, err := d.conn.Exec(`
+		INSERT INTO mail_rules (user_id, sender, keyword, action, label)
+		VALUES (?, ?, ?, ?, ?)
+	`, userID, nullString(rule.Sender), nullString(rule.Keyword), rule.Action, nullString(rule.Label))
+	if err != nil {
+		return nil, err
+	}
+	rule.ID, _ = result.LastInsertId()
+	rule.CreatedAt = time.Now()
+	return &rule, nil
+}
+
+// nullString stores empty strings as NULL.
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// ListMailRules returns a user's inbox rules in the order they were added.
+func (d *DB) ListMailRules(userID int64) ([]models.MailRule, error) {
+	return listMailRules(d.conn, userID)
+}
+
+// queryer is implemented by *sql.DB and *sql.Tx.
+type queryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+func listMailRules(q queryer, userID int64) ([]models.MailRule, error) {
+	rows, err := q.Query(`
+		SELECT id, COALESCE(sender, ''), COALESCE(keyword, ''), action, COALESCE(label, ''), created_at
+		FROM mail_rules
+		WHERE user_id = ?
+		ORDER BY id
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rules []models.MailRule
+	for rows.Next() {
+		var r models.MailRule
+		if err := rows.Scan(&r.ID, &r.Sender, &r.Keyword, &r.Action, &r.Label, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		rules = append(rules, r)
+	}
+	return rules, rows.Err()
+}
+
+// CountMailRules returns how many inbox rules a user has.
+func (d *DB) CountMailRules(userID int64) (int, error) {
+	var count int
+	err := d.conn.QueryRow("SELECT COUNT(*) FROM mail_rules WHERE user_id = ?", userID).Scan(&count)
+	return count, err
+}
+
+// DeleteMailRule deletes one of a user's inbox rules. Returns sql.ErrNoRows
+// if the user has no such rule.
+func (d *DB) DeleteMailRule(userID, ruleID int64) error {
+	result, err := d.conn.Exec("DELETE FROM mail_rules WHERE id = ? AND user_id = ?", ruleID, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// MatchesMail reports whether a rule applies to mail from sender with body.
+func MatchesMail(rule models.MailRule, sender, body string) bool {
+	if rule.Sender == "" && rule.Keyword == "" {
+		return false
+	}
+	if rule.Sender != "" && !strings.EqualFold(rule.Sender, sender) {
+		return false
+	}
+	if rule.Keyword != "" && !strings.Contains(strings.ToLower(body), strings.ToLower(rule.Keyword)) {
+		return false
+	}
+	return true
+}
+
+// filterIncomingMail decides how mail arrives in the recipient's inbox:
+// deleted on arrival if the recipient blocked the sender or a delete rule
+// matches, and with the labels of any matching label rules.
+func filterIncomingMail(tx *sql.Tx, fromUserID, toUserID int64, body string) (bool, []string, error) {
+	var blocked int
+	err := tx.QueryRow(
+		"SELECT COUNT(*) FROM user_blocks WHERE user_id = ? AND blocked_id = ?",
+		toUserID, fromUserID,
+	).Scan(&blocked)
+	if err != nil {
+		return false, nil, err
+	}
+	if blocked > 0 {
+		return true, nil, nil
+	}
+
+	rules, err := listMailRules(tx, toUserID)
+	if err != nil || len(rules) == 0 {
+		return false, nil, err
+	}
+
+	var sender string
+	if err := tx.QueryRow("SELECT username FROM users WHERE id = ?", fromUserID).Scan(&sender); err != nil {
+		return false, nil, err
+	}
+
+	deleted := false
+	var labels []string
+	for _, rule := range rules {
+		if !MatchesMail(rule, sender, body) {
+			continue
+		}
+		switch rule.Action {
+		case models.MailRuleDelete:
+			deleted = true
+		case models.MailRuleLabel:
+			labels = append(labels, rule.Label)
+		}
+	}
+	return deleted, labels, nil
+}
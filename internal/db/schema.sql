@@ -7,6 +7,7 @@ CREATE TABLE IF NOT EXISTS users (
     api_token_hash  TEXT NOT NULL,
     last_edit_at    TIMESTAMP,
     registration_ip TEXT,
+    mention_mail    INTEGER NOT NULL DEFAULT 0, -- deliver @mentions as system mail
     created_at      TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
 
@@ -37,22 +38,142 @@ CREATE TABLE IF NOT EXISTS channels (
     id          INTEGER PRIMARY KEY AUTOINCREMENT,
     name        TEXT UNIQUE NOT NULL,
     description TEXT,
+    topic       TEXT,
+    visibility  TEXT NOT NULL DEFAULT 'public', -- public, private, invite-only
+    archived_at TIMESTAMP,                      -- set when the channel is read-only
+    retention_days INTEGER NOT NULL DEFAULT 0,  -- delete messages after N days (0 = server default)
+    created_by  INTEGER NOT NULL,               -- the channel owner
+    created_at  TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (created_by) REFERENCES users(id)
+);
+
+-- Channel membership (used by private and invite-only channels)
+CREATE TABLE IF NOT EXISTS channel_members (
+    channel_id  INTEGER NOT NULL,
+    user_id     INTEGER NOT NULL,
+    added_by    INTEGER,
+    joined_at   TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (channel_id, user_id),
+    FOREIGN KEY (channel_id) REFERENCES channels(id),
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    FOREIGN KEY (added_by) REFERENCES users(id)
+);
+
+-- Channel moderators (appointed by the owner)
+CREATE TABLE IF NOT EXISTS channel_moderators (
+    channel_id   INTEGER NOT NULL,
+    user_id      INTEGER NOT NULL,
+    appointed_by INTEGER NOT NULL,
+    appointed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (channel_id, user_id),
+    FOREIGN KEY (channel_id) REFERENCES channels(id),
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    FOREIGN KEY (appointed_by) REFERENCES users(id)
+);
+
+-- Channel mutes and bans (expires_at NULL = permanent)
+CREATE TABLE IF NOT EXISTS channel_sanctions (
+    channel_id  INTEGER NOT NULL,
+    user_id     INTEGER NOT NULL,
+    kind        TEXT NOT NULL, -- mute, ban
+    reason      TEXT,
+    expires_at  TIMESTAMP,
     created_by  INTEGER NOT NULL,
     created_at  TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (channel_id, user_id, kind),
+    FOREIGN KEY (channel_id) REFERENCES channels(id),
+    FOREIGN KEY (user_id) REFERENCES users(id),
     FOREIGN KEY (created_by) REFERENCES users(id)
 );
 
+-- Channel moderation log
+CREATE TABLE IF NOT EXISTS channel_mod_log (
+    id             INTEGER PRIMARY KEY AUTOINCREMENT,
+    channel_id     INTEGER NOT NULL,
+    actor_id       INTEGER NOT NULL,
+    action         TEXT NOT NULL,
+    target_user_id INTEGER,
+    message_id     INTEGER,
+    details        TEXT,
+    created_at     TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (channel_id) REFERENCES channels(id),
+    FOREIGN KEY (actor_id) REFERENCES users(id),
+    FOREIGN KEY (target_user_id) REFERENCES users(id)
+);
+
 -- Messages
 CREATE TABLE IF NOT EXISTS messages (
     id          INTEGER PRIMARY KEY AUTOINCREMENT,
     channel_id  INTEGER NOT NULL,
     user_id     INTEGER NOT NULL,
     content     TEXT NOT NULL,
+    edited_at   TIMESTAMP,
     created_at  TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     FOREIGN KEY (channel_id) REFERENCES channels(id),
     FOREIGN KEY (user_id) REFERENCES users(id)
 );
 
+-- Message edit history (previous versions of edited messages)
+CREATE TABLE IF NOT EXISTS message_edits (
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    message_id  INTEGER NOT NULL,
+    content     TEXT NOT NULL,
+    edited_at   TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (message_id) REFERENCES messages(id)
+);
+
+-- Message reactions (one per user per emoji)
+CREATE TABLE IF NOT EXISTS message_reactions (
+    message_id  INTEGER NOT NULL,
+    user_id     INTEGER NOT NULL,
+    emoji       TEXT NOT NULL,
+    created_at  TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (message_id, user_id, emoji),
+    FOREIGN KEY (message_id) REFERENCES messages(id),
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+-- @mentions of users in channel messages
+CREATE TABLE IF NOT EXISTS mentions (
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    message_id  INTEGER NOT NULL,
+    channel_id  INTEGER NOT NULL,
+    user_id     INTEGER NOT NULL, -- the mentioned user
+    author_id   INTEGER NOT NULL,
+    read_at     TIMESTAMP,
+    created_at  TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (message_id, user_id),
+    FOREIGN KEY (message_id) REFERENCES messages(id),
+    FOREIGN KEY (channel_id) REFERENCES channels(id),
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    FOREIGN KEY (author_id) REFERENCES users(id)
+);
+
+-- Canvas references in channel messages, e.g. (512,300) or [512,300 64x64]
+-- (width and height are 0 for single-point references)
+CREATE TABLE IF NOT EXISTS message_refs (
+    message_id  INTEGER NOT NULL,
+    channel_id  INTEGER NOT NULL,
+    x           INTEGER NOT NULL,
+    y           INTEGER NOT NULL,
+    width       INTEGER NOT NULL DEFAULT 0,
+    height      INTEGER NOT NULL DEFAULT 0,
+    FOREIGN KEY (message_id) REFERENCES messages(id),
+    FOREIGN KEY (channel_id) REFERENCES channels(id)
+);
+
+-- Pinned channel messages
+CREATE TABLE IF NOT EXISTS channel_pins (
+    channel_id  INTEGER NOT NULL,
+    message_id  INTEGER NOT NULL,
+    pinned_by   INTEGER NOT NULL,
+    pinned_at   TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (channel_id, message_id),
+    FOREIGN KEY (channel_id) REFERENCES channels(id),
+    FOREIGN KEY (message_id) REFERENCES messages(id),
+    FOREIGN KEY (pinned_by) REFERENCES users(id)
+);
+
 -- Rate limiting by IP
 CREATE TABLE IF NOT EXISTS ip_rate_limits (
     ip           TEXT NOT NULL,
@@ -62,6 +183,13 @@ CREATE TABLE IF NOT EXISTS ip_rate_limits (
     PRIMARY KEY (ip, action)
 );
 
+-- One-off data migrations that have run, such as re-sanitizing pages
+-- after the sanitizer changes
+CREATE TABLE IF NOT EXISTS data_migrations (
+    name        TEXT PRIMARY KEY,
+    applied_at  TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
 -- Rate limiting by user
 CREATE TABLE IF NOT EXISTS user_rate_limits (
     user_id      INTEGER NOT NULL,
@@ -71,16 +199,70 @@ CREATE TABLE IF NOT EXISTS user_rate_limits (
     PRIMARY KEY (user_id, action)
 );
 
--- Pages (user static HTML pages)
+-- Pages (user static HTML pages). Pages pushed as Markdown keep their
+-- source and theme; content is always the rendered HTML.
 CREATE TABLE IF NOT EXISTS pages (
     id          INTEGER PRIMARY KEY AUTOINCREMENT,
     user_id     INTEGER UNIQUE NOT NULL,
     content     TEXT NOT NULL,
+    source      TEXT,
+    theme       TEXT,
+    hits        INTEGER NOT NULL DEFAULT 0,
     updated_at  TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     created_at  TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     FOREIGN KEY (user_id) REFERENCES users(id)
 );
 
+-- Other files in a bot's site, served at /m/{username}/{path}. The site's
+-- index.html is the page in pages.
+CREATE TABLE IF NOT EXISTS page_files (
+    id           INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id      INTEGER NOT NULL,
+    path         TEXT NOT NULL,
+    content_type TEXT NOT NULL,
+    content      BLOB NOT NULL,
+    updated_at   TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    created_at   TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (user_id, path),
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+-- Every version of each bot's page, numbered from 1. The newest is the
+-- content in pages; rolling back adds a copy of an old version.
+CREATE TABLE IF NOT EXISTS page_versions (
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id     INTEGER NOT NULL,
+    version     INTEGER NOT NULL,
+    content     TEXT NOT NULL,
+    source      TEXT,
+    theme       TEXT,
+    created_at  TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (user_id, version),
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+-- Who has visited each bot's page today, so each visitor counts once a day
+-- towards its hit counter. Visitors are hashed IPs; earlier days are
+-- cleared out as new visits come in.
+CREATE TABLE IF NOT EXISTS page_visits (
+    user_id     INTEGER NOT NULL,
+    day         TEXT NOT NULL,
+    visitor     TEXT NOT NULL,
+    PRIMARY KEY (user_id, day, visitor),
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+-- Messages bots leave in each other's page guestbooks
+CREATE TABLE IF NOT EXISTS guestbook_entries (
+    id           INTEGER PRIMARY KEY AUTOINCREMENT,
+    page_user_id INTEGER NOT NULL,
+    author_id    INTEGER NOT NULL,
+    message      TEXT NOT NULL,
+    created_at   TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (page_user_id) REFERENCES users(id),
+    FOREIGN KEY (author_id) REFERENCES users(id)
+);
+
 -- Page update tracking (for rate limiting)
 CREATE TABLE IF NOT EXISTS page_updates (
     id          INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -96,11 +278,125 @@ CREATE TABLE IF NOT EXISTS mail (
     to_user_id   INTEGER NOT NULL,
     body         TEXT NOT NULL,
     read_at      TIMESTAMP,
+    in_reply_to  INTEGER,                 -- mail this replies to, if any
+    thread_id    INTEGER,                 -- id of the first mail in the thread
+    sender_deleted_at    TIMESTAMP,       -- deleted from the sender's sent mail
+    recipient_deleted_at TIMESTAMP,       -- deleted from the recipient's inbox
+    archived_at  TIMESTAMP,               -- moved out of the recipient's inbox
     created_at   TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     FOREIGN KEY (from_user_id) REFERENCES users(id),
     FOREIGN KEY (to_user_id) REFERENCES users(id)
 );
 
+-- Mailing lists. Members can address mail to a list; only the owner manages
+-- its membership.
+CREATE TABLE IF NOT EXISTS mail_lists (
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    name        TEXT UNIQUE NOT NULL,
+    description TEXT,
+    owner_id    INTEGER NOT NULL,
+    created_at  TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (owner_id) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS mail_list_members (
+    list_id     INTEGER NOT NULL,
+    user_id     INTEGER NOT NULL,
+    added_by    INTEGER,
+    joined_at   TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (list_id, user_id),
+    FOREIGN KEY (list_id) REFERENCES mail_lists(id),
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    FOREIGN KEY (added_by) REFERENCES users(id)
+);
+
+-- Webrings link bots' pages in a ring. Bots ask to join and the owner
+-- approves them; approved members get the next position in the ring.
+CREATE TABLE IF NOT EXISTS webrings (
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    name        TEXT UNIQUE NOT NULL,
+    description TEXT,
+    owner_id    INTEGER NOT NULL,
+    created_at  TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (owner_id) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS webring_members (
+    webring_id  INTEGER NOT NULL,
+    user_id     INTEGER NOT NULL,
+    status      TEXT NOT NULL DEFAULT 'pending',
+    position    INTEGER,
+    updated_at  TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (webring_id, user_id),
+    FOREIGN KEY (webring_id) REFERENCES webrings(id),
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+-- Labels on received mail, set by inbox rules or the recipient
+CREATE TABLE IF NOT EXISTS mail_labels (
+    mail_id     INTEGER NOT NULL,
+    label       TEXT NOT NULL,
+    PRIMARY KEY (mail_id, label),
+    FOREIGN KEY (mail_id) REFERENCES mail(id)
+);
+
+-- Server-side inbox rules. A rule matches by sender, keyword or both, and
+-- either labels or deletes matching mail as it arrives.
+CREATE TABLE IF NOT EXISTS mail_rules (
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id     INTEGER NOT NULL,
+    sender      TEXT,                 -- username to match, if any
+    keyword     TEXT,                 -- case-insensitive body substring, if any
+    action      TEXT NOT NULL,        -- label, delete
+    label       TEXT,                 -- for label rules
+    created_at  TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+-- Users a user has blocked. Mail from a blocked user never reaches the
+-- blocker, and their channel messages are hidden from the blocker.
+CREATE TABLE IF NOT EXISTS user_blocks (
+    user_id     INTEGER NOT NULL,
+    blocked_id  INTEGER NOT NULL,
+    created_at  TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, blocked_id),
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    FOREIGN KEY (blocked_id) REFERENCES users(id)
+);
+
+-- Canvas regions attached to mail and channel messages. The pixels are
+-- frozen as a PNG when the message is sent.
+CREATE TABLE IF NOT EXISTS mail_attachments (
+    mail_id    INTEGER PRIMARY KEY,
+    x          INTEGER NOT NULL,
+    y          INTEGER NOT NULL,
+    width      INTEGER NOT NULL,
+    height     INTEGER NOT NULL,
+    proposed   INTEGER NOT NULL DEFAULT 0, -- pixels supplied by the sender
+    png        BLOB NOT NULL,
+    FOREIGN KEY (mail_id) REFERENCES mail(id)
+);
+
+CREATE TABLE IF NOT EXISTS message_attachments (
+    message_id INTEGER PRIMARY KEY,
+    x          INTEGER NOT NULL,
+    y          INTEGER NOT NULL,
+    width      INTEGER NOT NULL,
+    height     INTEGER NOT NULL,
+    proposed   INTEGER NOT NULL DEFAULT 0, -- pixels supplied by the sender
+    png        BLOB NOT NULL,
+    FOREIGN KEY (message_id) REFERENCES messages(id)
+);
+
+-- Message rate limiting. Kept apart from messages so that deleting a
+-- message doesn't give the post back.
+CREATE TABLE IF NOT EXISTS message_posts (
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id     INTEGER NOT NULL,
+    created_at  TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
 -- Mail rate limiting
 CREATE TABLE IF NOT EXISTS mail_sends (
     id          INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -109,15 +405,110 @@ CREATE TABLE IF NOT EXISTS mail_sends (
     FOREIGN KEY (user_id) REFERENCES users(id)
 );
 
+-- Outbound webhooks. Each webhook subscribes to one event type; message
+-- webhooks are scoped to a channel and pixel webhooks to a canvas region.
+CREATE TABLE IF NOT EXISTS webhooks (
+    id            INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id       INTEGER NOT NULL,
+    url           TEXT NOT NULL,
+    secret        TEXT NOT NULL,          -- HMAC key for payload signatures
+    event         TEXT NOT NULL,          -- mention, mail, message, pixel
+    channel_id    INTEGER,                -- message webhooks only
+    region_x      INTEGER,                -- pixel webhooks only
+    region_y      INTEGER,
+    region_width  INTEGER,
+    region_height INTEGER,
+    created_at    TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    FOREIGN KEY (channel_id) REFERENCES channels(id)
+);
+
+-- Webhook delivery log
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id            INTEGER PRIMARY KEY AUTOINCREMENT,
+    webhook_id    INTEGER NOT NULL,
+    event         TEXT NOT NULL,
+    payload       TEXT NOT NULL,
+    status        TEXT NOT NULL DEFAULT 'pending', -- pending, delivered, failed
+    attempts      INTEGER NOT NULL DEFAULT 0,
+    response_code INTEGER,
+    error         TEXT,
+    created_at    TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at    TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (webhook_id) REFERENCES webhooks(id)
+);
+
 -- Indexes for performance
 CREATE INDEX IF NOT EXISTS idx_edits_xy ON edits(x, y);
 CREATE INDEX IF NOT EXISTS idx_edits_time ON edits(created_at);
 CREATE INDEX IF NOT EXISTS idx_edits_user ON edits(user_id);
 CREATE INDEX IF NOT EXISTS idx_messages_channel ON messages(channel_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_message_edits_message ON message_edits(message_id, edited_at);
+CREATE INDEX IF NOT EXISTS idx_message_reactions_message ON message_reactions(message_id);
+CREATE INDEX IF NOT EXISTS idx_mentions_user ON mentions(user_id, id);
+CREATE INDEX IF NOT EXISTS idx_message_refs_message ON message_refs(message_id);
+CREATE INDEX IF NOT EXISTS idx_message_refs_xy ON message_refs(x, y);
 CREATE INDEX IF NOT EXISTS idx_channels_name ON channels(name);
+CREATE INDEX IF NOT EXISTS idx_channel_members_user ON channel_members(user_id);
+CREATE INDEX IF NOT EXISTS idx_channel_mod_log_channel ON channel_mod_log(channel_id, id);
 CREATE INDEX IF NOT EXISTS idx_users_username ON users(username);
+CREATE INDEX IF NOT EXISTS idx_users_username_nocase ON users(username COLLATE NOCASE);
 CREATE INDEX IF NOT EXISTS idx_pages_user ON pages(user_id);
 CREATE INDEX IF NOT EXISTS idx_page_updates_user ON page_updates(user_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_guestbook_page ON guestbook_entries(page_user_id, id);
+CREATE INDEX IF NOT EXISTS idx_guestbook_author ON guestbook_entries(author_id, created_at);
 CREATE INDEX IF NOT EXISTS idx_mail_to_user ON mail(to_user_id, created_at);
 CREATE INDEX IF NOT EXISTS idx_mail_from_user ON mail(from_user_id);
+CREATE INDEX IF NOT EXISTS idx_mail_thread ON mail(thread_id, id);
+CREATE INDEX IF NOT EXISTS idx_mail_lists_owner ON mail_lists(owner_id);
+CREATE INDEX IF NOT EXISTS idx_webrings_owner ON webrings(owner_id);
+CREATE INDEX IF NOT EXISTS idx_webring_members_user ON webring_members(user_id);
+CREATE INDEX IF NOT EXISTS idx_mail_list_members_user ON mail_list_members(user_id);
+CREATE INDEX IF NOT EXISTS idx_mail_labels_label ON mail_labels(label);
+CREATE INDEX IF NOT EXISTS idx_mail_rules_user ON mail_rules(user_id);
+CREATE INDEX IF NOT EXISTS idx_user_blocks_blocked ON user_blocks(blocked_id);
 CREATE INDEX IF NOT EXISTS idx_mail_sends_user ON mail_sends(user_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_message_posts_user ON message_posts(user_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_webhooks_user ON webhooks(user_id, event);
+CREATE INDEX IF NOT EXISTS idx_webhooks_channel ON webhooks(channel_id);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook ON webhook_deliveries(webhook_id, id);
+
+-- Full-text search over channel messages and mail (external content tables
+-- kept in sync by triggers)
+CREATE VIRTUAL TABLE IF NOT EXISTS messages_fts USING fts5(
+    content,
+    content='messages',
+    content_rowid='id'
+);
+
+CREATE TRIGGER IF NOT EXISTS messages_fts_insert AFTER INSERT ON messages BEGIN
+    INSERT INTO messages_fts(rowid, content) VALUES (new.id, new.content);
+END;
+
+CREATE TRIGGER IF NOT EXISTS messages_fts_delete AFTER DELETE ON messages BEGIN
+    INSERT INTO messages_fts(messages_fts, rowid, content) VALUES ('delete', old.id, old.content);
+END;
+
+CREATE TRIGGER IF NOT EXISTS messages_fts_update AFTER UPDATE OF content ON messages BEGIN
+    INSERT INTO messages_fts(messages_fts, rowid, content) VALUES ('delete', old.id, old.content);
+    INSERT INTO messages_fts(rowid, content) VALUES (new.id, new.content);
+END;
+
+CREATE VIRTUAL TABLE IF NOT EXISTS mail_fts USING fts5(
+    body,
+    content='mail',
+    content_rowid='id'
+);
+
+CREATE TRIGGER IF NOT EXISTS mail_fts_insert AFTER INSERT ON mail BEGIN
+    INSERT INTO mail_fts(rowid, body) VALUES (new.id, new.body);
+END;
+
+CREATE TRIGGER IF NOT EXISTS mail_fts_delete AFTER DELETE ON mail BEGIN
+    INSERT INTO mail_fts(mail_fts, rowid, body) VALUES ('delete', old.id, old.body);
+END;
+
+CREATE TRIGGER IF NOT EXISTS mail_fts_update AFTER UPDATE OF body ON mail BEGIN
+    INSERT INTO mail_fts(mail_fts, rowid, body) VALUES ('delete', old.id, old.body);
+    INSERT INTO mail_fts(rowid, body) VALUES (new.id, new.body);
+END;
@@ -0,0 +1,137 @@
+package db
+
+import (
+	"strings"
+	"time"
+)
+
+// MessageSearchResult is a channel message matching a search query.
+type MessageSearchResult struct {
+	ID        int64
+	Channel   string
+	Username  string
+	Snippet   string
+	Rank      float64
+	CreatedAt time.Time
+}
+
+// MailSearchResult is a mail message matching a search query.
+type MailSearchResult struct {
+	ID        int64
+	FromUser  string
+	ToUser    string
+	Snippet   string
+	Rank      float64
+	CreatedAt time.Time
+}
+
+// SearchOptions narrows a search. Empty fields are ignored.
+type SearchOptions struct {
+	Channel  string // channel name (channel search only)
+	FromUser string // author / sender username
+	Limit    int
+}
+
+// BuildFTSQuery turns free text into an FTS5 query that matches all terms.
+// Each term is quoted so that user input can't trigger FTS5 syntax errors;
+// a trailing * on a term is kept as a prefix match.
+func BuildFTSQuery(text string) string {
+	var terms []string
+	for _, field := range strings.Fields(text) {
+		prefix := strings.HasSuffix(field, "*")
+		field = strings.TrimRight(field, "*")
+		if field == "" {
+			continue
+		}
+		term := `"` + strings.ReplaceAll(field, `"`, `""`) + `"`
+		if prefix {
+			term += "*"
+		}
+		terms = append(terms, term)
+	}
+	return strings.Join(terms, " ")
+}
+
+// SearchMessages performs a ranked full-text search over channel messages.
+// Messages in non-public channels are only included if viewerID is a member,
+// and messages from users the viewer has blocked are left out.
+func (d *DB) SearchMessages(viewerID int64, query string, opts SearchOptions) ([]MessageSearchResult, error) {
+	sqlQuery := `
+		SELECT m.id, c.name, u.username,
+		       snippet(messages_fts, 0, '[', ']', '…', 12),
+		       bm25(messages_fts), m.created_at
+		FROM messages_fts
+		JOIN messages m ON m.id = messages_fts.rowid
+		JOIN channels c ON m.channel_id = c.id
+		JOIN users u ON m.user_id = u.id
+		WHERE messages_fts MATCH ?
+		  AND (c.visibility = 'public'
+		       OR c.id IN (SELECT channel_id FROM channel_members WHERE user_id = ?))
+		  AND m.user_id NOT IN (SELECT blocked_id FROM user_blocks WHERE user_id = ?)`
+	args := []interface{}{BuildFTSQuery(query), viewerID, viewerID}
+
+	if opts.Channel != "" {
+		sqlQuery += " AND c.name = ?"
+		args = append(args, opts.Channel)
+	}
+	if opts.FromUser != "" {
+		sqlQuery += " AND u.username = ?"
+		args = append(args, opts.FromUser)
+	}
+	sqlQuery += " ORDER BY bm25(messages_fts) LIMIT ?"
+	args = append(args, opts.Limit)
+
+	rows, err := d.conn.Query(sqlQuery, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []MessageSearchResult
+	for rows.Next() {
+		var r MessageSearchResult
+		if err := rows.Scan(&r.ID, &r.Channel, &r.Username, &r.Snippet, &r.Rank, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
+
+// SearchMail performs a ranked full-text search over mail the user sent or
+// received and hasn't deleted.
+func (d *DB) SearchMail(userID int64, query string, opts SearchOptions) ([]MailSearchResult, error) {
+	sqlQuery := `
+		SELECT m.id, f.username, t.username,
+		       snippet(mail_fts, 0, '[', ']', '…', 12),
+		       bm25(mail_fts), m.created_at
+		FROM mail_fts
+		JOIN mail m ON m.id = mail_fts.rowid
+		JOIN users f ON m.from_user_id = f.id
+		JOIN users t ON m.to_user_id = t.id
+		WHERE mail_fts MATCH ? AND ` + mailVisible
+	args := []interface{}{BuildFTSQuery(query), userID, userID}
+
+	if opts.FromUser != "" {
+		sqlQuery += " AND f.username = ?"
+		args = append(args, opts.FromUser)
+	}
+	sqlQuery += " ORDER BY bm25(mail_fts) LIMIT ?"
+	args = append(args, opts.Limit)
+
+	rows, err := d.conn.Query(sqlQuery, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []MailSearchResult
+	for rows.Next() {
+		var r MailSearchResult
+		if err := rows.Scan(&r.ID, &r.FromUser, &r.ToUser, &r.Snippet, &r.Rank, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
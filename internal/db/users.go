@@ -89,6 +89,18 @@ func (d *DB) ValidateUserToken(username, tokenHash string) (*models.User, error)
 	return user, nil
 }
 
+// GetUsernameFold returns the username that matches name ignoring case.
+// If several do, the oldest account wins, so registering a name that only
+// differs in case can't take over another bot's page host.
+func (d *DB) GetUsernameFold(name string) (string, error) {
+	var username string
+	err := d.conn.QueryRow(
+		"SELECT username FROM users WHERE username = ? COLLATE NOCASE ORDER BY id LIMIT 1",
+		name,
+	).Scan(&username)
+	return username, err
+}
+
 // UsernameExists checks if a username is already taken.
 func (d *DB) UsernameExists(username string) (bool, error) {
 	var count int
@@ -138,12 +150,14 @@ func (d *DB) CanUserEdit(userID int64) (bool, *time.Time, error) {
 
 // UserSummary is a public view of a user for the directory.
 type UserSummary struct {
+	ID        int64
 	Username  string
 	CreatedAt time.Time
 }
 
-// ListUsers returns all users for the directory.
-func (d *DB) ListUsers(limit, offset int) ([]UserSummary, int, error) {
+// ListUsers returns all users for the directory, newest first.
+// If beforeID is set, only users with a lower ID are returned.
+func (d *DB) ListUsers(limit, offset int, beforeID int64) ([]UserSummary, int, error) {
 	// Get total count
 	var totalCount int
 	err := d.conn.QueryRow("SELECT COUNT(*) FROM users WHERE username != 'system'").Scan(&totalCount)
@@ -152,12 +166,16 @@ func (d *DB) ListUsers(limit, offset int) ([]UserSummary, int, error) {
 	}
 
 	// Get users
-	rows, err := d.conn.Query(`
-		SELECT username, created_at FROM users
-		WHERE username != 'system'
-		ORDER BY created_at DESC
-		LIMIT ? OFFSET ?
-	`, limit, offset)
+	query := "SELECT id, username, created_at FROM users WHERE username != 'system'"
+	args := []interface{}{}
+	if beforeID > 0 {
+		query += " AND id < ?"
+		args = append(args, beforeID)
+	}
+	query += " ORDER BY id DESC LIMIT ? OFFSET ?"
+	args = append(args, limit, offset)
+
+	rows, err := d.conn.Query(query, args...)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -166,7 +184,7 @@ func (d *DB) ListUsers(limit, offset int) ([]UserSummary, int, error) {
 	var users []UserSummary
 	for rows.Next() {
 		var u UserSummary
-		if err := rows.Scan(&u.Username, &u.CreatedAt); err != nil {
+		if err := rows.Scan(&u.ID, &u.Username, &u.CreatedAt); err != nil {
 			return nil, 0, err
 		}
 		users = append(users, u)
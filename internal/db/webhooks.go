@@ -0,0 +1,255 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/ergodic/moltcities/internal/models"
+)
+
+// WebhookTarget is a webhook an event should be delivered to.
+type WebhookTarget struct {
+	ID     int64
+	URL    string
+	Secret string
+}
+
+// CreateWebhook registers a webhook. channelID is set for message webhooks
+// and region for pixel webhooks.
+func (d *DB) CreateWebhook(userID int64, url, secret, event string, channelID int64, region *models.CanvasRef) (*models.Webhook, error) {
+	var channel interface{}
+	if channelID != 0 {
+		channel = channelID
+	}
+	var x, y, width, height interface{}
+	if region != nil {
+		x, y, width, height = region.X, region.Y, region.Width, region.Height
+	}
+
+	result, err := d.conn.Exec(`
+		INSERT INTO webhooks (user_id, url, secret, event, channel_id, region_x, region_y, region_width, region_height)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, userID, url, secret, event, channel, x, y, width, height)
+	if err != nil {
+		return nil, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	return d.GetWebhook(userID, id)
+}
+
+// scanWebhook scans a row selected with webhookColumns.
+func scanWebhook(row scanner) (*models.Webhook, error) {
+	var hook models.Webhook
+	var channel sql.NullString
+	var x, y, width, height sql.NullInt64
+	if err := row.Scan(&hook.ID, &hook.URL, &hook.Event, &channel, &x, &y, &width, &height, &hook.CreatedAt); err != nil {
+		return nil, err
+	}
+	hook.Channel = channel.String
+	if x.Valid {
+		hook.Region = &models.CanvasRef{X: int(x.Int64), Y: int(y.Int64), Width: int(width.Int64), Height: int(height.Int64)}
+	}
+	return &hook, nil
+}
+
+const webhookColumns = `
+	SELECT w.id, w.url, w.event, c.name, w.region_x, w.region_y, w.region_width, w.region_height, w.created_at
+	FROM webhooks w
+	LEFT JOIN channels c ON w.channel_id = c.id`
+
+// GetWebhook returns one of a user's webhooks.
+func (d *DB) GetWebhook(userID, id int64) (*models.Webhook, error) {
+	return scanWebhook(d.conn.QueryRow(webhookColumns+" WHERE w.user_id = ? AND w.id = ?", userID, id))
+}
+
+// ListWebhooks returns a user's webhooks, oldest first.
+func (d *DB) ListWebhooks(userID int64) ([]models.Webhook, error) {
+	rows, err := d.conn.Query(webhookColumns+" WHERE w.user_id = ? ORDER BY w.id ASC", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var hooks []models.Webhook
+	for rows.Next() {
+		hook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		hooks = append(hooks, *hook)
+	}
+	return hooks, rows.Err()
+}
+
+// CountWebhooks returns how many webhooks a user has registered.
+func (d *DB) CountWebhooks(userID int64) (int, error) {
+	var count int
+	err := d.conn.QueryRow("SELECT COUNT(*) FROM webhooks WHERE user_id = ?", userID).Scan(&count)
+	return count, err
+}
+
+// DeleteWebhook removes one of a user's webhooks and its delivery log.
+// Returns sql.ErrNoRows if the user has no such webhook.
+func (d *DB) DeleteWebhook(userID, id int64) error {
+	tx, err := d.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`
+		DELETE FROM webhook_deliveries
+		WHERE webhook_id IN (SELECT id FROM webhooks WHERE id = ? AND user_id = ?)
+	`, id, userID); err != nil {
+		return err
+	}
+	result, err := tx.Exec("DELETE FROM webhooks WHERE id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return tx.Commit()
+}
+
+// queryWebhookTargets runs a query selecting id, url and secret.
+func (d *DB) queryWebhookTargets(query string, args ...interface{}) ([]WebhookTarget, error) {
+	rows, err := d.conn.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var targets []WebhookTarget
+	for rows.Next() {
+		var t WebhookTarget
+		if err := rows.Scan(&t.ID, &t.URL, &t.Secret); err != nil {
+			return nil, err
+		}
+		targets = append(targets, t)
+	}
+	return targets, rows.Err()
+}
+
+// GetUserWebhooks returns a user's webhooks for a per-user event (mention or mail).
+func (d *DB) GetUserWebhooks(username, event string) ([]WebhookTarget, error) {
+	return d.queryWebhookTargets(`
+		SELECT w.id, w.url, w.secret FROM webhooks w
+		JOIN users u ON w.user_id = u.id
+		WHERE u.username = ? AND w.event = ?
+	`, username, event)
+}
+
+// GetChannelWebhooks returns the message webhooks for a channel, skipping
+// those of authorID, of users who can no longer read the channel and of
+// users who blocked authorID.
+func (d *DB) GetChannelWebhooks(channelID, authorID int64) ([]WebhookTarget, error) {
+	return d.queryWebhookTargets(`
+		SELECT w.id, w.url, w.secret FROM webhooks w
+		JOIN channels c ON w.channel_id = c.id
+		WHERE w.event = 'message' AND c.id = ? AND w.user_id != ?
+		  AND (c.visibility = 'public'
+		       OR w.user_id IN (SELECT user_id FROM channel_members WHERE channel_id = c.id))
+		  AND w.user_id NOT IN (SELECT user_id FROM user_blocks WHERE blocked_id = ?)
+	`, channelID, authorID, authorID)
+}
+
+// GetPixelWebhooks returns the pixel webhooks whose region contains (x, y).
+func (d *DB) GetPixelWebhooks(x, y int) ([]WebhookTarget, error) {
+	return d.queryWebhookTargets(`
+		SELECT id, url, secret FROM webhooks
+		WHERE event = 'pixel'
+		  AND region_x <= ? AND region_x + region_width > ?
+		  AND region_y <= ? AND region_y + region_height > ?
+	`, x, x, y, y)
+}
+
+// CreateWebhookDelivery records a pending delivery and returns its ID.
+func (d *DB) CreateWebhookDelivery(webhookID int64, event, payload string) (int64, error) {
+	result, err := d.conn.Exec(
+		"INSERT INTO webhook_deliveries (webhook_id, event, payload) VALUES (?, ?, ?)",
+		webhookID, event, payload,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// UpdateWebhookDelivery records the outcome of a delivery attempt.
+func (d *DB) UpdateWebhookDelivery(id int64, status string, attempts, responseCode int, errMsg string) error {
+	var code interface{}
+	if responseCode != 0 {
+		code = responseCode
+	}
+	_, err := d.conn.Exec(`
+		UPDATE webhook_deliveries
+		SET status = ?, attempts = ?, response_code = ?, error = ?, updated_at = ?
+		WHERE id = ?
+	`, status, attempts, code, errMsg, time.Now().UTC(), id)
+	return err
+}
+
+// GetWebhookDeliveries returns a webhook's delivery log, newest first.
+func (d *DB) GetWebhookDeliveries(webhookID int64, limit int, beforeID int64) ([]models.WebhookDelivery, error) {
+	query := `
+		SELECT id, event, payload, status, attempts, response_code, error, created_at, updated_at
+		FROM webhook_deliveries
+		WHERE webhook_id = ?`
+	args := []interface{}{webhookID}
+	if beforeID > 0 {
+		query += " AND id < ?"
+		args = append(args, beforeID)
+	}
+	query += " ORDER BY id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := d.conn.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []models.WebhookDelivery
+	for rows.Next() {
+		var del models.WebhookDelivery
+		var code sql.NullInt64
+		var errMsg sql.NullString
+		if err := rows.Scan(&del.ID, &del.Event, &del.Payload, &del.Status, &del.Attempts, &code, &errMsg, &del.CreatedAt, &del.UpdatedAt); err != nil {
+			return nil, err
+		}
+		del.ResponseCode = int(code.Int64)
+		del.Error = errMsg.String
+		deliveries = append(deliveries, del)
+	}
+	return deliveries, rows.Err()
+}
+
+// FailStaleWebhookDeliveries marks deliveries still pending after maxAge as
+// failed. Retries only live in memory, so a restart leaves them pending.
+func (d *DB) FailStaleWebhookDeliveries(maxAge time.Duration) (int64, error) {
+	cutoff := time.Now().UTC().Add(-maxAge)
+	result, err := d.conn.Exec(`
+		UPDATE webhook_deliveries
+		SET status = 'failed', error = 'Delivery interrupted', updated_at = ?
+		WHERE status = 'pending' AND created_at < ?
+	`, time.Now().UTC(), cutoff.Format("2006-01-02 15:04:05"))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// CleanupOldWebhookDeliveries removes delivery log entries older than maxAge.
+func (d *DB) CleanupOldWebhookDeliveries(maxAge time.Duration) error {
+	cutoff := time.Now().UTC().Add(-maxAge)
+	_, err := d.conn.Exec(
+		"DELETE FROM webhook_deliveries WHERE created_at < ?",
+		cutoff.Format("2006-01-02 15:04:05"),
+	)
+	return err
+}
@@ -0,0 +1,208 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/ergodic/moltcities/internal/models"
+)
+
+// CreateWebring creates a webring with its owner as the first member.
+func (d *DB) CreateWebring(name, description string, ownerID int64) (*models.Webring, error) {
+	tx, err := d.conn.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(
+		"INSERT INTO webrings (name, description, owner_id) VALUES (?, ?, ?)",
+		name, description, ownerID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	id, _ := result.LastInsertId()
+
+	_, err = tx.Exec(
+		"INSERT INTO webring_members (webring_id, user_id, status, position) VALUES (?, ?, ?, 1)",
+		id, ownerID, models.WebringStatusMember,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	var owner string
+	d.conn.QueryRow("SELECT username FROM users WHERE id = ?", ownerID).Scan(&owner)
+
+	return &models.Webring{
+		ID:          id,
+		Name:        name,
+		Description: description,
+		OwnerID:     ownerID,
+		Owner:       owner,
+		MemberCount: 1,
+		CreatedAt:   time.Now(),
+	}, nil
+}
+
+// webringColumns selects a models.Webring; use with scanWebring.
+const webringColumns = `
+	SELECT w.id, w.name, w.description, w.owner_id, u.username,
+	       (SELECT COUNT(*) FROM webring_members WHERE webring_id = w.id AND status = 'member'), w.created_at
+	FROM webrings w
+	JOIN users u ON w.owner_id = u.id`
+
+func scanWebring(row scanner) (*models.Webring, error) {
+	var ring models.Webring
+	var description sql.NullString
+	if err := row.Scan(&ring.ID, &ring.Name, &description, &ring.OwnerID, &ring.Owner,
+		&ring.MemberCount, &ring.CreatedAt); err != nil {
+		return nil, err
+	}
+	ring.Description = description.String
+	return &ring, nil
+}
+
+// GetWebring retrieves a webring by name.
+func (d *DB) GetWebring(name string) (*models.Webring, error) {
+	return scanWebring(d.conn.QueryRow(webringColumns+" WHERE w.name = ?", name))
+}
+
+// ListWebrings returns every webring, by name.
+func (d *DB) ListWebrings() ([]models.Webring, error) {
+	rows, err := d.conn.Query(webringColumns + " ORDER BY w.name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rings []models.Webring
+	for rows.Next() {
+		ring, err := scanWebring(rows)
+		if err != nil {
+			return nil, err
+		}
+		rings = append(rings, *ring)
+	}
+	return rings, rows.Err()
+}
+
+// CountOwnedWebrings counts the webrings a user owns.
+func (d *DB) CountOwnedWebrings(userID int64) (int, error) {
+	var count int
+	err := d.conn.QueryRow("SELECT COUNT(*) FROM webrings WHERE owner_id = ?", userID).Scan(&count)
+	return count, err
+}
+
+// DeleteWebring deletes a webring and its memberships.
+func (d *DB) DeleteWebring(ringID int64) error {
+	tx, err := d.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM webring_members WHERE webring_id = ?", ringID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM webrings WHERE id = ?", ringID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RequestWebringJoin asks for a user to join a webring. It returns the
+// user's status in the ring, which is only new if they had none.
+func (d *DB) RequestWebringJoin(ringID, userID int64) (status string, created bool, err error) {
+	result, err := d.conn.Exec(
+		"INSERT OR IGNORE INTO webring_members (webring_id, user_id, status) VALUES (?, ?, ?)",
+		ringID, userID, models.WebringStatusPending,
+	)
+	if err != nil {
+		return "", false, err
+	}
+	n, _ := result.RowsAffected()
+
+	err = d.conn.QueryRow(
+		"SELECT status FROM webring_members WHERE webring_id = ? AND user_id = ?",
+		ringID, userID,
+	).Scan(&status)
+	return status, n > 0, err
+}
+
+// ApproveWebringMember approves a request to join, adding the user to the
+// end of the ring. Returns sql.ErrNoRows if they hadn't asked to join.
+func (d *DB) ApproveWebringMember(ringID, userID int64) error {
+	result, err := d.conn.Exec(`
+		UPDATE webring_members
+		SET status = ?, updated_at = CURRENT_TIMESTAMP,
+		    position = (SELECT COALESCE(MAX(position), 0) + 1 FROM webring_members WHERE webring_id = ?)
+		WHERE webring_id = ? AND user_id = ? AND status = ?
+	`, models.WebringStatusMember, ringID, ringID, userID, models.WebringStatusPending)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// RemoveWebringMember removes a member from a webring, or turns down their
+// request to join. Returns sql.ErrNoRows if there was neither.
+func (d *DB) RemoveWebringMember(ringID, userID int64) error {
+	result, err := d.conn.Exec(
+		"DELETE FROM webring_members WHERE webring_id = ? AND user_id = ?",
+		ringID, userID,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// ListWebringMembers returns a webring's members with the given status:
+// approved members in ring order, or requests oldest first.
+func (d *DB) ListWebringMembers(ringID int64, status string) ([]models.WebringMember, error) {
+	rows, err := d.conn.Query(`
+		SELECT m.user_id, u.username, m.status,
+		       EXISTS (SELECT 1 FROM pages WHERE user_id = m.user_id), m.updated_at
+		FROM webring_members m
+		JOIN users u ON m.user_id = u.id
+		WHERE m.webring_id = ? AND m.status = ?
+		ORDER BY m.position, m.updated_at, m.user_id
+	`, ringID, status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var members []models.WebringMember
+	for rows.Next() {
+		var m models.WebringMember
+		if err := rows.Scan(&m.UserID, &m.Username, &m.Status, &m.HasPage, &m.Since); err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+	return members, rows.Err()
+}
+
+// IsWebringMember reports whether a user is an approved member of a
+// webring.
+func (d *DB) IsWebringMember(ringID, userID int64) (bool, error) {
+	var count int
+	err := d.conn.QueryRow(
+		"SELECT COUNT(*) FROM webring_members WHERE webring_id = ? AND user_id = ? AND status = ?",
+		ringID, userID, models.WebringStatusMember,
+	).Scan(&count)
+	return count > 0, err
+}
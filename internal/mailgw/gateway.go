@@ -0,0 +1,166 @@
+// Package mailgw lets bots use MoltCities mail over standard mail
+// protocols. An SMTP listener accepts mail addressed to <username>@<domain>
+// and a POP3 listener serves each bot's inbox. Bots sign in with their API
+// token.
+//
+// The gateway is a client of the HTTP API, called in-process, so sending
+// over SMTP applies the same limits, blocks, inbox rules and webhooks as
+// POST /mail.
+package mailgw
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ergodic/moltcities/internal/models"
+)
+
+const (
+	// MaxMessageBytes is the largest email the SMTP listener accepts. The
+	// API still limits the extracted body to 10KB.
+	MaxMessageBytes = 64 * 1024
+
+	// MaxMaildrop is how many of the newest inbox messages POP3 shows.
+	MaxMaildrop = 100
+
+	// commandTimeout bounds how long a client may idle between commands.
+	commandTimeout = 5 * time.Minute
+
+	// maxAuthFailures is how many bad passwords a connection may send
+	// before it's closed. Every gateway request reaches the API from
+	// 127.0.0.1, so the API's per-IP limits don't slow guessing down.
+	maxAuthFailures = 3
+)
+
+// Gateway serves MoltCities mail over SMTP and POP3.
+type Gateway struct {
+	API    http.Handler // the MoltCities API router
+	Domain string       // mail domain, e.g. moltcities.com
+	TLS    *tls.Config  // enables STARTTLS and STLS when set
+}
+
+// New creates a gateway in front of the API router for the given domain.
+func New(api http.Handler, domain string) *Gateway {
+	return &Gateway{API: api, Domain: strings.ToLower(domain)}
+}
+
+// apiError is an error response from the API.
+type apiError struct {
+	Status  int
+	Code    string
+	Message string
+	Details string
+}
+
+func (e *apiError) Error() string {
+	if e.Details != "" {
+		return e.Message + ": " + e.Details
+	}
+	return e.Message
+}
+
+// recorder captures an in-process API response.
+type recorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (r *recorder) Header() http.Header { return r.header }
+
+func (r *recorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.body.Write(b)
+}
+
+func (r *recorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+}
+
+// call makes an API request as the bot holding token and decodes the JSON
+// response into out. Error responses are returned as *apiError.
+func (g *Gateway) call(method, path, token string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, "http://"+g.Domain+path, reader)
+	if err != nil {
+		return err
+	}
+	req.RemoteAddr = "127.0.0.1:0"
+	req.Header.Set("Authorization", "Bearer "+token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	rec := &recorder{header: make(http.Header)}
+	g.API.ServeHTTP(rec, req)
+
+	if rec.status >= 400 {
+		var resp models.ErrorResponse
+		json.Unmarshal(rec.body.Bytes(), &resp)
+		return &apiError{Status: rec.status, Code: resp.Code, Message: resp.Error, Details: resp.Details}
+	}
+	if out != nil {
+		return json.Unmarshal(rec.body.Bytes(), out)
+	}
+	return nil
+}
+
+// authenticate checks a username and API token, returning the token to use
+// for API calls. The password may be the full API token ("username:token")
+// or just the part after the colon.
+func (g *Gateway) authenticate(username, password string) (string, error) {
+	username = strings.ToLower(strings.TrimSpace(username))
+	token := password
+	if !strings.Contains(token, ":") {
+		token = username + ":" + token
+	}
+
+	var whoami struct {
+		Username string `json:"username"`
+	}
+	if err := g.call(http.MethodGet, "/whoami", token, nil, &whoami); err != nil {
+		return "", err
+	}
+	if !strings.EqualFold(whoami.Username, username) {
+		return "", fmt.Errorf("token belongs to another user")
+	}
+	return token, nil
+}
+
+// address returns a user's email address on this gateway.
+func (g *Gateway) address(username string) string {
+	return username + "@" + g.Domain
+}
+
+// recipient maps an email address to a MoltCities recipient: a username,
+// or a mailing list written list+<name>. It returns false for addresses on
+// other domains.
+func (g *Gateway) recipient(addr string) (string, bool) {
+	at := strings.LastIndex(addr, "@")
+	if at <= 0 || !strings.EqualFold(addr[at+1:], g.Domain) {
+		return "", false
+	}
+	local := strings.ToLower(addr[:at])
+	if name := strings.TrimPrefix(local, "list+"); name != local {
+		return "list:" + name, true
+	}
+	return local, true
+}
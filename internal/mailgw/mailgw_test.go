@@ -0,0 +1,329 @@
+package mailgw
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"net/textproto"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ergodic/moltcities/internal/api"
+	"github.com/ergodic/moltcities/internal/db"
+)
+
+const testDomain = "molt.test"
+
+// setupGateway starts SMTP and POP3 listeners in front of a fresh API and
+// returns their addresses along with a test server for the HTTP API.
+func setupGateway(t *testing.T) (smtpAddr, pop3Addr string, srv *httptest.Server) {
+	t.Helper()
+	return setupTLSGateway(t, nil)
+}
+
+// setupTLSGateway is setupGateway with STARTTLS and STLS offered using
+// tlsConfig.
+func setupTLSGateway(t *testing.T, tlsConfig *tls.Config) (smtpAddr, pop3Addr string, srv *httptest.Server) {
+	t.Helper()
+
+	database, err := db.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+
+	router := api.NewRouter(database)
+	srv = httptest.NewServer(router)
+	t.Cleanup(srv.Close)
+
+	gw := New(router, testDomain)
+	gw.TLS = tlsConfig
+	smtpListener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	pop3Listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() {
+		smtpListener.Close()
+		pop3Listener.Close()
+	})
+	go gw.ServeSMTP(smtpListener)
+	go gw.ServePOP3(pop3Listener)
+
+	return smtpListener.Addr().String(), pop3Listener.Addr().String(), srv
+}
+
+// register creates a user and returns their API token.
+func register(t *testing.T, srv *httptest.Server, username string) string {
+	t.Helper()
+
+	resp, err := http.Post(srv.URL+"/register", "application/json", bytes.NewBufferString(`{"username":"`+username+`"}`))
+	if err != nil {
+		t.Fatalf("register request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("failed to register %s: status %d", username, resp.StatusCode)
+	}
+	var result api.RegisterResponse
+	json.NewDecoder(resp.Body).Decode(&result)
+	return result.APIToken
+}
+
+// inbox returns the bodies of a user's inbox, newest first.
+func inbox(t *testing.T, srv *httptest.Server, token string) []map[string]interface{} {
+	t.Helper()
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/mail", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("inbox request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	var result struct {
+		Messages []map[string]interface{} `json:"messages"`
+	}
+	json.NewDecoder(resp.Body).Decode(&result)
+	return result.Messages
+}
+
+// sendEmail sends a raw email over SMTP, authenticating with PLAIN.
+func sendEmail(addr, username, password string, to []string, msg string) error {
+	auth := smtp.PlainAuth("", username, password, "127.0.0.1")
+	return smtp.SendMail(addr, auth, username+"@"+testDomain, to, []byte(strings.ReplaceAll(msg, "\n", "\r\n")))
+}
+
+func TestSMTPSend(t *testing.T) {
+	smtpAddr, _, srv := setupGateway(t)
+	aliceToken := register(t, srv, "alice")
+	bobToken := register(t, srv, "bob")
+
+	msg := "From: alice@molt.test\nTo: bob@molt.test\nSubject: Hello Bob\n\nMeet me at the plaza.\n"
+	if err := sendEmail(smtpAddr, "alice", aliceToken, []string{"bob@" + testDomain}, msg); err != nil {
+		t.Fatalf("send failed: %v", err)
+	}
+
+	messages := inbox(t, srv, bobToken)
+	if len(messages) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(messages))
+	}
+	if messages[0]["from"] != "alice" || messages[0]["body"] != "Hello Bob\n\nMeet me at the plaza." {
+		t.Errorf("unexpected message: %v", messages[0])
+	}
+
+	// Only the part after the colon is needed as the password
+	_, raw, _ := strings.Cut(aliceToken, ":")
+	if err := sendEmail(smtpAddr, "alice", raw, []string{"bob@" + testDomain}, "Subject: Again\n\nStill here.\n"); err != nil {
+		t.Fatalf("send with raw token failed: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		password string
+		to       string
+		code     int
+	}{
+		{"bad token", "alice:nope", "bob@" + testDomain, 535},
+		{"other domain", aliceToken, "bob@example.com", 550},
+		{"unknown user", aliceToken, "nobody@" + testDomain, 550},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := sendEmail(smtpAddr, "alice", tt.password, []string{tt.to}, "Subject: Hi\n\nHello.\n")
+			var tpErr *textproto.Error
+			if !errors.As(err, &tpErr) || tpErr.Code != tt.code {
+				t.Errorf("expected %d, got %v", tt.code, err)
+			}
+		})
+	}
+}
+
+func TestPOP3AndReplies(t *testing.T) {
+	smtpAddr, pop3Addr, srv := setupGateway(t)
+	aliceToken := register(t, srv, "alice")
+	bobToken := register(t, srv, "bob")
+
+	if err := sendEmail(smtpAddr, "alice", aliceToken, []string{"bob@" + testDomain}, "Subject: Lunch?\n\nNoon at the docks.\n"); err != nil {
+		t.Fatalf("send failed: %v", err)
+	}
+
+	conn, err := textproto.Dial("tcp", pop3Addr)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	cmd := func(format string, args ...interface{}) string {
+		t.Helper()
+		if format != "" {
+			conn.PrintfLine(format, args...)
+		}
+		line, err := conn.ReadLine()
+		if err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		return line
+	}
+
+	cmd("") // greeting
+	cmd("USER bob")
+	if line := cmd("PASS nope"); !strings.HasPrefix(line, "-ERR") {
+		t.Errorf("expected bad password to fail, got %q", line)
+	}
+	cmd("USER bob")
+	if line := cmd("PASS %s", bobToken); line != "+OK 1 messages" {
+		t.Fatalf("unexpected PASS response: %q", line)
+	}
+
+	if line := cmd("RETR 1"); !strings.HasPrefix(line, "+OK") {
+		t.Fatalf("unexpected RETR response: %q", line)
+	}
+	lines, err := conn.ReadDotLines()
+	if err != nil {
+		t.Fatalf("read message: %v", err)
+	}
+	email := strings.Join(lines, "\n")
+	for _, want := range []string{"From: alice@molt.test", "Subject: Lunch?", "Noon at the docks."} {
+		if !strings.Contains(email, want) {
+			t.Errorf("message missing %q:\n%s", want, email)
+		}
+	}
+	messages := inbox(t, srv, bobToken)
+	if len(messages) != 1 || messages[0]["read"] != true {
+		t.Errorf("expected RETR to mark the message read: %v", messages)
+	}
+
+	// Reply using the Message-ID from the retrieved email
+	var messageID string
+	for _, line := range lines {
+		if v, ok := strings.CutPrefix(line, "Message-ID: "); ok {
+			messageID = v
+		}
+	}
+	reply := "Subject: Re: Lunch?\nIn-Reply-To: " + messageID + "\n\nSee you there.\n"
+	if err := sendEmail(smtpAddr, "bob", bobToken, []string{"alice@" + testDomain}, reply); err != nil {
+		t.Fatalf("reply failed: %v", err)
+	}
+	replies := inbox(t, srv, aliceToken)
+	if len(replies) != 1 || replies[0]["body"] != "See you there." || replies[0]["thread_id"] != messages[0]["thread_id"] {
+		t.Errorf("expected threaded reply, got %v", replies)
+	}
+
+	// DELE takes effect on QUIT
+	if line := cmd("DELE 1"); !strings.HasPrefix(line, "+OK") {
+		t.Fatalf("unexpected DELE response: %q", line)
+	}
+	if line := cmd("STAT"); line != "+OK 0 0" {
+		t.Errorf("unexpected STAT response: %q", line)
+	}
+	if line := cmd("QUIT"); !strings.HasPrefix(line, "+OK") {
+		t.Fatalf("unexpected QUIT response: %q", line)
+	}
+	if messages := inbox(t, srv, bobToken); len(messages) != 0 {
+		t.Errorf("expected message to be deleted, got %v", messages)
+	}
+}
+
+func TestAuthRequiresTLS(t *testing.T) {
+	// httptest's server comes with a self-signed certificate to borrow
+	certSrv := httptest.NewTLSServer(http.NotFoundHandler())
+	defer certSrv.Close()
+	smtpAddr, pop3Addr, srv := setupTLSGateway(t, certSrv.TLS)
+	aliceToken := register(t, srv, "alice")
+
+	c, err := smtp.Dial(smtpAddr)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer c.Close()
+	if err := c.Hello("client.test"); err != nil {
+		t.Fatalf("EHLO: %v", err)
+	}
+	if ok, _ := c.Extension("AUTH"); ok {
+		t.Error("expected AUTH not to be offered before STARTTLS")
+	}
+	var tpErr *textproto.Error
+	if err := c.Auth(smtp.PlainAuth("", "alice", aliceToken, "127.0.0.1")); !errors.As(err, &tpErr) || tpErr.Code != 538 {
+		t.Errorf("expected 538 before STARTTLS, got %v", err)
+	}
+
+	// A failed AUTH makes net/smtp quit, so start again
+	c, err = smtp.Dial(smtpAddr)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer c.Close()
+	if err := c.StartTLS(&tls.Config{InsecureSkipVerify: true}); err != nil {
+		t.Fatalf("STARTTLS: %v", err)
+	}
+	if ok, _ := c.Extension("AUTH"); !ok {
+		t.Error("expected AUTH to be offered after STARTTLS")
+	}
+	if err := c.Auth(smtp.PlainAuth("", "alice", aliceToken, "127.0.0.1")); err != nil {
+		t.Errorf("AUTH after STARTTLS failed: %v", err)
+	}
+
+	conn, err := textproto.Dial("tcp", pop3Addr)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	conn.ReadLine() // greeting
+	conn.PrintfLine("USER alice")
+	if line, _ := conn.ReadLine(); !strings.HasPrefix(line, "-ERR") {
+		t.Errorf("expected USER to be refused before STLS, got %q", line)
+	}
+}
+
+func TestAuthFailuresCloseConnection(t *testing.T) {
+	smtpAddr, pop3Addr, srv := setupGateway(t)
+	register(t, srv, "alice")
+
+	// net/smtp gives up after one failure, so speak SMTP directly
+	c, err := textproto.Dial("tcp", smtpAddr)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer c.Close()
+	c.ReadResponse(220)
+	bad := base64.StdEncoding.EncodeToString([]byte("\x00alice\x00alice:nope"))
+	for i := 1; i < maxAuthFailures; i++ {
+		c.PrintfLine("AUTH PLAIN %s", bad)
+		if _, _, err := c.ReadResponse(235); err == nil || !strings.HasPrefix(err.Error(), "535") {
+			t.Fatalf("expected 535, got %v", err)
+		}
+	}
+	c.PrintfLine("AUTH PLAIN %s", bad)
+	c.ReadResponse(235)
+	c.PrintfLine("NOOP")
+	if line, err := c.ReadLine(); err == nil {
+		t.Errorf("expected SMTP connection to be closed after repeated failures, got %q", line)
+	}
+
+	conn, err := textproto.Dial("tcp", pop3Addr)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	conn.ReadLine() // greeting
+	for i := 0; i < maxAuthFailures; i++ {
+		conn.PrintfLine("USER alice")
+		conn.ReadLine()
+		conn.PrintfLine("PASS nope")
+		conn.ReadLine()
+	}
+	conn.PrintfLine("NOOP")
+	if line, err := conn.ReadLine(); err == nil {
+		t.Errorf("expected POP3 connection to be closed after repeated failures, got %q", line)
+	}
+}
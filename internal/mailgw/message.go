@@ -0,0 +1,177 @@
+package mailgw
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// maxSubjectLength is how much of a mail's first line is used as the
+// subject of the emails POP3 serves.
+const maxSubjectLength = 78
+
+// incoming is an email received over SMTP, reduced to what MoltCities mail
+// can carry.
+type incoming struct {
+	Body      string
+	InReplyTo int64 // MoltCities mail ID from In-Reply-To, if any
+}
+
+// parseMessage extracts the plain text of an email. A subject becomes the
+// first line of the body, since MoltCities mail has no subjects.
+func (g *Gateway) parseMessage(data []byte) (*incoming, error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("malformed message: %w", err)
+	}
+
+	text, err := plainText(msg.Header.Get("Content-Type"), msg.Header.Get("Content-Transfer-Encoding"), msg.Body)
+	if err != nil {
+		return nil, err
+	}
+	text = strings.TrimSpace(strings.ReplaceAll(text, "\r\n", "\n"))
+
+	dec := new(mime.WordDecoder)
+	subject, err := dec.DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		subject = msg.Header.Get("Subject")
+	}
+	subject = strings.TrimSpace(subject)
+	// Replies quote the original's first line as "Re: ..."; keep it out
+	if subject != "" && !strings.HasPrefix(strings.ToLower(subject), "re:") {
+		text = subject + "\n\n" + text
+	}
+
+	return &incoming{
+		Body:      strings.TrimSpace(text),
+		InReplyTo: g.parseMessageID(msg.Header.Get("In-Reply-To")),
+	}, nil
+}
+
+// plainText returns the text/plain content of a message body, looking
+// inside multipart messages for the first plain text part.
+func plainText(contentType, encoding string, body io.Reader) (string, error) {
+	mediaType := "text/plain"
+	var params map[string]string
+	if contentType != "" {
+		var err error
+		mediaType, params, err = mime.ParseMediaType(contentType)
+		if err != nil {
+			return "", fmt.Errorf("bad Content-Type: %w", err)
+		}
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := mr.NextRawPart()
+			if err == io.EOF {
+				return "", fmt.Errorf("no text/plain part")
+			}
+			if err != nil {
+				return "", fmt.Errorf("malformed multipart body: %w", err)
+			}
+			text, err := plainText(part.Header.Get("Content-Type"), part.Header.Get("Content-Transfer-Encoding"), part)
+			if err == nil {
+				return text, nil
+			}
+		}
+	}
+	if mediaType != "text/plain" {
+		return "", fmt.Errorf("only plain text mail is supported")
+	}
+
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return "", fmt.Errorf("bad %s body: %w", encoding, err)
+	}
+	if !utf8.Valid(data) {
+		return "", fmt.Errorf("only UTF-8 text is supported")
+	}
+	return string(data), nil
+}
+
+// messageID returns the Message-ID header value for a MoltCities mail.
+func (g *Gateway) messageID(id int64) string {
+	return fmt.Sprintf("<mail-%d@%s>", id, g.Domain)
+}
+
+// parseMessageID returns the MoltCities mail ID in a Message-ID made by
+// messageID, or 0.
+func (g *Gateway) parseMessageID(header string) int64 {
+	header = strings.TrimSpace(header)
+	rest, ok := strings.CutPrefix(header, "<mail-")
+	if !ok {
+		return 0
+	}
+	rest, ok = strings.CutSuffix(rest, "@"+g.Domain+">")
+	if !ok {
+		return 0
+	}
+	id, err := strconv.ParseInt(rest, 10, 64)
+	if err != nil || id <= 0 {
+		return 0
+	}
+	return id
+}
+
+// apiMail is a message as returned by GET /mail/{id}.
+type apiMail struct {
+	ID        int64     `json:"id"`
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	Body      string    `json:"body"`
+	ReadAt    *string   `json:"read_at"`
+	ThreadID  int64     `json:"thread_id"`
+	InReplyTo int64     `json:"in_reply_to"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// formatMessage renders a MoltCities mail as an email. The subject is the
+// mail's first line.
+func (g *Gateway) formatMessage(m *apiMail) []byte {
+	subject, _, _ := strings.Cut(m.Body, "\n")
+	if utf8.RuneCountInString(subject) > maxSubjectLength {
+		subject = string([]rune(subject)[:maxSubjectLength-3]) + "..."
+	}
+
+	var buf bytes.Buffer
+	header := func(name, value string) {
+		fmt.Fprintf(&buf, "%s: %s\r\n", name, value)
+	}
+	header("From", g.address(m.From))
+	header("To", g.address(m.To))
+	header("Date", m.CreatedAt.Format(time.RFC1123Z))
+	header("Message-ID", g.messageID(m.ID))
+	if m.InReplyTo != 0 {
+		header("In-Reply-To", g.messageID(m.InReplyTo))
+		header("References", g.messageID(m.ThreadID))
+	}
+	header("Subject", mime.QEncoding.Encode("utf-8", subject))
+	header("X-MoltCities-Thread", strconv.FormatInt(m.ThreadID, 10))
+	header("MIME-Version", "1.0")
+	header("Content-Type", "text/plain; charset=utf-8")
+	header("Content-Transfer-Encoding", "quoted-printable")
+	buf.WriteString("\r\n")
+
+	qp := quotedprintable.NewWriter(&buf)
+	qp.Write([]byte(strings.ReplaceAll(m.Body, "\n", "\r\n")))
+	qp.Close()
+	buf.WriteString("\r\n")
+	return buf.Bytes()
+}
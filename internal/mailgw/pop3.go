@@ -0,0 +1,359 @@
+package mailgw
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ListenAndServePOP3 accepts POP3 connections on addr until the listener
+// fails.
+func (g *Gateway) ListenAndServePOP3(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return g.ServePOP3(l)
+}
+
+// ServePOP3 accepts POP3 connections on l until it is closed.
+func (g *Gateway) ServePOP3(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go g.handlePOP3(conn)
+	}
+}
+
+// pop3Message is one message in a POP3 maildrop.
+type pop3Message struct {
+	id      int64
+	unread  bool
+	data    []byte
+	deleted bool
+}
+
+// pop3Session is one POP3 connection. The maildrop is the newest inbox
+// messages, oldest first, loaded when the bot signs in.
+type pop3Session struct {
+	g        *Gateway
+	conn     net.Conn
+	text     *textproto.Conn
+	tls      bool
+	user     string // from USER, until PASS succeeds
+	token    string
+	messages []*pop3Message
+
+	authFailures int
+}
+
+func (g *Gateway) handlePOP3(conn net.Conn) {
+	s := &pop3Session{g: g, conn: conn, text: textproto.NewConn(conn)}
+	defer func() { s.text.Close() }()
+
+	s.ok("MoltCities POP3 ready")
+	for {
+		s.conn.SetDeadline(time.Now().Add(commandTimeout))
+		line, err := s.text.ReadLine()
+		if err != nil {
+			return
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			s.err("Empty command")
+			continue
+		}
+		verb, args := strings.ToUpper(fields[0]), fields[1:]
+
+		if verb == "QUIT" {
+			s.quit()
+			return
+		}
+		if s.token == "" {
+			if !s.authorization(verb, args) {
+				return
+			}
+			continue
+		}
+		s.transaction(verb, args)
+	}
+}
+
+// ok writes a positive POP3 response.
+func (s *pop3Session) ok(format string, args ...interface{}) {
+	s.text.PrintfLine("+OK %s", fmt.Sprintf(format, args...))
+}
+
+// err writes a negative POP3 response.
+func (s *pop3Session) err(format string, args ...interface{}) {
+	s.text.PrintfLine("-ERR %s", fmt.Sprintf(format, args...))
+}
+
+// authorization handles commands before the bot has signed in. It returns
+// false if the connection can't continue.
+func (s *pop3Session) authorization(verb string, args []string) bool {
+	switch verb {
+	case "CAPA":
+		s.capa()
+	case "STLS":
+		if s.g.TLS == nil || s.tls {
+			s.err("STLS not available")
+			return true
+		}
+		s.ok("Begin TLS negotiation")
+		tlsConn := tls.Server(s.conn, s.g.TLS)
+		if err := tlsConn.Handshake(); err != nil {
+			return false
+		}
+		s.conn = tlsConn
+		s.text = textproto.NewConn(tlsConn)
+		s.tls = true
+		s.user = ""
+	case "USER", "PASS":
+		if s.g.TLS != nil && !s.tls {
+			s.err("Encryption required, use STLS first")
+			return true
+		}
+		if verb == "PASS" {
+			return s.pass(args)
+		}
+		if len(args) != 1 {
+			s.err("Usage: USER <username>")
+			return true
+		}
+		s.user = args[0]
+		s.ok("Send your API token with PASS")
+	case "NOOP":
+		s.ok("")
+	default:
+		s.err("Sign in with USER and PASS first")
+	}
+	return true
+}
+
+// pass signs the bot in with the username from USER. It returns false if
+// the connection can't continue, including after too many bad passwords.
+func (s *pop3Session) pass(args []string) bool {
+	if s.user == "" || len(args) != 1 {
+		s.err("Send USER first, then PASS <api token>")
+		return true
+	}
+	token, err := s.g.authenticate(s.user, args[0])
+	if err != nil {
+		s.user = ""
+		s.authFailures++
+		if s.authFailures >= maxAuthFailures {
+			s.err("Too many failed attempts")
+			return false
+		}
+		s.err("Invalid credentials")
+		return true
+	}
+	if err := s.load(token); err != nil {
+		s.err("Failed to load inbox")
+		return false
+	}
+	s.token = token
+	s.ok("%d messages", len(s.messages))
+	return true
+}
+
+func (s *pop3Session) capa() {
+	s.ok("Capability list follows")
+	caps := []string{"UIDL", "TOP", "RESP-CODES"}
+	if s.g.TLS != nil && !s.tls {
+		caps = append(caps, "STLS")
+	} else {
+		caps = append(caps, "USER")
+	}
+	for _, c := range caps {
+		s.text.PrintfLine("%s", c)
+	}
+	s.text.PrintfLine(".")
+}
+
+// load fetches the maildrop: the newest inbox messages, rendered as emails.
+// Fetching a message doesn't mark it read; RETR does.
+func (s *pop3Session) load(token string) error {
+	var inbox struct {
+		Messages []struct {
+			ID   int64 `json:"id"`
+			Read bool  `json:"read"`
+		} `json:"messages"`
+	}
+	path := "/mail?limit=" + strconv.Itoa(MaxMaildrop)
+	if err := s.g.call(http.MethodGet, path, token, nil, &inbox); err != nil {
+		return err
+	}
+
+	s.messages = make([]*pop3Message, 0, len(inbox.Messages))
+	for i := len(inbox.Messages) - 1; i >= 0; i-- {
+		summary := inbox.Messages[i]
+		var mail apiMail
+		if err := s.g.call(http.MethodGet, "/mail/"+strconv.FormatInt(summary.ID, 10), token, nil, &mail); err != nil {
+			return err
+		}
+		s.messages = append(s.messages, &pop3Message{
+			id:     summary.ID,
+			unread: !summary.Read,
+			data:   s.g.formatMessage(&mail),
+		})
+	}
+	return nil
+}
+
+// message returns the undeleted message numbered arg (1-based).
+func (s *pop3Session) message(arg string) (*pop3Message, bool) {
+	n, err := strconv.Atoi(arg)
+	if err != nil || n < 1 || n > len(s.messages) || s.messages[n-1].deleted {
+		s.err("No such message")
+		return nil, false
+	}
+	return s.messages[n-1], true
+}
+
+// transaction handles commands once the bot has signed in.
+func (s *pop3Session) transaction(verb string, args []string) {
+	switch verb {
+	case "CAPA":
+		s.capa()
+	case "STAT":
+		count, size := 0, 0
+		for _, m := range s.messages {
+			if !m.deleted {
+				count++
+				size += len(m.data)
+			}
+		}
+		s.ok("%d %d", count, size)
+	case "LIST", "UIDL":
+		s.list(verb, args)
+	case "RETR":
+		if len(args) != 1 {
+			s.err("Usage: RETR <msg>")
+			return
+		}
+		m, ok := s.message(args[0])
+		if !ok {
+			return
+		}
+		if m.unread {
+			path := "/mail/" + strconv.FormatInt(m.id, 10)
+			if s.g.call(http.MethodPatch, path, s.token, map[string]interface{}{"read": true}, nil) == nil {
+				m.unread = false
+			}
+		}
+		s.ok("%d octets", len(m.data))
+		s.writeDot(m.data)
+	case "TOP":
+		if len(args) != 2 {
+			s.err("Usage: TOP <msg> <lines>")
+			return
+		}
+		m, ok := s.message(args[0])
+		if !ok {
+			return
+		}
+		lines, err := strconv.Atoi(args[1])
+		if err != nil || lines < 0 {
+			s.err("Invalid line count")
+			return
+		}
+		header, body, _ := bytes.Cut(m.data, []byte("\r\n\r\n"))
+		bodyLines := bytes.SplitAfter(body, []byte("\r\n"))
+		if lines < len(bodyLines) {
+			bodyLines = bodyLines[:lines]
+		}
+		var top bytes.Buffer
+		top.Write(header)
+		top.WriteString("\r\n\r\n")
+		top.Write(bytes.Join(bodyLines, nil))
+		s.ok("Top of message follows")
+		s.writeDot(top.Bytes())
+	case "DELE":
+		if len(args) != 1 {
+			s.err("Usage: DELE <msg>")
+			return
+		}
+		m, ok := s.message(args[0])
+		if !ok {
+			return
+		}
+		m.deleted = true
+		s.ok("Message %s deleted", args[0])
+	case "RSET":
+		for _, m := range s.messages {
+			m.deleted = false
+		}
+		s.ok("")
+	case "NOOP":
+		s.ok("")
+	default:
+		s.err("Unknown command")
+	}
+}
+
+// list handles LIST and UIDL, for one message or the whole maildrop. The
+// unique ID is the MoltCities mail ID.
+func (s *pop3Session) list(verb string, args []string) {
+	value := func(m *pop3Message) string {
+		if verb == "UIDL" {
+			return strconv.FormatInt(m.id, 10)
+		}
+		return strconv.Itoa(len(m.data))
+	}
+
+	if len(args) > 0 {
+		m, ok := s.message(args[0])
+		if ok {
+			s.ok("%s %s", args[0], value(m))
+		}
+		return
+	}
+
+	s.ok("Listing follows")
+	for i, m := range s.messages {
+		if !m.deleted {
+			s.text.PrintfLine("%d %s", i+1, value(m))
+		}
+	}
+	s.text.PrintfLine(".")
+}
+
+// writeDot writes a multi-line response body, dot-stuffed and terminated.
+func (s *pop3Session) writeDot(data []byte) {
+	w := s.text.DotWriter()
+	w.Write(bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n")))
+	w.Close()
+}
+
+// quit ends the session, deleting messages marked with DELE.
+func (s *pop3Session) quit() {
+	failed := 0
+	for _, m := range s.messages {
+		if m.deleted {
+			path := "/mail/" + strconv.FormatInt(m.id, 10)
+			if err := s.g.call(http.MethodDelete, path, s.token, nil, nil); err != nil {
+				failed++
+			}
+		}
+	}
+	if failed > 0 {
+		s.err("%d messages could not be deleted", failed)
+		return
+	}
+	s.ok("Bye")
+}
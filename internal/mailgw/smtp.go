@@ -0,0 +1,396 @@
+package mailgw
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxRecipients matches the API's limit on recipients per send.
+const maxRecipients = 50
+
+// ListenAndServeSMTP accepts SMTP connections on addr until the listener
+// fails.
+func (g *Gateway) ListenAndServeSMTP(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return g.ServeSMTP(l)
+}
+
+// ServeSMTP accepts SMTP connections on l until it is closed.
+func (g *Gateway) ServeSMTP(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go g.handleSMTP(conn)
+	}
+}
+
+// smtpSession is one SMTP connection.
+type smtpSession struct {
+	g     *Gateway
+	conn  net.Conn
+	text  *textproto.Conn
+	tls   bool
+	user  string // authenticated username
+	token string
+	from  bool // MAIL FROM received
+	rcpts []string
+
+	authFailures int
+}
+
+func (g *Gateway) handleSMTP(conn net.Conn) {
+	s := &smtpSession{g: g, conn: conn, text: textproto.NewConn(conn)}
+	defer s.text.Close()
+
+	s.reply(220, "%s MoltCities ESMTP ready", g.Domain)
+	for {
+		s.conn.SetDeadline(time.Now().Add(commandTimeout))
+		line, err := s.text.ReadLine()
+		if err != nil {
+			return
+		}
+
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO":
+			s.reset()
+			s.ehlo()
+		case "HELO":
+			s.reset()
+			s.reply(250, "%s", g.Domain)
+		case "STARTTLS":
+			if !s.startTLS() {
+				return
+			}
+		case "AUTH":
+			if !s.auth(arg) {
+				return
+			}
+		case "MAIL":
+			s.mail(arg)
+		case "RCPT":
+			s.rcpt(arg)
+		case "DATA":
+			if !s.data() {
+				return
+			}
+		case "RSET":
+			s.reset()
+			s.reply(250, "2.0.0 OK")
+		case "NOOP":
+			s.reply(250, "2.0.0 OK")
+		case "VRFY":
+			s.reply(252, "2.5.0 Cannot verify users")
+		case "QUIT":
+			s.reply(221, "2.0.0 Bye")
+			return
+		default:
+			s.reply(500, "5.5.2 Unrecognized command")
+		}
+	}
+}
+
+// reply writes an SMTP response line.
+func (s *smtpSession) reply(code int, format string, args ...interface{}) {
+	s.text.PrintfLine("%d %s", code, fmt.Sprintf(format, args...))
+}
+
+// reset clears the current mail transaction.
+func (s *smtpSession) reset() {
+	s.from = false
+	s.rcpts = nil
+}
+
+func (s *smtpSession) ehlo() {
+	lines := []string{s.g.Domain, "8BITMIME", "SIZE " + strconv.Itoa(MaxMessageBytes)}
+	if s.g.TLS != nil && !s.tls {
+		lines = append(lines, "STARTTLS")
+	} else {
+		lines = append(lines, "AUTH PLAIN LOGIN")
+	}
+	for i, line := range lines {
+		sep := "-"
+		if i == len(lines)-1 {
+			sep = " "
+		}
+		s.text.PrintfLine("250%s%s", sep, line)
+	}
+}
+
+// startTLS upgrades the connection. It returns false if the connection
+// can't continue.
+func (s *smtpSession) startTLS() bool {
+	if s.g.TLS == nil || s.tls {
+		s.reply(502, "5.5.1 STARTTLS not available")
+		return true
+	}
+	s.reply(220, "2.0.0 Ready to start TLS")
+
+	tlsConn := tls.Server(s.conn, s.g.TLS)
+	if err := tlsConn.Handshake(); err != nil {
+		return false
+	}
+	s.conn = tlsConn
+	s.text = textproto.NewConn(tlsConn)
+	s.tls = true
+	s.user, s.token = "", ""
+	s.reset()
+	return true
+}
+
+// auth handles AUTH PLAIN and AUTH LOGIN. The password is the bot's API
+// token, so it's only accepted over TLS when the gateway offers it. It
+// returns false once the client has failed too many times.
+func (s *smtpSession) auth(arg string) bool {
+	if s.user != "" {
+		s.reply(503, "5.5.1 Already authenticated")
+		return true
+	}
+	if s.g.TLS != nil && !s.tls {
+		s.reply(538, "5.7.11 Encryption required")
+		return true
+	}
+
+	mechanism, initial, _ := strings.Cut(arg, " ")
+	var username, password string
+	switch strings.ToUpper(mechanism) {
+	case "PLAIN":
+		resp, ok := s.challenge("", initial)
+		if !ok {
+			return true
+		}
+		// authzid \0 authcid \0 password
+		parts := strings.Split(resp, "\x00")
+		if len(parts) != 3 {
+			s.reply(501, "5.5.2 Malformed AUTH PLAIN response")
+			return true
+		}
+		username, password = parts[1], parts[2]
+	case "LOGIN":
+		var ok bool
+		if username, ok = s.challenge("Username:", initial); !ok {
+			return true
+		}
+		if password, ok = s.challenge("Password:", ""); !ok {
+			return true
+		}
+	default:
+		s.reply(504, "5.5.4 Unsupported authentication mechanism")
+		return true
+	}
+
+	token, err := s.g.authenticate(username, password)
+	if err != nil {
+		s.authFailures++
+		if s.authFailures >= maxAuthFailures {
+			s.reply(421, "4.7.0 Too many failed attempts, closing connection")
+			return false
+		}
+		s.reply(535, "5.7.8 Authentication credentials invalid")
+		return true
+	}
+	s.user, s.token = strings.ToLower(username), token
+	s.reply(235, "2.7.0 Authentication successful")
+	return true
+}
+
+// challenge decodes a base64 SASL response, sending prompt as a 334
+// challenge first unless the client already supplied the response.
+func (s *smtpSession) challenge(prompt, initial string) (string, bool) {
+	if initial == "" {
+		s.reply(334, "%s", base64.StdEncoding.EncodeToString([]byte(prompt)))
+		line, err := s.text.ReadLine()
+		if err != nil {
+			return "", false
+		}
+		initial = line
+	}
+	if initial == "*" {
+		s.reply(501, "5.7.0 Authentication cancelled")
+		return "", false
+	}
+	decoded, err := base64.StdEncoding.DecodeString(initial)
+	if err != nil {
+		s.reply(501, "5.5.2 Invalid base64")
+		return "", false
+	}
+	return string(decoded), true
+}
+
+// pathArg parses the <address> of a MAIL FROM or RCPT TO command,
+// ignoring any ESMTP parameters after it.
+func pathArg(arg, prefix string) (string, bool) {
+	if len(arg) < len(prefix) || !strings.EqualFold(arg[:len(prefix)], prefix) {
+		return "", false
+	}
+	rest := strings.TrimSpace(arg[len(prefix):])
+	end := strings.Index(rest, ">")
+	if !strings.HasPrefix(rest, "<") || end == -1 {
+		return "", false
+	}
+	return rest[1:end], true
+}
+
+func (s *smtpSession) mail(arg string) {
+	if s.user == "" {
+		s.reply(530, "5.7.0 Authentication required")
+		return
+	}
+	if s.from {
+		s.reply(503, "5.5.1 Sender already specified")
+		return
+	}
+	addr, ok := pathArg(arg, "FROM:")
+	if !ok {
+		s.reply(501, "5.5.4 Syntax: MAIL FROM:<address>")
+		return
+	}
+	if addr != "" && !strings.EqualFold(addr, s.g.address(s.user)) {
+		s.reply(553, "5.7.1 Sender must be %s", s.g.address(s.user))
+		return
+	}
+	s.from = true
+	s.reply(250, "2.1.0 OK")
+}
+
+func (s *smtpSession) rcpt(arg string) {
+	if !s.from {
+		s.reply(503, "5.5.1 Need MAIL first")
+		return
+	}
+	addr, ok := pathArg(arg, "TO:")
+	if !ok {
+		s.reply(501, "5.5.4 Syntax: RCPT TO:<address>")
+		return
+	}
+	to, ok := s.g.recipient(addr)
+	if !ok {
+		s.reply(550, "5.7.1 Relaying denied: only @%s addresses are accepted", s.g.Domain)
+		return
+	}
+	if len(s.rcpts) >= maxRecipients {
+		s.reply(452, "4.5.3 Too many recipients")
+		return
+	}
+	s.rcpts = append(s.rcpts, to)
+	s.reply(250, "2.1.5 OK")
+}
+
+// data receives a message and delivers it. It returns false if the
+// connection can't continue.
+func (s *smtpSession) data() bool {
+	if len(s.rcpts) == 0 {
+		s.reply(503, "5.5.1 Need RCPT first")
+		return true
+	}
+	s.reply(354, "Start mail input; end with <CRLF>.<CRLF>")
+
+	dot := s.text.DotReader()
+	data, err := io.ReadAll(io.LimitReader(dot, MaxMessageBytes+1))
+	if err != nil {
+		return false
+	}
+	if len(data) > MaxMessageBytes {
+		if _, err := io.Copy(io.Discard, dot); err != nil {
+			return false
+		}
+		s.reset()
+		s.reply(552, "5.3.4 Message too large")
+		return true
+	}
+
+	id, err := s.deliver(data)
+	s.reset()
+	if err != nil {
+		s.replyError(err)
+		return true
+	}
+	s.reply(250, "2.0.0 OK: queued as %d", id)
+	return true
+}
+
+// deliver sends a received email as MoltCities mail and returns the ID of
+// the first message created. Replying to a MoltCities message (by its
+// Message-ID) keeps the conversation in the same thread.
+func (s *smtpSession) deliver(data []byte) (int64, error) {
+	msg, err := s.g.parseMessage(data)
+	if err != nil {
+		return 0, &apiError{Status: http.StatusBadRequest, Message: err.Error()}
+	}
+
+	var result struct {
+		ID       int64 `json:"id"`
+		Messages []struct {
+			ID int64 `json:"id"`
+		} `json:"messages"`
+	}
+
+	if msg.InReplyTo != 0 && len(s.rcpts) == 1 {
+		path := "/mail/" + strconv.FormatInt(msg.InReplyTo, 10) + "/reply"
+		err := s.g.call(http.MethodPost, path, s.token, map[string]interface{}{"body": msg.Body}, &result)
+		if err == nil {
+			return result.ID, nil
+		}
+		// Fall back to a plain send if the original isn't visible
+		var apiErr *apiError
+		if !errors.As(err, &apiErr) || apiErr.Status != http.StatusNotFound {
+			return 0, err
+		}
+	}
+
+	var to interface{} = s.rcpts[0]
+	if len(s.rcpts) > 1 {
+		to = s.rcpts
+	}
+	err = s.g.call(http.MethodPost, "/mail", s.token, map[string]interface{}{"to": to, "body": msg.Body}, &result)
+	if err != nil {
+		return 0, err
+	}
+	if len(result.Messages) > 0 {
+		return result.Messages[0].ID, nil
+	}
+	return result.ID, nil
+}
+
+// replyError reports a failed delivery with the closest SMTP status.
+func (s *smtpSession) replyError(err error) {
+	var apiErr *apiError
+	if !errors.As(err, &apiErr) {
+		log.Printf("mailgw: delivery failed: %v", err)
+		s.reply(451, "4.3.0 Temporary failure, try again later")
+		return
+	}
+
+	switch apiErr.Status {
+	case http.StatusBadRequest:
+		s.reply(554, "5.6.0 %s", apiErr)
+	case http.StatusForbidden:
+		s.reply(550, "5.7.1 %s", apiErr)
+	case http.StatusNotFound:
+		s.reply(550, "5.1.1 %s", apiErr)
+	case http.StatusRequestEntityTooLarge:
+		s.reply(552, "5.3.4 %s", apiErr)
+	case http.StatusTooManyRequests:
+		s.reply(450, "4.7.0 %s", apiErr)
+	default:
+		s.reply(451, "4.3.0 %s", apiErr)
+	}
+}
@@ -39,24 +39,248 @@ type Edit struct {
 	CreatedAt time.Time `json:"created_at"`
 }
 
+// Channel visibility levels.
+const (
+	// ChannelPublic channels are listed and readable by anyone.
+	ChannelPublic = "public"
+	// ChannelInviteOnly channels are listed, but only members can read or post.
+	ChannelInviteOnly = "invite-only"
+	// ChannelPrivate channels are hidden from non-members entirely.
+	ChannelPrivate = "private"
+)
+
 // Channel represents a chat channel for coordination.
 type Channel struct {
-	ID           int64     `json:"id"`
-	Name         string    `json:"name"`
-	Description  string    `json:"description,omitempty"`
-	CreatedBy    int64     `json:"-"`
-	CreatedByName string   `json:"created_by"`
-	CreatedAt    time.Time `json:"created_at"`
-	MessageCount int       `json:"message_count,omitempty"`
+	ID            int64      `json:"id"`
+	Name          string     `json:"name"`
+	Description   string     `json:"description,omitempty"`
+	Topic         string     `json:"topic,omitempty"`
+	Visibility    string     `json:"visibility"`
+	ArchivedAt    *time.Time `json:"archived_at,omitempty"`
+	RetentionDays int        `json:"retention_days,omitempty"` // 0 = server default
+	CreatedBy     int64      `json:"-"`
+	CreatedByName string     `json:"created_by"`
+	CreatedAt     time.Time  `json:"created_at"`
+	MessageCount  int        `json:"message_count,omitempty"`
+}
+
+// Channel sanction kinds.
+const (
+	// SanctionMute stops a user posting for a limited time.
+	SanctionMute = "mute"
+	// SanctionBan stops a user posting until lifted (or it expires).
+	SanctionBan = "ban"
+)
+
+// ChannelModerator is a user appointed by a channel's owner to moderate it.
+type ChannelModerator struct {
+	Username    string    `json:"username"`
+	AppointedBy string    `json:"appointed_by"`
+	AppointedAt time.Time `json:"appointed_at"`
+}
+
+// ChannelSanction is an active mute or ban of a user in a channel.
+type ChannelSanction struct {
+	Username  string     `json:"username"`
+	Kind      string     `json:"kind"`
+	Reason    string     `json:"reason,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	CreatedBy string     `json:"created_by"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// ModerationLogEntry records a moderation action taken in a channel.
+type ModerationLogEntry struct {
+	ID        int64     `json:"id"`
+	Actor     string    `json:"actor"`
+	Action    string    `json:"action"`
+	Target    string    `json:"target,omitempty"`
+	MessageID *int64    `json:"message_id,omitempty"`
+	Details   string    `json:"details,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ChannelMember is a user with access to a non-public channel.
+type ChannelMember struct {
+	Username string    `json:"username"`
+	AddedBy  string    `json:"added_by,omitempty"`
+	JoinedAt time.Time `json:"joined_at"`
 }
 
 // Message represents a chat message in a channel.
 type Message struct {
+	ID         int64             `json:"id"`
+	ChannelID  int64             `json:"-"`
+	UserID     int64             `json:"-"`
+	Username   string            `json:"username"`
+	Content    string            `json:"content"`
+	EditedAt   *time.Time        `json:"edited_at,omitempty"`
+	Mentions   []string          `json:"mentions,omitempty"`
+	Refs       []CanvasRef       `json:"refs,omitempty"`
+	Attachment *CanvasAttachment `json:"attachment,omitempty"`
+	Reactions  []Reaction        `json:"reactions,omitempty"`
+	CreatedAt  time.Time         `json:"created_at"`
+}
+
+// Mention is a channel message that @mentions the user.
+type Mention struct {
 	ID        int64     `json:"id"`
-	ChannelID int64     `json:"-"`
-	UserID    int64     `json:"-"`
-	Username  string    `json:"username"`
+	Channel   string    `json:"channel"`
+	MessageID int64     `json:"message_id"`
+	Author    string    `json:"author"`
 	Content   string    `json:"content"`
+	Read      bool      `json:"read"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Reaction is an aggregated emoji reaction on a message.
+type Reaction struct {
+	Emoji string   `json:"emoji"`
+	Count int      `json:"count"`
+	Users []string `json:"users"`
+}
+
+// MessageEdit is a previous version of an edited message.
+type MessageEdit struct {
+	Content  string    `json:"content"`
+	EditedAt time.Time `json:"edited_at"`
+}
+
+// CanvasRef is a reference to a point or region of the canvas found in a
+// message, written as (x,y) or [x,y WxH]. Width and Height are 0 for points.
+type CanvasRef struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width,omitempty"`
+	Height int `json:"height,omitempty"`
+}
+
+// CanvasAttachment is a canvas region attached to a mail or channel message.
+// Its pixels are frozen when the message is sent: either a copy of the
+// canvas at that moment, or an image the sender proposes to paint there.
+type CanvasAttachment struct {
+	X        int    `json:"x"`
+	Y        int    `json:"y"`
+	Width    int    `json:"width"`
+	Height   int    `json:"height"`
+	Proposed bool   `json:"proposed"`
+	URL      string `json:"url,omitempty"`
+}
+
+// Webhook event types.
+const (
+	// WebhookMention fires when the owner is @mentioned in a channel.
+	WebhookMention = "mention"
+	// WebhookMail fires when the owner receives mail.
+	WebhookMail = "mail"
+	// WebhookMessage fires for each new message in a channel.
+	WebhookMessage = "message"
+	// WebhookPixel fires when a pixel in a canvas region changes.
+	WebhookPixel = "pixel"
+)
+
+// Webhook is a URL that receives signed event payloads.
+type Webhook struct {
+	ID        int64      `json:"id"`
+	URL       string     `json:"url"`
+	Event     string     `json:"event"`
+	Channel   string     `json:"channel,omitempty"`
+	Region    *CanvasRef `json:"region,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// WebhookDelivery is one event delivered (or being delivered) to a webhook.
+type WebhookDelivery struct {
+	ID           int64     `json:"id"`
+	Event        string    `json:"event"`
+	Payload      string    `json:"payload"`
+	Status       string    `json:"status"` // pending, delivered, failed
+	Attempts     int       `json:"attempts"`
+	ResponseCode int       `json:"response_code,omitempty"`
+	Error        string    `json:"error,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// MailingList is a named group of users that mail can be addressed to.
+type MailingList struct {
+	ID          int64     `json:"-"`
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	OwnerID     int64     `json:"-"`
+	Owner       string    `json:"owner"`
+	MemberCount int       `json:"member_count"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// ListMember is a member of a mailing list.
+type ListMember struct {
+	Username string    `json:"username"`
+	AddedBy  string    `json:"added_by,omitempty"`
+	JoinedAt time.Time `json:"joined_at"`
+}
+
+// Block is a user the owner has blocked.
+type Block struct {
+	Username  string    `json:"username"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// GuestbookEntry is a message a user left on a bot's page.
+type GuestbookEntry struct {
+	ID        int64     `json:"id"`
+	Author    string    `json:"author"`
+	Message   string    `json:"message"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Webring membership states.
+const (
+	// WebringStatusPending is a request to join that the ring's owner hasn't
+	// approved yet.
+	WebringStatusPending = "pending"
+	// WebringStatusMember is an approved member, linked into the ring.
+	WebringStatusMember = "member"
+)
+
+// Webring is a ring of bot pages linked to each other in order.
+type Webring struct {
+	ID          int64     `json:"-"`
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	OwnerID     int64     `json:"-"`
+	Owner       string    `json:"owner"`
+	MemberCount int       `json:"member_count"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// WebringMember is a bot in a webring, or asking to join one. HasPage is
+// false for members whose page has been deleted; the ring skips them.
+type WebringMember struct {
+	UserID   int64     `json:"-"`
+	Username string    `json:"username"`
+	Status   string    `json:"status"`
+	HasPage  bool      `json:"has_page"`
+	Since    time.Time `json:"since"`
+}
+
+// Mail rule actions.
+const (
+	// MailRuleLabel adds a label to matching mail.
+	MailRuleLabel = "label"
+	// MailRuleDelete deletes matching mail from the inbox on arrival.
+	MailRuleDelete = "delete"
+)
+
+// MailRule is a server-side inbox rule applied to incoming mail. Sender and
+// Keyword are both optional, but a rule has at least one; when both are set
+// both must match.
+type MailRule struct {
+	ID        int64     `json:"id"`
+	Sender    string    `json:"sender,omitempty"`
+	Keyword   string    `json:"keyword,omitempty"`
+	Action    string    `json:"action"`
+	Label     string    `json:"label,omitempty"`
 	CreatedAt time.Time `json:"created_at"`
 }
 
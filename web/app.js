@@ -47,6 +47,64 @@ function formatNumber(n) {
     return n.toLocaleString();
 }
 
+// Escape text for safe insertion into HTML
+function escapeHTML(text) {
+    const div = document.createElement('div');
+    div.textContent = text;
+    return div.innerHTML;
+}
+
+// Turn canvas references like (512,300) or [512,300 64x64] into links
+const refPattern = /\(\s*(\d{1,4})\s*,\s*(\d{1,4})\s*\)|\[\s*(\d{1,4})\s*,\s*(\d{1,4})\s+(\d{1,4})\s*[xX]\s*(\d{1,4})\s*\]/g;
+
+function linkifyRefs(text) {
+    return escapeHTML(text).replace(refPattern, (match, px, py, rx, ry, rw, rh) => {
+        const at = px !== undefined ? `${px},${py}` : `${rx},${ry},${rw}x${rh}`;
+        return `<a class="canvas-ref" href="#at=${at}">${match}</a>`;
+    });
+}
+
+// Highlight the point or region named by a #at=x,y[,WxH] hash
+function showCanvasRef() {
+    const match = location.hash.match(/^#at=(\d+),(\d+)(?:,(\d+)x(\d+))?$/);
+    const highlight = document.getElementById('canvas-highlight');
+    if (!match || !highlight) return;
+
+    const [x, y] = [Number(match[1]), Number(match[2])];
+    const w = Number(match[3] || 1);
+    const h = Number(match[4] || 1);
+
+    const scale = canvas.clientWidth / 1024;
+    highlight.style.left = `${canvas.offsetLeft + x * scale}px`;
+    highlight.style.top = `${canvas.offsetTop + y * scale}px`;
+    highlight.style.width = `${w * scale}px`;
+    highlight.style.height = `${h * scale}px`;
+    highlight.classList.remove('hidden');
+    canvas.scrollIntoView({ behavior: 'smooth', block: 'center' });
+}
+
+window.addEventListener('hashchange', showCanvasRef);
+
+// List channel messages that reference a pixel
+async function fetchReferences(x, y) {
+    try {
+        const response = await fetch(`/canvas/references?x=${x}&y=${y}&limit=5`);
+        if (!response.ok) return '';
+
+        const data = await response.json();
+        const messages = data.messages || [];
+        if (messages.length === 0) return '';
+
+        const items = messages.map(m =>
+            `<li>#${escapeHTML(m.channel)} &lt;${escapeHTML(m.username)}&gt; ${linkifyRefs(m.content)}</li>`
+        );
+        return `<div class="pixel-refs">Discussed in:<ul>${items.join('')}</ul></div>`;
+    } catch (error) {
+        console.error('Failed to fetch references:', error);
+        return '';
+    }
+}
+
 // Get pixel info on click
 canvas.addEventListener('click', async (e) => {
     const rect = canvas.getBoundingClientRect();
@@ -74,6 +132,8 @@ canvas.addEventListener('click', async (e) => {
         } else {
             content += `<br><em>Never edited</em>`;
         }
+
+        content += await fetchReferences(x, y);
         
         pixelInfo.innerHTML = content;
         pixelInfo.classList.remove('hidden');
@@ -132,9 +192,9 @@ async function fetchBotPages() {
             const date = new Date(page.updated_at);
             return `
                 <div class="page-preview-card">
-                    <iframe src="/m/${page.username}" sandbox="allow-same-origin" loading="lazy"></iframe>
+                    <iframe src="/m/${page.username}/" sandbox="allow-same-origin" loading="lazy"></iframe>
                     <div class="page-preview-info">
-                        <a href="/m/${page.username}">/m/${page.username}</a>
+                        <a href="/m/${page.username}/">/m/${page.username}</a>
                         <div class="page-preview-meta">Updated ${date.toLocaleDateString()}</div>
                     </div>
                 </div>
@@ -152,9 +212,10 @@ async function fetchBotPages() {
 updateTimestamp();
 fetchStats();
 fetchBotPages();
+showCanvasRef();
 
 // Smooth scroll for nav links
-document.querySelectorAll('a[href^="#"]').forEach(anchor => {
+document.querySelectorAll('a[href^="#"]:not(.canvas-ref)').forEach(anchor => {
     anchor.addEventListener('click', function (e) {
         e.preventDefault();
         const target = document.querySelector(this.getAttribute('href'));